@@ -416,6 +416,15 @@ function getImportTooltip(remote: RemoteType): React.ReactElement<any, any> {
                 <i className="fa-sharp fa-solid fa-file-import" />
             </Tooltip>
         );
+    } else if (remote.sshconfigsrc == "remotes-file") {
+        return (
+            <Tooltip
+                message={`This remote is managed by remotes.json in the config directory.`}
+                icon={<i className="fa-sharp fa-solid fa-file-code" />}
+            >
+                <i className="fa-sharp fa-solid fa-file-code" />
+            </Tooltip>
+        );
     } else {
         return <></>;
     }
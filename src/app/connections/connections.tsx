@@ -81,6 +81,8 @@ class ConnectionsView extends React.Component<{ model: RemotesModel }, { hovered
         const { sshconfigsrc } = item;
         if (sshconfigsrc == "sshconfig-import") {
             return <i title="Connection Imported from SSH Config" className="fa-sharp fa-solid fa-file-import" />;
+        } else if (sshconfigsrc == "remotes-file") {
+            return <i title="Connection Managed by remotes.json" className="fa-sharp fa-solid fa-file-code" />;
         } else {
             return <></>;
         }
@@ -113,6 +115,27 @@ class ConnectionsView extends React.Component<{ model: RemotesModel }, { hovered
         }
     }
 
+    @boundMethod
+    getSysMetrics(item: RemoteType): React.ReactElement<any, any> {
+        const metrics = GlobalModel.remoteSysMetrics.get(item.remoteid);
+        if (item.status != "connected" || metrics == null) {
+            return null;
+        }
+        let memPct = 0;
+        if (metrics.memtotal > 0) {
+            memPct = Math.round((100 * (metrics.memtotal - metrics.memavail)) / metrics.memtotal);
+        }
+        const loadStr = (metrics.loadavg ?? []).map((load) => load.toFixed(2)).join(" ");
+        const title = `${metrics.hostname}, ${metrics.numcpu} cpus, load ${loadStr}, up ${util.formatDuration(
+            metrics.uptimesec * 1000
+        )}`;
+        return (
+            <div className="sysmetrics text-secondary" title={title}>
+                cpu {Math.round(metrics.cpupct)}% &middot; mem {memPct}%
+            </div>
+        );
+    }
+
     @boundMethod
     handleClose() {
         GlobalModel.connectionViewModel.closeView();
@@ -201,6 +224,7 @@ class ConnectionsView extends React.Component<{ model: RemotesModel }, { hovered
                                         <div>
                                             <Status status={this.getStatus(item.status)} text={item.status} />
                                         </div>
+                                        {this.getSysMetrics(item)}
                                     </td>
                                 </tr>
                             </For>
@@ -14,7 +14,7 @@ import { termHeightFromRows } from "@/util/textmeasure";
 import { clsx } from "clsx";
 import { getTermPtyData } from "@/util/modelutil";
 
-import { renderCmdText } from "@/common/elements";
+import { renderCmdText, Markdown } from "@/common/elements";
 import { SimpleBlobRenderer } from "@/plugins/core/basicrenderer";
 import { IncrementalRenderer } from "@/plugins/core/incrementalrenderer";
 import { TerminalRenderer } from "@/plugins/terminal/terminal";
@@ -323,6 +323,19 @@ class LineHeader extends React.Component<{ screen: LineContainerType; line: Line
         );
     }
 
+    renderNote(line: LineType) {
+        let noteTitle: string = null;
+        if (line.notets > 0) {
+            noteTitle = "note edited " + lineutil.getLineDateTimeStr(line.notets);
+        }
+        return (
+            <div key="note" className="meta line-note" title={noteTitle}>
+                <i className="fa-sharp fa-regular fa-note-sticky line-note-icon" />
+                <Markdown text={line.note} className="line-note-text" />
+            </div>
+        );
+    }
+
     render() {
         const { line, cmd } = this.props;
         const hidePrompt = getIsHidePrompt(line);
@@ -330,6 +343,7 @@ class LineHeader extends React.Component<{ screen: LineContainerType; line: Line
             <div key="header" className={clsx("line-header", { "hide-prompt": hidePrompt })}>
                 {this.renderMeta1(cmd)}
                 <If condition={!hidePrompt}>{this.renderCmdText(cmd)}</If>
+                <If condition={!isBlank(line.note)}>{this.renderNote(line)}</If>
             </div>
         );
     }
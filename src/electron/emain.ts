@@ -85,6 +85,7 @@ const app = electron.app;
 app.setName(isDev ? "Wave (Dev)" : "Wave");
 let waveSrvProc: child_process.ChildProcessWithoutNullStreams | null = null;
 let waveSrvShouldRestart = false;
+const WaveSrvRestartExitCode = 77; // must match golang, wavesrv exits with this code to be restarted (e.g. /db:restore)
 
 electron.dialog.showErrorBox = (title, content) => {
     oldConsoleLog("ERROR", title, content);
@@ -704,9 +705,9 @@ function runWaveSrv() {
         waveSrvProc = null;
         sendWSSC();
         pReject(new Error(sprintf("failed to start local server (%s)", waveSrvCmd)));
-        if (waveSrvShouldRestart) {
+        if (waveSrvShouldRestart || e == WaveSrvRestartExitCode) {
             waveSrvShouldRestart = false;
-            this.runWaveSrv();
+            runWaveSrv();
         }
     });
     proc.on("spawn", (e) => {
@@ -71,6 +71,7 @@ class Model {
     remotesLoaded: OV<boolean> = mobx.observable.box(false, {
         name: "remotesLoaded",
     });
+    remoteSysMetrics: OMap<string, SysMetricsType> = mobx.observable.map({}, { name: "remoteSysMetrics", deep: false }); // key = remoteid (polled by wavesrv)
     screenLines: OMap<string, ScreenLines> = mobx.observable.map({}, { name: "screenLines", deep: false }); // key = "sessionid/screenid" (screenlines)
     termUsedRowsCache: Record<string, number> = {}; // key = "screenid/lineid"
     debugCmds: number = 0;
@@ -114,6 +115,11 @@ class Model {
     lineHeightEnv: LineHeightEnv;
 
     keybindManager: KeybindManager;
+    configKeybindings: Array<SettingsKeybindingType> = [];
+    settingsKeybindings: Array<SettingsKeybindingType> = [];
+    settingsErrors: OV<string[]> = mobx.observable.box(null, {
+        name: "settingsErrors",
+    });
     inputModel: InputModel;
     autocompleteModel: AutocompleteModel;
     sidebarchatModel: SidebarChatModel;
@@ -227,10 +233,28 @@ class Model {
             }
             return resp.json();
         }).then((userKeybindings) => {
-            this.keybindManager.setUserKeybindings(userKeybindings);
+            this.configKeybindings = userKeybindings instanceof Array ? userKeybindings : [];
+            this.updateUserKeybindings();
         });
     }
 
+    // keybindings.json is applied first, keybindings from settings.json take precedence
+    updateUserKeybindings() {
+        this.keybindManager.setUserKeybindings([...this.configKeybindings, ...this.settingsKeybindings]);
+    }
+
+    applySettingsUpdate(settings: SettingsUpdateType) {
+        this.settingsKeybindings = settings.keybindings ?? [];
+        this.updateUserKeybindings();
+        const errors = settings.errors ?? [];
+        mobx.action(() => {
+            this.settingsErrors.set(errors.length > 0 ? errors : null);
+        })();
+        if (errors.length > 0) {
+            this.inputModel.flashInfoMsg({ infotitle: "errors in settings.json", infolines: errors }, null);
+        }
+    }
+
     windowFocus(): void {
         if (this.activeMainView.get() == "session" && !this.modalsModel.hasOpenModals()) {
             this.refocus();
@@ -985,6 +1009,9 @@ class Model {
                         this.updateScreenStatusIndicators(update.connect.screenstatusindicators);
                     }
                     this.mergeTermThemes(update.connect.termthemes ?? {});
+                    if (update.connect.settings != null) {
+                        this.applySettingsUpdate(update.connect.settings);
+                    }
                     this.sessionListLoaded.set(true);
                     this.remotesLoaded.set(true);
                 } else if (update.screen != null) {
@@ -1059,6 +1086,13 @@ class Model {
                     this.modalsModel.pushModal(appconst.USER_INPUT, userInputRequest);
                 } else if (update.termthemes != null) {
                     this.mergeTermThemes(update.termthemes);
+                } else if (update.settings != null) {
+                    this.applySettingsUpdate(update.settings);
+                } else if (update.remotesysmetrics != null) {
+                    this.remoteSysMetrics.set(update.remotesysmetrics.remoteid, update.remotesysmetrics.metrics);
+                } else if (update.inputdenied != null) {
+                    // sent directly to this client (another client is typing into the same target)
+                    this.inputModel.flashInfoMsg({ infoerror: update.inputdenied.msg }, 2000);
                 } else if (update.sessiontombstone != null || update.screentombstone != null) {
                     // nothing (ignore)
                 } else {
@@ -1116,6 +1150,11 @@ class Model {
 
     updateRemotes(remotes: RemoteType[]): void {
         genMergeSimpleData(this.remotes, remotes, (r) => r.remoteid, null);
+        for (const remote of remotes) {
+            if (remote.remove || remote.archived) {
+                this.remoteSysMetrics.delete(remote.remoteid);
+            }
+        }
     }
 
     getActiveSession(): Session {
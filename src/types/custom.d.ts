@@ -52,6 +52,8 @@ declare global {
         renderer: string;
         contentheight?: number;
         star?: number;
+        note?: string;
+        notets?: number;
         archived?: boolean;
         pinned?: boolean;
         ephemeral?: boolean;
@@ -132,6 +134,10 @@ declare global {
         remove?: boolean;
         shellpref: string;
         defaultshelltype: string;
+        latencyms?: number;
+        lastseents?: number;
+        missedheartbeats?: number;
+        degraded?: boolean;
     };
 
     type RemoteStateType = {
@@ -346,6 +352,19 @@ declare global {
         screennumrunningcommands: ScreenNumRunningCommandsUpdateType[];
         activesessionid: string;
         termthemes: TermThemesType;
+        settings?: SettingsUpdateType;
+    };
+
+    type SettingsKeybindingType = {
+        command: string;
+        keys: string[];
+        commandStr?: string[];
+        info?: string;
+    };
+
+    type SettingsUpdateType = {
+        keybindings?: SettingsKeybindingType[];
+        errors?: string[];
     };
 
     type BookmarksUpdateType = {
@@ -388,6 +407,41 @@ declare global {
         screentombstone?: any;
         sessiontombstone?: any;
         termthemes?: TermThemesType;
+        settings?: SettingsUpdateType;
+        inputdenied?: InputDeniedUpdateType;
+        remotesysmetrics?: RemoteSysMetricsUpdateType;
+    };
+
+    type InputDeniedUpdateType = {
+        target: string;
+        msg: string;
+    };
+
+    type DiskUsageType = {
+        mount: string;
+        fstype: string;
+        total: number;
+        used: number;
+        avail: number;
+    };
+
+    type SysMetricsType = {
+        ts: number;
+        hostname: string;
+        numcpu: number;
+        cpupct: number;
+        loadavg: number[];
+        memtotal: number;
+        memavail: number;
+        swaptotal: number;
+        swapfree: number;
+        uptimesec: number;
+        disks?: DiskUsageType[];
+    };
+
+    type RemoteSysMetricsUpdateType = {
+        remoteid: string;
+        metrics: SysMetricsType;
     };
 
     type TermThemesType = {
@@ -29,7 +29,7 @@ const SSHCommandVarName = "SSH_COMMAND"
 const WaveshellDebugVarName = "MSHELL_DEBUG"
 const SessionsDirBaseName = "sessions"
 const RcFilesDirBaseName = "rcfiles"
-const WaveshellVersion = "v0.7.0"
+const WaveshellVersion = "v0.8.0"
 const RemoteIdFile = "remoteid"
 const DefaultWaveshellInstallBinDir = "/opt/mshell/bin"
 const LogFileName = "mshell.log"
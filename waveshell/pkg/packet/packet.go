@@ -32,6 +32,7 @@ import (
 // >writefile, <writefileready, >filedata*, <writefiledone
 
 const MaxCompGenValues = 100
+const CompGenScriptTimeout = 5 * time.Second
 
 var GlobalDebug = false
 
@@ -67,6 +68,11 @@ const (
 	RpcInputPacketStr       = "rpcinput" // rpc-followup
 	SudoRequestPacketStr    = "sudorequest"
 	SudoResponsePacketStr   = "sudoresponse"
+	SysMetricsPacketStr     = "sysmetrics"     // rpc
+	SysMetricsResponseStr   = "sysmetricsresp" // rpc-response
+	ProcListPacketStr       = "proclist"       // rpc
+	ProcListResponseStr     = "proclistresp"   // rpc-response
+	ProcSignalPacketStr     = "procsignal"     // rpc
 
 	OpenAIPacketStr   = "openai" // other
 	OpenAICloudReqStr = "openai-cloudreq"
@@ -124,6 +130,11 @@ func init() {
 	TypeStrToFactory[RpcInputPacketStr] = reflect.TypeOf(RpcInputPacketType{})
 	TypeStrToFactory[SudoRequestPacketStr] = reflect.TypeOf(SudoRequestPacketType{})
 	TypeStrToFactory[SudoResponsePacketStr] = reflect.TypeOf(SudoResponsePacketType{})
+	TypeStrToFactory[SysMetricsPacketStr] = reflect.TypeOf(SysMetricsPacketType{})
+	TypeStrToFactory[SysMetricsResponseStr] = reflect.TypeOf(SysMetricsResponseType{})
+	TypeStrToFactory[ProcListPacketStr] = reflect.TypeOf(ProcListPacketType{})
+	TypeStrToFactory[ProcListResponseStr] = reflect.TypeOf(ProcListResponseType{})
+	TypeStrToFactory[ProcSignalPacketStr] = reflect.TypeOf(ProcSignalPacketType{})
 
 	var _ RpcPacketType = (*RunPacketType)(nil)
 	var _ RpcPacketType = (*GetCmdPacketType)(nil)
@@ -133,6 +144,10 @@ func init() {
 	var _ RpcPacketType = (*ReInitPacketType)(nil)
 	var _ RpcPacketType = (*StreamFilePacketType)(nil)
 	var _ RpcPacketType = (*WriteFilePacketType)(nil)
+	var _ RpcPacketType = (*PingPacketType)(nil)
+	var _ RpcPacketType = (*SysMetricsPacketType)(nil)
+	var _ RpcPacketType = (*ProcListPacketType)(nil)
+	var _ RpcPacketType = (*ProcSignalPacketType)(nil)
 
 	var _ RpcResponsePacketType = (*CmdStartPacketType)(nil)
 	var _ RpcResponsePacketType = (*ResponsePacketType)(nil)
@@ -141,6 +156,8 @@ func init() {
 	var _ RpcResponsePacketType = (*WriteFileReadyPacketType)(nil)
 	var _ RpcResponsePacketType = (*WriteFileDonePacketType)(nil)
 	var _ RpcResponsePacketType = (*ShellStatePacketType)(nil)
+	var _ RpcResponsePacketType = (*SysMetricsResponseType)(nil)
+	var _ RpcResponsePacketType = (*ProcListResponseType)(nil)
 
 	var _ RpcFollowUpPacketType = (*FileDataPacketType)(nil)
 	var _ RpcFollowUpPacketType = (*RpcInputPacketType)(nil)
@@ -166,14 +183,21 @@ func MakePacket(packetType string) (PacketType, error) {
 	return rtn.Interface().(PacketType), nil
 }
 
+// pings without a reqid are keepalives (dropped by the parser).
+// pings with a reqid are heartbeats, answered with a response packet (used to measure latency)
 type PingPacketType struct {
-	Type string `json:"type"`
+	Type  string `json:"type"`
+	ReqId string `json:"reqid,omitempty"`
 }
 
 func (*PingPacketType) GetType() string {
 	return PingPacketStr
 }
 
+func (p *PingPacketType) GetReqId() string {
+	return p.ReqId
+}
+
 func MakePingPacket() *PingPacketType {
 	return &PingPacketType{Type: PingPacketStr}
 }
@@ -527,8 +551,13 @@ type CompGenPacketType struct {
 	Prefix   string `json:"prefix"`
 	CompType string `json:"comptype"`
 	Cwd      string `json:"cwd"`
+	Script   string `json:"script,omitempty"` // only used for CompGenTypeScript (completion spec generators)
 }
 
+// runs CompGenPacketType.Script instead of "compgen -A"
+const CompGenTypeScript = "script"
+
+// valid "compgen -A" actions
 func IsValidCompGenType(t string) bool {
 	return (t == "file" || t == "command" || t == "directory" || t == "variable")
 }
@@ -545,6 +574,147 @@ func MakeCompGenPacket() *CompGenPacketType {
 	return &CompGenPacketType{Type: CompGenPacketStr}
 }
 
+type SysMetricsPacketType struct {
+	Type        string `json:"type"`
+	ReqId       string `json:"reqid"`
+	NumTopProcs int    `json:"numtopprocs,omitempty"`
+}
+
+func (*SysMetricsPacketType) GetType() string {
+	return SysMetricsPacketStr
+}
+
+func (p *SysMetricsPacketType) GetReqId() string {
+	return p.ReqId
+}
+
+func MakeSysMetricsPacket() *SysMetricsPacketType {
+	return &SysMetricsPacketType{Type: SysMetricsPacketStr}
+}
+
+type DiskUsageType struct {
+	Mount  string `json:"mount"`
+	FsType string `json:"fstype"`
+	Total  uint64 `json:"total"`
+	Used   uint64 `json:"used"`
+	Avail  uint64 `json:"avail"`
+}
+
+type ProcInfoType struct {
+	Pid     int     `json:"pid"`
+	PPid    int     `json:"ppid"`
+	Uid     int     `json:"uid"`
+	User    string  `json:"user,omitempty"`
+	Name    string  `json:"name"`
+	State   string  `json:"state"`
+	CmdLine string  `json:"cmdline,omitempty"`
+	CpuPct  float64 `json:"cpupct"`
+	RssSize uint64  `json:"rsssize"`
+	StartTs int64   `json:"startts,omitempty"`
+}
+
+type SysMetricsType struct {
+	Ts        int64            `json:"ts"`
+	HostName  string           `json:"hostname"`
+	NumCpu    int              `json:"numcpu"`
+	CpuPct    float64          `json:"cpupct"`
+	LoadAvg   [3]float64       `json:"loadavg"`
+	MemTotal  uint64           `json:"memtotal"`
+	MemAvail  uint64           `json:"memavail"`
+	SwapTotal uint64           `json:"swaptotal"`
+	SwapFree  uint64           `json:"swapfree"`
+	UptimeSec int64            `json:"uptimesec"`
+	Disks     []*DiskUsageType `json:"disks,omitempty"`
+	TopProcs  []*ProcInfoType  `json:"topprocs,omitempty"`
+}
+
+type SysMetricsResponseType struct {
+	Type    string          `json:"type"`
+	RespId  string          `json:"respid"`
+	Metrics *SysMetricsType `json:"metrics,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func (*SysMetricsResponseType) GetType() string {
+	return SysMetricsResponseStr
+}
+
+func (p *SysMetricsResponseType) GetResponseId() string {
+	return p.RespId
+}
+
+func (p *SysMetricsResponseType) GetResponseDone() bool {
+	return true
+}
+
+func MakeSysMetricsResponse(respId string) *SysMetricsResponseType {
+	return &SysMetricsResponseType{Type: SysMetricsResponseStr, RespId: respId}
+}
+
+type ProcListPacketType struct {
+	Type     string `json:"type"`
+	ReqId    string `json:"reqid"`
+	Filter   string `json:"filter,omitempty"` // substring match against name and cmdline
+	User     string `json:"user,omitempty"`
+	MaxItems int    `json:"maxitems,omitempty"`
+}
+
+func (*ProcListPacketType) GetType() string {
+	return ProcListPacketStr
+}
+
+func (p *ProcListPacketType) GetReqId() string {
+	return p.ReqId
+}
+
+func MakeProcListPacket() *ProcListPacketType {
+	return &ProcListPacketType{Type: ProcListPacketStr}
+}
+
+type ProcListResponseType struct {
+	Type     string          `json:"type"`
+	RespId   string          `json:"respid"`
+	Procs    []*ProcInfoType `json:"procs,omitempty"`
+	NumProcs int             `json:"numprocs"` // total number of matching procs (before MaxItems is applied)
+	Error    string          `json:"error,omitempty"`
+}
+
+func (*ProcListResponseType) GetType() string {
+	return ProcListResponseStr
+}
+
+func (p *ProcListResponseType) GetResponseId() string {
+	return p.RespId
+}
+
+func (p *ProcListResponseType) GetResponseDone() bool {
+	return true
+}
+
+func MakeProcListResponse(respId string) *ProcListResponseType {
+	return &ProcListResponseType{Type: ProcListResponseStr, RespId: respId}
+}
+
+// responds with a ResponsePacketType
+type ProcSignalPacketType struct {
+	Type    string `json:"type"`
+	ReqId   string `json:"reqid"`
+	Pid     int    `json:"pid"`
+	SigName string `json:"signame"` // same format as SpecialInputPacketType.SigName
+}
+
+func (*ProcSignalPacketType) GetType() string {
+	return ProcSignalPacketStr
+}
+
+func (p *ProcSignalPacketType) GetReqId() string {
+	return p.ReqId
+}
+
+func MakeProcSignalPacket() *ProcSignalPacketType {
+	return &ProcSignalPacketType{Type: ProcSignalPacketStr}
+}
+
 type ResponsePacketType struct {
 	Type      string      `json:"type"`
 	RespId    string      `json:"respid"`
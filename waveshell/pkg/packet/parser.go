@@ -242,7 +242,7 @@ func MakePacketParser(input io.Reader, opts *PacketParserOpts) *PacketParser {
 			if pk.GetType() == DonePacketStr {
 				return
 			}
-			if pk.GetType() == PingPacketStr {
+			if pingPk, ok := pk.(*PingPacketType); ok && pingPk.ReqId == "" {
 				continue
 			}
 			if pk.GetType() == LogPacketStr {
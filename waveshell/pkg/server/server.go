@@ -22,6 +22,7 @@ import (
 	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/shellapi"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/shexec"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/sysinfo"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/wlog"
 )
@@ -235,6 +236,44 @@ func runSingleCompGen(cwd string, compType string, prefix string) ([]string, boo
 	return parts, hasMore, nil
 }
 
+// runs a completion spec generator script, each line of output is a completion (filtered by prefix)
+// a non-zero exit status is not an error (e.g. "git branch" outside of a repository)
+func runScriptCompGen(cwd string, script string, prefix string) ([]string, bool, error) {
+	if strings.TrimSpace(script) == "" {
+		return nil, false, fmt.Errorf("compgen script is empty")
+	}
+	sapi, err := shellapi.MakeShellApi(packet.ShellType_bash)
+	if err != nil {
+		return nil, false, err
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), packet.CompGenScriptTimeout)
+	defer cancelFn()
+	compGenCmdStr := fmt.Sprintf("cd %s; %s", shellescape.Quote(cwd), script)
+	ecmd := exec.CommandContext(ctx, sapi.GetLocalShellPath(), "-c", compGenCmdStr)
+	outputBytes, err := ecmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && ctx.Err() == nil) {
+		return nil, false, fmt.Errorf("compgen script error: %w", err)
+	}
+	seen := make(map[string]bool)
+	var parts []string
+	for _, line := range strings.Split(string(outputBytes), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		seen[line] = true
+		parts = append(parts, line)
+	}
+	sort.Strings(parts)
+	hasMore := false
+	if len(parts) > packet.MaxCompGenValues {
+		hasMore = true
+		parts = parts[0:packet.MaxCompGenValues]
+	}
+	return parts, hasMore, nil
+}
+
 func appendSlashes(comps []string) {
 	for idx, comp := range comps {
 		comps[idx] = comp + "/"
@@ -280,6 +319,19 @@ func (m *MServer) runMixedCompGen(compPk *packet.CompGenPacketType) {
 
 func (m *MServer) runCompGen(compPk *packet.CompGenPacketType) {
 	reqId := compPk.GetReqId()
+	if compPk.CompType == packet.CompGenTypeScript {
+		comps, hasMore, err := runScriptCompGen(compPk.Cwd, compPk.Script, compPk.Prefix)
+		if err != nil {
+			m.Sender.SendErrorResponse(reqId, err)
+			return
+		}
+		m.Sender.SendResponse(reqId, map[string]interface{}{"comps": comps, "hasmore": hasMore})
+		return
+	}
+	if !packet.IsValidCompGenType(compPk.CompType) {
+		m.Sender.SendErrorResponse(reqId, fmt.Errorf("invalid compgen type '%s'", compPk.CompType))
+		return
+	}
 	if compPk.CompType == "file" || compPk.CompType == "command" {
 		m.runMixedCompGen(compPk)
 		return
@@ -667,6 +719,29 @@ func int64Min(v1 int64, v2 int64) int64 {
 	return v2
 }
 
+func (m *MServer) sysMetrics(pk *packet.SysMetricsPacketType) {
+	resp := packet.MakeSysMetricsResponse(pk.ReqId)
+	metrics, err := sysinfo.GetSysMetrics(pk.NumTopProcs)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Metrics = metrics
+	}
+	m.Sender.SendPacket(resp)
+}
+
+func (m *MServer) procList(pk *packet.ProcListPacketType) {
+	resp := packet.MakeProcListResponse(pk.ReqId)
+	procs, numProcs, err := sysinfo.GetFilteredProcList(pk.Filter, pk.User, pk.MaxItems)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Procs = procs
+		resp.NumProcs = numProcs
+	}
+	m.Sender.SendPacket(resp)
+}
+
 func (m *MServer) ProcessRpcPacket(pk packet.RpcPacketType) {
 	reqId := pk.GetReqId()
 	if cdPk, ok := pk.(*packet.CdPacketType); ok {
@@ -678,6 +753,27 @@ func (m *MServer) ProcessRpcPacket(pk packet.RpcPacketType) {
 		m.Sender.SendResponse(reqId, true)
 		return
 	}
+	if _, ok := pk.(*packet.PingPacketType); ok {
+		m.Sender.SendResponse(reqId, true)
+		return
+	}
+	if metricsPk, ok := pk.(*packet.SysMetricsPacketType); ok {
+		go m.sysMetrics(metricsPk)
+		return
+	}
+	if procListPk, ok := pk.(*packet.ProcListPacketType); ok {
+		go m.procList(procListPk)
+		return
+	}
+	if sigPk, ok := pk.(*packet.ProcSignalPacketType); ok {
+		err := sysinfo.SignalProc(sigPk.Pid, sigPk.SigName)
+		if err != nil {
+			m.Sender.SendErrorResponse(reqId, err)
+			return
+		}
+		m.Sender.SendResponse(reqId, true)
+		return
+	}
 	if compPk, ok := pk.(*packet.CompGenPacketType); ok {
 		go m.runCompGen(compPk)
 		return
@@ -141,6 +141,78 @@ func (sw SessionWrap) StderrPipe() (io.ReadCloser, error) {
 	return io.NopCloser(stderrReader), nil
 }
 
+// a local command whose stdin/stdout is a pipe to a shell on the remote (kubectl exec -i, lxc exec, etc.).
+// StartLine is written to the shell when the command starts, the shell should exec the real command so
+// the rest of stdin/stdout belongs to it.  nothing else should be written until the real command responds
+// (the remote shell may read ahead of StartLine).
+type ShellPipeWrap struct {
+	Cmd       *exec.Cmd
+	StartLine string
+	stdin     io.WriteCloser
+}
+
+func MakeShellPipeWrap(ecmd *exec.Cmd, startLine string) *ShellPipeWrap {
+	return &ShellPipeWrap{Cmd: ecmd, StartLine: startLine}
+}
+
+func (pw *ShellPipeWrap) Kill() {
+	pw.Cmd.Process.Kill()
+}
+
+func (pw *ShellPipeWrap) Wait() error {
+	return pw.Cmd.Wait()
+}
+
+func (pw *ShellPipeWrap) Sender() (*packet.PacketSender, io.WriteCloser, error) {
+	inputWriter, err := pw.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating stdin pipe: %v", err)
+	}
+	sender := packet.MakePacketSender(inputWriter, nil)
+	return sender, inputWriter, nil
+}
+
+func (pw *ShellPipeWrap) Parser() (*packet.PacketParser, io.ReadCloser, io.ReadCloser, error) {
+	return CmdWrap{Cmd: pw.Cmd}.Parser()
+}
+
+func (pw *ShellPipeWrap) Start() error {
+	stdin, err := pw.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("creating stdin pipe: %v", err)
+	}
+	err = CmdWrap{Cmd: pw.Cmd}.Start()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdin, pw.StartLine+"\n")
+	if err != nil {
+		pw.Kill()
+		return fmt.Errorf("writing start command to shell: %v", err)
+	}
+	return nil
+}
+
+// the stdin pipe is shared with Start(), so it can only be created once
+func (pw *ShellPipeWrap) StdinPipe() (io.WriteCloser, error) {
+	if pw.stdin == nil {
+		stdin, err := pw.Cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		pw.stdin = stdin
+	}
+	return pw.stdin, nil
+}
+
+func (pw *ShellPipeWrap) StdoutPipe() (io.ReadCloser, error) {
+	return pw.Cmd.StdoutPipe()
+}
+
+func (pw *ShellPipeWrap) StderrPipe() (io.ReadCloser, error) {
+	return pw.Cmd.StderrPipe()
+}
+
 type ConnInterface interface {
 	Kill()
 	Wait() error
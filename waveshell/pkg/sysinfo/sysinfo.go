@@ -0,0 +1,451 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// reads host metrics and process information from /proc (linux only)
+package sysinfo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"golang.org/x/sys/unix"
+)
+
+const ProcDir = "/proc"
+const ClockTicks = 100 // USER_HZ (fixed at 100 on all mainstream linux architectures)
+const CpuSampleDuration = 250 * time.Millisecond
+const DefaultNumTopProcs = 5
+const MaxNumTopProcs = 50
+const MaxDisks = 10
+const MaxCmdLineLen = 200
+const DefaultMaxProcListItems = 100
+const MaxProcListItems = 2000
+
+// pseudo filesystems that are never interesting for disk usage
+var skipFsTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "cgroup": true, "cgroup2": true,
+	"pstore": true, "bpf": true, "tracefs": true, "debugfs": true, "securityfs": true, "mqueue": true, "hugetlbfs": true,
+	"configfs": true, "fusectl": true, "autofs": true, "binfmt_misc": true, "rpc_pipefs": true, "nsfs": true,
+	"squashfs": true, "overlay": true, "efivarfs": true, "ramfs": true, "selinuxfs": true, "fuse.lxcfs": true,
+}
+
+var userNameCache = &sync.Map{}
+
+func checkSupported() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("system metrics are not supported on %s (linux only)", runtime.GOOS)
+	}
+	return nil
+}
+
+type cpuTimes struct {
+	Total uint64
+	Idle  uint64
+}
+
+// parses the aggregate "cpu" line of /proc/stat
+func parseCpuLine(line string) (cpuTimes, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, fmt.Errorf("invalid cpu line")
+	}
+	var rtn cpuTimes
+	for idx, field := range fields[1:] {
+		if idx >= 8 {
+			// guest and guest_nice are already included in user and nice
+			break
+		}
+		val, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, fmt.Errorf("invalid cpu line: %w", err)
+		}
+		rtn.Total += val
+		if idx == 3 || idx == 4 {
+			// idle + iowait
+			rtn.Idle += val
+		}
+	}
+	return rtn, nil
+}
+
+// returns aggregate cpu times and the boot time (unix seconds)
+func readProcStat() (cpuTimes, int64, error) {
+	data, err := os.ReadFile(filepath.Join(ProcDir, "stat"))
+	if err != nil {
+		return cpuTimes{}, 0, err
+	}
+	var times cpuTimes
+	var bootTime int64
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "cpu ") {
+			times, err = parseCpuLine(line)
+			if err != nil {
+				return cpuTimes{}, 0, err
+			}
+		} else if strings.HasPrefix(line, "btime ") {
+			bootTime, _ = strconv.ParseInt(strings.TrimSpace(line[len("btime "):]), 10, 64)
+		}
+	}
+	return times, bootTime, nil
+}
+
+// returns values in bytes (keys without the trailing colon)
+func parseMemInfo(data string) map[string]uint64 {
+	rtn := make(map[string]uint64)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) >= 3 && fields[2] == "kB" {
+			val *= 1024
+		}
+		rtn[strings.TrimSuffix(fields[0], ":")] = val
+	}
+	return rtn
+}
+
+func parseLoadAvg(data string) ([3]float64, error) {
+	var rtn [3]float64
+	fields := strings.Fields(data)
+	if len(fields) < 3 {
+		return rtn, fmt.Errorf("invalid loadavg")
+	}
+	for idx := 0; idx < 3; idx++ {
+		val, err := strconv.ParseFloat(fields[idx], 64)
+		if err != nil {
+			return rtn, fmt.Errorf("invalid loadavg: %w", err)
+		}
+		rtn[idx] = val
+	}
+	return rtn, nil
+}
+
+// /proc/mounts escapes spaces, tabs, newlines and backslashes as octal
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if val, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(val))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+func readDisks() []*packet.DiskUsageType {
+	data, err := os.ReadFile(filepath.Join(ProcDir, "mounts"))
+	if err != nil {
+		return nil
+	}
+	var rtn []*packet.DiskUsageType
+	seenDevs := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		device, mount, fsType := fields[0], unescapeMountPath(fields[1]), fields[2]
+		if skipFsTypes[fsType] || seenDevs[device] || strings.HasPrefix(mount, "/snap/") {
+			continue
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mount, &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+		seenDevs[device] = true
+		bsize := uint64(st.Bsize)
+		rtn = append(rtn, &packet.DiskUsageType{
+			Mount:  mount,
+			FsType: fsType,
+			Total:  st.Blocks * bsize,
+			Used:   (st.Blocks - st.Bfree) * bsize,
+			Avail:  st.Bavail * bsize,
+		})
+		if len(rtn) >= MaxDisks {
+			break
+		}
+	}
+	return rtn
+}
+
+type procSample struct {
+	Info     *packet.ProcInfoType
+	CpuTicks uint64
+}
+
+// parses /proc/[pid]/stat (the comm field can contain spaces and parens, so we split on the last ')')
+func parseProcPidStat(data string) (*packet.ProcInfoType, uint64, uint64, error) {
+	openIdx := strings.Index(data, "(")
+	closeIdx := strings.LastIndex(data, ")")
+	if openIdx == -1 || closeIdx < openIdx {
+		return nil, 0, 0, fmt.Errorf("invalid stat format")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(data[0:openIdx]))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid pid: %w", err)
+	}
+	fields := strings.Fields(data[closeIdx+1:])
+	// fields[0] is field 3 (state) in proc(5)
+	if len(fields) < 22 {
+		return nil, 0, 0, fmt.Errorf("invalid stat format (not enough fields)")
+	}
+	info := &packet.ProcInfoType{Pid: pid, Name: data[openIdx+1 : closeIdx], State: fields[0]}
+	info.PPid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	startTicks, _ := strconv.ParseUint(fields[19], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+	info.RssSize = rssPages * uint64(os.Getpagesize())
+	return info, utime + stime, startTicks, nil
+}
+
+func lookupUserName(uid int) string {
+	if name, ok := userNameCache.Load(uid); ok {
+		return name.(string)
+	}
+	var name string
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	userNameCache.Store(uid, name)
+	return name
+}
+
+func readProcCmdLine(pid int) string {
+	data, err := os.ReadFile(filepath.Join(ProcDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	cmdLine := strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	if len(cmdLine) > MaxCmdLineLen {
+		cmdLine = cmdLine[0:MaxCmdLineLen-3] + "..."
+	}
+	return cmdLine
+}
+
+func readProcSamples(bootTime int64) map[int]*procSample {
+	rtn := make(map[int]*procSample)
+	entries, err := os.ReadDir(ProcDir)
+	if err != nil {
+		return rtn
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		pidDir := filepath.Join(ProcDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(pidDir, "stat"))
+		if err != nil {
+			// process exited
+			continue
+		}
+		info, cpuTicks, startTicks, err := parseProcPidStat(string(data))
+		if err != nil || info.Pid != pid {
+			continue
+		}
+		if bootTime > 0 {
+			info.StartTs = (bootTime*ClockTicks + int64(startTicks)) * 1000 / ClockTicks
+		}
+		if finfo, err := os.Stat(pidDir); err == nil {
+			if st, ok := finfo.Sys().(*syscall.Stat_t); ok {
+				info.Uid = int(st.Uid)
+			}
+		}
+		rtn[pid] = &procSample{Info: info, CpuTicks: cpuTicks}
+	}
+	return rtn
+}
+
+// samples all processes twice (CpuSampleDuration apart) to compute cpu percentages.
+// returns processes sorted by cpu (then rss), the overall cpu percentage, and the number of cpus.
+func sampleProcs() ([]*packet.ProcInfoType, float64, error) {
+	startCpu, bootTime, err := readProcStat()
+	if err != nil {
+		return nil, 0, err
+	}
+	startSamples := readProcSamples(bootTime)
+	time.Sleep(CpuSampleDuration)
+	endCpu, _, err := readProcStat()
+	if err != nil {
+		return nil, 0, err
+	}
+	endSamples := readProcSamples(bootTime)
+	numCpu := runtime.NumCPU()
+	totalDelta := float64(endCpu.Total - startCpu.Total)
+	var cpuPct float64
+	if totalDelta > 0 {
+		cpuPct = 100 * (totalDelta - float64(endCpu.Idle-startCpu.Idle)) / totalDelta
+	}
+	rtn := make([]*packet.ProcInfoType, 0, len(endSamples))
+	for pid, endSample := range endSamples {
+		info := endSample.Info
+		if startSample := startSamples[pid]; startSample != nil && totalDelta > 0 && endSample.CpuTicks >= startSample.CpuTicks {
+			// percent of a single cpu (like top)
+			info.CpuPct = 100 * float64(endSample.CpuTicks-startSample.CpuTicks) * float64(numCpu) / totalDelta
+		}
+		rtn = append(rtn, info)
+	}
+	sort.Slice(rtn, func(i int, j int) bool {
+		if rtn[i].CpuPct != rtn[j].CpuPct {
+			return rtn[i].CpuPct > rtn[j].CpuPct
+		}
+		if rtn[i].RssSize != rtn[j].RssSize {
+			return rtn[i].RssSize > rtn[j].RssSize
+		}
+		return rtn[i].Pid < rtn[j].Pid
+	})
+	return rtn, cpuPct, nil
+}
+
+func fillProcDetails(procs []*packet.ProcInfoType) {
+	for _, info := range procs {
+		info.User = lookupUserName(info.Uid)
+		info.CmdLine = readProcCmdLine(info.Pid)
+	}
+}
+
+// GetProcList returns all processes (sorted by cpu usage), blocks for CpuSampleDuration
+func GetProcList() ([]*packet.ProcInfoType, error) {
+	if err := checkSupported(); err != nil {
+		return nil, err
+	}
+	procs, _, err := sampleProcs()
+	if err != nil {
+		return nil, err
+	}
+	fillProcDetails(procs)
+	return procs, nil
+}
+
+// FilterProcs returns the procs matching filter (case-insensitive substring of name or cmdline) and user.
+// empty filter/user match everything.
+func FilterProcs(procs []*packet.ProcInfoType, filter string, userName string) []*packet.ProcInfoType {
+	if filter == "" && userName == "" {
+		return procs
+	}
+	filter = strings.ToLower(filter)
+	var rtn []*packet.ProcInfoType
+	for _, info := range procs {
+		if userName != "" && info.User != userName && strconv.Itoa(info.Uid) != userName {
+			continue
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(info.Name), filter) && !strings.Contains(strings.ToLower(info.CmdLine), filter) {
+			continue
+		}
+		rtn = append(rtn, info)
+	}
+	return rtn
+}
+
+// GetFilteredProcList returns matching procs (capped at maxItems) and the total number of matches
+func GetFilteredProcList(filter string, userName string, maxItems int) ([]*packet.ProcInfoType, int, error) {
+	if maxItems <= 0 {
+		maxItems = DefaultMaxProcListItems
+	}
+	if maxItems > MaxProcListItems {
+		maxItems = MaxProcListItems
+	}
+	procs, err := GetProcList()
+	if err != nil {
+		return nil, 0, err
+	}
+	procs = FilterProcs(procs, filter, userName)
+	numProcs := len(procs)
+	if len(procs) > maxItems {
+		procs = procs[0:maxItems]
+	}
+	return procs, numProcs, nil
+}
+
+// SignalProc sends a signal to pid.  sigName is a number (e.g. "9") or a name with the "SIG" prefix (e.g. "SIGTERM")
+func SignalProc(pid int, sigName string) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	if pid == os.Getpid() {
+		return fmt.Errorf("cannot signal the waveshell server process (pid %d)", pid)
+	}
+	var signal syscall.Signal
+	sigNum, err := strconv.Atoi(sigName)
+	if err == nil {
+		signal = syscall.Signal(sigNum)
+	} else {
+		signal = unix.SignalNum(sigName)
+	}
+	if signal <= 0 {
+		return fmt.Errorf("signal %q not found, cannot send", sigName)
+	}
+	err = syscall.Kill(pid, signal)
+	if err != nil {
+		return fmt.Errorf("cannot send %s to pid %d: %w", sigName, pid, err)
+	}
+	return nil
+}
+
+// GetSysMetrics returns host metrics, blocks for CpuSampleDuration
+func GetSysMetrics(numTopProcs int) (*packet.SysMetricsType, error) {
+	if err := checkSupported(); err != nil {
+		return nil, err
+	}
+	if numTopProcs <= 0 {
+		numTopProcs = DefaultNumTopProcs
+	}
+	if numTopProcs > MaxNumTopProcs {
+		numTopProcs = MaxNumTopProcs
+	}
+	rtn := &packet.SysMetricsType{Ts: time.Now().UnixMilli(), NumCpu: runtime.NumCPU()}
+	rtn.HostName, _ = os.Hostname()
+	if data, err := os.ReadFile(filepath.Join(ProcDir, "loadavg")); err == nil {
+		rtn.LoadAvg, _ = parseLoadAvg(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(ProcDir, "meminfo")); err == nil {
+		memInfo := parseMemInfo(string(data))
+		rtn.MemTotal = memInfo["MemTotal"]
+		rtn.MemAvail = memInfo["MemAvailable"]
+		rtn.SwapTotal = memInfo["SwapTotal"]
+		rtn.SwapFree = memInfo["SwapFree"]
+	}
+	if data, err := os.ReadFile(filepath.Join(ProcDir, "uptime")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) > 0 {
+			uptime, _ := strconv.ParseFloat(fields[0], 64)
+			rtn.UptimeSec = int64(uptime)
+		}
+	}
+	rtn.Disks = readDisks()
+	procs, cpuPct, err := sampleProcs()
+	if err != nil {
+		return nil, err
+	}
+	rtn.CpuPct = cpuPct
+	if len(procs) > numTopProcs {
+		procs = procs[0:numTopProcs]
+	}
+	fillProcDetails(procs)
+	rtn.TopProcs = procs
+	return rtn, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sysinfo
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+)
+
+func TestParseCpuLine(t *testing.T) {
+	times, err := parseCpuLine("cpu  100 5 50 800 20 1 2 3 7 0")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if times.Total != 981 || times.Idle != 820 {
+		t.Errorf("unexpected cpu times: %+v", times)
+	}
+	if _, err := parseCpuLine("cpu0 1 2 3 4"); err == nil {
+		t.Errorf("expected error for per-cpu line")
+	}
+}
+
+func TestParseProcPidStat(t *testing.T) {
+	stat := "1234 (my (weird) proc) S 1 1234 1234 0 -1 4194560 100 0 0 0 150 50 0 0 20 0 1 0 5000 1000000 300 18446744073709551615"
+	info, cpuTicks, startTicks, err := parseProcPidStat(stat)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if info.Pid != 1234 || info.PPid != 1 || info.Name != "my (weird) proc" || info.State != "S" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if cpuTicks != 200 || startTicks != 5000 {
+		t.Errorf("unexpected ticks cpu=%d start=%d", cpuTicks, startTicks)
+	}
+	if info.RssSize != 300*uint64(os.Getpagesize()) {
+		t.Errorf("unexpected rss %d", info.RssSize)
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	memInfo := parseMemInfo("MemTotal:       16000 kB\nMemAvailable:    8000 kB\nHugePages_Total:       0\n")
+	if memInfo["MemTotal"] != 16000*1024 || memInfo["MemAvailable"] != 8000*1024 || memInfo["HugePages_Total"] != 0 {
+		t.Errorf("unexpected meminfo: %v", memInfo)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if rtn := unescapeMountPath(`/mnt/my\040disk`); rtn != "/mnt/my disk" {
+		t.Errorf("unexpected unescape result %q", rtn)
+	}
+}
+
+func TestFilterProcs(t *testing.T) {
+	procs := []*packet.ProcInfoType{
+		{Pid: 1, Uid: 0, User: "root", Name: "systemd", CmdLine: "/sbin/init"},
+		{Pid: 200, Uid: 1000, User: "mike", Name: "bash", CmdLine: "-bash"},
+		{Pid: 300, Uid: 1000, User: "mike", Name: "node", CmdLine: "node server.js --port 8080"},
+	}
+	if rtn := FilterProcs(procs, "", ""); len(rtn) != 3 {
+		t.Errorf("empty filter should match all, got %d", len(rtn))
+	}
+	if rtn := FilterProcs(procs, "SERVER", ""); len(rtn) != 1 || rtn[0].Pid != 300 {
+		t.Errorf("cmdline filter failed: %v", rtn)
+	}
+	if rtn := FilterProcs(procs, "", "mike"); len(rtn) != 2 {
+		t.Errorf("user filter failed: %v", rtn)
+	}
+	if rtn := FilterProcs(procs, "", "0"); len(rtn) != 1 || rtn[0].Pid != 1 {
+		t.Errorf("uid filter failed: %v", rtn)
+	}
+	if rtn := FilterProcs(procs, "bash", "root"); len(rtn) != 0 {
+		t.Errorf("combined filter failed: %v", rtn)
+	}
+}
+
+func TestSignalProcInvalid(t *testing.T) {
+	if err := SignalProc(0, "SIGTERM"); err == nil {
+		t.Errorf("expected error for pid 0")
+	}
+	if err := SignalProc(os.Getpid(), "SIGTERM"); err == nil {
+		t.Errorf("expected error for own pid")
+	}
+	if err := SignalProc(1, "SIGNOTASIGNAL"); err == nil {
+		t.Errorf("expected error for invalid signal")
+	}
+}
@@ -34,11 +34,16 @@ import (
 	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/server"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/wlog"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/apitoken"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/bookmarks"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/bufferedpipe"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/cmdrunner"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/comp"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/ephemeral"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/janitor"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/pcloud"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/ptystream"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/releasechecker"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/rtnstate"
@@ -69,6 +74,11 @@ const WSStatePacketChSize = 20
 const InitialTelemetryWait = 30 * time.Second
 const TelemetryTick = 10 * time.Minute
 const TelemetryInterval = 4 * time.Hour
+const InitialTrashPurgeWait = 1 * time.Minute
+const TrashPurgeInterval = 6 * time.Hour
+const InitialDBBackupWait = 5 * time.Minute
+const DBBackupCheckInterval = 1 * time.Hour
+const RestartExitCode = 77 // must match emain.ts, electron restarts wavesrv
 
 const MaxWriteFileMemSize = 20 * (1024 * 1024) // 20M
 
@@ -158,6 +168,7 @@ func HandleWs(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebSocket opened %s %s\n", state.ClientId, shell.RemoteAddr)
 
 	state.RunWSRead()
+	scws.ReleaseInputLeases(clientId)
 }
 
 // todo: sync multiple writes to the same fifoName into a single go-routine and do liveness checking on fifo
@@ -818,34 +829,86 @@ func ConfigHandlerCheckIsDir(dirHandler http.Handler, fileHandler http.Handler)
 			return
 		}
 		if fstat.IsDir() {
-			AuthKeyMiddleWare(dirHandler).ServeHTTP(w, r)
+			AuthKeyMiddleWare(apitoken.ScopeRead, dirHandler).ServeHTTP(w, r)
 		} else {
-			AuthKeyMiddleWare(fileHandler).ServeHTTP(w, r)
+			AuthKeyMiddleWare(apitoken.ScopeRead, fileHandler).ServeHTTP(w, r)
 		}
 	})
 }
 
-func AuthKeyMiddleWare(next http.Handler) http.Handler {
+// returns the X-AuthKey header, or the bearer token from the Authorization header
+func getRequestAuthKey(r *http.Request) string {
+	reqAuthKey := r.Header.Get("X-AuthKey")
+	if reqAuthKey != "" {
+		return reqAuthKey
+	}
+	bearerToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		return strings.TrimSpace(bearerToken)
+	}
+	return ""
+}
+
+// the main auth key grants everything.  api tokens must grant scope and (if the request has a "screenid"
+// query param) have access to the screen.  api token requests are audited, and the token is added to
+// the request context (so /api/run-command can check the commands it runs).
+func checkRequestAuth(w http.ResponseWriter, r *http.Request, reqAuthKey string, scope string) (*http.Request, bool) {
+	if reqAuthKey == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("no x-authkey header"))
+		return nil, false
+	}
+	if reqAuthKey == scbase.WaveAuthKey {
+		return r, true
+	}
+	token, err := apitoken.Authenticate(r.Context(), reqAuthKey)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("x-authkey header is invalid"))
+		return nil, false
+	}
+	screenId := r.URL.Query().Get("screenid")
+	now := time.Now()
+	err = token.CheckScope(scope, now)
+	if err == nil {
+		err = token.CheckScreen(screenId)
+	}
+	var detail string
+	if err != nil {
+		detail = err.Error()
+	}
+	auditErr := apitoken.RecordUse(r.Context(), token, r.URL.Path, screenId, err == nil, detail)
+	if auditErr != nil {
+		log.Printf("[error] recording api token use: %v\n", auditErr)
+	}
+	if err != nil {
+		if token.Status(now) != "active" {
+			// revoked or expired
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(err.Error()))
+			return nil, false
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return nil, false
+	}
+	return r.WithContext(apitoken.WithToken(r.Context(), token)), true
+}
+
+func AuthKeyMiddleWare(scope string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqAuthKey := r.Header.Get("X-AuthKey")
 		w.Header().Set(CacheControlHeaderKey, CacheControlHeaderNoCache)
-		if reqAuthKey == "" {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("no x-authkey header"))
-			return
-		}
-		if reqAuthKey != scbase.WaveAuthKey {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("x-authkey header is invalid"))
+		r, ok := checkRequestAuth(w, r, getRequestAuthKey(r), scope)
+		if !ok {
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func AuthKeyWrapAllowHmac(fn WebFnType) WebFnType {
+func AuthKeyWrapAllowHmac(scope string, fn WebFnType) WebFnType {
 	return func(w http.ResponseWriter, r *http.Request) {
-		reqAuthKey := r.Header.Get("X-AuthKey")
+		reqAuthKey := getRequestAuthKey(r)
 		if reqAuthKey == "" {
 			// try hmac
 			qvals := r.URL.Query()
@@ -861,10 +924,12 @@ func AuthKeyWrapAllowHmac(fn WebFnType) WebFnType {
 				return
 			}
 			// fallthrough (hmac is valid)
-		} else if reqAuthKey != scbase.WaveAuthKey {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("x-authkey header is invalid"))
-			return
+		} else {
+			var ok bool
+			r, ok = checkRequestAuth(w, r, reqAuthKey, scope)
+			if !ok {
+				return
+			}
 		}
 		w.Header().Set(CacheControlHeaderKey, CacheControlHeaderNoCache)
 		fn(w, r)
@@ -872,17 +937,10 @@ func AuthKeyWrapAllowHmac(fn WebFnType) WebFnType {
 
 }
 
-func AuthKeyWrap(fn WebFnType) WebFnType {
+func AuthKeyWrap(scope string, fn WebFnType) WebFnType {
 	return func(w http.ResponseWriter, r *http.Request) {
-		reqAuthKey := r.Header.Get("X-AuthKey")
-		if reqAuthKey == "" {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("no x-authkey header"))
-			return
-		}
-		if reqAuthKey != scbase.WaveAuthKey {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("x-authkey header is invalid"))
+		r, ok := checkRequestAuth(w, r, getRequestAuthKey(r), scope)
+		if !ok {
 			return
 		}
 		w.Header().Set(CacheControlHeaderKey, CacheControlHeaderNoCache)
@@ -966,6 +1024,95 @@ func telemetryLoop() {
 	}
 }
 
+func purgeExpiredTrashWrapper() {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		log.Printf("[error] in purgeExpiredTrashWrapper: %v\n", r)
+		debug.PrintStack()
+	}()
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelFn()
+	removed, err := sstore.PurgeExpiredTrash(ctx)
+	if err != nil {
+		log.Printf("[error] purging expired trash: %v\n", err)
+		return
+	}
+	if len(removed) > 0 {
+		log.Printf("purged %d expired trash item(s)\n", len(removed))
+	}
+}
+
+func trashPurgeLoop() {
+	time.Sleep(InitialTrashPurgeWait)
+	for {
+		purgeExpiredTrashWrapper()
+		time.Sleep(TrashPurgeInterval)
+	}
+}
+
+// takes an "auto" db backup if the last one is older than DBBackupInterval and rotates the old ones
+func scheduledDBBackupWrapper() {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		log.Printf("[error] in scheduledDBBackupWrapper: %v\n", r)
+		debug.PrintStack()
+	}()
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancelFn()
+	clientData, err := sstore.EnsureClientData(ctx)
+	if err != nil {
+		log.Printf("[error] scheduled db backup, cannot get client data: %v\n", err)
+		return
+	}
+	keepCount := clientData.ClientOpts.DBBackupCount
+	if keepCount < 0 {
+		return
+	}
+	if keepCount == 0 {
+		keepCount = sstore.DefaultDBBackupCount
+	}
+	backups, err := sstore.GetDBBackups()
+	if err != nil {
+		log.Printf("[error] scheduled db backup: %v\n", err)
+		return
+	}
+	for _, backup := range backups {
+		if backup.Kind == sstore.DBBackupKind_Auto {
+			if time.Since(time.UnixMilli(backup.Ts)) < sstore.DBBackupInterval {
+				return
+			}
+			break
+		}
+	}
+	backup, err := sstore.BackupDB(ctx, sstore.DBBackupKind_Auto)
+	if err != nil {
+		log.Printf("[error] scheduled db backup: %v\n", err)
+		return
+	}
+	log.Printf("[db] scheduled backup written to %s\n", backup.Path)
+	removed, err := sstore.RotateDBBackups(keepCount)
+	if err != nil {
+		log.Printf("[error] rotating db backups: %v\n", err)
+	}
+	if len(removed) > 0 {
+		log.Printf("[db] removed %d old backup(s)\n", len(removed))
+	}
+}
+
+func dbBackupLoop() {
+	time.Sleep(InitialDBBackupWait)
+	for {
+		scheduledDBBackupWrapper()
+		time.Sleep(DBBackupCheckInterval)
+	}
+}
+
 // watch stdin, kill server if stdin is closed
 func stdinReadWatch() {
 	buf := make([]byte, 1024)
@@ -992,16 +1139,7 @@ func installSignalHandlers() {
 
 func doShutdown(reason string) {
 	shutdownOnce.Do(func() {
-		log.Printf("[wave] local server %v, start shutdown\n", reason)
-		shutdownActivityUpdate()
-		sendTelemetryWrapper()
-		log.Printf("[wave] closing db connection\n")
-		sstore.CloseDB()
-		log.Printf("[wave] *** shutting down local server\n")
-		watcher := configstore.GetWatcher()
-		if watcher != nil {
-			watcher.Close()
-		}
+		shutdownCleanup(reason)
 		time.Sleep(1 * time.Second)
 		syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 		time.Sleep(5 * time.Second)
@@ -1009,6 +1147,32 @@ func doShutdown(reason string) {
 	})
 }
 
+// exits with RestartExitCode so electron starts a new wavesrv
+func doRestart(reason string) {
+	shutdownOnce.Do(func() {
+		shutdownCleanup(reason)
+		log.Printf("[wave] exiting for restart\n")
+		os.Exit(RestartExitCode)
+	})
+}
+
+func shutdownCleanup(reason string) {
+	log.Printf("[wave] local server %v, start shutdown\n", reason)
+	shutdownActivityUpdate()
+	sendTelemetryWrapper()
+	err := apitoken.FlushAudit(context.Background())
+	if err != nil {
+		log.Printf("[error] flushing api token audit: %v\n", err)
+	}
+	log.Printf("[wave] closing db connection\n")
+	sstore.CloseDB()
+	log.Printf("[wave] *** shutting down local server\n")
+	watcher := configstore.GetWatcher()
+	if watcher != nil {
+		watcher.Close()
+	}
+}
+
 func configDirHandler(w http.ResponseWriter, r *http.Request) {
 	configPath := r.URL.Path
 	homeDir := scbase.GetWaveHomeDir()
@@ -1123,6 +1287,14 @@ func main() {
 		log.Printf("[error] ensuring config directory: %v\n", err)
 		return
 	}
+	restored, err := sstore.ApplyPendingDBRestore()
+	if err != nil {
+		log.Printf("[error] restoring db: %v\n", err)
+		return
+	}
+	if restored {
+		log.Printf("[db] database restored from backup\n")
+	}
 	err = sstore.TryMigrateUp()
 	if err != nil {
 		log.Printf("[error] migrate up: %v\n", err)
@@ -1150,6 +1322,26 @@ func main() {
 		return
 	}
 
+	err = remote.ReconcileRemotesFile(context.Background())
+	if err != nil {
+		log.Printf("[error] loading %s: %v\n", remote.RemotesFileName, err)
+	}
+
+	_, err = bookmarks.SyncBookmarksFile(context.Background())
+	if err != nil {
+		log.Printf("[error] syncing %s: %v\n", bookmarks.BookmarksFileName, err)
+	}
+
+	_, err = cmdrunner.ApplySettingsFile(context.Background())
+	if err != nil {
+		log.Printf("[error] applying %s: %v\n", configstore.SettingsFileName, err)
+	}
+
+	err = comp.LoadCompSpecs()
+	if err != nil {
+		log.Printf("[error] loading completion specs: %v\n", err)
+	}
+
 	err = sstore.HangupAllRunningCmds(context.Background())
 	if err != nil {
 		log.Printf("[error] calling HUP on all running commands: %v\n", err)
@@ -1162,8 +1354,13 @@ func main() {
 	log.Printf("PCLOUD_ENDPOINT=%s\n", pcloud.GetEndpoint())
 	startupActivityUpdate()
 	installSignalHandlers()
+	cmdrunner.RestartServerFn = doRestart
 	go telemetryLoop()
+	go trashPurgeLoop()
+	go dbBackupLoop()
+	go janitor.RunJanitorLoop()
 	go configWatcher()
+	go remote.RunSysMetricsLoop()
 	go stdinReadWatch()
 	go runWebSocketServer()
 	go func() {
@@ -1171,19 +1368,20 @@ func main() {
 		pcloud.StartUpdateWriter()
 	}()
 	gr := mux.NewRouter()
-	gr.HandleFunc("/api/ptyout", AuthKeyWrap(HandleGetPtyOut))
-	gr.HandleFunc("/api/remote-pty", AuthKeyWrap(HandleRemotePty))
-	gr.HandleFunc("/api/rtnstate", AuthKeyWrap(HandleRtnState))
-	gr.HandleFunc("/api/get-screen-lines", AuthKeyWrap(HandleGetScreenLines))
-	gr.HandleFunc("/api/run-command", AuthKeyWrap(HandleRunCommand)).Methods("POST")
-	gr.HandleFunc("/api/run-ephemeral-command", AuthKeyWrap(HandleRunEphemeralCommand)).Methods("POST")
-	gr.HandleFunc(bufferedpipe.BufferedPipeGetterUrl, AuthKeyWrapAllowHmac(bufferedpipe.HandleGetBufferedPipeOutput))
-	gr.HandleFunc("/api/get-client-data", AuthKeyWrap(HandleGetClientData))
-	gr.HandleFunc("/api/set-winsize", AuthKeyWrap(HandleSetWinSize))
-	gr.HandleFunc("/api/power-monitor", AuthKeyWrap(HandlePowerMonitor))
-	gr.HandleFunc("/api/log-active-state", AuthKeyWrap(HandleLogActiveState))
-	gr.HandleFunc("/api/read-file", AuthKeyWrapAllowHmac(HandleReadFile))
-	gr.HandleFunc("/api/write-file", AuthKeyWrap(HandleWriteFile)).Methods("POST")
+	gr.HandleFunc("/api/ptyout", AuthKeyWrap(apitoken.ScopeRead, HandleGetPtyOut))
+	gr.HandleFunc("/api/remote-pty", AuthKeyWrap(apitoken.ScopeAdmin, HandleRemotePty))
+	gr.HandleFunc("/api/rtnstate", AuthKeyWrap(apitoken.ScopeRead, HandleRtnState))
+	gr.HandleFunc("/api/get-screen-lines", AuthKeyWrap(apitoken.ScopeRead, HandleGetScreenLines))
+	gr.HandleFunc("/api/run-command", AuthKeyWrap(apitoken.ScopeRun, HandleRunCommand)).Methods("POST")
+	gr.HandleFunc("/api/run-ephemeral-command", AuthKeyWrap(apitoken.ScopeRun, HandleRunEphemeralCommand)).Methods("POST")
+	gr.HandleFunc(bufferedpipe.BufferedPipeGetterUrl, AuthKeyWrapAllowHmac(apitoken.ScopeRun, bufferedpipe.HandleGetBufferedPipeOutput))
+	gr.HandleFunc("/api/get-client-data", AuthKeyWrap(apitoken.ScopeAdmin, HandleGetClientData))
+	gr.HandleFunc("/api/set-winsize", AuthKeyWrap(apitoken.ScopeAdmin, HandleSetWinSize))
+	gr.HandleFunc("/api/power-monitor", AuthKeyWrap(apitoken.ScopeAdmin, HandlePowerMonitor))
+	gr.HandleFunc("/api/log-active-state", AuthKeyWrap(apitoken.ScopeAdmin, HandleLogActiveState))
+	gr.HandleFunc(ptystream.StreamPtyOutUrl, AuthKeyWrap(apitoken.ScopeRead, ptystream.HandleStreamPtyOut)).Methods("GET")
+	gr.HandleFunc("/api/read-file", AuthKeyWrapAllowHmac(apitoken.ScopeRead, HandleReadFile))
+	gr.HandleFunc("/api/write-file", AuthKeyWrap(apitoken.ScopeAdmin, HandleWriteFile)).Methods("POST")
 	configPath := filepath.Join(scbase.GetWaveHomeDir(), "config") + string(filepath.Separator)
 	log.Printf("[wave] config path: %q\n", configPath)
 	isFileHandler := http.StripPrefix("/config/", http.FileServer(http.Dir(configPath)))
@@ -1194,12 +1392,22 @@ func main() {
 	if scbase.IsDevMode() {
 		serverAddr = MainServerDevAddr
 	}
+	// streaming responses cannot go through the TimeoutHandler (it buffers the response), the stream handler
+	// manages its own write deadlines
+	timeoutHandler := http.TimeoutHandler(gr, HttpTimeoutDuration, "Timeout")
+	mainHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ptystream.StreamPtyOutUrl {
+			gr.ServeHTTP(w, r)
+			return
+		}
+		timeoutHandler.ServeHTTP(w, r)
+	})
 	server := &http.Server{
 		Addr:           serverAddr,
 		ReadTimeout:    HttpReadTimeout,
 		WriteTimeout:   HttpWriteTimeout,
 		MaxHeaderBytes: HttpMaxHeaderBytes,
-		Handler:        http.TimeoutHandler(gr, HttpTimeoutDuration, "Timeout"),
+		Handler:        mainHandler,
 	}
 	server.SetKeepAlivesEnabled(false)
 	log.Printf("Running main server on %s\n", serverAddr)
@@ -0,0 +1,291 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
+)
+
+const MainServerAddr = "127.0.0.1:1619"    // must match main-server.go
+const MainServerDevAddr = "127.0.0.1:8090" // must match main-server.go
+const WaveDirName = ".waveterm"            // must match scbase.go
+const WaveDevDirName = ".waveterm-dev"     // must match scbase.go
+const WaveAuthKeyFileName = "waveterm.authkey"
+
+const (
+	CmdStatusRunning  = "running"
+	CmdStatusDetached = "detached"
+	CmdStatusDone     = "done"
+)
+
+type waveClient struct {
+	ServerAddr string
+	AuthKey    string
+	HttpClient *http.Client
+}
+
+// subset of the sstore types returned by the api
+type cmdInfo struct {
+	ScreenId   string `json:"screenid"`
+	LineId     string `json:"lineid"`
+	CmdStr     string `json:"cmdstr"`
+	Status     string `json:"status"`
+	ExitCode   int    `json:"exitcode"`
+	DurationMs int    `json:"durationms"`
+}
+
+func (c *cmdInfo) isRunning() bool {
+	return c.Status == CmdStatusRunning || c.Status == CmdStatusDetached
+}
+
+type lineInfo struct {
+	ScreenId string `json:"screenid"`
+	LineId   string `json:"lineid"`
+	LineNum  int64  `json:"linenum"`
+	LineType string `json:"linetype"`
+	Ts       int64  `json:"ts"`
+	Text     string `json:"text,omitempty"`
+}
+
+// the "line" item in a model update
+type lineUpdateInfo struct {
+	Line *lineInfo `json:"line"`
+	Cmd  *cmdInfo  `json:"cmd"`
+}
+
+type screenInfo struct {
+	SessionId string `json:"sessionid"`
+	ScreenId  string `json:"screenid"`
+	Name      string `json:"name"`
+}
+
+type screenLinesInfo struct {
+	ScreenId string      `json:"screenid"`
+	Lines    []*lineInfo `json:"lines"`
+	Cmds     []*cmdInfo  `json:"cmds"`
+}
+
+type apiResponse struct {
+	Success bool            `json:"success"`
+	Error   string          `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// a model update is {"type": "model", "data": [{"[type]": {...}}, ...]}
+type modelUpdateResponse struct {
+	Type string                       `json:"type"`
+	Data []map[string]json.RawMessage `json:"data"`
+}
+
+func getWaveHomeDir(isDev bool) string {
+	if homeDir := os.Getenv("WAVETERM_HOME"); homeDir != "" {
+		return homeDir
+	}
+	dirName := WaveDirName
+	if isDev {
+		dirName = WaveDevDirName
+	}
+	return filepath.Join(os.Getenv("HOME"), dirName)
+}
+
+// $WAVETERM_AUTHKEY (the main auth key or an api token), otherwise the main auth key from the wave home dir
+func readAuthKey(isDev bool) (string, error) {
+	if authKey := os.Getenv("WAVETERM_AUTHKEY"); authKey != "" {
+		return authKey, nil
+	}
+	fileName := filepath.Join(getWaveHomeDir(isDev), WaveAuthKeyFileName)
+	barr, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("no auth key found (set WAVETERM_AUTHKEY or run wave to create %s)", fileName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read auth key %s: %v", fileName, err)
+	}
+	return strings.TrimSpace(string(barr)), nil
+}
+
+func (c *waveClient) makeRequest(ctx context.Context, method string, path string, qvals url.Values, body any) (*http.Response, error) {
+	urlStr := "http://" + c.ServerAddr + path
+	if len(qvals) > 0 {
+		urlStr = urlStr + "?" + qvals.Encode()
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		barr, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal request: %v", err)
+		}
+		bodyReader = bytes.NewReader(barr)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-AuthKey", c.AuthKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to wavesrv at %s (is wave running?): %v", c.ServerAddr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(errBody)))
+	}
+	return resp, nil
+}
+
+// for endpoints that return {"success": true, "data": ...} or {"error": ...}
+func (c *waveClient) doJsonRequest(ctx context.Context, method string, path string, qvals url.Values, body any, rtn any) error {
+	resp, err := c.makeRequest(ctx, method, path, qvals, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var apiResp apiResponse
+	err = json.NewDecoder(resp.Body).Decode(&apiResp)
+	if err != nil {
+		return fmt.Errorf("cannot decode %s response: %v", path, err)
+	}
+	if apiResp.Error != "" {
+		return errors.New(apiResp.Error)
+	}
+	if !apiResp.Success {
+		return fmt.Errorf("%s request failed", path)
+	}
+	if rtn == nil || len(apiResp.Data) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(apiResp.Data, rtn)
+	if err != nil {
+		return fmt.Errorf("cannot decode %s response data: %v", path, err)
+	}
+	return nil
+}
+
+func (c *waveClient) runCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (*modelUpdateResponse, error) {
+	var update modelUpdateResponse
+	err := c.doJsonRequest(ctx, http.MethodPost, "/api/run-command", nil, pk, &update)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// returns the first item of the given type in a model update (nil if not found)
+func getUpdateItem[T any](update *modelUpdateResponse, itemType string) (*T, error) {
+	for _, item := range update.Data {
+		raw, ok := item[itemType]
+		if !ok {
+			continue
+		}
+		var rtn T
+		err := json.Unmarshal(raw, &rtn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s update: %v", itemType, err)
+		}
+		return &rtn, nil
+	}
+	return nil, nil
+}
+
+// returns the info message (or error) from a model update, if any
+func getUpdateInfoStr(update *modelUpdateResponse) string {
+	type infoMsg struct {
+		InfoTitle string   `json:"infotitle"`
+		InfoError string   `json:"infoerror"`
+		InfoMsg   string   `json:"infomsg"`
+		InfoLines []string `json:"infolines"`
+	}
+	info, err := getUpdateItem[infoMsg](update, "info")
+	if err != nil || info == nil {
+		return ""
+	}
+	var parts []string
+	for _, str := range []string{info.InfoError, info.InfoTitle, info.InfoMsg} {
+		if str != "" {
+			parts = append(parts, str)
+		}
+	}
+	parts = append(parts, info.InfoLines...)
+	return strings.Join(parts, "\n")
+}
+
+func (c *waveClient) getScreenLines(ctx context.Context, screenId string) (*screenLinesInfo, error) {
+	var rtn screenLinesInfo
+	qvals := url.Values{}
+	qvals.Set("screenid", screenId)
+	err := c.doJsonRequest(ctx, http.MethodGet, "/api/get-screen-lines", qvals, nil, &rtn)
+	if err != nil {
+		return nil, err
+	}
+	return &rtn, nil
+}
+
+func (c *waveClient) getCmd(ctx context.Context, screenId string, lineId string) (*cmdInfo, error) {
+	screenLines, err := c.getScreenLines(ctx, screenId)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range screenLines.Cmds {
+		if cmd.LineId == lineId {
+			return cmd, nil
+		}
+	}
+	return nil, fmt.Errorf("command for line %s not found", lineId)
+}
+
+// returns (offset, data).  offset is the absolute pty offset of the start of data (the ptyout file is circular,
+// so the start of the output may no longer be available).  returns (0, nil) if there is no output yet.
+func (c *waveClient) getPtyOut(ctx context.Context, screenId string, lineId string) (int64, []byte, error) {
+	qvals := url.Values{}
+	qvals.Set("screenid", screenId)
+	qvals.Set("lineid", lineId)
+	resp, err := c.makeRequest(ctx, http.MethodGet, "/api/ptyout", qvals, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading ptyout: %v", err)
+	}
+	offsetStr := resp.Header.Get("X-PtyDataOffset")
+	if offsetStr == "" {
+		return 0, data, nil
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid ptydata offset %q", offsetStr)
+	}
+	return offset, data, nil
+}
+
+// returns the part of data (which starts at dataOffset) after printedOffset, and the new printed offset
+func getNewOutput(dataOffset int64, data []byte, printedOffset int64) ([]byte, int64) {
+	dataEnd := dataOffset + int64(len(data))
+	if dataEnd <= printedOffset {
+		return nil, printedOffset
+	}
+	if printedOffset <= dataOffset {
+		return data, dataEnd
+	}
+	return data[printedOffset-dataOffset:], dataEnd
+}
@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetNewOutput(t *testing.T) {
+	out, printed := getNewOutput(0, []byte("hello"), 0)
+	if string(out) != "hello" || printed != 5 {
+		t.Errorf("unexpected output %q %d", out, printed)
+	}
+	out, printed = getNewOutput(0, []byte("hello world"), printed)
+	if string(out) != " world" || printed != 11 {
+		t.Errorf("unexpected output %q %d", out, printed)
+	}
+	out, printed = getNewOutput(0, []byte("hello world"), printed)
+	if len(out) != 0 || printed != 11 {
+		t.Errorf("expected no new output, got %q %d", out, printed)
+	}
+	// circular file wrapped past what was printed
+	out, printed = getNewOutput(20, []byte("abc"), printed)
+	if string(out) != "abc" || printed != 23 {
+		t.Errorf("unexpected output %q %d", out, printed)
+	}
+}
+
+func TestGetUpdateItem(t *testing.T) {
+	var update modelUpdateResponse
+	err := json.Unmarshal([]byte(`{"type": "model", "data": [{"screen": {"screenid": "s1"}}, {"line": {"line": {"lineid": "l1"}, "cmd": {"lineid": "l1", "status": "running"}}}]}`), &update)
+	if err != nil {
+		t.Fatalf("error parsing update: %v", err)
+	}
+	lu, err := getUpdateItem[lineUpdateInfo](&update, "line")
+	if err != nil || lu == nil || lu.Line.LineId != "l1" || !lu.Cmd.isRunning() {
+		t.Errorf("unexpected line update %v %v", lu, err)
+	}
+	screen, err := getUpdateItem[screenInfo](&update, "screen")
+	if err != nil || screen == nil || screen.ScreenId != "s1" {
+		t.Errorf("unexpected screen update %v %v", screen, err)
+	}
+	info, _ := getUpdateItem[screenInfo](&update, "info")
+	if info != nil {
+		t.Errorf("expected no info update")
+	}
+}
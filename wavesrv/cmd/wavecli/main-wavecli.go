@@ -0,0 +1,402 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
+)
+
+// this is set from build/linker flags
+var BuildTime = "0"
+
+const PollInterval = 250 * time.Millisecond
+const RequestTimeout = 30 * time.Second
+
+// exit codes (otherwise the exit code of the command is returned)
+const (
+	ExitCodeError      = 1
+	ExitCodeUsage      = 2
+	ExitCodeTimeout    = 124 // matches timeout(1)
+	ExitCodeCmdNotDone = 255 // command ended without an exit code (error, hangup)
+)
+
+const ScreenEnvVar = "WAVECLI_SCREEN"
+
+var errTimeout = errors.New("timed out waiting for command")
+
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func handleUsage() {
+	usage := `
+wavecli drives a running wave terminal (wavesrv) from scripts.
+
+Usage:
+    wavecli [--dev] [--server addr] <command> [options]
+
+Commands:
+    screen:new [--session id] [--name name] [--activate]
+                            - creates a new screen (tab), prints its screenid (the session defaults to
+                              the active session, api tokens need the "run" scope and no screen restriction)
+    run [--screen id] [--remote name] [--timeout dur] [--nowait] [--quiet] -- <cmd>
+                            - runs <cmd> in a screen, prints its output, and exits with its exit code
+                              (--nowait prints the lineid and returns immediately)
+    wait [--screen id] --line id [--timeout dur]
+                            - waits for a command to finish, exits with its exit code
+    output [--screen id] --line id [--follow]
+                            - prints the output of a command (--follow keeps printing until it finishes)
+    lines [--screen id] [--json]
+                            - lists the commands in a screen
+    version                 - prints the wavecli version
+
+The screen defaults to $WAVECLI_SCREEN.  Requests are authenticated with $WAVETERM_AUTHKEY (the wave auth key
+or an api token from /apitoken:new), or the auth key in $WAVETERM_HOME.  wavecli exits with 124 on timeout and
+255 if a command ended without an exit code.
+`
+	fmt.Printf("%s\n\n", strings.TrimSpace(usage))
+}
+
+func makeCommandPacket(metaCmd string, args []string, kwargs map[string]string, sessionId string, screenId string) *scpacket.FeCommandPacketType {
+	pk := scpacket.MakeFeCommandPacket()
+	pk.MetaCmd, pk.MetaSubCmd, _ = strings.Cut(metaCmd, ":")
+	pk.Args = args
+	if kwargs != nil {
+		pk.Kwargs = kwargs
+	}
+	pk.UIContext = &scpacket.UIContextType{SessionId: sessionId, ScreenId: screenId}
+	return pk
+}
+
+func getScreenArg(screenArg string) (string, error) {
+	if screenArg == "" {
+		screenArg = os.Getenv(ScreenEnvVar)
+	}
+	if screenArg == "" {
+		return "", usageError{fmt.Sprintf("--screen is required (or set $%s)", ScreenEnvVar)}
+	}
+	return screenArg, nil
+}
+
+func withRequestTimeout(fn func(ctx context.Context) error) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancelFn()
+	return fn(ctx)
+}
+
+func cmdExitCode(cmd *cmdInfo) int {
+	if cmd.Status != CmdStatusDone {
+		fmt.Fprintf(os.Stderr, "wavecli: command ended with status %q\n", cmd.Status)
+		return ExitCodeCmdNotDone
+	}
+	return cmd.ExitCode
+}
+
+// polls until the command is no longer running (printing new output to stdout if printOutput is set).
+// timeout of 0 waits forever.
+func waitForCmd(client *waveClient, screenId string, lineId string, timeout time.Duration, printOutput bool) (*cmdInfo, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	var printedOffset int64
+	for {
+		var cmd *cmdInfo
+		err := withRequestTimeout(func(ctx context.Context) error {
+			var err error
+			cmd, err = client.getCmd(ctx, screenId, lineId)
+			if err != nil || !printOutput {
+				return err
+			}
+			dataOffset, data, err := client.getPtyOut(ctx, screenId, lineId)
+			if err != nil {
+				return err
+			}
+			var newOutput []byte
+			newOutput, printedOffset = getNewOutput(dataOffset, data, printedOffset)
+			os.Stdout.Write(newOutput)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !cmd.isRunning() {
+			return cmd, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, errTimeout
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+func screenNewCommand(client *waveClient, args []string) (int, error) {
+	flags := flag.NewFlagSet("screen:new", flag.ContinueOnError)
+	sessionId := flags.String("session", "", "session id (defaults to the active session)")
+	name := flags.String("name", "", "screen name")
+	activate := flags.Bool("activate", false, "switch the ui to the new screen")
+	err := flags.Parse(args)
+	if err != nil {
+		return ExitCodeUsage, nil
+	}
+	var screen *screenInfo
+	err = withRequestTimeout(func(ctx context.Context) error {
+		// without --session the server uses the active session
+		kwargs := map[string]string{"activate": fmt.Sprintf("%v", *activate)}
+		if *name != "" {
+			kwargs["name"] = *name
+		}
+		update, err := client.runCommand(ctx, makeCommandPacket("screen:open", nil, kwargs, *sessionId, ""))
+		if err != nil {
+			return err
+		}
+		screen, err = getUpdateItem[screenInfo](update, "screen")
+		if err != nil {
+			return err
+		}
+		if screen == nil {
+			return fmt.Errorf("no screen returned")
+		}
+		return nil
+	})
+	if err != nil {
+		return ExitCodeError, err
+	}
+	fmt.Printf("%s\n", screen.ScreenId)
+	return 0, nil
+}
+
+func runCommand(client *waveClient, args []string) (int, error) {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	screenArg := flags.String("screen", "", "screen id")
+	remoteArg := flags.String("remote", "local", "remote (connection) name")
+	timeout := flags.Duration("timeout", 0, "max time to wait for the command (0 for no timeout)")
+	noWait := flags.Bool("nowait", false, "print the lineid and return without waiting")
+	quiet := flags.Bool("quiet", false, "do not print the command's output")
+	err := flags.Parse(args)
+	if err != nil {
+		return ExitCodeUsage, nil
+	}
+	screenId, err := getScreenArg(*screenArg)
+	if err != nil {
+		return ExitCodeUsage, err
+	}
+	cmdStr := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if cmdStr == "" {
+		return ExitCodeUsage, usageError{"run requires a command"}
+	}
+	var lu *lineUpdateInfo
+	err = withRequestTimeout(func(ctx context.Context) error {
+		pk := makeCommandPacket("run", []string{cmdStr}, map[string]string{"remote": *remoteArg}, "", screenId)
+		pk.RawStr = cmdStr
+		update, err := client.runCommand(ctx, pk)
+		if err != nil {
+			return err
+		}
+		lu, err = getUpdateItem[lineUpdateInfo](update, "line")
+		if err != nil {
+			return err
+		}
+		if lu == nil || lu.Line == nil {
+			if infoStr := getUpdateInfoStr(update); infoStr != "" {
+				return errors.New(infoStr)
+			}
+			return fmt.Errorf("no line returned for command")
+		}
+		return nil
+	})
+	if err != nil {
+		return ExitCodeError, err
+	}
+	lineId := lu.Line.LineId
+	if *noWait {
+		fmt.Printf("%s\n", lineId)
+		return 0, nil
+	}
+	if lu.Cmd == nil || lu.Cmd.LineId == "" {
+		return 0, nil // not a command line
+	}
+	cmd, err := waitForCmd(client, screenId, lineId, *timeout, !*quiet)
+	if errors.Is(err, errTimeout) {
+		return ExitCodeTimeout, fmt.Errorf("%v (lineid %s)", err, lineId)
+	}
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return cmdExitCode(cmd), nil
+}
+
+func waitCommand(client *waveClient, args []string) (int, error) {
+	flags := flag.NewFlagSet("wait", flag.ContinueOnError)
+	screenArg := flags.String("screen", "", "screen id")
+	lineId := flags.String("line", "", "line id")
+	timeout := flags.Duration("timeout", 0, "max time to wait for the command (0 for no timeout)")
+	err := flags.Parse(args)
+	if err != nil {
+		return ExitCodeUsage, nil
+	}
+	screenId, err := getScreenArg(*screenArg)
+	if err != nil {
+		return ExitCodeUsage, err
+	}
+	if *lineId == "" {
+		return ExitCodeUsage, usageError{"--line is required"}
+	}
+	cmd, err := waitForCmd(client, screenId, *lineId, *timeout, false)
+	if errors.Is(err, errTimeout) {
+		return ExitCodeTimeout, err
+	}
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return cmdExitCode(cmd), nil
+}
+
+func outputCommand(client *waveClient, args []string) (int, error) {
+	flags := flag.NewFlagSet("output", flag.ContinueOnError)
+	screenArg := flags.String("screen", "", "screen id")
+	lineId := flags.String("line", "", "line id")
+	follow := flags.Bool("follow", false, "keep printing output until the command finishes")
+	err := flags.Parse(args)
+	if err != nil {
+		return ExitCodeUsage, nil
+	}
+	screenId, err := getScreenArg(*screenArg)
+	if err != nil {
+		return ExitCodeUsage, err
+	}
+	if *lineId == "" {
+		return ExitCodeUsage, usageError{"--line is required"}
+	}
+	if *follow {
+		cmd, err := waitForCmd(client, screenId, *lineId, 0, true)
+		if err != nil {
+			return ExitCodeError, err
+		}
+		return cmdExitCode(cmd), nil
+	}
+	err = withRequestTimeout(func(ctx context.Context) error {
+		_, data, err := client.getPtyOut(ctx, screenId, *lineId)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	})
+	if err != nil {
+		return ExitCodeError, err
+	}
+	return 0, nil
+}
+
+func linesCommand(client *waveClient, args []string) (int, error) {
+	flags := flag.NewFlagSet("lines", flag.ContinueOnError)
+	screenArg := flags.String("screen", "", "screen id")
+	jsonOutput := flags.Bool("json", false, "print json output")
+	err := flags.Parse(args)
+	if err != nil {
+		return ExitCodeUsage, nil
+	}
+	screenId, err := getScreenArg(*screenArg)
+	if err != nil {
+		return ExitCodeUsage, err
+	}
+	var screenLines *screenLinesInfo
+	err = withRequestTimeout(func(ctx context.Context) error {
+		screenLines, err = client.getScreenLines(ctx, screenId)
+		return err
+	})
+	if err != nil {
+		return ExitCodeError, err
+	}
+	cmdMap := make(map[string]*cmdInfo)
+	for _, cmd := range screenLines.Cmds {
+		cmdMap[cmd.LineId] = cmd
+	}
+	if *jsonOutput {
+		barr, err := json.MarshalIndent(screenLines.Cmds, "", "  ")
+		if err != nil {
+			return ExitCodeError, err
+		}
+		fmt.Printf("%s\n", barr)
+		return 0, nil
+	}
+	for _, line := range screenLines.Lines {
+		cmd := cmdMap[line.LineId]
+		if cmd == nil {
+			continue
+		}
+		exitStr := "-"
+		if cmd.Status == CmdStatusDone {
+			exitStr = fmt.Sprintf("%d", cmd.ExitCode)
+		}
+		fmt.Printf("%4d  %s  %-8s %4s  %s\n", line.LineNum, line.LineId, cmd.Status, exitStr, cmd.CmdStr)
+	}
+	return 0, nil
+}
+
+func main() {
+	globalFlags := flag.NewFlagSet("wavecli", flag.ContinueOnError)
+	isDev := globalFlags.Bool("dev", os.Getenv("WAVETERM_DEV") != "", "connect to the dev wavesrv")
+	serverAddr := globalFlags.String("server", "", "wavesrv address (host:port)")
+	globalFlags.Usage = handleUsage
+	err := globalFlags.Parse(os.Args[1:])
+	if err != nil || globalFlags.NArg() == 0 {
+		handleUsage()
+		os.Exit(ExitCodeUsage)
+	}
+	cmdName := globalFlags.Arg(0)
+	cmdArgs := globalFlags.Args()[1:]
+	if cmdName == "help" {
+		handleUsage()
+		return
+	}
+	if cmdName == "version" {
+		fmt.Printf("wavecli %s\n", BuildTime)
+		return
+	}
+	cmdFns := map[string]func(*waveClient, []string) (int, error){
+		"screen:new": screenNewCommand,
+		"run":        runCommand,
+		"wait":       waitCommand,
+		"output":     outputCommand,
+		"lines":      linesCommand,
+	}
+	cmdFn := cmdFns[cmdName]
+	if cmdFn == nil {
+		fmt.Fprintf(os.Stderr, "wavecli: unknown command %q (see wavecli --help)\n", cmdName)
+		os.Exit(ExitCodeUsage)
+	}
+	authKey, err := readAuthKey(*isDev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wavecli: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if *serverAddr == "" {
+		*serverAddr = MainServerAddr
+		if *isDev {
+			*serverAddr = MainServerDevAddr
+		}
+	}
+	client := &waveClient{ServerAddr: *serverAddr, AuthKey: authKey, HttpClient: &http.Client{}}
+	exitCode, err := cmdFn(client, cmdArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wavecli %s: %v\n", cmdName, err)
+	}
+	os.Exit(exitCode)
+}
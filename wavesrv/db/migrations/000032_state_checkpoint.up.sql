@@ -0,0 +1,10 @@
+CREATE TABLE state_checkpoint (
+    remoteid varchar(36) NOT NULL,
+    name varchar(50) NOT NULL,
+    ts bigint NOT NULL,
+    shelltype varchar(20) NOT NULL,
+    festate json NOT NULL,
+    statebasehash varchar(36) NOT NULL,
+    statediffhasharr json NOT NULL,
+    PRIMARY KEY (remoteid, name)
+);
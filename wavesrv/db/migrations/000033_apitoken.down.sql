@@ -0,0 +1,4 @@
+DROP INDEX idx_apitoken_audit_tokenid;
+DROP TABLE apitoken_audit;
+DROP INDEX idx_apitoken_tokenhash;
+DROP TABLE apitoken;
@@ -0,0 +1,22 @@
+CREATE TABLE apitoken (
+    tokenid varchar(36) PRIMARY KEY,
+    name varchar(50) NOT NULL,
+    tokenhash varchar(64) NOT NULL,
+    scope varchar(10) NOT NULL,
+    screenids json NOT NULL,
+    createdts bigint NOT NULL,
+    expirests bigint NOT NULL,
+    lastusedts bigint NOT NULL,
+    revoked boolean NOT NULL
+);
+CREATE UNIQUE INDEX idx_apitoken_tokenhash ON apitoken (tokenhash);
+CREATE TABLE apitoken_audit (
+    auditid integer PRIMARY KEY,
+    tokenid varchar(36) NOT NULL,
+    ts bigint NOT NULL,
+    endpoint varchar(100) NOT NULL,
+    screenid varchar(36) NOT NULL,
+    allowed boolean NOT NULL,
+    detail varchar(200) NOT NULL
+);
+CREATE INDEX idx_apitoken_audit_tokenid ON apitoken_audit (tokenid, ts);
@@ -0,0 +1 @@
+ALTER TABLE remote DROP COLUMN connectcmd;
@@ -0,0 +1 @@
+ALTER TABLE remote ADD COLUMN connectcmd varchar(300) NOT NULL DEFAULT '';
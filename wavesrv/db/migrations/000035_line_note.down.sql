@@ -0,0 +1,2 @@
+ALTER TABLE line DROP COLUMN note;
+ALTER TABLE line DROP COLUMN notets;
@@ -0,0 +1,2 @@
+ALTER TABLE line ADD COLUMN note text NOT NULL DEFAULT '';
+ALTER TABLE line ADD COLUMN notets bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE trash (
+    trashid varchar(36) PRIMARY KEY,
+    itemtype varchar(10) NOT NULL,
+    sessionid varchar(36) NOT NULL,
+    screenid varchar(36) NOT NULL,
+    description varchar(200) NOT NULL,
+    numlines int NOT NULL,
+    deletedts bigint NOT NULL,
+    data blob NOT NULL
+);
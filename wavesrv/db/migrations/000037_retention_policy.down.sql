@@ -0,0 +1 @@
+DROP TABLE retention_policy;
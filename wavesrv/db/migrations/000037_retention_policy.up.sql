@@ -0,0 +1,6 @@
+CREATE TABLE retention_policy (
+    sessionid varchar(36) PRIMARY KEY,
+    outputdays int NOT NULL,
+    maxoutputsize bigint NOT NULL,
+    historydays int NOT NULL
+);
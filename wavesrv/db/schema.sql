@@ -56,7 +56,7 @@ CREATE TABLE remote (
     local boolean NOT NULL,
     archived boolean NOT NULL,
     remoteidx int NOT NULL
-, statevars json NOT NULL DEFAULT '{}', openaiopts json NOT NULL DEFAULT '{}', sshconfigsrc varchar(36) NOT NULL DEFAULT 'waveterm-manual', shellpref varchar(20) NOT NULL DEFAULT 'detect');
+, statevars json NOT NULL DEFAULT '{}', openaiopts json NOT NULL DEFAULT '{}', sshconfigsrc varchar(36) NOT NULL DEFAULT 'waveterm-manual', shellpref varchar(20) NOT NULL DEFAULT 'detect', connectcmd varchar(300) NOT NULL DEFAULT '');
 CREATE TABLE history (
     historyid varchar(36) PRIMARY KEY,
     ts bigint NOT NULL,
@@ -162,7 +162,7 @@ CREATE TABLE IF NOT EXISTS "line" (
     contentheight int NOT NULL,
     star int NOT NULL,
     archived boolean NOT NULL,
-    renderer varchar(50) NOT NULL, linestate json NOT NULL DEFAULT '{}',
+    renderer varchar(50) NOT NULL, linestate json NOT NULL DEFAULT '{}', note text NOT NULL DEFAULT '', notets bigint NOT NULL DEFAULT 0,
     PRIMARY KEY (screenid, lineid)
 );
 CREATE TABLE screenupdate (
@@ -222,3 +222,51 @@ CREATE TABLE screen_tombstone (
     screenopts json NOT NULL,
     name varchar(50) NOT NULL
 );
+CREATE TABLE state_checkpoint (
+    remoteid varchar(36) NOT NULL,
+    name varchar(50) NOT NULL,
+    ts bigint NOT NULL,
+    shelltype varchar(20) NOT NULL,
+    festate json NOT NULL,
+    statebasehash varchar(36) NOT NULL,
+    statediffhasharr json NOT NULL,
+    PRIMARY KEY (remoteid, name)
+);
+CREATE TABLE apitoken (
+    tokenid varchar(36) PRIMARY KEY,
+    name varchar(50) NOT NULL,
+    tokenhash varchar(64) NOT NULL,
+    scope varchar(10) NOT NULL,
+    screenids json NOT NULL,
+    createdts bigint NOT NULL,
+    expirests bigint NOT NULL,
+    lastusedts bigint NOT NULL,
+    revoked boolean NOT NULL
+);
+CREATE UNIQUE INDEX idx_apitoken_tokenhash ON apitoken (tokenhash);
+CREATE TABLE apitoken_audit (
+    auditid integer PRIMARY KEY,
+    tokenid varchar(36) NOT NULL,
+    ts bigint NOT NULL,
+    endpoint varchar(100) NOT NULL,
+    screenid varchar(36) NOT NULL,
+    allowed boolean NOT NULL,
+    detail varchar(200) NOT NULL
+);
+CREATE INDEX idx_apitoken_audit_tokenid ON apitoken_audit (tokenid, ts);
+CREATE TABLE trash (
+    trashid varchar(36) PRIMARY KEY,
+    itemtype varchar(10) NOT NULL,
+    sessionid varchar(36) NOT NULL,
+    screenid varchar(36) NOT NULL,
+    description varchar(200) NOT NULL,
+    numlines int NOT NULL,
+    deletedts bigint NOT NULL,
+    data blob NOT NULL
+);
+CREATE TABLE retention_policy (
+    sessionid varchar(36) PRIMARY KEY,
+    outputdays int NOT NULL,
+    maxoutputsize bigint NOT NULL,
+    historydays int NOT NULL
+);
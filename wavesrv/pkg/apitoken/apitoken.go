@@ -0,0 +1,363 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/dbutil"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// scoped api tokens for external automation (minted with /apitoken:new).  tokens are only stored as a sha256 hash.
+// scopes are ordered (read < run < admin):
+//
+//	read  - read-only endpoints (ptyout, rtnstate, screen lines, read-file, config)
+//	run   - read + /api/run-command (only /run, /eval, /comment, /signal, and /screen:open) and /api/run-ephemeral-command
+//	admin - everything except managing api tokens (which always requires the main auth key)
+//
+// a token can optionally be restricted to a list of screens.
+
+const (
+	ScopeRead  = "read"
+	ScopeRun   = "run"
+	ScopeAdmin = "admin"
+)
+
+const TokenPrefix = "wave_"
+const tokenRandomBytes = 24
+const MaxAuditDetailLen = 200
+const AuditRetention = 30 * 24 * time.Hour
+const MaxAuditRows = 10000
+const AuditFlushDelay = 5 * time.Second
+const MaxPendingAudit = 100
+
+var scopeLevels = map[string]int{
+	ScopeRead:  1,
+	ScopeRun:   2,
+	ScopeAdmin: 3,
+}
+
+var AllScopes = []string{ScopeRead, ScopeRun, ScopeAdmin}
+
+// metacmds allowed with "run" scope (eval is re-checked once the command string has been parsed)
+var runScopeCmds = map[string]bool{
+	"run":     true,
+	"eval":    true,
+	"comment": true,
+	"signal":  true,
+	// creates screens (wavecli screen:new), screen-restricted tokens are rejected (no screen)
+	"screen:open": true,
+	"screen:new":  true,
+}
+
+type ApiTokenType struct {
+	TokenId    string   `json:"tokenid"`
+	Name       string   `json:"name"`
+	TokenHash  string   `json:"-"`
+	Scope      string   `json:"scope"`
+	ScreenIds  []string `json:"screenids"`
+	CreatedTs  int64    `json:"createdts"`
+	ExpiresTs  int64    `json:"expirests"` // 0 for never
+	LastUsedTs int64    `json:"lastusedts"`
+	Revoked    bool     `json:"revoked"`
+}
+
+func (ApiTokenType) UseDBMap() {}
+
+type ApiTokenAuditType struct {
+	AuditId  int64  `json:"auditid"`
+	TokenId  string `json:"tokenid"`
+	Ts       int64  `json:"ts"`
+	Endpoint string `json:"endpoint"`
+	ScreenId string `json:"screenid"`
+	Allowed  bool   `json:"allowed"`
+	Detail   string `json:"detail"`
+}
+
+func (ApiTokenAuditType) UseDBMap() {}
+
+type apiTokenCtxKey struct{}
+
+func IsValidScope(scope string) bool {
+	return scopeLevels[scope] > 0
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// returns (token, tokenhash).  the token itself is only shown to the user once.
+func GenerateToken() (string, string, error) {
+	barr := make([]byte, tokenRandomBytes)
+	_, err := rand.Read(barr)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot generate token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(barr)
+	return token, HashToken(token), nil
+}
+
+func LooksLikeToken(str string) bool {
+	return strings.HasPrefix(str, TokenPrefix)
+}
+
+func (t *ApiTokenType) IsExpired(now time.Time) bool {
+	return t.ExpiresTs > 0 && now.UnixMilli() >= t.ExpiresTs
+}
+
+func (t *ApiTokenType) Status(now time.Time) string {
+	if t.Revoked {
+		return "revoked"
+	}
+	if t.IsExpired(now) {
+		return "expired"
+	}
+	return "active"
+}
+
+// checks that the token is usable and grants at least requiredScope
+func (t *ApiTokenType) CheckScope(requiredScope string, now time.Time) error {
+	if t.Revoked {
+		return fmt.Errorf("api token has been revoked")
+	}
+	if t.IsExpired(now) {
+		return fmt.Errorf("api token has expired")
+	}
+	if scopeLevels[t.Scope] < scopeLevels[requiredScope] {
+		return fmt.Errorf("api token scope %q does not allow this request (requires %q)", t.Scope, requiredScope)
+	}
+	return nil
+}
+
+// an empty screenId is only allowed for tokens that are not restricted to screens
+func (t *ApiTokenType) CheckScreen(screenId string) error {
+	if len(t.ScreenIds) == 0 {
+		return nil
+	}
+	if screenId == "" {
+		return fmt.Errorf("api token is restricted to specific screens, request must specify a screen")
+	}
+	if !utilfn.ContainsStr(t.ScreenIds, screenId) {
+		return fmt.Errorf("api token does not have access to screen %s", screenId)
+	}
+	return nil
+}
+
+// cmdName is "metacmd" or "metacmd:subcmd"
+func (t *ApiTokenType) CheckCommand(cmdName string, screenId string) error {
+	metaCmd, _, _ := strings.Cut(cmdName, ":")
+	if metaCmd == "apitoken" {
+		return fmt.Errorf("api tokens cannot manage api tokens")
+	}
+	if t.Scope != ScopeAdmin && !runScopeCmds[cmdName] {
+		return fmt.Errorf("api token scope %q does not allow /%s", t.Scope, cmdName)
+	}
+	return t.CheckScreen(screenId)
+}
+
+func WithToken(ctx context.Context, token *ApiTokenType) context.Context {
+	return context.WithValue(ctx, apiTokenCtxKey{}, token)
+}
+
+// returns nil if the request was not authenticated with an api token
+func FromContext(ctx context.Context) *ApiTokenType {
+	token, _ := ctx.Value(apiTokenCtxKey{}).(*ApiTokenType)
+	return token
+}
+
+func InsertToken(ctx context.Context, token *ApiTokenType) error {
+	return sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+		query := `SELECT tokenid FROM apitoken WHERE name = ? AND NOT revoked`
+		if tx.Exists(query, token.Name) {
+			return fmt.Errorf("an active api token named %q already exists", token.Name)
+		}
+		query = `INSERT INTO apitoken ( tokenid, name, tokenhash, scope, screenids, createdts, expirests, lastusedts, revoked)
+                               VALUES (:tokenid,:name,:tokenhash,:scope,:screenids,:createdts,:expirests,:lastusedts,:revoked)`
+		tx.NamedExec(query, dbutil.ToDBMap(token, false))
+		return nil
+	})
+}
+
+// returns nil if no token matches
+func GetTokenByHash(ctx context.Context, tokenHash string) (*ApiTokenType, error) {
+	return sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) (*ApiTokenType, error) {
+		query := `SELECT * FROM apitoken WHERE tokenhash = ?`
+		return dbutil.GetMappable[*ApiTokenType](tx, query, tokenHash), nil
+	})
+}
+
+func GetTokens(ctx context.Context) ([]*ApiTokenType, error) {
+	err := FlushAudit(ctx) // for up to date lastusedts values
+	if err != nil {
+		return nil, err
+	}
+	return sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) ([]*ApiTokenType, error) {
+		query := `SELECT * FROM apitoken ORDER BY createdts`
+		return dbutil.SelectMappable[*ApiTokenType](tx, query), nil
+	})
+}
+
+// tokenArg is a name (of an active token), a tokenid, or a tokenid prefix (8 chars)
+func ResolveToken(ctx context.Context, tokenArg string) (*ApiTokenType, error) {
+	return sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) (*ApiTokenType, error) {
+		query := `SELECT * FROM apitoken WHERE name = ? AND NOT revoked`
+		token := dbutil.GetMappable[*ApiTokenType](tx, query, tokenArg)
+		if token != nil {
+			return token, nil
+		}
+		if len(tokenArg) == 8 {
+			query = `SELECT * FROM apitoken WHERE tokenid LIKE (? || '%')`
+		} else {
+			query = `SELECT * FROM apitoken WHERE tokenid = ?`
+		}
+		tokens := dbutil.SelectMappable[*ApiTokenType](tx, query, tokenArg)
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("api token %q not found", tokenArg)
+		}
+		if len(tokens) > 1 {
+			return nil, fmt.Errorf("api token %q is ambiguous", tokenArg)
+		}
+		return tokens[0], nil
+	})
+}
+
+func RevokeToken(ctx context.Context, tokenId string) error {
+	return sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+		query := `UPDATE apitoken SET revoked = 1 WHERE tokenid = ?`
+		tx.Exec(query, tokenId)
+		return nil
+	})
+}
+
+// audit entries are buffered and written in batches (every AuditFlushDelay or MaxPendingAudit entries),
+// so authenticated requests do not each write to the db
+var auditLock = &sync.Mutex{}
+var pendingAudit []*ApiTokenAuditType
+var auditFlushTimer *time.Timer
+
+// records a use of a token (and updates its lastusedts if it was allowed) in the next audit flush
+func RecordUse(ctx context.Context, token *ApiTokenType, endpoint string, screenId string, allowed bool, detail string) error {
+	audit := &ApiTokenAuditType{
+		TokenId:  token.TokenId,
+		Ts:       time.Now().UnixMilli(),
+		Endpoint: endpoint,
+		ScreenId: screenId,
+		Allowed:  allowed,
+		Detail:   utilfn.EllipsisStr(detail, MaxAuditDetailLen),
+	}
+	auditLock.Lock()
+	pendingAudit = append(pendingAudit, audit)
+	numPending := len(pendingAudit)
+	if auditFlushTimer == nil && numPending < MaxPendingAudit {
+		auditFlushTimer = time.AfterFunc(AuditFlushDelay, func() {
+			ctx, cancelFn := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancelFn()
+			err := FlushAudit(ctx)
+			if err != nil {
+				log.Printf("[error] flushing api token audit: %v\n", err)
+			}
+		})
+	}
+	auditLock.Unlock()
+	if numPending >= MaxPendingAudit {
+		return FlushAudit(ctx)
+	}
+	return nil
+}
+
+// writes the pending audit entries and token lastusedts values, trims old audit entries
+func FlushAudit(ctx context.Context) error {
+	auditLock.Lock()
+	audits := pendingAudit
+	pendingAudit = nil
+	if auditFlushTimer != nil {
+		auditFlushTimer.Stop()
+		auditFlushTimer = nil
+	}
+	auditLock.Unlock()
+	if len(audits) == 0 {
+		return nil
+	}
+	lastUsed := make(map[string]int64)
+	for _, audit := range audits {
+		if audit.Allowed && audit.Ts > lastUsed[audit.TokenId] {
+			lastUsed[audit.TokenId] = audit.Ts
+		}
+	}
+	return sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+		query := `INSERT INTO apitoken_audit ( tokenid, ts, endpoint, screenid, allowed, detail)
+                                     VALUES (:tokenid,:ts,:endpoint,:screenid,:allowed,:detail)`
+		for _, audit := range audits {
+			tx.NamedExec(query, dbutil.ToDBMap(audit, false))
+		}
+		for tokenId, ts := range lastUsed {
+			query = `UPDATE apitoken SET lastusedts = max(lastusedts, ?) WHERE tokenid = ?`
+			tx.Exec(query, ts, tokenId)
+		}
+		query = `DELETE FROM apitoken_audit WHERE ts < ? OR auditid <= (SELECT max(auditid) FROM apitoken_audit) - ?`
+		tx.Exec(query, time.Now().Add(-AuditRetention).UnixMilli(), MaxAuditRows)
+		return nil
+	})
+}
+
+// most recent first, tokenId may be empty for all tokens
+func GetAudit(ctx context.Context, tokenId string, maxItems int) ([]*ApiTokenAuditType, error) {
+	err := FlushAudit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) ([]*ApiTokenAuditType, error) {
+		if tokenId == "" {
+			query := `SELECT * FROM apitoken_audit ORDER BY auditid DESC LIMIT ?`
+			return dbutil.SelectMappable[*ApiTokenAuditType](tx, query, maxItems), nil
+		}
+		query := `SELECT * FROM apitoken_audit WHERE tokenid = ? ORDER BY auditid DESC LIMIT ?`
+		return dbutil.SelectMappable[*ApiTokenAuditType](tx, query, tokenId, maxItems), nil
+	})
+}
+
+// looks up a token (by its hash) from a request header value, returns an error if it does not exist
+func Authenticate(ctx context.Context, tokenStr string) (*ApiTokenType, error) {
+	if !LooksLikeToken(tokenStr) {
+		return nil, fmt.Errorf("invalid auth key")
+	}
+	token, err := GetTokenByHash(ctx, HashToken(tokenStr))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("invalid api token")
+	}
+	return token, nil
+}
+
+// creates a new (not yet inserted) token, returns the token and its secret (which is not stored)
+func MakeToken(name string, scope string, screenIds []string, expiresTs int64) (*ApiTokenType, string, error) {
+	tokenStr, tokenHash, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := &ApiTokenType{
+		TokenId:   scbase.GenWaveUUID(),
+		Name:      name,
+		TokenHash: tokenHash,
+		Scope:     scope,
+		ScreenIds: screenIds,
+		CreatedTs: time.Now().UnixMilli(),
+		ExpiresTs: expiresTs,
+	}
+	return token, tokenStr, nil
+}
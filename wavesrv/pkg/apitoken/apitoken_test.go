@@ -0,0 +1,79 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package apitoken
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, hash, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	if !LooksLikeToken(token) || len(token) != len(TokenPrefix)+tokenRandomBytes*2 {
+		t.Errorf("invalid token format %q", token)
+	}
+	if hash != HashToken(token) || hash == token {
+		t.Errorf("invalid token hash %q", hash)
+	}
+	token2, _, _ := GenerateToken()
+	if token == token2 {
+		t.Errorf("tokens should be unique")
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	now := time.Now()
+	token := &ApiTokenType{Scope: ScopeRun}
+	if err := token.CheckScope(ScopeRead, now); err != nil {
+		t.Errorf("run scope should allow read: %v", err)
+	}
+	if err := token.CheckScope(ScopeRun, now); err != nil {
+		t.Errorf("run scope should allow run: %v", err)
+	}
+	if err := token.CheckScope(ScopeAdmin, now); err == nil {
+		t.Errorf("run scope should not allow admin")
+	}
+	token.ExpiresTs = now.Add(-time.Minute).UnixMilli()
+	if err := token.CheckScope(ScopeRead, now); err == nil || token.Status(now) != "expired" {
+		t.Errorf("expired token should not be allowed")
+	}
+	token.ExpiresTs = 0
+	token.Revoked = true
+	if err := token.CheckScope(ScopeRead, now); err == nil || token.Status(now) != "revoked" {
+		t.Errorf("revoked token should not be allowed")
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	token := &ApiTokenType{Scope: ScopeRun, ScreenIds: []string{"screen-a"}}
+	if err := token.CheckCommand("run", "screen-a"); err != nil {
+		t.Errorf("run scope should allow /run: %v", err)
+	}
+	if err := token.CheckCommand("run", "screen-b"); err == nil {
+		t.Errorf("token should not allow other screens")
+	}
+	if err := token.CheckCommand("run", ""); err == nil {
+		t.Errorf("screen-restricted token should require a screen")
+	}
+	if err := token.CheckCommand("remote:new", "screen-a"); err == nil {
+		t.Errorf("run scope should not allow /remote:new")
+	}
+	if err := token.CheckCommand("screen:open", ""); err == nil {
+		t.Errorf("screen-restricted token should not create screens")
+	}
+	unrestricted := &ApiTokenType{Scope: ScopeRun}
+	if err := unrestricted.CheckCommand("screen:open", ""); err != nil {
+		t.Errorf("run scope should allow /screen:open: %v", err)
+	}
+	admin := &ApiTokenType{Scope: ScopeAdmin}
+	if err := admin.CheckCommand("remote:new", ""); err != nil {
+		t.Errorf("admin scope should allow /remote:new: %v", err)
+	}
+	if err := admin.CheckCommand("apitoken:new", ""); err == nil {
+		t.Errorf("tokens should never be able to manage tokens")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/dbutil"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
 )
@@ -100,15 +101,24 @@ func GetBookmarkById(ctx context.Context, bookmarkId string, tag string) (*Bookm
 	return rtn, nil
 }
 
+// bookmarkArg can be an alias, a full bookmark id, or the first 8 characters of the id
 func GetBookmarkIdByArg(ctx context.Context, bookmarkArg string) (string, error) {
 	var rtnId string
 	txErr := sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+		if bookmarkArg == "" {
+			return nil
+		}
+		query := `SELECT bookmarkid FROM bookmark WHERE alias = ?`
+		rtnId = tx.GetString(query, bookmarkArg)
+		if rtnId != "" {
+			return nil
+		}
 		if len(bookmarkArg) == 8 {
 			query := `SELECT bookmarkid FROM bookmark WHERE bookmarkid LIKE (? || '%')`
 			rtnId = tx.GetString(query, bookmarkArg)
 			return nil
 		}
-		query := `SELECT bookmarkid FROM bookmark WHERE bookmarkid = ?`
+		query = `SELECT bookmarkid FROM bookmark WHERE bookmarkid = ?`
 		rtnId = tx.GetString(query, bookmarkArg)
 		return nil
 	})
@@ -153,6 +163,8 @@ func InsertBookmark(ctx context.Context, bm *BookmarkType) error {
 const (
 	BookmarkField_Desc   = "desc"
 	BookmarkField_CmdStr = "cmdstr"
+	BookmarkField_Alias  = "alias" // "" removes the alias
+	BookmarkField_Tags   = "tags"  // []string, replaces the current tags
 )
 
 func EditBookmark(ctx context.Context, bookmarkId string, editMap map[string]interface{}) error {
@@ -169,6 +181,40 @@ func EditBookmark(ctx context.Context, bookmarkId string, editMap map[string]int
 			query = `UPDATE bookmark SET cmdstr = ? WHERE bookmarkid = ?`
 			tx.Exec(query, cmdStr, bookmarkId)
 		}
+		if alias, found := editMap[BookmarkField_Alias]; found {
+			query = `SELECT bookmarkid FROM bookmark WHERE alias = ? AND alias <> '' AND bookmarkid <> ?`
+			if tx.Exists(query, alias, bookmarkId) {
+				return fmt.Errorf("bookmark alias %q is already in use", alias)
+			}
+			query = `UPDATE bookmark SET alias = ? WHERE bookmarkid = ?`
+			tx.Exec(query, alias, bookmarkId)
+		}
+		if tagsVal, found := editMap[BookmarkField_Tags]; found {
+			tags, ok := tagsVal.([]string)
+			if !ok {
+				return fmt.Errorf("invalid tags value (must be a list of strings)")
+			}
+			query = `UPDATE bookmark SET tags = ? WHERE bookmarkid = ?`
+			tx.Exec(query, dbutil.QuickJsonArr(tags), bookmarkId)
+			query = `SELECT tag FROM bookmark_order WHERE bookmarkid = ? AND tag <> ''`
+			curTags := tx.SelectStrings(query, bookmarkId)
+			for _, tag := range curTags {
+				if !utilfn.ContainsStr(tags, tag) {
+					query = `DELETE FROM bookmark_order WHERE bookmarkid = ? AND tag = ?`
+					tx.Exec(query, bookmarkId, tag)
+				}
+			}
+			for _, tag := range tags {
+				if tag == "" || utilfn.ContainsStr(curTags, tag) {
+					continue
+				}
+				query = `SELECT COALESCE(max(orderidx), 0) FROM bookmark_order WHERE tag = ?`
+				maxOrder := tx.GetInt(query, tag)
+				query = `INSERT INTO bookmark_order (tag, bookmarkid, orderidx) VALUES (?, ?, ?)`
+				tx.Exec(query, tag, bookmarkId, maxOrder+1)
+			}
+			fixupBookmarkOrder(tx)
+		}
 		return nil
 	})
 	return txErr
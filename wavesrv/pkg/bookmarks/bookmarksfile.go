@@ -0,0 +1,424 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package bookmarks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// bookmarks are mirrored to [config]/bookmarks.json.  edits made in the app rewrite the file, and edits
+// to the file (picked up by the config watcher) are applied to the bookmark table.  the file can be kept
+// in a shared (git) repository, hand-written entries can use any id (it does not need to be a uuid).
+//
+//	{"bookmarks": [{"id": "deploy-prod", "cmdstr": "make deploy ENV=prod", "alias": "deploy", "desc": "...", "tags": ["ops"]}]}
+//
+// the last synced version of the file is kept in [home]/bookmarks-sync.json and used as the base of a
+// three-way merge.  a bookmark that changed in the file is applied to the DB, a bookmark that changed in
+// the DB is written to the file.  if a bookmark changed in both (to different values) the DB version is
+// kept and the conflict is reported.  removing the file does not remove any bookmarks (it is re-created),
+// and the order of the entries in the file is not synced (new entries are added at the end).
+
+const BookmarksFileName = "bookmarks.json"
+const BookmarksSyncStateFileName = "bookmarks-sync.json"
+const BookmarksFileTimeout = 10 * time.Second
+const maxBookmarkIdLen = 50
+const maxBookmarkAliasLen = 50
+const maxBookmarkCmdStrLen = 4096
+
+var bookmarksFileIdRe = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9._-]*$")
+var bookmarksFileAliasRe = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9._-]*$")
+
+// syncs are serialized (file events and app edits can happen at the same time)
+var bookmarksFileLock = &sync.Mutex{}
+
+type BookmarksFileType struct {
+	Bookmarks []*BookmarksFileEntryType `json:"bookmarks"`
+}
+
+type BookmarksFileEntryType struct {
+	Id     string   `json:"id"`
+	CmdStr string   `json:"cmdstr"`
+	Alias  string   `json:"alias,omitempty"`
+	Desc   string   `json:"desc,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+type BookmarksSyncResultType struct {
+	Updated   []*BookmarkType // bookmarks created or edited from the file
+	Removed   []string        // bookmark ids removed from the file
+	Conflicts []string
+}
+
+func init() {
+	configstore.RegisterConfigHandler(BookmarksFileName, func(relPath string, removed bool) {
+		if removed {
+			// editors often save by renaming, the file will be synced when it is re-created
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), BookmarksFileTimeout)
+		defer cancelFn()
+		result, err := SyncBookmarksFile(ctx)
+		update := scbus.MakeUpdatePacket()
+		if err != nil {
+			log.Printf("error syncing %s: %v\n", BookmarksFileName, err)
+			update.AddUpdate(sstore.InfoMsgType{InfoError: fmt.Sprintf("error loading %s: %v", BookmarksFileName, err)})
+			scbus.MainUpdateBus.DoUpdate(update)
+			return
+		}
+		if !result.AddToUpdate(update) {
+			return
+		}
+		scbus.MainUpdateBus.DoUpdate(update)
+	})
+}
+
+// returns false if there is nothing to send
+func (result *BookmarksSyncResultType) AddToUpdate(update *scbus.ModelUpdatePacketType) bool {
+	if result == nil || (len(result.Updated) == 0 && len(result.Removed) == 0 && len(result.Conflicts) == 0) {
+		return false
+	}
+	bms := append([]*BookmarkType{}, result.Updated...)
+	for _, bookmarkId := range result.Removed {
+		bms = append(bms, &BookmarkType{BookmarkId: bookmarkId, Remove: true})
+	}
+	if len(bms) > 0 {
+		AddBookmarksUpdate(update, bms, nil)
+	}
+	if len(result.Conflicts) > 0 {
+		update.AddUpdate(sstore.InfoMsgType{
+			InfoTitle: fmt.Sprintf("%s conflicts (kept the app version)", BookmarksFileName),
+			InfoLines: result.Conflicts,
+		})
+	}
+	return true
+}
+
+func (entry *BookmarksFileEntryType) Validate() error {
+	if entry.Id == "" {
+		return fmt.Errorf("id is required")
+	}
+	if len(entry.Id) > maxBookmarkIdLen || !bookmarksFileIdRe.MatchString(entry.Id) {
+		return fmt.Errorf("invalid id %q", entry.Id)
+	}
+	if entry.CmdStr == "" {
+		return fmt.Errorf("cmdstr is required")
+	}
+	if len(entry.CmdStr) > maxBookmarkCmdStrLen {
+		return fmt.Errorf("cmdstr too long, max length = %d", maxBookmarkCmdStrLen)
+	}
+	if entry.Alias != "" {
+		if len(entry.Alias) > maxBookmarkAliasLen {
+			return fmt.Errorf("alias %q too long, max length = %d", entry.Alias, maxBookmarkAliasLen)
+		}
+		if !bookmarksFileAliasRe.MatchString(entry.Alias) {
+			return fmt.Errorf("invalid alias format %q", entry.Alias)
+		}
+	}
+	for _, tag := range entry.Tags {
+		if tag == "" {
+			return fmt.Errorf("invalid empty tag")
+		}
+	}
+	return nil
+}
+
+func (entry *BookmarksFileEntryType) Equals(other *BookmarksFileEntryType) bool {
+	if entry == nil || other == nil {
+		return entry == other
+	}
+	if entry.Id != other.Id || entry.CmdStr != other.CmdStr || entry.Alias != other.Alias || entry.Desc != other.Desc {
+		return false
+	}
+	if len(entry.Tags) != len(other.Tags) {
+		return false
+	}
+	for idx, tag := range entry.Tags {
+		if other.Tags[idx] != tag {
+			return false
+		}
+	}
+	return true
+}
+
+func makeBookmarksFileEntry(bm *BookmarkType) *BookmarksFileEntryType {
+	entry := &BookmarksFileEntryType{
+		Id:     bm.BookmarkId,
+		CmdStr: bm.CmdStr,
+		Alias:  bm.Alias,
+		Desc:   bm.Description,
+	}
+	if len(bm.Tags) > 0 {
+		entry.Tags = bm.Tags
+	}
+	return entry
+}
+
+// validates all entries, duplicate ids and aliases are errors
+func ParseBookmarksFile(barr []byte) (*BookmarksFileType, error) {
+	var rtn BookmarksFileType
+	err := json.Unmarshal(barr, &rtn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	seenIds := make(map[string]bool)
+	seenAliases := make(map[string]bool)
+	for idx, entry := range rtn.Bookmarks {
+		if entry == nil {
+			return nil, fmt.Errorf("bookmark #%d: invalid (null) entry", idx+1)
+		}
+		err = entry.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("bookmark #%d: %v", idx+1, err)
+		}
+		if seenIds[entry.Id] {
+			return nil, fmt.Errorf("bookmark #%d: duplicate id %q", idx+1, entry.Id)
+		}
+		seenIds[entry.Id] = true
+		if entry.Alias != "" {
+			if seenAliases[entry.Alias] {
+				return nil, fmt.Errorf("bookmark #%d: duplicate alias %q", idx+1, entry.Alias)
+			}
+			seenAliases[entry.Alias] = true
+		}
+	}
+	return &rtn, nil
+}
+
+func (bf *BookmarksFileType) entryMap() map[string]*BookmarksFileEntryType {
+	rtn := make(map[string]*BookmarksFileEntryType)
+	if bf == nil {
+		return rtn
+	}
+	for _, entry := range bf.Bookmarks {
+		rtn[entry.Id] = entry
+	}
+	return rtn
+}
+
+func (bf *BookmarksFileType) Marshal() ([]byte, error) {
+	if bf.Bookmarks == nil {
+		bf.Bookmarks = []*BookmarksFileEntryType{}
+	}
+	barr, err := json.MarshalIndent(bf, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(barr, '\n'), nil
+}
+
+type bookmarksMergeOpType struct {
+	BookmarkId string
+	Entry      *BookmarksFileEntryType // nil to remove the bookmark
+	IsNew      bool
+}
+
+// three-way merge of the file and the DB against the last synced version (base).
+// returns the operations to apply to the DB and the conflicts (in both cases the DB version wins).
+// entries that only changed in the DB need no operation (the file is rewritten from the DB).
+func mergeBookmarks(base map[string]*BookmarksFileEntryType, file map[string]*BookmarksFileEntryType, db map[string]*BookmarksFileEntryType) ([]bookmarksMergeOpType, []string) {
+	idMap := make(map[string]bool)
+	for _, m := range []map[string]*BookmarksFileEntryType{base, file, db} {
+		for id := range m {
+			idMap[id] = true
+		}
+	}
+	var ids []string
+	for id := range idMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var ops []bookmarksMergeOpType
+	var conflicts []string
+	for _, id := range ids {
+		baseEntry, fileEntry, dbEntry := base[id], file[id], db[id]
+		if fileEntry.Equals(baseEntry) || fileEntry.Equals(dbEntry) {
+			continue
+		}
+		if !dbEntry.Equals(baseEntry) {
+			conflicts = append(conflicts, describeBookmarkConflict(id, fileEntry, dbEntry))
+			continue
+		}
+		ops = append(ops, bookmarksMergeOpType{BookmarkId: id, Entry: fileEntry, IsNew: dbEntry == nil})
+	}
+	return ops, conflicts
+}
+
+func describeBookmarkConflict(id string, fileEntry *BookmarksFileEntryType, dbEntry *BookmarksFileEntryType) string {
+	if fileEntry == nil {
+		return fmt.Sprintf("%s: removed in file, edited in app", id)
+	}
+	if dbEntry == nil {
+		return fmt.Sprintf("%s: edited in file (cmdstr %q), removed in app", id, fileEntry.CmdStr)
+	}
+	return fmt.Sprintf("%s: edited in both file (cmdstr %q) and app", id, fileEntry.CmdStr)
+}
+
+// returns (nil, nil, nil) if the file does not exist
+func readBookmarksFileAt(fileName string) (*BookmarksFileType, []byte, error) {
+	barr, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	bf, err := ParseBookmarksFile(barr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bf, barr, nil
+}
+
+// writes to a temp file and renames it, so the watcher (and other readers) never see a partial file
+func writeFileAtomic(fileName string, barr []byte) error {
+	err := os.MkdirAll(filepath.Dir(fileName), 0755)
+	if err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	err = os.WriteFile(tmpName, barr, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+func getBookmarksSyncStatePath() string {
+	return filepath.Join(scbase.GetWaveHomeDir(), BookmarksSyncStateFileName)
+}
+
+func getDBBookmarksFile(ctx context.Context) (*BookmarksFileType, error) {
+	bms, err := GetBookmarks(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bms, func(i, j int) bool {
+		return bms[i].OrderIdx < bms[j].OrderIdx
+	})
+	rtn := &BookmarksFileType{}
+	for _, bm := range bms {
+		rtn.Bookmarks = append(rtn.Bookmarks, makeBookmarksFileEntry(bm))
+	}
+	return rtn, nil
+}
+
+func applyBookmarksMergeOp(ctx context.Context, op bookmarksMergeOpType) error {
+	if op.Entry == nil {
+		return DeleteBookmark(ctx, op.BookmarkId)
+	}
+	if op.IsNew {
+		return InsertBookmark(ctx, &BookmarkType{
+			BookmarkId:  op.BookmarkId,
+			CreatedTs:   time.Now().UnixMilli(),
+			CmdStr:      op.Entry.CmdStr,
+			Alias:       op.Entry.Alias,
+			Tags:        op.Entry.Tags,
+			Description: op.Entry.Desc,
+		})
+	}
+	editMap := map[string]interface{}{
+		BookmarkField_CmdStr: op.Entry.CmdStr,
+		BookmarkField_Desc:   op.Entry.Desc,
+		BookmarkField_Alias:  op.Entry.Alias,
+		BookmarkField_Tags:   op.Entry.Tags,
+	}
+	return EditBookmark(ctx, op.BookmarkId, editMap)
+}
+
+// syncs bookmarks.json with the bookmark table (in both directions), called when the file changes and
+// after bookmarks are edited in the app.  if the file is invalid, or some of its changes cannot be applied,
+// an error is returned and the file is left as-is (so it can be fixed).
+func SyncBookmarksFile(ctx context.Context) (*BookmarksSyncResultType, error) {
+	bookmarksFileLock.Lock()
+	defer bookmarksFileLock.Unlock()
+	filePath := configstore.GetConfigPath(BookmarksFileName)
+	bmFile, fileBytes, err := readBookmarksFileAt(filePath)
+	if err != nil {
+		return nil, err
+	}
+	baseFile, baseBytes, err := readBookmarksFileAt(getBookmarksSyncStatePath())
+	if err != nil {
+		// the base is only used to detect conflicts, start over
+		log.Printf("%s: ignoring invalid sync state: %v\n", BookmarksFileName, err)
+		baseFile = nil
+	}
+	dbFile, err := getDBBookmarksFile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve bookmarks: %v", err)
+	}
+	if bmFile == nil && len(dbFile.Bookmarks) == 0 {
+		return &BookmarksSyncResultType{}, nil
+	}
+	baseMap := baseFile.entryMap()
+	fileMap := baseMap
+	if bmFile != nil {
+		fileMap = bmFile.entryMap()
+	}
+	ops, conflicts := mergeBookmarks(baseMap, fileMap, dbFile.entryMap())
+	result := &BookmarksSyncResultType{Conflicts: conflicts}
+	// removes first so aliases are freed up for the updates and creates
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Entry == nil && ops[j].Entry != nil
+	})
+	var numErrors int
+	for _, op := range ops {
+		err = applyBookmarksMergeOp(ctx, op)
+		if err != nil {
+			numErrors++
+			log.Printf("%s: cannot apply bookmark %q: %v\n", BookmarksFileName, op.BookmarkId, err)
+			continue
+		}
+		if op.Entry == nil {
+			result.Removed = append(result.Removed, op.BookmarkId)
+			continue
+		}
+		bm, err := GetBookmarkById(ctx, op.BookmarkId, "")
+		if err == nil && bm != nil {
+			result.Updated = append(result.Updated, bm)
+		}
+	}
+	if numErrors > 0 {
+		return result, fmt.Errorf("%d bookmark(s) could not be applied (see log for details)", numErrors)
+	}
+	for _, conflict := range conflicts {
+		log.Printf("%s: conflict %s\n", BookmarksFileName, conflict)
+	}
+	dbFile, err = getDBBookmarksFile(ctx)
+	if err != nil {
+		return result, fmt.Errorf("cannot retrieve bookmarks: %v", err)
+	}
+	newBytes, err := dbFile.Marshal()
+	if err != nil {
+		return result, err
+	}
+	if !bytes.Equal(newBytes, fileBytes) {
+		err = writeFileAtomic(filePath, newBytes)
+		if err != nil {
+			return result, fmt.Errorf("cannot write %s: %v", BookmarksFileName, err)
+		}
+	}
+	if !bytes.Equal(newBytes, baseBytes) {
+		err = writeFileAtomic(getBookmarksSyncStatePath(), newBytes)
+		if err != nil {
+			return result, fmt.Errorf("cannot write sync state: %v", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+func TestParseBookmarksFile(t *testing.T) {
+	bf, err := ParseBookmarksFile([]byte(`{"bookmarks": [
+		{"id": "deploy-prod", "cmdstr": "make deploy ENV=prod", "alias": "deploy", "tags": ["ops"]},
+		{"id": "0b3f1a2c-5d6e-4f70-8a9b-0c1d2e3f4a5b", "cmdstr": "ls -l", "desc": "list"}
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bf.Bookmarks) != 2 || bf.Bookmarks[0].Alias != "deploy" || bf.Bookmarks[1].Desc != "list" {
+		t.Errorf("file not parsed correctly: %+v", bf.Bookmarks)
+	}
+	badFiles := []string{
+		`{"bookmarks": [`,
+		`{"bookmarks": [null]}`,
+		`{"bookmarks": [{"cmdstr": "ls"}]}`,
+		`{"bookmarks": [{"id": "a b", "cmdstr": "ls"}]}`,
+		`{"bookmarks": [{"id": "a"}]}`,
+		`{"bookmarks": [{"id": "a", "cmdstr": "ls"}, {"id": "a", "cmdstr": "pwd"}]}`,
+		`{"bookmarks": [{"id": "a", "cmdstr": "ls", "alias": "x"}, {"id": "b", "cmdstr": "pwd", "alias": "x"}]}`,
+		`{"bookmarks": [{"id": "a", "cmdstr": "ls", "alias": "1x"}]}`,
+		`{"bookmarks": [{"id": "a", "cmdstr": "ls", "tags": [""]}]}`,
+	}
+	for _, bad := range badFiles {
+		if _, err := ParseBookmarksFile([]byte(bad)); err == nil {
+			t.Errorf("expected error for file %s", bad)
+		}
+	}
+}
+
+func makeTestEntryMap(entries ...*BookmarksFileEntryType) map[string]*BookmarksFileEntryType {
+	return (&BookmarksFileType{Bookmarks: entries}).entryMap()
+}
+
+func TestMergeBookmarks(t *testing.T) {
+	a := &BookmarksFileEntryType{Id: "a", CmdStr: "ls"}
+	aFile := &BookmarksFileEntryType{Id: "a", CmdStr: "ls -l"}
+	aDB := &BookmarksFileEntryType{Id: "a", CmdStr: "ls -la"}
+	b := &BookmarksFileEntryType{Id: "b", CmdStr: "pwd"}
+	bDB := &BookmarksFileEntryType{Id: "b", CmdStr: "pwd", Tags: []string{"x"}}
+	c := &BookmarksFileEntryType{Id: "c", CmdStr: "make"}
+	d := &BookmarksFileEntryType{Id: "d", CmdStr: "git status"}
+
+	// a edited in file, b edited in db, c added to file, d removed from file
+	base := makeTestEntryMap(a, b, d)
+	ops, conflicts := mergeBookmarks(base, makeTestEntryMap(aFile, b, c), makeTestEntryMap(a, bDB, d))
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts %v", conflicts)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expected 3 ops, got %+v", ops)
+	}
+	if ops[0].BookmarkId != "a" || ops[0].IsNew || ops[0].Entry != aFile {
+		t.Errorf("unexpected op for a: %+v", ops[0])
+	}
+	if ops[1].BookmarkId != "c" || !ops[1].IsNew {
+		t.Errorf("unexpected op for c: %+v", ops[1])
+	}
+	if ops[2].BookmarkId != "d" || ops[2].Entry != nil {
+		t.Errorf("unexpected op for d: %+v", ops[2])
+	}
+
+	// a edited in both, d removed from file and edited in db
+	dDB := &BookmarksFileEntryType{Id: "d", CmdStr: "git status -s"}
+	ops, conflicts = mergeBookmarks(base, makeTestEntryMap(aFile, b), makeTestEntryMap(aDB, b, dDB))
+	if len(ops) != 0 || len(conflicts) != 2 {
+		t.Errorf("expected 2 conflicts and no ops, got ops:%+v conflicts:%v", ops, conflicts)
+	}
+
+	// same edit in both is not a conflict
+	ops, conflicts = mergeBookmarks(base, makeTestEntryMap(aFile, b, d), makeTestEntryMap(aFile, b, d))
+	if len(ops) != 0 || len(conflicts) != 0 {
+		t.Errorf("expected no ops or conflicts, got ops:%+v conflicts:%v", ops, conflicts)
+	}
+
+	// no base (first sync), entries that differ are conflicts, entries on one side are added
+	ops, conflicts = mergeBookmarks(nil, makeTestEntryMap(aFile, c), makeTestEntryMap(aDB, b))
+	if len(ops) != 1 || ops[0].BookmarkId != "c" || len(conflicts) != 1 {
+		t.Errorf("unexpected first sync result ops:%+v conflicts:%v", ops, conflicts)
+	}
+}
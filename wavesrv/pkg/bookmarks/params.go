@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package bookmarks
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bookmark cmdstrs can contain parameters, "{{name}}" or "{{name:default}}".  a parameter can appear more than
+// once (every occurrence gets the same value).  values are substituted as-is (they are not shell quoted).
+
+var bookmarkParamRe = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(?::([^}]*))?\}\}`)
+
+type BookmarkParamType struct {
+	Name       string `json:"name"`
+	Default    string `json:"default,omitempty"`
+	HasDefault bool   `json:"hasdefault,omitempty"`
+}
+
+// returns the parameters in the order they first appear.  if a parameter appears more than once
+// the first default is used.
+func ParseBookmarkParams(cmdStr string) []BookmarkParamType {
+	var rtn []BookmarkParamType
+	seen := make(map[string]bool)
+	for _, m := range bookmarkParamRe.FindAllStringSubmatchIndex(cmdStr, -1) {
+		name := cmdStr[m[2]:m[3]]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		param := BookmarkParamType{Name: name}
+		if m[4] != -1 {
+			param.Default = strings.TrimSpace(cmdStr[m[4]:m[5]])
+			param.HasDefault = true
+		}
+		rtn = append(rtn, param)
+	}
+	return rtn
+}
+
+// vals must contain a value for every parameter (see ParseBookmarkParams)
+func FillBookmarkParams(cmdStr string, vals map[string]string) string {
+	return bookmarkParamRe.ReplaceAllStringFunc(cmdStr, func(match string) string {
+		m := bookmarkParamRe.FindStringSubmatch(match)
+		return vals[m[1]]
+	})
+}
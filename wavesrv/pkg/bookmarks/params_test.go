@@ -0,0 +1,38 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+func TestParseBookmarkParams(t *testing.T) {
+	params := ParseBookmarkParams("ssh {{host}} 'cd /srv && git checkout {{ branch:main }} && git log -1 {{branch}}' {{empty:}}")
+	if len(params) != 3 {
+		t.Fatalf("expected 3 params, got %v", params)
+	}
+	if params[0].Name != "host" || params[0].HasDefault {
+		t.Errorf("unexpected host param %+v", params[0])
+	}
+	if params[1].Name != "branch" || !params[1].HasDefault || params[1].Default != "main" {
+		t.Errorf("unexpected branch param %+v", params[1])
+	}
+	if params[2].Name != "empty" || !params[2].HasDefault || params[2].Default != "" {
+		t.Errorf("unexpected empty param %+v", params[2])
+	}
+	if len(ParseBookmarkParams("echo {{}} {{1abc}} { {x} }")) != 0 {
+		t.Errorf("expected no params")
+	}
+}
+
+func TestFillBookmarkParams(t *testing.T) {
+	cmdStr := "git checkout {{branch:main}} && git push {{remote}} {{ branch }}"
+	rtn := FillBookmarkParams(cmdStr, map[string]string{"branch": "dev", "remote": "origin"})
+	if rtn != "git checkout dev && git push origin dev" {
+		t.Errorf("unexpected filled cmdstr %q", rtn)
+	}
+	if rtn := FillBookmarkParams("ls -l", nil); rtn != "ls -l" {
+		t.Errorf("unexpected cmdstr without params %q", rtn)
+	}
+}
@@ -34,11 +34,15 @@ import (
 	"github.com/wavetermdev/waveterm/waveshell/pkg/shellutil"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/shexec"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/apitoken"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/bookmarks"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/comp"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/dbutil"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/ephemeral"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/find"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/history"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/janitor"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/pcloud"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/releasechecker"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
@@ -49,6 +53,7 @@ import (
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/userinput"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/waveenc"
 	"golang.org/x/mod/semver"
 )
@@ -69,6 +74,8 @@ const MaxNameLen = 50
 const MaxShareNameLen = 150
 const MaxRendererLen = 50
 const MaxRemoteAliasLen = 50
+const MaxConnectCmdLen = 300
+const MaxLineNoteLen = 10000
 const PasswordUnchangedSentinel = "--unchanged--"
 const DefaultPTERM = "MxM"
 const MaxCommandLen = 4096
@@ -83,6 +90,8 @@ const TermFontSizeMin = 8
 const TermFontSizeMax = 24
 
 const TsFormatStr = "2006-01-02 15:04:05"
+const DefaultApiTokenExpires = "30d"
+const DefaultApiTokenAuditItems = 50
 
 const OpenAIPacketTimeout = 10 * 1000 * time.Millisecond
 const OpenAIStreamTimeout = 5 * time.Minute
@@ -101,15 +110,15 @@ const (
 
 var ColorNames = []string{"yellow", "blue", "pink", "mint", "cyan", "violet", "orange", "green", "red", "white"}
 var TabIcons = []string{"square", "sparkle", "fire", "ghost", "cloud", "compass", "crown", "droplet", "graduation-cap", "heart", "file"}
-var RemoteColorNames = []string{"red", "green", "yellow", "blue", "magenta", "cyan", "white", "orange"}
-var RemoteSetArgs = []string{"alias", "connectmode", "key", "password", "autoinstall", "color"}
+var RemoteColorNames = remote.RemoteColorNames
+var RemoteSetArgs = []string{"alias", "connectmode", "key", "password", "autoinstall", "color", "connectcmd"}
 var ConfirmFlags = []string{"hideshellprompt"}
 var SidebarNames = []string{"main"}
 var ThemeSources = []string{"light", "dark", "system"}
 
 var ScreenCmds = []string{"run", "comment", "cd", "cr", "clear", "sw", "reset", "signal", "chat"}
-var NoHistCmds = []string{"_compgen", "line", "history", "_killserver"}
-var GlobalCmds = []string{"session", "screen", "remote", "set", "client", "telemetry", "bookmark", "bookmarks"}
+var NoHistCmds = []string{"_compgen", "_suggest", "line", "history", "_killserver"}
+var GlobalCmds = []string{"session", "screen", "remote", "set", "client", "telemetry", "bookmark", "bookmarks", "proc", "apitoken", "find", "trash", "retention", "db"}
 
 var SetVarNameMap map[string]string = map[string]string{
 	"tabcolor": "screen.tabcolor",
@@ -134,12 +143,17 @@ var SetVarScopes = []SetVarScope{
 
 var userHostRe = regexp.MustCompile(`^(sudo@)?([a-zA-Z0-9][a-zA-Z0-9._@:\\-]*@)?([a-z0-9][a-z0-9.-]*)(?::([0-9]+))?$`)
 var remoteAliasRe = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9._-]*$")
+var runAsUserRe = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]*$`)
+var bookmarkAliasRe = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9._-]*$")
 var genericNameRe = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_ .()<>,/\"'\\[\\]{}=+$@!*-]*$")
 var rendererRe = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_.:-]*$")
 var positionRe = regexp.MustCompile("^((S?\\+|E?-)?[0-9]+|(\\+|-|S|E))$")
 var wsRe = regexp.MustCompile("\\s+")
 var sigNameRe = regexp.MustCompile("^((SIG[A-Z0-9]+)|(\\d+))$")
 
+// set by main-server, shuts down wavesrv and has electron start a new one
+var RestartServerFn func(reason string)
+
 type contextType string
 
 var historyContextKey = contextType("history")
@@ -174,6 +188,7 @@ func init() {
 	registerCmdFn("connect", CrCommand)
 	registerCmdFn("_compgen", CompGenCommand)
 	registerCmdFn("_compfiledir", CompFileDirCommand)
+	registerCmdFn("_suggest", SuggestCommand)
 	registerCmdFn("clear", ClearCommand)
 	registerCmdFn("reset", RemoteResetCommand)
 	registerCmdFn("reset:cwd", ResetCwdCommand)
@@ -207,6 +222,7 @@ func init() {
 	registerCmdFn("screen:reorder", ScreenReorderCommand)
 	registerCmdFn("screen:show", ScreenShowCommand)
 	registerCmdFn("screen:termtheme", TermSetThemeCommand)
+	registerCmdFn("screen:templates", ScreenTemplatesCommand)
 
 	registerCmdAlias("remote", RemoteCommand)
 	registerCmdFn("remote:show", RemoteShowCommand)
@@ -220,6 +236,11 @@ func init() {
 	registerCmdFn("remote:installcancel", RemoteInstallCancelCommand)
 	registerCmdFn("remote:reset", RemoteResetCommand)
 	registerCmdFn("remote:parse", RemoteConfigParseCommand)
+	registerCmdFn("remote:stats", RemoteStatsCommand)
+
+	registerCmdFn("proc", ProcListCommand)
+	registerCmdFn("proc:list", ProcListCommand)
+	registerCmdFn("proc:kill", ProcKillCommand)
 
 	registerCmdFn("copyfile", CopyFileCommand)
 
@@ -228,6 +249,7 @@ func init() {
 	registerCmdFn("line", LineCommand)
 	registerCmdFn("line:show", LineShowCommand)
 	registerCmdFn("line:star", LineStarCommand)
+	registerCmdFn("line:note", LineNoteCommand)
 	registerCmdFn("line:bookmark", LineBookmarkCommand)
 	registerCmdFn("line:pin", LinePinCommand)
 	registerCmdFn("line:archive", LineArchiveCommand)
@@ -237,6 +259,35 @@ func init() {
 	registerCmdFn("line:set", LineSetCommand)
 	registerCmdFn("line:restart", LineRestartCommand)
 	registerCmdFn("line:minimize", LineMinimizeCommand)
+	registerCmdFn("line:statediff", LineStateDiffCommand)
+
+	registerCmdFn("state:diff", StateDiffCommand)
+	registerCmdFn("state:save", StateSaveCommand)
+	registerCmdFn("state:restore", StateRestoreCommand)
+	registerCmdFn("state:checkpoints", StateCheckpointsCommand)
+	registerCmdFn("state:delete", StateDeleteCommand)
+
+	registerCmdFn("apitoken", ApiTokenListCommand)
+	registerCmdFn("apitoken:new", ApiTokenNewCommand)
+	registerCmdFn("apitoken:list", ApiTokenListCommand)
+	registerCmdFn("apitoken:revoke", ApiTokenRevokeCommand)
+	registerCmdFn("apitoken:audit", ApiTokenAuditCommand)
+
+	registerCmdFn("trash", TrashListCommand)
+	registerCmdFn("trash:list", TrashListCommand)
+	registerCmdFn("trash:restore", TrashRestoreCommand)
+	registerCmdFn("trash:empty", TrashEmptyCommand)
+
+	registerCmdFn("retention", RetentionShowCommand)
+	registerCmdFn("retention:show", RetentionShowCommand)
+	registerCmdFn("retention:set", RetentionSetCommand)
+	registerCmdFn("retention:run", RetentionRunCommand)
+
+	registerCmdFn("db", DBListCommand)
+	registerCmdFn("db:list", DBListCommand)
+	registerCmdFn("db:backup", DBBackupCommand)
+	registerCmdFn("db:restore", DBRestoreCommand)
+	registerCmdFn("db:check", DBCheckCommand)
 
 	registerCmdFn("client", ClientCommand)
 	registerCmdFn("client:show", ClientShowCommand)
@@ -258,6 +309,7 @@ func init() {
 	registerCmdFn("telemetry:off", TelemetryOffCommand)
 	registerCmdFn("telemetry:send", TelemetrySendCommand)
 	registerCmdFn("telemetry:show", TelemetryShowCommand)
+	registerCmdFn("telemetry:report", TelemetryReportCommand)
 
 	registerCmdFn("releasecheck", ReleaseCheckCommand)
 	registerCmdFn("releasecheck:autoon", ReleaseCheckOnCommand)
@@ -266,11 +318,15 @@ func init() {
 	registerCmdFn("history", HistoryCommand)
 	registerCmdFn("history:viewall", HistoryViewAllCommand)
 	registerCmdFn("history:purge", HistoryPurgeCommand)
+	registerCmdFn("history:stats", HistoryStatsCommand)
+
+	registerCmdFn("find", FindCommand)
 
 	registerCmdFn("bookmarks:show", BookmarksShowCommand)
 
 	registerCmdFn("bookmark:set", BookmarkSetCommand)
 	registerCmdFn("bookmark:delete", BookmarkDeleteCommand)
+	registerCmdFn("bookmark:run", BookmarkRunCommand)
 
 	registerCmdFn("chat", OpenAICommand)
 
@@ -345,6 +401,12 @@ func HandleCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus
 		}
 		return nil, fmt.Errorf("invalid command '/%s', no handler", cmdName)
 	}
+	if token := apitoken.FromContext(ctx); token != nil {
+		err := checkApiTokenCommand(ctx, token, cmdName, pk)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return entry.Fn(ctx, pk)
 }
 
@@ -745,6 +807,18 @@ func addToHistory(ctx context.Context, pk *scpacket.FeCommandPacketType, history
 	return nil
 }
 
+// makes an /eval packet for running cmdStr (shell or meta command) on the uiContext's screen
+func makeEvalPacket(uiContext *scpacket.UIContextType, cmdStr string, interactive bool) *scpacket.FeCommandPacketType {
+	evalPk := scpacket.MakeFeCommandPacket()
+	evalPk.MetaCmd = "eval"
+	evalPk.Args = []string{cmdStr}
+	evalPk.Kwargs = make(map[string]string)
+	evalPk.RawStr = cmdStr
+	evalPk.UIContext = uiContext
+	evalPk.Interactive = interactive
+	return evalPk
+}
+
 func EvalCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	if len(pk.Args) == 0 {
 		return nil, fmt.Errorf("usage: /eval [command], no command passed to eval")
@@ -891,6 +965,20 @@ func ScreenOpenCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (s
 			return nil, err
 		}
 	}
+	var tmpl *configstore.ScreenTemplateType
+	if tmplName := pk.Kwargs["template"]; tmplName != "" {
+		tmpl, err = configstore.ReadScreenTemplate(tmplName)
+		if err != nil {
+			return nil, fmt.Errorf("/%s %v", GetCmdStr(pk), err)
+		}
+		err = validateScreenTemplate(ctx, tmpl, ids.SessionId)
+		if err != nil {
+			return nil, fmt.Errorf("/%s invalid screen template %q: %v", GetCmdStr(pk), tmplName, err)
+		}
+		if newName == "" {
+			newName = tmpl.TabName
+		}
+	}
 	sco := sstore.ScreenCreateOpts{RtnScreenId: new(string)}
 	update, err := sstore.InsertScreen(ctx, ids.SessionId, newName, sco, activate)
 	if err != nil {
@@ -900,12 +988,23 @@ func ScreenOpenCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (s
 		return nil, fmt.Errorf("error creating tab, no tab id returned")
 	}
 	uiContextCopy := *pk.UIContext
+	uiContextCopy.SessionId = ids.SessionId
 	uiContextCopy.ScreenId = *sco.RtnScreenId
-	crUpdate, err := doNewTabConnectLocal(ctx, *sco.RtnScreenId, &uiContextCopy)
-	if err != nil {
-		return nil, err
+	if tmpl != nil {
+		tmplUpdate, err := applyScreenTemplate(ctx, tmpl, &uiContextCopy)
+		if err != nil {
+			// the screen was created, the ui still needs it
+			scbus.MainUpdateBus.DoUpdate(update)
+			return nil, fmt.Errorf("/%s error applying screen template %q: %v", GetCmdStr(pk), tmpl.Name, err)
+		}
+		update.Merge(tmplUpdate)
+	} else {
+		crUpdate, err := doNewTabConnectLocal(ctx, *sco.RtnScreenId, &uiContextCopy)
+		if err != nil {
+			return nil, err
+		}
+		update.Merge(crUpdate)
 	}
-	update.Merge(crUpdate)
 	telemetry.GoUpdateActivityWrap(telemetry.ActivityUpdate{NewTab: 1}, "screen:open")
 	return update, nil
 }
@@ -1877,6 +1976,7 @@ type RemoteEditArgs struct {
 	AutoInstall   bool
 	Color         string
 	ShellPref     string
+	ConnectCmd    string
 	EditMap       map[string]interface{}
 }
 
@@ -1885,9 +1985,58 @@ func parseRemoteEditArgs(isNew bool, pk *scpacket.FeCommandPacketType, isLocal b
 	var sshOpts *sstore.SSHOpts
 	var isSudo bool
 
-	if isNew {
+	connectCmd := strings.TrimSpace(pk.Kwargs["connectcmd"])
+	if len(connectCmd) > MaxConnectCmdLen {
+		return nil, fmt.Errorf("connectcmd too long, max length = %d", MaxConnectCmdLen)
+	}
+	if _, found := pk.Kwargs["connectcmd"]; found && connectCmd == "" {
+		return nil, fmt.Errorf("connectcmd cannot be empty")
+	}
+	runAsUser := pk.Kwargs["runas"]
+	runAsMethod := pk.Kwargs["runasmethod"]
+	if !isNew && (runAsUser != "" || runAsMethod != "") {
+		return nil, fmt.Errorf("cannot update 'runas' value")
+	}
+	if runAsUser != "" {
+		if len(runAsUser) > MaxRemoteAliasLen || !runAsUserRe.MatchString(runAsUser) {
+			return nil, fmt.Errorf("invalid runas user %q", runAsUser)
+		}
+		if runAsMethod == "" {
+			runAsMethod = sstore.RunAsMethodSudo
+		}
+		if runAsMethod != sstore.RunAsMethodSudo && runAsMethod != sstore.RunAsMethodSu {
+			return nil, fmt.Errorf("invalid runasmethod %q, must be %s", runAsMethod, formatStrs([]string{sstore.RunAsMethodSudo, sstore.RunAsMethodSu}, "or", false))
+		}
+	} else if runAsMethod != "" {
+		return nil, fmt.Errorf("runasmethod requires a runas user")
+	}
+	if isNew && connectCmd != "" {
+		// command remote, the argument is just a name (there is no user@host)
 		if len(pk.Args) == 0 {
-			return nil, fmt.Errorf("/remote:new must specify user@host argument (set visual=1 to edit in UI)")
+			return nil, fmt.Errorf("/remote:new with connectcmd must specify a name argument")
+		}
+		for _, sshArg := range []string{"sudo", "port", "key", "password", "runas"} {
+			if pk.Kwargs[sshArg] != "" {
+				return nil, fmt.Errorf("cannot set '%s' for a remote with connectcmd", sshArg)
+			}
+		}
+		canonicalName = pk.Args[0]
+		if len(canonicalName) > MaxRemoteAliasLen || !remoteAliasRe.MatchString(canonicalName) {
+			return nil, fmt.Errorf("invalid name %q for a remote with connectcmd", canonicalName)
+		}
+		sshOpts = &sstore.SSHOpts{}
+	} else if isNew && runAsUser != "" && len(pk.Args) == 0 {
+		// local run-as remote
+		for _, sshArg := range []string{"sudo", "port", "key", "password"} {
+			if pk.Kwargs[sshArg] != "" {
+				return nil, fmt.Errorf("cannot set '%s' for a local runas remote", sshArg)
+			}
+		}
+		sshOpts = &sstore.SSHOpts{Local: true, RunAsUser: runAsUser, RunAsMethod: runAsMethod}
+		canonicalName = "runas:" + runAsUser + "@local"
+	} else if isNew {
+		if len(pk.Args) == 0 {
+			return nil, fmt.Errorf("/remote:new must specify user@host argument, or runas=[user] for a local runas remote (set visual=1 to edit in UI)")
 		}
 		userHost := pk.Args[0]
 		m := userHostRe.FindStringSubmatch(userHost)
@@ -1948,6 +2097,14 @@ func parseRemoteEditArgs(isNew bool, pk *scpacket.FeCommandPacketType, isLocal b
 		if isSudo {
 			canonicalName = "sudo@" + canonicalName
 		}
+		if runAsUser != "" {
+			if isSudo {
+				return nil, fmt.Errorf("cannot combine sudo and runas (use runas=root)")
+			}
+			sshOpts.RunAsUser = runAsUser
+			sshOpts.RunAsMethod = runAsMethod
+			canonicalName = "runas:" + runAsUser + "@" + canonicalName
+		}
 	} else {
 		if pk.Kwargs["sudo"] != "" {
 			return nil, fmt.Errorf("cannot update 'sudo' value")
@@ -2032,6 +2189,12 @@ func parseRemoteEditArgs(isNew bool, pk *scpacket.FeCommandPacketType, isLocal b
 	if _, found := pk.Kwargs["shellpref"]; found {
 		editMap[sstore.RemoteField_ShellPref] = shellPref
 	}
+	if _, found := pk.Kwargs["connectcmd"]; found {
+		if isLocal {
+			return nil, fmt.Errorf("Cannot set connectcmd for 'local' remote")
+		}
+		editMap[sstore.RemoteField_ConnectCmd] = connectCmd
+	}
 
 	return &RemoteEditArgs{
 		SSHOpts:       sshOpts,
@@ -2042,6 +2205,7 @@ func parseRemoteEditArgs(isNew bool, pk *scpacket.FeCommandPacketType, isLocal b
 		Color:         color,
 		EditMap:       editMap,
 		ShellPref:     shellPref,
+		ConnectCmd:    connectCmd,
 	}, nil
 }
 
@@ -2068,6 +2232,16 @@ func RemoteNewCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (sc
 		SSHConfigSrc:        sstore.SSHConfigSrcTypeManual,
 		ShellPref:           editArgs.ShellPref,
 	}
+	if editArgs.ConnectCmd != "" {
+		r.RemoteType = sstore.RemoteTypeCommand
+		r.ConnectCmd = editArgs.ConnectCmd
+	}
+	if r.IsRunAs() {
+		r.RemoteUser = r.SSHOpts.RunAsUser
+		if r.SSHOpts.Local {
+			r.RemoteHost, _ = os.Hostname()
+		}
+	}
 	if editArgs.Color != "" {
 		r.RemoteOpts = &sstore.RemoteOptsType{Color: editArgs.Color}
 	}
@@ -2093,6 +2267,9 @@ func RemoteSetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (sc
 	if visualEdit && !isSubmitted && len(editArgs.EditMap) == 0 {
 		return makeRemoteEditUpdate_edit(ids, nil), nil
 	}
+	if _, found := editArgs.EditMap[sstore.RemoteField_ConnectCmd]; found && !ids.Remote.RemoteCopy.IsCommand() {
+		return makeRemoteEditErrorReturn_edit(ids, visualEdit, fmt.Errorf("/remote:set connectcmd can only be set on remotes created with a connectcmd"))
+	}
 	if !visualEdit && len(editArgs.EditMap) == 0 {
 		return nil, fmt.Errorf("/remote:set no updates, can set %s.  (set visual=1 to edit in UI)", formatStrs(RemoteSetArgs, "or", false))
 	}
@@ -2120,6 +2297,166 @@ func RemoteShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (s
 	return createRemoteViewRemoteIdUpdate(state.RemoteId), nil
 }
 
+func formatSysMetrics(metrics *packet.SysMetricsType) string {
+	var buf bytes.Buffer
+	uptime := time.Duration(metrics.UptimeSec) * time.Second
+	buf.WriteString(fmt.Sprintf("  %-10s %s\n", "host", metrics.HostName))
+	buf.WriteString(fmt.Sprintf("  %-10s %s\n", "uptime", uptime.String()))
+	buf.WriteString(fmt.Sprintf("  %-10s %.1f%% (%d cpus)\n", "cpu", metrics.CpuPct, metrics.NumCpu))
+	buf.WriteString(fmt.Sprintf("  %-10s %.2f %.2f %.2f\n", "load", metrics.LoadAvg[0], metrics.LoadAvg[1], metrics.LoadAvg[2]))
+	memUsed := metrics.MemTotal - metrics.MemAvail
+	buf.WriteString(fmt.Sprintf("  %-10s %s / %s\n", "memory", scbase.NumFormatB2(int64(memUsed)), scbase.NumFormatB2(int64(metrics.MemTotal))))
+	if metrics.SwapTotal > 0 {
+		swapUsed := metrics.SwapTotal - metrics.SwapFree
+		buf.WriteString(fmt.Sprintf("  %-10s %s / %s\n", "swap", scbase.NumFormatB2(int64(swapUsed)), scbase.NumFormatB2(int64(metrics.SwapTotal))))
+	}
+	if len(metrics.Disks) > 0 {
+		buf.WriteString("\n")
+		for _, disk := range metrics.Disks {
+			var usedPct float64
+			if disk.Total > 0 {
+				usedPct = 100 * float64(disk.Used) / float64(disk.Total)
+			}
+			buf.WriteString(fmt.Sprintf("  %-20s %-6s %10s / %-10s %5.1f%%\n", disk.Mount, disk.FsType, scbase.NumFormatB2(int64(disk.Used)), scbase.NumFormatB2(int64(disk.Total)), usedPct))
+		}
+	}
+	if len(metrics.TopProcs) > 0 {
+		buf.WriteString(fmt.Sprintf("\n  %7s %-10s %6s %10s  %s\n", "pid", "user", "cpu", "rss", "command"))
+		for _, proc := range metrics.TopProcs {
+			buf.WriteString(fmt.Sprintf("  %7d %-10s %5.1f%% %10s  %s\n", proc.Pid, utilfn.EllipsisStr(proc.User, 10), proc.CpuPct, scbase.NumFormatB2(int64(proc.RssSize)), proc.Name))
+		}
+	}
+	return buf.String()
+}
+
+func RemoteStatsCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, err
+	}
+	wsh := ids.Remote.Waveshell
+	if wsh == nil || !wsh.IsConnected() {
+		return nil, fmt.Errorf("/remote:stats remote %s is not connected", ids.Remote.DisplayName)
+	}
+	numProcs, err := resolvePosInt(pk.Kwargs["procs"], 0)
+	if err != nil {
+		return nil, fmt.Errorf("/remote:stats invalid procs: %v", err)
+	}
+	metrics, err := wsh.GetSysMetrics(ctx, numProcs)
+	if err != nil {
+		return nil, fmt.Errorf("/remote:stats error: %v", err)
+	}
+	var outputStr string
+	if resolveBool(pk.Kwargs["json"], false) {
+		barr, err := json.MarshalIndent(metrics, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("/remote:stats error marshaling metrics: %v", err)
+		}
+		outputStr = string(barr)
+	} else {
+		outputStr = formatSysMetrics(metrics)
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(remote.RemoteSysMetricsType{RemoteId: wsh.RemoteId, Metrics: metrics})
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("system stats for %s", ids.Remote.DisplayName),
+		InfoLines: splitLinesForInfo(outputStr),
+	})
+	return update, nil
+}
+
+func formatProcList(procs []*packet.ProcInfoType) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%7s %7s %-10s %-2s %6s %10s  %s\n", "pid", "ppid", "user", "st", "cpu", "rss", "command"))
+	for _, proc := range procs {
+		cmdStr := proc.CmdLine
+		if cmdStr == "" {
+			cmdStr = "[" + proc.Name + "]"
+		}
+		buf.WriteString(fmt.Sprintf("%7d %7d %-10s %-2s %5.1f%% %10s  %s\n", proc.Pid, proc.PPid, utilfn.EllipsisStr(proc.User, 10), proc.State, proc.CpuPct, scbase.NumFormatB2(int64(proc.RssSize)), cmdStr))
+	}
+	return buf.String()
+}
+
+func resolveConnectedWaveshell(ctx context.Context, pk *scpacket.FeCommandPacketType, cmdName string) (*remote.WaveshellProc, string, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, "", err
+	}
+	wsh := ids.Remote.Waveshell
+	if wsh == nil || !wsh.IsConnected() {
+		return nil, "", fmt.Errorf("%s remote %s is not connected", cmdName, ids.Remote.DisplayName)
+	}
+	return wsh, ids.Remote.DisplayName, nil
+}
+
+func ProcListCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	wsh, displayName, err := resolveConnectedWaveshell(ctx, pk, "/proc:list")
+	if err != nil {
+		return nil, err
+	}
+	maxItems, err := resolvePosInt(pk.Kwargs["max"], 0)
+	if err != nil {
+		return nil, fmt.Errorf("/proc:list invalid max: %v", err)
+	}
+	filter := pk.Kwargs["filter"]
+	if filter == "" {
+		filter = firstArg(pk)
+	}
+	procs, numProcs, err := wsh.GetProcList(ctx, filter, pk.Kwargs["user"], maxItems)
+	if err != nil {
+		return nil, fmt.Errorf("/proc:list error: %v", err)
+	}
+	var outputStr string
+	if resolveBool(pk.Kwargs["json"], false) {
+		barr, err := json.MarshalIndent(procs, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("/proc:list error marshaling procs: %v", err)
+		}
+		outputStr = string(barr)
+	} else {
+		outputStr = formatProcList(procs)
+		if numProcs > len(procs) {
+			outputStr += fmt.Sprintf("(showing %d of %d processes, use max=N to see more)\n", len(procs), numProcs)
+		}
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("processes on %s", displayName),
+		InfoLines: splitLinesForInfo(outputStr),
+	})
+	return update, nil
+}
+
+func ProcKillCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/proc:kill requires a pid argument")
+	}
+	if !isAllDigits(pk.Args[0]) {
+		return nil, fmt.Errorf("/proc:kill invalid pid %q", pk.Args[0])
+	}
+	pid, err := strconv.Atoi(pk.Args[0])
+	if err != nil || pid <= 0 {
+		return nil, fmt.Errorf("/proc:kill invalid pid %q", pk.Args[0])
+	}
+	sigArg := "SIGTERM"
+	if len(pk.Args) > 1 {
+		sigArg, err = resolveSignalArg(pk.Args[1])
+		if err != nil {
+			return nil, fmt.Errorf("/proc:kill %v", err)
+		}
+	}
+	wsh, displayName, err := resolveConnectedWaveshell(ctx, pk, "/proc:kill")
+	if err != nil {
+		return nil, err
+	}
+	err = wsh.SignalProc(ctx, pid, sigArg)
+	if err != nil {
+		return nil, fmt.Errorf("/proc:kill error: %v", err)
+	}
+	return sstore.InfoMsgUpdate("sent %s to pid %d on %s", sigArg, pid, displayName), nil
+}
+
 func RemoteShowAllCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	stateArr := remote.GetAllRemoteRuntimeState()
 	var buf bytes.Buffer
@@ -3398,6 +3735,41 @@ func CompGenCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbu
 	return update, nil
 }
 
+// returns history-based suggestions for the command line (prefix matches), or "next command"
+// suggestions for the current screen when the prefix is empty
+func SuggestCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, 0) // best-effort
+	if err != nil {
+		return nil, fmt.Errorf("/_suggest error: %w", err)
+	}
+	maxItems, err := resolvePosInt(pk.Kwargs["maxitems"], history.DefaultMaxSuggestions)
+	if err != nil {
+		return nil, fmt.Errorf("/_suggest invalid maxitems value '%s' (must be a number): %v", pk.Kwargs["maxitems"], err)
+	}
+	opts := history.SuggestOpts{
+		Prefix:   firstArg(pk),
+		ScreenId: ids.ScreenId,
+		MaxItems: maxItems,
+	}
+	if ids.Remote != nil {
+		opts.RemoteId = ids.Remote.RemotePtr.RemoteId
+		if ids.Remote.FeState != nil {
+			opts.Cwd = ids.Remote.FeState["cwd"]
+		}
+	}
+	items, err := history.GetSuggestions(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("/_suggest error: %w", err)
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(history.HistorySuggestionsType{
+		Prefix:   opts.Prefix,
+		ScreenId: ids.ScreenId,
+		Items:    items,
+	})
+	return update, nil
+}
+
 func CommentCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
 	if err != nil {
@@ -4196,6 +4568,97 @@ func historyCmdFilter(hitem *history.HistoryItemType) bool {
 	return true
 }
 
+func resolveDayStrTs(arg string) (int64, error) {
+	dayStr, err := telemetry.GetCustomDayStr(arg)
+	if err != nil {
+		return 0, err
+	}
+	dayTime, err := time.ParseInLocation("2006-01-02", dayStr, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return dayTime.UnixMilli(), nil
+}
+
+// scope=[global|session|screen] remote=[remote] from=[daystr] to=[daystr] (to is inclusive) days=[n] json=[bool]
+func HistoryStatsCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, 0)
+	if err != nil {
+		return nil, err
+	}
+	var opts history.StatsOpts
+	scope := pk.Kwargs["scope"]
+	switch scope {
+	case "", "global":
+	case "session":
+		if ids.SessionId == "" {
+			return nil, fmt.Errorf("/history:stats scope=session requires an active session")
+		}
+		opts.SessionId = ids.SessionId
+	case "screen":
+		if ids.ScreenId == "" {
+			return nil, fmt.Errorf("/history:stats scope=screen requires an active screen")
+		}
+		opts.SessionId = ids.SessionId
+		opts.ScreenId = ids.ScreenId
+	default:
+		return nil, fmt.Errorf("/history:stats invalid scope %q (must be %s)", scope, formatStrs([]string{"global", "session", "screen"}, "or", false))
+	}
+	if pk.Kwargs["remote"] != "" {
+		rptr, err := resolveRemoteArg(pk.Kwargs["remote"])
+		if err != nil {
+			return nil, fmt.Errorf("/history:stats invalid remote: %v", err)
+		}
+		if rptr == nil {
+			return nil, fmt.Errorf("/history:stats remote %q not found", pk.Kwargs["remote"])
+		}
+		opts.RemoteId = rptr.RemoteId
+	}
+	days, err := resolvePosInt(pk.Kwargs["days"], 30)
+	if err != nil {
+		return nil, fmt.Errorf("/history:stats invalid days: %v", err)
+	}
+	fromArg := pk.Kwargs["from"]
+	if fromArg == "" {
+		fromArg = fmt.Sprintf("today-%dd", days-1)
+	}
+	opts.StartTs, err = resolveDayStrTs(fromArg)
+	if err != nil {
+		return nil, fmt.Errorf("/history:stats invalid from: %v", err)
+	}
+	if pk.Kwargs["to"] != "" {
+		toTs, err := resolveDayStrTs(pk.Kwargs["to"] + "+1d")
+		if err != nil {
+			return nil, fmt.Errorf("/history:stats invalid to: %v", err)
+		}
+		opts.EndTs = toTs
+	}
+	opts.MaxItems, err = resolvePosInt(pk.Kwargs["maxitems"], history.DefaultStatsMaxItems)
+	if err != nil {
+		return nil, fmt.Errorf("/history:stats invalid maxitems: %v", err)
+	}
+	stats, err := history.GetHistoryStats(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("/history:stats error: %v", err)
+	}
+	var outputStr string
+	if resolveBool(pk.Kwargs["json"], false) {
+		barr, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("/history:stats error marshaling stats: %v", err)
+		}
+		outputStr = string(barr)
+	} else {
+		outputStr = stats.String()
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "history stats",
+		InfoLines: splitLinesForInfo(outputStr),
+	})
+	return update, nil
+}
+
 func HistoryViewAllCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	_, err := resolveUiIds(ctx, pk, 0)
 	if err != nil {
@@ -4660,6 +5123,85 @@ func LineViewCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scb
 	return update, nil
 }
 
+func formatFindTs(ts int64) string {
+	if ts <= 0 {
+		return "-"
+	}
+	return time.UnixMilli(ts).Format("2006-01-02 15:04")
+}
+
+func openFindResult(ctx context.Context, pk *scpacket.FeCommandPacketType, r *find.FindResultType) (scbus.UpdatePacket, error) {
+	openPk := &scpacket.FeCommandPacketType{UIContext: pk.UIContext, Interactive: pk.Interactive, Kwargs: make(map[string]string)}
+	switch r.ItemType {
+	case find.ItemTypeSession:
+		openPk.MetaCmd = "session"
+		openPk.Args = []string{r.SessionId}
+		return SessionCommand(ctx, openPk)
+	case find.ItemTypeScreen:
+		openPk.MetaCmd = "screen"
+		openPk.Kwargs["session"] = r.SessionId
+		openPk.Args = []string{r.ScreenId}
+		return ScreenCommand(ctx, openPk)
+	default:
+		openPk.MetaCmd = "line"
+		openPk.MetaSubCmd = "view"
+		openPk.Args = []string{r.SessionId, r.ScreenId, strconv.FormatInt(r.LineNum, 10)}
+		return LineViewCommand(ctx, openPk)
+	}
+}
+
+func FindCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	searchText := strings.TrimSpace(strings.Join(pk.Args, " "))
+	if searchText == "" {
+		return nil, fmt.Errorf("usage /find [search-text] (archived=1 to include archived items, max=N, open=N)")
+	}
+	maxItems, err := resolvePosInt(pk.Kwargs["max"], find.DefaultMaxItems)
+	if err != nil {
+		return nil, fmt.Errorf("/find invalid max value '%s': %v", pk.Kwargs["max"], err)
+	}
+	openNum, err := resolvePosInt(pk.Kwargs["open"], 0)
+	if err != nil {
+		return nil, fmt.Errorf("/find invalid open value '%s': %v", pk.Kwargs["open"], err)
+	}
+	if openNum > maxItems {
+		maxItems = openNum
+	}
+	opts := find.FindOpts{
+		Query:           searchText,
+		IncludeArchived: resolveBool(pk.Kwargs["archived"], false),
+		MaxItems:        maxItems,
+	}
+	results, err := find.Find(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("/find error: %v", err)
+	}
+	if openNum > 0 {
+		if openNum > len(results) {
+			return nil, fmt.Errorf("/find cannot open result %d, only %d result(s) found for %q", openNum, len(results), searchText)
+		}
+		return openFindResult(ctx, pk, results[openNum-1])
+	}
+	if len(results) == 0 {
+		return sstore.InfoMsgUpdate("no results found for %q", searchText), nil
+	}
+	var buf bytes.Buffer
+	for idx, r := range results {
+		archivedStr := ""
+		if r.Archived {
+			archivedStr = " (archived)"
+		}
+		buf.WriteString(fmt.Sprintf("%3d. %-7s %s%s  [%s]\n", idx+1, r.ItemType, r.Location(), archivedStr, formatFindTs(r.Ts)))
+		buf.WriteString(fmt.Sprintf("       %s: %s\n", r.MatchField, r.DisplayMatchText()))
+		buf.WriteString(fmt.Sprintf("       %s\n", r.OpenCommand()))
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("find results for %q (open with /find %s open=N)", searchText, searchText),
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
 func BookmarksShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	// no resolve ui ids!
 	var tagName string // defaults to ''
@@ -4680,6 +5222,17 @@ func BookmarksShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType)
 	return update, nil
 }
 
+// edits made in the app are written to bookmarks.json (errors are logged, the DB edit already succeeded)
+// the sync can also merge in changes from the file, those are added to update
+func syncBookmarksFileAfterEdit(ctx context.Context, update *scbus.ModelUpdatePacketType) {
+	result, err := bookmarks.SyncBookmarksFile(ctx)
+	if err != nil {
+		log.Printf("error syncing %s: %v\n", bookmarks.BookmarksFileName, err)
+		return
+	}
+	result.AddToUpdate(update)
+}
+
 func BookmarkSetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	if len(pk.Args) == 0 {
 		return nil, fmt.Errorf("/bookmark:set requires one argument (bookmark id)")
@@ -4699,19 +5252,31 @@ func BookmarkSetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (
 	if cmdStr, found := pk.Kwargs["cmdstr"]; found {
 		editMap[bookmarks.BookmarkField_CmdStr] = cmdStr
 	}
+	if alias, found := pk.Kwargs["alias"]; found {
+		if alias != "" {
+			if len(alias) > MaxNameLen {
+				return nil, fmt.Errorf("bookmark alias too long, max length is %d", MaxNameLen)
+			}
+			if !bookmarkAliasRe.MatchString(alias) {
+				return nil, fmt.Errorf("invalid bookmark alias %q (must start with a letter and contain only letters, numbers, '_', '.' and '-')", alias)
+			}
+		}
+		editMap[bookmarks.BookmarkField_Alias] = alias
+	}
 	if len(editMap) == 0 {
-		return nil, fmt.Errorf("no fields set, can set %s", formatStrs([]string{"desc", "cmdstr"}, "or", false))
+		return nil, fmt.Errorf("no fields set, can set %s", formatStrs([]string{"desc", "cmdstr", "alias"}, "or", false))
 	}
 	err = bookmarks.EditBookmark(ctx, bookmarkId, editMap)
 	if err != nil {
 		return nil, fmt.Errorf("error trying to edit bookmark: %v", err)
 	}
+	update := scbus.MakeUpdatePacket()
+	syncBookmarksFileAfterEdit(ctx, update)
 	bm, err := bookmarks.GetBookmarkById(ctx, bookmarkId, "")
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving edited bookmark: %v", err)
 	}
 	bms := []*bookmarks.BookmarkType{bm}
-	update := scbus.MakeUpdatePacket()
 	bookmarks.AddBookmarksUpdate(update, bms, nil)
 	update.AddUpdate(sstore.InfoMsgUpdate("bookmark edited"))
 	return update, nil
@@ -4734,59 +5299,168 @@ func BookmarkDeleteCommand(ctx context.Context, pk *scpacket.FeCommandPacketType
 		return nil, fmt.Errorf("error deleting bookmark: %v", err)
 	}
 	update := scbus.MakeUpdatePacket()
+	syncBookmarksFileAfterEdit(ctx, update)
 	bms := []*bookmarks.BookmarkType{{BookmarkId: bookmarkId, Remove: true}}
 	bookmarks.AddBookmarksUpdate(update, bms, nil)
 	update.AddUpdate(sstore.InfoMsgUpdate("bookmark deleted"))
 	return update, nil
 }
 
-func LineBookmarkCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+// /bookmark:run [alias|id] [param=value ...]
+// parameters without a value or a default are prompted for, in that case the command runs asynchronously
+// (after the prompts are answered).
+func BookmarkRunCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
 	if err != nil {
 		return nil, err
 	}
 	if len(pk.Args) == 0 {
-		return nil, fmt.Errorf("/line:bookmark requires an argument (line number or id)")
+		return nil, fmt.Errorf("/bookmark:run requires one argument (bookmark alias or id)")
 	}
-	lineArg := pk.Args[0]
-	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	bookmarkId, err := bookmarks.GetBookmarkIdByArg(ctx, pk.Args[0])
 	if err != nil {
-		return nil, fmt.Errorf("error looking up lineid: %v", err)
+		return nil, fmt.Errorf("error trying to resolve bookmark: %v", err)
 	}
-	if lineId == "" {
-		return nil, fmt.Errorf("line %q not found", lineArg)
+	if bookmarkId == "" {
+		return nil, fmt.Errorf("bookmark not found")
 	}
-	_, cmdObj, err := sstore.GetLineCmdByLineId(ctx, ids.ScreenId, lineId)
+	bm, err := bookmarks.GetBookmarkById(ctx, bookmarkId, "")
 	if err != nil {
-		return nil, fmt.Errorf("/line:bookmark error getting line: %v", err)
+		return nil, fmt.Errorf("error retrieving bookmark: %v", err)
 	}
-	if cmdObj == nil {
-		return nil, fmt.Errorf("cannot bookmark non-cmd line")
+	if bm == nil {
+		return nil, fmt.Errorf("bookmark not found")
 	}
-	existingBmIds, err := bookmarks.GetBookmarkIdsByCmdStr(ctx, cmdObj.CmdStr)
-	if err != nil {
-		return nil, fmt.Errorf("error trying to retrieve current boookmarks: %v", err)
+	params := bookmarks.ParseBookmarkParams(bm.CmdStr)
+	var paramNames []string
+	for _, param := range params {
+		paramNames = append(paramNames, param.Name)
 	}
-	var newBmId string
-	if len(existingBmIds) > 0 {
-		newBmId = existingBmIds[0]
-	} else {
-		newBm := &bookmarks.BookmarkType{
-			BookmarkId:  uuid.New().String(),
-			CreatedTs:   time.Now().UnixMilli(),
-			CmdStr:      cmdObj.CmdStr,
-			Alias:       "",
-			Tags:        nil,
-			Description: "",
+	vals := make(map[string]string)
+	for key, val := range pk.Kwargs {
+		if key == "session" || key == "screen" {
+			// used to resolve the screen (see resolveUiIds)
+			continue
 		}
-		err = bookmarks.InsertBookmark(ctx, newBm)
-		if err != nil {
-			return nil, fmt.Errorf("cannot insert bookmark: %v", err)
+		if !utilfn.ContainsStr(paramNames, key) {
+			if len(paramNames) == 0 {
+				return nil, fmt.Errorf("/bookmark:run invalid parameter %q, bookmark has no parameters", key)
+			}
+			return nil, fmt.Errorf("/bookmark:run invalid parameter %q, valid parameters are: %s", key, formatStrs(paramNames, "and", false))
 		}
-		newBmId = newBm.BookmarkId
+		vals[key] = val
+	}
+	var missing []string
+	for _, param := range params {
+		if _, found := vals[param.Name]; found {
+			continue
+		}
+		if param.HasDefault {
+			vals[param.Name] = param.Default
+			continue
+		}
+		missing = append(missing, param.Name)
+	}
+	uiContext := scpacket.UIContextType{}
+	if pk.UIContext != nil {
+		uiContext = *pk.UIContext
+	}
+	uiContext.SessionId = ids.SessionId
+	uiContext.ScreenId = ids.ScreenId
+	if len(missing) == 0 {
+		return EvalCommand(ctx, makeEvalPacket(&uiContext, bookmarks.FillBookmarkParams(bm.CmdStr, vals), pk.Interactive))
+	}
+	go runBookmarkWithInput(bm, vals, missing, uiContext, pk.Interactive)
+	return nil, nil
+}
+
+const BookmarkParamInputTimeout = 2 * time.Minute
+const BookmarkRunTimeout = 10 * time.Second
+
+func runBookmarkWithInput(bm *bookmarks.BookmarkType, vals map[string]string, missing []string, uiContext scpacket.UIContextType, interactive bool) {
+	err := func() error {
+		for _, paramName := range missing {
+			request := &userinput.UserInputRequestType{
+				QueryText:    fmt.Sprintf("Enter a value for `{{%s}}` in:\n```\n%s\n```", paramName, bm.CmdStr),
+				ResponseType: "text",
+				Title:        "Bookmark Parameter",
+				Markdown:     true,
+				PublicText:   true,
+			}
+			inputCtx, inputCancelFn := context.WithTimeout(context.Background(), BookmarkParamInputTimeout)
+			response, err := userinput.GetUserInput(inputCtx, scbus.MainRpcBus, request)
+			inputCancelFn()
+			if err != nil {
+				return fmt.Errorf("no value for {{%s}}: %v", paramName, err)
+			}
+			vals[paramName] = response.Text
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), BookmarkRunTimeout)
+		defer cancelFn()
+		update, err := EvalCommand(ctx, makeEvalPacket(&uiContext, bookmarks.FillBookmarkParams(bm.CmdStr, vals), interactive))
+		if err != nil {
+			return err
+		}
+		if update != nil {
+			scbus.MainUpdateBus.DoScreenUpdate(uiContext.ScreenId, update)
+		}
+		return nil
+	}()
+	if err != nil {
+		update := scbus.MakeUpdatePacket()
+		sstore.AddInfoMsgUpdateError(update, fmt.Sprintf("/bookmark:run error: %v", err))
+		scbus.MainUpdateBus.DoScreenUpdate(uiContext.ScreenId, update)
+	}
+}
+
+func LineBookmarkCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/line:bookmark requires an argument (line number or id)")
+	}
+	lineArg := pk.Args[0]
+	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up lineid: %v", err)
+	}
+	if lineId == "" {
+		return nil, fmt.Errorf("line %q not found", lineArg)
+	}
+	_, cmdObj, err := sstore.GetLineCmdByLineId(ctx, ids.ScreenId, lineId)
+	if err != nil {
+		return nil, fmt.Errorf("/line:bookmark error getting line: %v", err)
+	}
+	if cmdObj == nil {
+		return nil, fmt.Errorf("cannot bookmark non-cmd line")
+	}
+	existingBmIds, err := bookmarks.GetBookmarkIdsByCmdStr(ctx, cmdObj.CmdStr)
+	if err != nil {
+		return nil, fmt.Errorf("error trying to retrieve current boookmarks: %v", err)
 	}
-	bms, err := bookmarks.GetBookmarks(ctx, "")
 	update := scbus.MakeUpdatePacket()
+	var newBmId string
+	if len(existingBmIds) > 0 {
+		newBmId = existingBmIds[0]
+	} else {
+		newBm := &bookmarks.BookmarkType{
+			BookmarkId:  uuid.New().String(),
+			CreatedTs:   time.Now().UnixMilli(),
+			CmdStr:      cmdObj.CmdStr,
+			Alias:       "",
+			Tags:        nil,
+			Description: "",
+		}
+		err = bookmarks.InsertBookmark(ctx, newBm)
+		if err != nil {
+			return nil, fmt.Errorf("cannot insert bookmark: %v", err)
+		}
+		newBmId = newBm.BookmarkId
+		syncBookmarksFileAfterEdit(ctx, update)
+	}
+	bms, err := bookmarks.GetBookmarks(ctx, "")
 	update.AddUpdate(&MainViewUpdate{
 		MainView:      sstore.MainViewBookmarks,
 		BookmarksView: &bookmarks.BookmarksUpdate{Bookmarks: bms, SelectedBookmark: newBmId},
@@ -4841,6 +5515,66 @@ func LineStarCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scb
 	return update, nil
 }
 
+// raw args (so the markdown is not shell parsed): /line:note [line] [markdown]
+// with no markdown shows the current note, /line:note[clear] [line] removes it
+func LineNoteCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	argStr := strings.TrimSpace(firstArg(pk))
+	if argStr == "" {
+		return nil, fmt.Errorf("/line:note requires an argument (line number or id)")
+	}
+	lineArg, note := argStr, ""
+	if spaceIdx := strings.IndexFunc(argStr, unicode.IsSpace); spaceIdx != -1 {
+		lineArg, note = argStr[:spaceIdx], strings.TrimSpace(argStr[spaceIdx+1:])
+	}
+	if len(note) > MaxLineNoteLen {
+		return nil, fmt.Errorf("/line:note note too long, len:%d, max:%d", len(note), MaxLineNoteLen)
+	}
+	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up lineid: %v", err)
+	}
+	if lineId == "" {
+		return nil, fmt.Errorf("line %q not found", lineArg)
+	}
+	clearNote := resolveBool(pk.Kwargs["clear"], false)
+	if clearNote && note != "" {
+		return nil, fmt.Errorf("/line:note cannot set and clear a note at the same time")
+	}
+	if note == "" && !clearNote {
+		lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
+		if err != nil {
+			return nil, fmt.Errorf("/line:note error getting line: %v", err)
+		}
+		if lineObj == nil || lineObj.Note == "" {
+			return sstore.InfoMsgUpdate("line %s has no note", lineArg), nil
+		}
+		update := scbus.MakeUpdatePacket()
+		update.AddUpdate(sstore.InfoMsgType{
+			InfoTitle: fmt.Sprintf("note for line %d (edited %s)", lineObj.LineNum, time.UnixMilli(lineObj.NoteTs).Format(TsFormatStr)),
+			InfoLines: splitLinesForInfo(lineObj.Note),
+		})
+		return update, nil
+	}
+	err = sstore.UpdateLineNote(ctx, ids.ScreenId, lineId, note)
+	if err != nil {
+		return nil, fmt.Errorf("/line:note error updating note: %v", err)
+	}
+	lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
+	if err != nil {
+		return nil, fmt.Errorf("/line:note error getting line: %v", err)
+	}
+	if lineObj == nil {
+		return nil, nil
+	}
+	update := scbus.MakeUpdatePacket()
+	sstore.AddLineUpdate(update, lineObj, nil)
+	return update, nil
+}
+
 func LineArchiveCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
 	if err != nil {
@@ -4861,193 +5595,1020 @@ func LineArchiveCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (
 	if len(pk.Args) >= 2 {
 		shouldArchive = resolveBool(pk.Args[1], true)
 	}
-	err = sstore.SetLineArchivedById(ctx, ids.ScreenId, lineId, shouldArchive)
-	if err != nil {
-		return nil, fmt.Errorf("/line:archive error updating hidden status: %v", err)
+	err = sstore.SetLineArchivedById(ctx, ids.ScreenId, lineId, shouldArchive)
+	if err != nil {
+		return nil, fmt.Errorf("/line:archive error updating hidden status: %v", err)
+	}
+	lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
+	if err != nil {
+		return nil, fmt.Errorf("/line:archive error getting line: %v", err)
+	}
+	if lineObj == nil {
+		// no line (which is strange given we checked for it above).  just return a nop.
+		return nil, nil
+	}
+	update := scbus.MakeUpdatePacket()
+	sstore.AddLineUpdate(update, lineObj, nil)
+	return update, nil
+}
+
+func LineMinimizeCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/line:minimize requires arguments (line number or id and min value)")
+	}
+	if len(pk.Args) > 2 {
+		return nil, fmt.Errorf("/line:minimize only takes up to 2 argument (line number or id and min value)")
+	}
+	lineArg1 := pk.Args[0]
+	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg1)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up lineid: %v", err)
+	}
+	if lineId == "" {
+		return nil, fmt.Errorf("line %q not found", lineArg1)
+	}
+	lineArg2 := pk.Args[1]
+	minVal := resolveBool(lineArg2, true)
+	lineState := make(map[string]any)
+	if minVal {
+		lineState[sstore.LineState_Min] = minVal
+	} else {
+		// Remove sstore.LineState_Min from lineState if it exists
+		delete(lineState, sstore.LineState_Min)
+	}
+	err = sstore.UpdateLineState(ctx, ids.ScreenId, lineId, lineState)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update linestate: %v", err)
+	}
+	lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
+	if err != nil {
+		return nil, fmt.Errorf("/line:minimize cannot retrieve updated line: %v", err)
+	}
+	if lineObj == nil {
+		// no line (which is strange given we checked for it above).  just return a nop.
+		return nil, nil
+	}
+	update := scbus.MakeUpdatePacket()
+	sstore.AddLineUpdate(update, lineObj, nil)
+	return update, nil
+}
+
+func LineDeleteCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/line:delete requires at least one argument (line number or id)")
+	}
+	var lineIds []string
+	for _, lineArg := range pk.Args {
+		lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up lineid: %v", err)
+		}
+		if lineId == "" {
+			return nil, fmt.Errorf("line %q not found", lineArg)
+		}
+		lineIds = append(lineIds, lineId)
+	}
+	err = sstore.DeleteLinesByIds(ctx, ids.ScreenId, lineIds)
+	if err != nil {
+		return nil, fmt.Errorf("/line:delete error deleting lines: %v", err)
+	}
+	update := scbus.MakeUpdatePacket()
+	for _, lineId := range lineIds {
+		line := &sstore.LineType{ScreenId: ids.ScreenId, LineId: lineId, Remove: true}
+		sstore.AddLineUpdate(update, line, nil)
+	}
+	screen, err := sstore.FixupScreenSelectedLine(ctx, ids.ScreenId)
+	if err != nil {
+		return nil, fmt.Errorf("/line:delete error fixing up screen: %v", err)
+	}
+	if screen != nil {
+		update.AddUpdate(*screen)
+	}
+	return update, nil
+}
+
+func LineShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/line:show requires an argument (line number or id)")
+	}
+	lineArg := pk.Args[0]
+	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up lineid: %v", err)
+	}
+	if lineId == "" {
+		return nil, fmt.Errorf("line %q not found", lineArg)
+	}
+	line, cmd, err := sstore.GetLineCmdByLineId(ctx, ids.ScreenId, lineId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting line: %v", err)
+	}
+	if line == nil {
+		return nil, fmt.Errorf("line %q not found", lineArg)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "screenid", line.ScreenId))
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "lineid", line.LineId))
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "type", line.LineType))
+	lineNumStr := strconv.FormatInt(line.LineNum, 10)
+	if line.LineNumTemp {
+		lineNumStr = "~" + lineNumStr
+	}
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "linenum", lineNumStr))
+	ts := time.UnixMilli(line.Ts)
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "ts", ts.Format(TsFormatStr)))
+	if line.Ephemeral {
+		buf.WriteString(fmt.Sprintf("  %-15s %v\n", "ephemeral", true))
+	}
+	if line.Renderer != "" {
+		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "renderer", line.Renderer))
+	} else {
+		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "renderer", "terminal"))
+	}
+	if cmd != nil {
+		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "remote", cmd.Remote.MakeFullRemoteRef()))
+		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "status", cmd.Status))
+		if cmd.FeState["cwd"] != "" {
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "cwd", cmd.FeState["cwd"]))
+		}
+		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "termopts", formatTermOpts(cmd.TermOpts)))
+		if cmd.TermOpts != cmd.OrigTermOpts {
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "orig-termopts", formatTermOpts(cmd.OrigTermOpts)))
+		}
+		if cmd.RtnState {
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "rtnstate", "true"))
+		}
+		stat, _ := sstore.StatCmdPtyFile(ctx, cmd.ScreenId, cmd.LineId)
+		if stat == nil {
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file", "-"))
+		} else {
+			fileDataStr := fmt.Sprintf("v%d data=%d offset=%d max=%s", stat.Version, stat.DataSize, stat.FileOffset, scbase.NumFormatB2(stat.MaxSize))
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file", stat.Location))
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file-data", fileDataStr))
+		}
+		if cmd.RestartTs > 0 {
+			restartTs := time.UnixMilli(cmd.RestartTs)
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "restartts", restartTs.Format(TsFormatStr)))
+		}
+		if cmd.DoneTs != 0 {
+			doneTs := time.UnixMilli(cmd.DoneTs)
+			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "donets", doneTs.Format(TsFormatStr)))
+			buf.WriteString(fmt.Sprintf("  %-15s %d\n", "exitcode", cmd.ExitCode))
+			buf.WriteString(fmt.Sprintf("  %-15s %dms\n", "duration", cmd.DurationMs))
+		}
+	}
+	stateStr := dbutil.QuickJson(line.LineState)
+	if len(stateStr) > 80 {
+		stateStr = stateStr[0:77] + "..."
+	}
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "state", stateStr))
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("line %d info", line.LineNum),
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
+func resolveLineCmdArg(ctx context.Context, screenId string, lineArg string, cmdStr string) (*sstore.LineType, *sstore.CmdType, error) {
+	lineId, err := sstore.FindLineIdByArg(ctx, screenId, lineArg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s error looking up lineid: %v", cmdStr, err)
+	}
+	if lineId == "" {
+		return nil, nil, fmt.Errorf("%s line %q not found", cmdStr, lineArg)
+	}
+	line, cmd, err := sstore.GetLineCmdByLineId(ctx, screenId, lineId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s error getting line: %v", cmdStr, err)
+	}
+	if line == nil {
+		return nil, nil, fmt.Errorf("%s line %q not found", cmdStr, lineArg)
+	}
+	if cmd == nil {
+		return nil, nil, fmt.Errorf("%s line %q is not a command", cmdStr, lineArg)
+	}
+	return line, cmd, nil
+}
+
+func makeStateDiffUpdate(pk *scpacket.FeCommandPacketType, title string, diff *rtnstate.StateDiffType) (scbus.UpdatePacket, error) {
+	var outputStr string
+	if resolveBool(pk.Kwargs["json"], false) {
+		barr, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling state diff: %v", err)
+		}
+		outputStr = string(barr)
+	} else {
+		outputStr = diff.String()
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: title,
+		InfoLines: splitLinesForInfo(outputStr),
+	})
+	return update, nil
+}
+
+// shows the state changes made by a single command (state it ran with vs. its rtnstate)
+func LineStateDiffCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) == 0 {
+		return nil, fmt.Errorf("/line:statediff requires an argument (line number or id)")
+	}
+	line, cmd, err := resolveLineCmdArg(ctx, ids.ScreenId, pk.Args[0], "/line:statediff")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := rtnstate.GetStateDiffFromPtrs(ctx, cmd.StatePtr, rtnstate.GetCmdFinalStatePtr(cmd))
+	if err != nil {
+		return nil, fmt.Errorf("/line:statediff error: %v", err)
+	}
+	return makeStateDiffUpdate(pk, fmt.Sprintf("line %d state changes", line.LineNum), diff)
+}
+
+// compares the shell state in effect after line1 with the state in effect after line2
+func StateDiffCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk.Args) != 2 {
+		return nil, fmt.Errorf("/state:diff requires 2 arguments (line1 line2)")
+	}
+	line1, cmd1, err := resolveLineCmdArg(ctx, ids.ScreenId, pk.Args[0], "/state:diff")
+	if err != nil {
+		return nil, err
+	}
+	line2, cmd2, err := resolveLineCmdArg(ctx, ids.ScreenId, pk.Args[1], "/state:diff")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := rtnstate.GetStateDiffFromPtrs(ctx, rtnstate.GetCmdFinalStatePtr(cmd1), rtnstate.GetCmdFinalStatePtr(cmd2))
+	if err != nil {
+		return nil, fmt.Errorf("/state:diff error: %v", err)
+	}
+	title := fmt.Sprintf("state diff line %d => line %d", line1.LineNum, line2.LineNum)
+	if cmd1.Remote.RemoteId != cmd2.Remote.RemoteId {
+		title += " (different connections)"
+	}
+	return makeStateDiffUpdate(pk, title, diff)
+}
+
+// saves the current shell state of the screen's remote instance as a named checkpoint
+func StateSaveCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, err
+	}
+	name := firstArg(pk)
+	if name == "" {
+		return nil, fmt.Errorf("/state:save requires an argument (checkpoint name)")
+	}
+	err = validateName(name, "checkpoint")
+	if err != nil {
+		return nil, fmt.Errorf("/state:save error: %w", err)
+	}
+	ri, err := sstore.GetRemoteInstance(ctx, ids.SessionId, ids.ScreenId, ids.Remote.RemotePtr)
+	if err != nil {
+		return nil, fmt.Errorf("/state:save error: %w", err)
+	}
+	if ri == nil || ri.StateBaseHash == "" {
+		return nil, fmt.Errorf("/state:save no shell state found (run /reset)")
+	}
+	cp := &sstore.StateCheckpointType{
+		RemoteId:         ids.Remote.RemotePtr.RemoteId,
+		Name:             name,
+		Ts:               time.Now().UnixMilli(),
+		ShellType:        ri.ShellType,
+		FeState:          ri.FeState,
+		StateBaseHash:    ri.StateBaseHash,
+		StateDiffHashArr: ri.StateDiffHashArr,
+	}
+	err = sstore.UpsertStateCheckpoint(ctx, cp)
+	if err != nil {
+		return nil, fmt.Errorf("/state:save error: %w", err)
+	}
+	return sstore.InfoMsgUpdate("saved state checkpoint %q", name), nil
+}
+
+// restores the screen's remote instance to the state after a line (line=[linearg]) or to a named checkpoint
+func StateRestoreCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, err
+	}
+	lineArg := pk.Kwargs["line"]
+	cpName := firstArg(pk)
+	if cpName == "" {
+		cpName = pk.Kwargs["name"]
+	}
+	if (lineArg == "") == (cpName == "") {
+		return nil, fmt.Errorf("/state:restore requires either line=[linearg] or a checkpoint name")
+	}
+	var statePtr packet.ShellStatePtr
+	var restoredFrom string
+	if lineArg != "" {
+		line, cmd, err := resolveLineCmdArg(ctx, ids.ScreenId, lineArg, "/state:restore")
+		if err != nil {
+			return nil, err
+		}
+		if cmd.Remote.RemoteId != ids.Remote.RemotePtr.RemoteId {
+			return nil, fmt.Errorf("/state:restore line %d was run on a different connection", line.LineNum)
+		}
+		statePtr = rtnstate.GetCmdFinalStatePtr(cmd)
+		restoredFrom = fmt.Sprintf("line %d", line.LineNum)
+	} else {
+		cp, err := sstore.GetStateCheckpoint(ctx, ids.Remote.RemotePtr.RemoteId, cpName)
+		if err != nil {
+			return nil, fmt.Errorf("/state:restore error: %w", err)
+		}
+		if cp == nil {
+			return nil, fmt.Errorf("/state:restore checkpoint %q not found for this connection", cpName)
+		}
+		statePtr = cp.GetStatePtr()
+		restoredFrom = fmt.Sprintf("checkpoint %q", cpName)
+	}
+	if statePtr.IsEmpty() {
+		return nil, fmt.Errorf("/state:restore no shell state recorded for %s", restoredFrom)
+	}
+	fullState, err := sstore.GetFullState(ctx, statePtr)
+	if err != nil {
+		return nil, fmt.Errorf("/state:restore cannot get shell state: %w", err)
+	}
+	remoteInst, err := remote.UpdateRIWithFullState(ctx, ids.SessionId, ids.ScreenId, ids.Remote.RemotePtr, fullState)
+	if err != nil {
+		return nil, fmt.Errorf("/state:restore could not update remote state: %w", err)
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.MakeSessionUpdateForRemote(ids.SessionId, remoteInst), sstore.InteractiveUpdate(pk.Interactive))
+	update.AddUpdate(sstore.InfoMsgType{InfoMsg: fmt.Sprintf("restored shell state from %s", restoredFrom)})
+	return update, nil
+}
+
+func StateCheckpointsCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, err
+	}
+	cps, err := sstore.GetStateCheckpoints(ctx, ids.Remote.RemotePtr.RemoteId)
+	if err != nil {
+		return nil, fmt.Errorf("/state:checkpoints error: %w", err)
+	}
+	if len(cps) == 0 {
+		return sstore.InfoMsgUpdate("no state checkpoints for this connection"), nil
+	}
+	var buf bytes.Buffer
+	for _, cp := range cps {
+		ts := time.UnixMilli(cp.Ts)
+		buf.WriteString(fmt.Sprintf("  %-20s %-5s %s  %s\n", cp.Name, cp.ShellType, ts.Format(TsFormatStr), cp.FeState["cwd"]))
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "state checkpoints",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
+func StateDeleteCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen|R_Remote)
+	if err != nil {
+		return nil, err
+	}
+	name := firstArg(pk)
+	if name == "" {
+		return nil, fmt.Errorf("/state:delete requires an argument (checkpoint name)")
+	}
+	err = sstore.DeleteStateCheckpoint(ctx, ids.Remote.RemotePtr.RemoteId, name)
+	if err != nil {
+		return nil, fmt.Errorf("/state:delete error: %w", err)
+	}
+	return sstore.InfoMsgUpdate("deleted state checkpoint %q", name), nil
+}
+
+// checks and audits commands run through /api/run-command with an api token.
+// allowed /eval commands are not audited (the parsed command is checked and audited when it runs).
+func checkApiTokenCommand(ctx context.Context, token *apitoken.ApiTokenType, cmdName string, pk *scpacket.FeCommandPacketType) error {
+	var screenId string
+	if pk.UIContext != nil {
+		screenId = pk.UIContext.ScreenId
+	}
+	// screen restrictions are also checked on the resolved screen (see resolveUiIds)
+	err := token.CheckCommand(cmdName, screenId)
+	if err != nil || cmdName != "eval" {
+		auditErr := apitoken.RecordUse(ctx, token, "/"+cmdName, screenId, err == nil, pk.GetRawStr())
+		if auditErr != nil {
+			log.Printf("error recording api token use: %v\n", auditErr)
+		}
+	}
+	return err
+}
+
+// returns 0 for "never"
+func resolveApiTokenExpires(expiresArg string, now time.Time) (int64, error) {
+	if expiresArg == "never" {
+		return 0, nil
+	}
+	var dur time.Duration
+	if days, ok := strings.CutSuffix(expiresArg, "d"); ok && isAllDigits(days) && days != "" {
+		numDays, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expires %q", expiresArg)
+		}
+		dur = time.Duration(numDays) * 24 * time.Hour
+	} else {
+		var err error
+		dur, err = time.ParseDuration(expiresArg)
+		if err != nil {
+			return 0, fmt.Errorf("invalid expires %q (use a duration like 12h or 30d, or \"never\")", expiresArg)
+		}
+	}
+	if dur <= 0 {
+		return 0, fmt.Errorf("invalid expires %q, must be positive", expiresArg)
+	}
+	return now.Add(dur).UnixMilli(), nil
+}
+
+// screensArg is a comma separated list of screen ids, or screen names/numbers in the current session ("current" for the current screen)
+func resolveApiTokenScreens(ctx context.Context, ids resolvedIds, screensArg string) ([]string, error) {
+	if screensArg == "" {
+		return nil, nil
+	}
+	var screenIds []string
+	for _, screenArg := range strings.Split(screensArg, ",") {
+		screenArg = strings.TrimSpace(screenArg)
+		if screenArg == "" {
+			continue
+		}
+		var screenId string
+		if screenArg == "current" {
+			screenId = ids.ScreenId
+		} else if _, err := uuid.Parse(screenArg); err == nil {
+			screen, err := sstore.GetScreenById(ctx, screenArg)
+			if err != nil {
+				return nil, err
+			}
+			if screen == nil {
+				return nil, fmt.Errorf("screen %s not found", screenArg)
+			}
+			screenId = screenArg
+		} else {
+			if ids.SessionId == "" {
+				return nil, fmt.Errorf("cannot resolve screen %q without a session", screenArg)
+			}
+			ritem, err := resolveSessionScreen(ctx, ids.SessionId, screenArg, ids.ScreenId)
+			if err != nil {
+				return nil, err
+			}
+			screenId = ritem.Id
+		}
+		if screenId == "" {
+			return nil, fmt.Errorf("cannot resolve screen %q", screenArg)
+		}
+		if !utilfn.ContainsStr(screenIds, screenId) {
+			screenIds = append(screenIds, screenId)
+		}
+	}
+	return screenIds, nil
+}
+
+func ApiTokenNewCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	ids, err := resolveUiIds(ctx, pk, 0)
+	if err != nil {
+		return nil, err
+	}
+	name := pk.Kwargs["name"]
+	if name == "" {
+		name = firstArg(pk)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("/apitoken:new requires a name (name=[name])")
+	}
+	err = validateName(name, "api token")
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:new %v", err)
+	}
+	scope := pk.Kwargs["scope"]
+	if scope == "" {
+		scope = apitoken.ScopeRead
+	}
+	if !apitoken.IsValidScope(scope) {
+		return nil, fmt.Errorf("/apitoken:new invalid scope %q, must be %s", scope, formatStrs(apitoken.AllScopes, "or", false))
+	}
+	screenIds, err := resolveApiTokenScreens(ctx, ids, pk.Kwargs["screens"])
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:new invalid screens: %v", err)
+	}
+	expiresArg := pk.Kwargs["expires"]
+	if expiresArg == "" {
+		expiresArg = DefaultApiTokenExpires
+	}
+	expiresTs, err := resolveApiTokenExpires(expiresArg, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:new %v", err)
+	}
+	token, tokenStr, err := apitoken.MakeToken(name, scope, screenIds, expiresTs)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:new %v", err)
+	}
+	err = apitoken.InsertToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:new %v", err)
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("api token %q (%s)", name, token.TokenId[0:8]),
+		InfoLines: []string{
+			tokenStr,
+			"",
+			fmt.Sprintf("scope=%s screens=%s expires=%s", scope, formatApiTokenScreens(token), formatApiTokenTs(token.ExpiresTs, "never")),
+			"this token will not be shown again, pass it in the X-AuthKey header",
+		},
+	})
+	return update, nil
+}
+
+func formatApiTokenTs(ts int64, zeroStr string) string {
+	if ts == 0 {
+		return zeroStr
+	}
+	return time.UnixMilli(ts).Format(TsFormatStr)
+}
+
+func formatApiTokenScreens(token *apitoken.ApiTokenType) string {
+	if len(token.ScreenIds) == 0 {
+		return "all"
+	}
+	var shortIds []string
+	for _, screenId := range token.ScreenIds {
+		shortIds = append(shortIds, screenId[0:8])
+	}
+	return strings.Join(shortIds, ",")
+}
+
+func ApiTokenListCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	tokens, err := apitoken.GetTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:list error: %v", err)
+	}
+	showAll := resolveBool(pk.Kwargs["all"], false)
+	now := time.Now()
+	var buf bytes.Buffer
+	var numShown int
+	for _, token := range tokens {
+		status := token.Status(now)
+		if !showAll && status != "active" {
+			continue
+		}
+		numShown++
+		buf.WriteString(fmt.Sprintf("  %s  %-20s %-6s %-8s screens=%-17s expires=%-19s lastused=%s\n", token.TokenId[0:8], token.Name, token.Scope, status,
+			formatApiTokenScreens(token), formatApiTokenTs(token.ExpiresTs, "never"), formatApiTokenTs(token.LastUsedTs, "-")))
+	}
+	if numShown == 0 {
+		return sstore.InfoMsgUpdate("no api tokens (create one with /apitoken:new)"), nil
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "api tokens",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
+func ApiTokenRevokeCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	tokenArg := firstArg(pk)
+	if tokenArg == "" {
+		return nil, fmt.Errorf("/apitoken:revoke requires an argument (token name or id)")
+	}
+	token, err := apitoken.ResolveToken(ctx, tokenArg)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:revoke %v", err)
+	}
+	if token.Revoked {
+		return nil, fmt.Errorf("/apitoken:revoke api token %q is already revoked", token.Name)
+	}
+	err = apitoken.RevokeToken(ctx, token.TokenId)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:revoke error: %v", err)
+	}
+	return sstore.InfoMsgUpdate("revoked api token %q (%s)", token.Name, token.TokenId[0:8]), nil
+}
+
+func ApiTokenAuditCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	maxItems, err := resolvePosInt(pk.Kwargs["max"], DefaultApiTokenAuditItems)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:audit invalid max: %v", err)
+	}
+	var tokenId string
+	tokenNames := make(map[string]string)
+	if tokenArg := firstArg(pk); tokenArg != "" {
+		token, err := apitoken.ResolveToken(ctx, tokenArg)
+		if err != nil {
+			return nil, fmt.Errorf("/apitoken:audit %v", err)
+		}
+		tokenId = token.TokenId
+	}
+	tokens, err := apitoken.GetTokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:audit error: %v", err)
+	}
+	for _, token := range tokens {
+		tokenNames[token.TokenId] = token.Name
+	}
+	audits, err := apitoken.GetAudit(ctx, tokenId, maxItems)
+	if err != nil {
+		return nil, fmt.Errorf("/apitoken:audit error: %v", err)
+	}
+	if len(audits) == 0 {
+		return sstore.InfoMsgUpdate("no api token usage recorded"), nil
+	}
+	var buf bytes.Buffer
+	for _, audit := range audits {
+		result := "allowed"
+		if !audit.Allowed {
+			result = "DENIED"
+		}
+		screenStr := "-"
+		if len(audit.ScreenId) >= 8 {
+			screenStr = audit.ScreenId[0:8]
+		}
+		buf.WriteString(fmt.Sprintf("  %s  %-20s %-7s %-28s screen=%-8s %s\n", formatApiTokenTs(audit.Ts, "-"), tokenNames[audit.TokenId], result, audit.Endpoint, screenStr, audit.Detail))
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "api token audit (most recent first)",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
+func TrashListCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	items, err := sstore.GetTrashItems(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("/trash:list error: %v", err)
+	}
+	if len(items) == 0 {
+		return sstore.InfoMsgUpdate("trash is empty"), nil
+	}
+	var buf bytes.Buffer
+	for idx, item := range items {
+		deletedTime := time.UnixMilli(item.DeletedTs)
+		buf.WriteString(fmt.Sprintf("%3d. %s  %-9s %-40s lines=%-5d deleted=%s  expires=%s\n", idx+1, item.TrashId[0:8], item.ItemType, item.Description, item.NumLines,
+			deletedTime.Format("2006-01-02 15:04"), deletedTime.Add(sstore.TrashRetention).Format("2006-01-02")))
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "trash (restore with /trash:restore N)",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
+
+func resolveTrashArg(ctx context.Context, cmdName string, trashArg string) (string, error) {
+	trashId, err := sstore.FindTrashIdByArg(ctx, trashArg)
+	if err != nil {
+		return "", fmt.Errorf("/%s error looking up trash item: %v", cmdName, err)
+	}
+	if trashId == "" {
+		return "", fmt.Errorf("/%s trash item %q not found (see /trash:list)", cmdName, trashArg)
+	}
+	return trashId, nil
+}
+
+func TrashRestoreCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	trashArg := firstArg(pk)
+	if trashArg == "" {
+		return nil, fmt.Errorf("/trash:restore requires an argument (item number from /trash:list or trash id)")
+	}
+	trashId, err := resolveTrashArg(ctx, "trash:restore", trashArg)
+	if err != nil {
+		return nil, err
+	}
+	update, err := sstore.RestoreTrashItem(ctx, trashId)
+	if err != nil {
+		return nil, fmt.Errorf("/trash:restore error: %v", err)
+	}
+	update.AddUpdate(sstore.InfoMsgType{InfoMsg: "restored from trash"})
+	return update, nil
+}
+
+// /trash:empty removes all items, /trash:empty [N|id] removes a single item
+func TrashEmptyCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	trashArg := firstArg(pk)
+	if trashArg != "" {
+		trashId, err := resolveTrashArg(ctx, "trash:empty", trashArg)
+		if err != nil {
+			return nil, err
+		}
+		err = sstore.DeleteTrashItem(ctx, trashId)
+		if err != nil {
+			return nil, fmt.Errorf("/trash:empty error: %v", err)
+		}
+		return sstore.InfoMsgUpdate("trash item permanently deleted"), nil
+	}
+	removed, err := sstore.EmptyTrash(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("/trash:empty error: %v", err)
+	}
+	return sstore.InfoMsgUpdate("trash emptied, %d item(s) permanently deleted", len(removed)), nil
+}
+
+func formatRetentionDays(days int) string {
+	if days == sstore.RetentionOff {
+		return "off"
+	}
+	if days == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dd", days)
+}
+
+func formatRetentionSize(size int64) string {
+	if size == sstore.RetentionOff {
+		return "off"
+	}
+	if size == 0 {
+		return "-"
+	}
+	return scbase.NumFormatB2(size)
+}
+
+var byteSizeRe = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*(b|k|kb|m|mb|g|gb|t|tb)?$`)
+
+// parses sizes like "500MB", "5g", "1.5GB" (1024 based)
+func parseByteSize(arg string) (int64, error) {
+	m := byteSizeRe.FindStringSubmatch(strings.TrimSpace(arg))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q (use a number with an optional B, KB, MB, GB, or TB suffix)", arg)
 	}
-	lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
+	fval, err := strconv.ParseFloat(m[1], 64)
 	if err != nil {
-		return nil, fmt.Errorf("/line:archive error getting line: %v", err)
+		return 0, fmt.Errorf("invalid size %q", arg)
 	}
-	if lineObj == nil {
-		// no line (which is strange given we checked for it above).  just return a nop.
-		return nil, nil
+	mult := float64(1)
+	switch strings.TrimSuffix(strings.ToLower(m[2]), "b") {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	case "t":
+		mult = 1 << 40
 	}
-	update := scbus.MakeUpdatePacket()
-	sstore.AddLineUpdate(update, lineObj, nil)
-	return update, nil
+	return int64(fval * mult), nil
 }
 
-func LineMinimizeCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
-	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+// "" leaves the value unchanged (ok=false), "0" or "default" clears it, "off" disables the limit
+func resolveRetentionArg(arg string, isSession bool, parseFn func(string) (int64, error)) (int64, bool, error) {
+	if arg == "" {
+		return 0, false, nil
+	}
+	switch strings.ToLower(arg) {
+	case "0", "default":
+		return 0, true, nil
+	case "off":
+		if isSession {
+			return sstore.RetentionOff, true, nil
+		}
+		return 0, true, nil
+	}
+	val, err := parseFn(arg)
 	if err != nil {
-		return nil, err
+		return 0, false, err
 	}
-	if len(pk.Args) == 0 {
-		return nil, fmt.Errorf("/line:minimize requires arguments (line number or id and min value)")
+	if val <= 0 {
+		return 0, false, fmt.Errorf("must be greater than 0")
 	}
-	if len(pk.Args) > 2 {
-		return nil, fmt.Errorf("/line:minimize only takes up to 2 argument (line number or id and min value)")
+	return val, true, nil
+}
+
+func parseRetentionDays(arg string) (int64, error) {
+	ival, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of days %q", arg)
 	}
-	lineArg1 := pk.Args[0]
-	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg1)
+	return int64(ival), nil
+}
+
+func RetentionShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	policies, err := sstore.GetRetentionPolicies(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error looking up lineid: %v", err)
+		return nil, fmt.Errorf("/retention:show error: %v", err)
 	}
-	if lineId == "" {
-		return nil, fmt.Errorf("line %q not found", lineArg1)
+	clientPolicy := &sstore.RetentionPolicyType{}
+	var buf bytes.Buffer
+	for _, policy := range policies {
+		if policy.SessionId == "" {
+			clientPolicy = policy
+		}
 	}
-	lineArg2 := pk.Args[1]
-	minVal := resolveBool(lineArg2, true)
-	lineState := make(map[string]any)
-	if minVal {
-		lineState[sstore.LineState_Min] = minVal
-	} else {
-		// Remove sstore.LineState_Min from lineState if it exists
-		delete(lineState, sstore.LineState_Min)
+	buf.WriteString(fmt.Sprintf("  %-20s  outputdays=%-5s maxoutput=%-10s historydays=%s\n", "client", formatRetentionDays(clientPolicy.OutputDays),
+		formatRetentionSize(clientPolicy.MaxOutputSize), formatRetentionDays(clientPolicy.HistoryDays)))
+	for _, policy := range policies {
+		if policy.SessionId == "" {
+			continue
+		}
+		sessionName := policy.SessionId[0:8]
+		session, err := sstore.GetBareSessionById(ctx, policy.SessionId)
+		if err == nil && session != nil {
+			sessionName = session.Name
+		}
+		buf.WriteString(fmt.Sprintf("  %-20s  outputdays=%-5s maxoutput=%-10s historydays=%s\n", "session "+sessionName, formatRetentionDays(policy.OutputDays),
+			formatRetentionSize(policy.MaxOutputSize), formatRetentionDays(policy.HistoryDays)))
 	}
-	err = sstore.UpdateLineState(ctx, ids.ScreenId, lineId, lineState)
+	buf.WriteString("\n")
+	pending, err := janitor.RunJanitor(ctx, true)
 	if err != nil {
-		return nil, fmt.Errorf("cannot update linestate: %v", err)
+		return nil, fmt.Errorf("/retention:show error: %v", err)
 	}
-	lineObj, err := sstore.GetLineById(ctx, ids.ScreenId, lineId)
-	if err != nil {
-		return nil, fmt.Errorf("/line:minimize cannot retrieve updated line: %v", err)
+	buf.WriteString(fmt.Sprintf("total output: %s\n", scbase.NumFormatB2(pending.TotalOutputSize+pending.BytesRemoved)))
+	if pending.HasRemoved() {
+		buf.WriteString(fmt.Sprintf("pending: %s\n", pending.String()))
 	}
-	if lineObj == nil {
-		// no line (which is strange given we checked for it above).  just return a nop.
-		return nil, nil
+	lastReport := janitor.GetLastReport()
+	if lastReport != nil {
+		buf.WriteString(fmt.Sprintf("last run %s: %s\n", time.UnixMilli(lastReport.Ts).Format("2006-01-02 15:04"), lastReport.String()))
+		for _, errStr := range lastReport.Errors {
+			buf.WriteString(fmt.Sprintf("  error: %s\n", errStr))
+		}
 	}
 	update := scbus.MakeUpdatePacket()
-	sstore.AddLineUpdate(update, lineObj, nil)
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "retention policies (- means not set, set with /retention:set)",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
 	return update, nil
 }
 
-func LineDeleteCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
-	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
-	if err != nil {
-		return nil, err
-	}
-	if len(pk.Args) == 0 {
-		return nil, fmt.Errorf("/line:delete requires at least one argument (line number or id)")
+// /retention:set [scope=client|session] [outputdays=N] [maxoutput=SIZE] [historydays=N]
+func RetentionSetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	scope := defaultStr(pk.Kwargs["scope"], "client")
+	if scope != "client" && scope != "session" {
+		return nil, fmt.Errorf("/retention:set invalid scope %q (must be client or session)", scope)
 	}
-	var lineIds []string
-	for _, lineArg := range pk.Args {
-		lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	var sessionId string
+	if scope == "session" {
+		ids, err := resolveUiIds(ctx, pk, R_Session)
 		if err != nil {
-			return nil, fmt.Errorf("error looking up lineid: %v", err)
-		}
-		if lineId == "" {
-			return nil, fmt.Errorf("line %q not found", lineArg)
+			return nil, err
 		}
-		lineIds = append(lineIds, lineId)
+		sessionId = ids.SessionId
 	}
-	err = sstore.DeleteLinesByIds(ctx, ids.ScreenId, lineIds)
+	isSession := sessionId != ""
+	policy, err := sstore.GetRetentionPolicy(ctx, sessionId)
 	if err != nil {
-		return nil, fmt.Errorf("/line:delete error deleting lines: %v", err)
-	}
-	update := scbus.MakeUpdatePacket()
-	for _, lineId := range lineIds {
-		line := &sstore.LineType{ScreenId: ids.ScreenId, LineId: lineId, Remove: true}
-		sstore.AddLineUpdate(update, line, nil)
+		return nil, fmt.Errorf("/retention:set error: %v", err)
 	}
-	screen, err := sstore.FixupScreenSelectedLine(ctx, ids.ScreenId)
+	var varsUpdated []string
+	outputDays, ok, err := resolveRetentionArg(pk.Kwargs["outputdays"], isSession, parseRetentionDays)
 	if err != nil {
-		return nil, fmt.Errorf("/line:delete error fixing up screen: %v", err)
+		return nil, fmt.Errorf("/retention:set invalid outputdays: %v", err)
 	}
-	if screen != nil {
-		update.AddUpdate(*screen)
+	if ok {
+		policy.OutputDays = int(outputDays)
+		varsUpdated = append(varsUpdated, "outputdays")
 	}
-	return update, nil
-}
-
-func LineShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
-	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
+	maxOutput, ok, err := resolveRetentionArg(pk.Kwargs["maxoutput"], isSession, parseByteSize)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("/retention:set invalid maxoutput: %v", err)
 	}
-	if len(pk.Args) == 0 {
-		return nil, fmt.Errorf("/line:show requires an argument (line number or id)")
+	if ok {
+		policy.MaxOutputSize = maxOutput
+		varsUpdated = append(varsUpdated, "maxoutput")
 	}
-	lineArg := pk.Args[0]
-	lineId, err := sstore.FindLineIdByArg(ctx, ids.ScreenId, lineArg)
+	historyDays, ok, err := resolveRetentionArg(pk.Kwargs["historydays"], isSession, parseRetentionDays)
 	if err != nil {
-		return nil, fmt.Errorf("error looking up lineid: %v", err)
+		return nil, fmt.Errorf("/retention:set invalid historydays: %v", err)
 	}
-	if lineId == "" {
-		return nil, fmt.Errorf("line %q not found", lineArg)
+	if ok {
+		policy.HistoryDays = int(historyDays)
+		varsUpdated = append(varsUpdated, "historydays")
 	}
-	line, cmd, err := sstore.GetLineCmdByLineId(ctx, ids.ScreenId, lineId)
+	if len(varsUpdated) == 0 {
+		return nil, fmt.Errorf("/retention:set requires a value to set: %s", formatStrs([]string{"outputdays", "maxoutput", "historydays"}, "or", false))
+	}
+	err = sstore.SetRetentionPolicy(ctx, policy)
 	if err != nil {
-		return nil, fmt.Errorf("error getting line: %v", err)
+		return nil, fmt.Errorf("/retention:set error: %v", err)
 	}
-	if line == nil {
-		return nil, fmt.Errorf("line %q not found", lineArg)
+	return sstore.InfoMsgUpdate("%s retention policy updated: %s (applied within the hour, or run /retention:run)", scope, formatStrs(varsUpdated, "and", false)), nil
+}
+
+// /retention:run [dryrun=1]
+func RetentionRunCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	dryRun := resolveBool(pk.Kwargs["dryrun"], false)
+	report, err := janitor.RunJanitor(ctx, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("/retention:run error: %v", err)
 	}
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "screenid", line.ScreenId))
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "lineid", line.LineId))
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "type", line.LineType))
-	lineNumStr := strconv.FormatInt(line.LineNum, 10)
-	if line.LineNumTemp {
-		lineNumStr = "~" + lineNumStr
+	lines := []string{report.String(), fmt.Sprintf("total output: %s", scbase.NumFormatB2(report.TotalOutputSize))}
+	for _, errStr := range report.Errors {
+		lines = append(lines, fmt.Sprintf("error: %s", errStr))
 	}
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "linenum", lineNumStr))
-	ts := time.UnixMilli(line.Ts)
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "ts", ts.Format(TsFormatStr)))
-	if line.Ephemeral {
-		buf.WriteString(fmt.Sprintf("  %-15s %v\n", "ephemeral", true))
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "retention policy run",
+		InfoLines: lines,
+	})
+	return update, nil
+}
+
+func DBBackupCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	backup, err := sstore.BackupDB(ctx, sstore.DBBackupKind_Manual)
+	if err != nil {
+		return nil, fmt.Errorf("/db:backup error: %v", err)
 	}
-	if line.Renderer != "" {
-		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "renderer", line.Renderer))
-	} else {
-		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "renderer", "terminal"))
+	return sstore.InfoMsgUpdate("database backed up to %s (%s)", backup.Path, scbase.NumFormatB2(backup.Size)), nil
+}
+
+func DBListCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	backups, err := sstore.GetDBBackups()
+	if err != nil {
+		return nil, fmt.Errorf("/db:list error: %v", err)
 	}
-	if cmd != nil {
-		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "remote", cmd.Remote.MakeFullRemoteRef()))
-		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "status", cmd.Status))
-		if cmd.FeState["cwd"] != "" {
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "cwd", cmd.FeState["cwd"]))
-		}
-		buf.WriteString(fmt.Sprintf("  %-15s %s\n", "termopts", formatTermOpts(cmd.TermOpts)))
-		if cmd.TermOpts != cmd.OrigTermOpts {
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "orig-termopts", formatTermOpts(cmd.OrigTermOpts)))
-		}
-		if cmd.RtnState {
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "rtnstate", "true"))
-		}
-		stat, _ := sstore.StatCmdPtyFile(ctx, cmd.ScreenId, cmd.LineId)
-		if stat == nil {
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file", "-"))
-		} else {
-			fileDataStr := fmt.Sprintf("v%d data=%d offset=%d max=%s", stat.Version, stat.DataSize, stat.FileOffset, scbase.NumFormatB2(stat.MaxSize))
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file", stat.Location))
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "file-data", fileDataStr))
-		}
-		if cmd.RestartTs > 0 {
-			restartTs := time.UnixMilli(cmd.RestartTs)
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "restartts", restartTs.Format(TsFormatStr)))
-		}
-		if cmd.DoneTs != 0 {
-			doneTs := time.UnixMilli(cmd.DoneTs)
-			buf.WriteString(fmt.Sprintf("  %-15s %s\n", "donets", doneTs.Format(TsFormatStr)))
-			buf.WriteString(fmt.Sprintf("  %-15s %d\n", "exitcode", cmd.ExitCode))
-			buf.WriteString(fmt.Sprintf("  %-15s %dms\n", "duration", cmd.DurationMs))
-		}
+	if len(backups) == 0 {
+		return sstore.InfoMsgUpdate("no database backups (create one with /db:backup)"), nil
 	}
-	stateStr := dbutil.QuickJson(line.LineState)
-	if len(stateStr) > 80 {
-		stateStr = stateStr[0:77] + "..."
+	var buf bytes.Buffer
+	for idx, backup := range backups {
+		buf.WriteString(fmt.Sprintf("%3d. %-45s %-6s %s  %s\n", idx+1, backup.Name, backup.Kind, time.UnixMilli(backup.Ts).Format("2006-01-02 15:04"),
+			scbase.NumFormatB2(backup.Size)))
 	}
-	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "state", stateStr))
 	update := scbus.MakeUpdatePacket()
 	update.AddUpdate(sstore.InfoMsgType{
-		InfoTitle: fmt.Sprintf("line %d info", line.LineNum),
+		InfoTitle: fmt.Sprintf("database backups in %s (restore with /db:restore N)", scbase.GetDBBackupsDir()),
 		InfoLines: splitLinesForInfo(buf.String()),
 	})
 	return update, nil
 }
 
+// the snapshot replaces the current database when wavesrv restarts (changes made since the snapshot are lost)
+func DBRestoreCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	backupArg := firstArg(pk)
+	if backupArg == "" {
+		return nil, fmt.Errorf("/db:restore requires an argument (backup number from /db:list or backup name)")
+	}
+	backup, err := sstore.FindDBBackupByArg(backupArg)
+	if err != nil {
+		return nil, fmt.Errorf("/db:restore error: %v", err)
+	}
+	if backup == nil {
+		return nil, fmt.Errorf("/db:restore backup %q not found (see /db:list)", backupArg)
+	}
+	if RestartServerFn == nil {
+		return nil, fmt.Errorf("/db:restore cannot restart the server")
+	}
+	err = sstore.StageDBRestore(ctx, backup)
+	if err != nil {
+		return nil, fmt.Errorf("/db:restore error: %v", err)
+	}
+	go func() {
+		log.Printf("received /db:restore %s, restarting\n", backup.Name)
+		time.Sleep(1 * time.Second)
+		RestartServerFn("restoring database")
+	}()
+	return sstore.InfoMsgUpdate("restoring database from %s, restarting the local server", backup.Name), nil
+}
+
+func DBCheckCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	result, err := sstore.CheckDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("/db:check error: %v", err)
+	}
+	if len(result.Problems) > 0 {
+		lines := []string{fmt.Sprintf("integrity check found %d problem(s), database was not vacuumed", len(result.Problems))}
+		for _, problem := range result.Problems {
+			lines = append(lines, "  "+problem)
+		}
+		lines = append(lines, "consider restoring a backup (see /db:list)")
+		update := scbus.MakeUpdatePacket()
+		update.AddUpdate(sstore.InfoMsgType{
+			InfoTitle: "database check",
+			InfoError: "database integrity check failed",
+			InfoLines: lines,
+		})
+		return update, nil
+	}
+	return sstore.InfoMsgUpdate("database integrity check ok, vacuumed %s -> %s", scbase.NumFormatB2(result.SizeBefore), scbase.NumFormatB2(result.SizeAfter)), nil
+}
+
 func SetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	var setMap map[string]map[string]string
 	setMap = make(map[string]map[string]string)
@@ -5493,6 +7054,26 @@ func EditTestCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scb
 	return update, nil
 }
 
+// normalizes a signal name/number (e.g. "term", "SIGTERM", "15") to the format waveshell expects
+func resolveSignalArg(sigArg string) (string, error) {
+	if isAllDigits(sigArg) {
+		val, _ := strconv.Atoi(sigArg)
+		if val <= 0 || val > MaxSignalNum {
+			return "", fmt.Errorf("signal number is out of bounds: %q", sigArg)
+		}
+	} else if !strings.HasPrefix(strings.ToUpper(sigArg), "SIG") {
+		sigArg = "SIG" + sigArg
+	}
+	sigArg = strings.ToUpper(sigArg)
+	if len(sigArg) > 12 {
+		return "", fmt.Errorf("invalid signal (too long): %q", sigArg)
+	}
+	if !sigNameRe.MatchString(sigArg) {
+		return "", fmt.Errorf("invalid signal name/number: %q", sigArg)
+	}
+	return sigArg, nil
+}
+
 func SignalCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	ids, err := resolveUiIds(ctx, pk, R_Session|R_Screen)
 	if err != nil {
@@ -5522,21 +7103,9 @@ func SignalCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus
 	if cmd.Status != sstore.CmdStatusRunning {
 		return nil, fmt.Errorf("line %q command is not running, cannot send signal", lineArg)
 	}
-	sigArg := pk.Args[1]
-	if isAllDigits(sigArg) {
-		val, _ := strconv.Atoi(sigArg)
-		if val <= 0 || val > MaxSignalNum {
-			return nil, fmt.Errorf("signal number is out of bounds: %q", sigArg)
-		}
-	} else if !strings.HasPrefix(sigArg, "SIG") {
-		sigArg = "SIG" + sigArg
-	}
-	sigArg = strings.ToUpper(sigArg)
-	if len(sigArg) > 12 {
-		return nil, fmt.Errorf("invalid signal (too long): %q", sigArg)
-	}
-	if !sigNameRe.MatchString(sigArg) {
-		return nil, fmt.Errorf("invalid signal name/number: %q", sigArg)
+	sigArg, err := resolveSignalArg(pk.Args[1])
+	if err != nil {
+		return nil, err
 	}
 	wsh := remote.GetRemoteById(cmd.Remote.RemoteId)
 	if wsh == nil {
@@ -6090,6 +7659,45 @@ func ClientSetCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (sc
 		}
 		varsUpdated = append(varsUpdated, "sudopwtimeout")
 	}
+	if intervalStr, found := pk.Kwargs["sysmetricsinterval"]; found {
+		var intervalSec int
+		if intervalStr == "off" {
+			intervalSec = -1
+		} else {
+			intervalSec, err = resolvePosInt(intervalStr, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sysmetricsinterval, must be a number of seconds or \"off\": %v", err)
+			}
+			if intervalSec < remote.MinSysMetricsIntervalSec {
+				return nil, fmt.Errorf("invalid sysmetricsinterval, minimum is %d seconds", remote.MinSysMetricsIntervalSec)
+			}
+		}
+		clientOpts := clientData.ClientOpts
+		clientOpts.SysMetricsIntervalSec = intervalSec
+		err = sstore.SetClientOpts(ctx, clientOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error updating client sysmetricsinterval: %v", err)
+		}
+		varsUpdated = append(varsUpdated, "sysmetricsinterval")
+	}
+	if backupCountStr, found := pk.Kwargs["dbbackupcount"]; found {
+		var backupCount int
+		if backupCountStr == "off" {
+			backupCount = -1
+		} else {
+			backupCount, err = resolvePosInt(backupCountStr, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid dbbackupcount, must be a number of backups or \"off\": %v", err)
+			}
+		}
+		clientOpts := clientData.ClientOpts
+		clientOpts.DBBackupCount = backupCount
+		err = sstore.SetClientOpts(ctx, clientOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error updating client dbbackupcount: %v", err)
+		}
+		varsUpdated = append(varsUpdated, "dbbackupcount")
+	}
 	if sudoPwClearOnSleepStr, found := pk.Kwargs["sudopwclearonsleep"]; found {
 		newSudoPwClearOnSleep := resolveBool(sudoPwClearOnSleepStr, true)
 		feOpts := clientData.FeOpts
@@ -6266,6 +7874,34 @@ func TelemetryShowCommand(ctx context.Context, pk *scpacket.FeCommandPacketType)
 	return update, nil
 }
 
+// local usage summary (does not require telemetry to be on, nothing is sent)
+func TelemetryReportCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	days, err := resolvePosInt(pk.Kwargs["days"], telemetry.DefaultReportDays)
+	if err != nil {
+		return nil, fmt.Errorf("/telemetry:report invalid days: %v", err)
+	}
+	report, err := telemetry.GetUsageReport(ctx, days)
+	if err != nil {
+		return nil, fmt.Errorf("/telemetry:report error: %v", err)
+	}
+	var outputStr string
+	if resolveBool(pk.Kwargs["json"], false) {
+		barr, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("/telemetry:report error marshaling report: %v", err)
+		}
+		outputStr = string(barr)
+	} else {
+		outputStr = report.String()
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: fmt.Sprintf("usage report (last %d days)", report.Days),
+		InfoLines: splitLinesForInfo(outputStr),
+	})
+	return update, nil
+}
+
 func TelemetrySendCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
 	clientData, err := sstore.EnsureClientData(ctx)
 	if err != nil {
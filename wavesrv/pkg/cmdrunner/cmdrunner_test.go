@@ -0,0 +1,115 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+func makeRemoteEditPk(args []string, kwargs map[string]string) *scpacket.FeCommandPacketType {
+	pk := scpacket.MakeFeCommandPacket()
+	pk.MetaCmd = "remote"
+	pk.MetaSubCmd = "new"
+	pk.Args = args
+	pk.Kwargs = kwargs
+	return pk
+}
+
+func TestParseRemoteEditArgsConnectCmd(t *testing.T) {
+	tests := []struct {
+		name          string
+		isNew         bool
+		args          []string
+		kwargs        map[string]string
+		isErr         bool
+		canonicalName string
+		connectCmd    string
+	}{
+		{"new", true, []string{"mypod"}, map[string]string{"connectcmd": "kubectl exec -i mypod -- sh"}, false, "mypod", "kubectl exec -i mypod -- sh"},
+		{"trimmed", true, []string{"box"}, map[string]string{"connectcmd": "  lxc exec box -- sh  "}, false, "box", "lxc exec box -- sh"},
+		{"empty", true, []string{"box"}, map[string]string{"connectcmd": "  "}, true, "", ""},
+		{"too long", true, []string{"box"}, map[string]string{"connectcmd": strings.Repeat("x", MaxConnectCmdLen+1)}, true, "", ""},
+		{"no name", true, nil, map[string]string{"connectcmd": "lxc exec box -- sh"}, true, "", ""},
+		{"bad name", true, []string{"user@host"}, map[string]string{"connectcmd": "lxc exec box -- sh"}, true, "", ""},
+		{"ssh port", true, []string{"box"}, map[string]string{"connectcmd": "lxc exec box -- sh", "port": "22"}, true, "", ""},
+		{"ssh sudo", true, []string{"box"}, map[string]string{"connectcmd": "lxc exec box -- sh", "sudo": "1"}, true, "", ""},
+		{"edit", false, nil, map[string]string{"connectcmd": "lxc exec other -- sh"}, false, "", "lxc exec other -- sh"},
+	}
+	for _, test := range tests {
+		editArgs, err := parseRemoteEditArgs(test.isNew, makeRemoteEditPk(test.args, test.kwargs), false)
+		if test.isErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if editArgs.ConnectCmd != test.connectCmd || editArgs.CanonicalName != test.canonicalName {
+			t.Errorf("%s: got name %q connectcmd %q", test.name, editArgs.CanonicalName, editArgs.ConnectCmd)
+		}
+		if !test.isNew && editArgs.EditMap[sstore.RemoteField_ConnectCmd] != test.connectCmd {
+			t.Errorf("%s: connectcmd missing from edit map %v", test.name, editArgs.EditMap)
+		}
+	}
+	_, err := parseRemoteEditArgs(false, makeRemoteEditPk(nil, map[string]string{"connectcmd": "sh"}), true)
+	if err == nil {
+		t.Errorf("expected an error setting connectcmd on the local remote")
+	}
+}
+
+func TestParseRemoteEditArgsRunAs(t *testing.T) {
+	tests := []struct {
+		name          string
+		isNew         bool
+		args          []string
+		kwargs        map[string]string
+		isErr         bool
+		canonicalName string
+		runAsMethod   string
+	}{
+		{"ssh sudo", true, []string{"user@host"}, map[string]string{"runas": "deploy"}, false, "runas:deploy@user@host", sstore.RunAsMethodSudo},
+		{"ssh su", true, []string{"user@host"}, map[string]string{"runas": "deploy", "runasmethod": "su"}, false, "runas:deploy@user@host", sstore.RunAsMethodSu},
+		{"local", true, nil, map[string]string{"runas": "svc.user-1"}, false, "runas:svc.user-1@local", sstore.RunAsMethodSudo},
+		{"local underscore", true, nil, map[string]string{"runas": "_www"}, false, "runas:_www@local", sstore.RunAsMethodSudo},
+		{"bad method", true, []string{"user@host"}, map[string]string{"runas": "deploy", "runasmethod": "doas"}, true, "", ""},
+		{"method without user", true, []string{"user@host"}, map[string]string{"runasmethod": "sudo"}, true, "", ""},
+		{"with sudo", true, []string{"user@host"}, map[string]string{"runas": "deploy", "sudo": "1"}, true, "", ""},
+		{"local with port", true, nil, map[string]string{"runas": "deploy", "port": "22"}, true, "", ""},
+		{"with connectcmd", true, []string{"box"}, map[string]string{"runas": "deploy", "connectcmd": "lxc exec box -- sh"}, true, "", ""},
+		{"edit", false, nil, map[string]string{"runas": "deploy"}, true, "", ""},
+		{"option user", true, nil, map[string]string{"runas": "-u"}, true, "", ""},
+		{"space", true, nil, map[string]string{"runas": "a b"}, true, "", ""},
+		{"semicolon", true, nil, map[string]string{"runas": "root;id"}, true, "", ""},
+		{"subst", true, nil, map[string]string{"runas": "$(id)"}, true, "", ""},
+		{"quote", true, nil, map[string]string{"runas": "o'brien"}, true, "", ""},
+		{"at", true, nil, map[string]string{"runas": "user@host"}, true, "", ""},
+		{"too long", true, nil, map[string]string{"runas": strings.Repeat("u", MaxRemoteAliasLen+1)}, true, "", ""},
+	}
+	for _, test := range tests {
+		editArgs, err := parseRemoteEditArgs(test.isNew, makeRemoteEditPk(test.args, test.kwargs), false)
+		if test.isErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if editArgs.CanonicalName != test.canonicalName {
+			t.Errorf("%s: got name %q, expected %q", test.name, editArgs.CanonicalName, test.canonicalName)
+		}
+		if editArgs.SSHOpts == nil || editArgs.SSHOpts.RunAsUser != test.kwargs["runas"] || editArgs.SSHOpts.RunAsMethod != test.runAsMethod {
+			t.Errorf("%s: unexpected sshopts %#v", test.name, editArgs.SSHOpts)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/apitoken"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
 	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
@@ -234,6 +235,32 @@ func resolveUiIds(ctx context.Context, pk *scpacket.FeCommandPacketType, rtype i
 			rtn.ScreenId = screenId
 		}
 	}
+	if rtn.SessionId == "" && rtn.ScreenId != "" {
+		// external clients (wavecli, api) may only know the screen
+		screen, err := sstore.GetScreenById(ctx, rtn.ScreenId)
+		if err != nil {
+			return rtn, err
+		}
+		if screen == nil {
+			return rtn, fmt.Errorf("screen %s not found", rtn.ScreenId)
+		}
+		rtn.SessionId = screen.SessionId
+	}
+	if rtn.SessionId == "" && rtype&R_Session > 0 {
+		// the ui always sends its session, external clients (wavecli, api) default to the session active in the ui
+		sessionId, err := sstore.GetActiveSessionId(ctx)
+		if err != nil {
+			return rtn, err
+		}
+		rtn.SessionId = sessionId
+	}
+	if token := apitoken.FromContext(ctx); token != nil && rtn.ScreenId != "" {
+		// the screen kwarg can point somewhere other than the ui context, check the screen that was resolved
+		err := token.CheckScreen(rtn.ScreenId)
+		if err != nil {
+			return rtn, err
+		}
+	}
 	var rptr *sstore.RemotePtrType
 	var err error
 	if pk.Kwargs["remote"] != "" {
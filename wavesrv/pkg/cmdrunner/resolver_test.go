@@ -0,0 +1,89 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/apitoken"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// migrated db in a temp wave home, closed when the test ends
+func setupTestDB(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	sstore.CloseDB()
+	t.Cleanup(sstore.CloseDB)
+	err := sstore.TryMigrateUp()
+	if err != nil {
+		t.Fatalf("cannot migrate db: %v", err)
+	}
+	_, err = sstore.EnsureClientData(context.Background())
+	if err != nil {
+		t.Fatalf("cannot create client data: %v", err)
+	}
+	err = sstore.EnsureLocalRemote(context.Background())
+	if err != nil {
+		t.Fatalf("cannot create local remote: %v", err)
+	}
+}
+
+// a screen:open packet as sent by wavecli screen:new (no session in the ui context)
+func makeExternalScreenOpenPk() *scpacket.FeCommandPacketType {
+	pk := scpacket.MakeFeCommandPacket()
+	pk.MetaCmd = "screen"
+	pk.MetaSubCmd = "open"
+	pk.Kwargs = map[string]string{"activate": "false"}
+	pk.UIContext = &scpacket.UIContextType{}
+	return pk
+}
+
+func TestScreenOpenActiveSession(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, sessionId, _, err := sstore.InsertSessionWithName(ctx, "test", true)
+	if err != nil {
+		t.Fatalf("cannot create session: %v", err)
+	}
+	t.Cleanup(func() { apitoken.FlushAudit(context.Background()) })
+	tests := []struct {
+		name  string
+		token *apitoken.ApiTokenType // nil for the main auth key
+		isErr bool
+	}{
+		{"main auth key", nil, false},
+		{"run token", &apitoken.ApiTokenType{TokenId: "token-run", Scope: apitoken.ScopeRun}, false},
+		{"admin token", &apitoken.ApiTokenType{TokenId: "token-admin", Scope: apitoken.ScopeAdmin}, false},
+		{"screen-restricted token", &apitoken.ApiTokenType{TokenId: "token-screen", Scope: apitoken.ScopeRun, ScreenIds: []string{"screen-a"}}, true},
+	}
+	for _, test := range tests {
+		pk := makeExternalScreenOpenPk()
+		testCtx := ctx
+		if test.token != nil {
+			testCtx = apitoken.WithToken(ctx, test.token)
+			err = checkApiTokenCommand(testCtx, test.token, "screen:open", pk)
+			if test.isErr {
+				if err == nil {
+					t.Errorf("%s: expected /screen:open to be rejected", test.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+				continue
+			}
+		}
+		ids, err := resolveUiIds(testCtx, pk, R_Session)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if ids.SessionId != sessionId {
+			t.Errorf("%s: expected the active session %s, got %q", test.name, sessionId, ids.SessionId)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scpacket"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// screen templates (see configstore/screentemplates.go) are applied after the screen is created.
+// the template's cwd and env become a single "cd ... && export ..." command that runs before the
+// template's commands.  commands are started in order, each one waits for the screen's remote to be
+// connected and for any state-changing command (cd, export, etc.) to finish, but not for long running
+// commands (so a template can start a "tail -f" and keep going).
+
+const ScreenTemplateReadyTimeout = 60 * time.Second
+const ScreenTemplatePollInterval = 200 * time.Millisecond
+const ScreenTemplateCmdTimeout = 10 * time.Second
+
+func validateScreenTemplate(ctx context.Context, tmpl *configstore.ScreenTemplateType, sessionId string) error {
+	if tmpl.TabName != "" {
+		err := validateName(tmpl.TabName, "screen")
+		if err != nil {
+			return err
+		}
+	}
+	if tmpl.TabColor != "" {
+		err := validateColor(tmpl.TabColor, "screen tabcolor")
+		if err != nil {
+			return err
+		}
+	}
+	if tmpl.Sidebar != nil && tmpl.Sidebar.Width != "" && !sidebarWidthRe.MatchString(tmpl.Sidebar.Width) {
+		return fmt.Errorf("invalid sidebar width %q, must be either a px value or a percent (e.g. '300px' or '50%%')", tmpl.Sidebar.Width)
+	}
+	if tmpl.Remote != "" {
+		_, rptr, _, err := resolveRemote(ctx, tmpl.Remote, sessionId, "")
+		if err != nil {
+			return err
+		}
+		if rptr == nil {
+			return fmt.Errorf("remote %q not found", tmpl.Remote)
+		}
+	}
+	for _, cmdStr := range tmpl.Commands {
+		if len(cmdStr) > MaxCommandLen {
+			return fmt.Errorf("command too long len:%d, max:%d", len(cmdStr), MaxCommandLen)
+		}
+	}
+	if initCmd := makeScreenTemplateInitCmd(tmpl); len(initCmd) > MaxCommandLen {
+		return fmt.Errorf("cwd and env too long (command len:%d, max:%d)", len(initCmd), MaxCommandLen)
+	}
+	return nil
+}
+
+// quotes a directory for cd, a leading "~" or "~/" is left unquoted so the shell expands it
+func quoteCdDir(dir string) string {
+	if dir == "~" {
+		return dir
+	}
+	if strings.HasPrefix(dir, "~/") {
+		if dir == "~/" {
+			return dir
+		}
+		return "~/" + shellescape.Quote(dir[2:])
+	}
+	return shellescape.Quote(dir)
+}
+
+// returns "" if the template has no cwd or env
+func makeScreenTemplateInitCmd(tmpl *configstore.ScreenTemplateType) string {
+	var parts []string
+	if tmpl.Cwd != "" {
+		parts = append(parts, "cd "+quoteCdDir(tmpl.Cwd))
+	}
+	if len(tmpl.Env) > 0 {
+		var assigns []string
+		for _, name := range tmpl.EnvNames() {
+			assigns = append(assigns, name+"="+shellescape.Quote(tmpl.Env[name]))
+		}
+		parts = append(parts, "export "+strings.Join(assigns, " "))
+	}
+	return strings.Join(parts, " && ")
+}
+
+func getScreenTemplateCmds(tmpl *configstore.ScreenTemplateType) []string {
+	var rtn []string
+	if initCmd := makeScreenTemplateInitCmd(tmpl); initCmd != "" {
+		rtn = append(rtn, initCmd)
+	}
+	return append(rtn, tmpl.Commands...)
+}
+
+// applies the template's screen options and connects the screen to the template's remote.
+// startup commands are run asynchronously (they need the connection to finish first).
+func applyScreenTemplate(ctx context.Context, tmpl *configstore.ScreenTemplateType, uiContext *scpacket.UIContextType) (scbus.UpdatePacket, error) {
+	screenId := uiContext.ScreenId
+	update := scbus.MakeUpdatePacket()
+	updateMap := make(map[string]interface{})
+	if tmpl.TabColor != "" {
+		updateMap[sstore.ScreenField_TabColor] = tmpl.TabColor
+	}
+	if tmpl.TabIcon != "" {
+		updateMap[sstore.ScreenField_TabIcon] = tmpl.TabIcon
+	}
+	if len(updateMap) > 0 {
+		screen, err := sstore.UpdateScreen(ctx, screenId, updateMap)
+		if err != nil {
+			return nil, fmt.Errorf("cannot update screen: %v", err)
+		}
+		update.AddUpdate(*screen)
+	}
+	if tmpl.Sidebar != nil {
+		screen, err := sidebarSetOpen(ctx, "screen:new", screenId, tmpl.Sidebar.Open, tmpl.Sidebar.Width)
+		if err != nil {
+			return nil, err
+		}
+		update.AddUpdate(*screen)
+	}
+	if tmpl.TermTheme != "" {
+		clientData, err := sstore.EnsureClientData(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot retrieve client data: %v", err)
+		}
+		feOpts := clientData.FeOpts
+		if feOpts.TermThemeSettings == nil {
+			feOpts.TermThemeSettings = make(map[string]string)
+		}
+		feOpts.TermThemeSettings[screenId] = tmpl.TermTheme
+		err = sstore.UpdateClientFeOpts(ctx, feOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error updating client feopts: %v", err)
+		}
+		clientData, err = sstore.EnsureClientData(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot retrieve updated client data: %v", err)
+		}
+		update.AddUpdate(*clientData)
+	}
+	remoteName := tmpl.Remote
+	if remoteName == "" {
+		remoteName = sstore.LocalRemoteAlias
+	}
+	crPk := scpacket.MakeFeCommandPacket()
+	crPk.MetaCmd = "connect"
+	crPk.Args = []string{remoteName}
+	crPk.RawStr = "/connect " + remoteName
+	crPk.UIContext = uiContext
+	crUpdate, err := CrCommand(ctx, crPk)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to remote: %w", err)
+	}
+	update.Merge(crUpdate)
+	cmds := getScreenTemplateCmds(tmpl)
+	if len(cmds) > 0 {
+		go runScreenTemplateCmds(tmpl.Name, *uiContext, cmds)
+	}
+	return update, nil
+}
+
+// screen is ready when its remote is connected, has a shell state, and has no pending state command
+func isScreenReadyForCmd(ctx context.Context, sessionId string, screenId string) (bool, error) {
+	screen, err := sstore.GetScreenById(ctx, screenId)
+	if err != nil {
+		return false, err
+	}
+	if screen == nil || screen.Archived {
+		return false, fmt.Errorf("screen was closed")
+	}
+	wsh := remote.GetRemoteById(screen.CurRemote.RemoteId)
+	if wsh == nil || !wsh.IsConnected() {
+		return false, nil
+	}
+	statePtr, err := sstore.GetRemoteStatePtr(ctx, sessionId, screenId, screen.CurRemote)
+	if err != nil || statePtr == nil {
+		return false, nil
+	}
+	return !wsh.HasPendingStateCmd(screenId, screen.CurRemote), nil
+}
+
+func waitForScreenReady(ctx context.Context, sessionId string, screenId string) error {
+	for {
+		ready, err := isScreenReadyForCmd(ctx, sessionId, screenId)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for screen to be ready")
+		case <-time.After(ScreenTemplatePollInterval):
+		}
+	}
+}
+
+func runScreenTemplateCmds(tmplName string, uiContext scpacket.UIContextType, cmds []string) {
+	for idx, cmdStr := range cmds {
+		err := runScreenTemplateCmd(&uiContext, cmdStr)
+		if err != nil {
+			log.Printf("[error] screen template %q, command #%d: %v\n", tmplName, idx+1, err)
+			update := scbus.MakeUpdatePacket()
+			sstore.AddInfoMsgUpdateError(update, fmt.Sprintf("screen template %q, cannot run %q: %v (remaining commands skipped)", tmplName, cmdStr, err))
+			scbus.MainUpdateBus.DoScreenUpdate(uiContext.ScreenId, update)
+			return
+		}
+	}
+}
+
+func runScreenTemplateCmd(uiContext *scpacket.UIContextType, cmdStr string) error {
+	waitCtx, waitCancelFn := context.WithTimeout(context.Background(), ScreenTemplateReadyTimeout)
+	defer waitCancelFn()
+	err := waitForScreenReady(waitCtx, uiContext.SessionId, uiContext.ScreenId)
+	if err != nil {
+		return err
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), ScreenTemplateCmdTimeout)
+	defer cancelFn()
+	update, err := EvalCommand(ctx, makeEvalPacket(uiContext, cmdStr, false))
+	if err != nil {
+		return err
+	}
+	if update != nil {
+		scbus.MainUpdateBus.DoScreenUpdate(uiContext.ScreenId, update)
+	}
+	return nil
+}
+
+func ScreenTemplatesCommand(ctx context.Context, pk *scpacket.FeCommandPacketType) (scbus.UpdatePacket, error) {
+	names, err := configstore.ListScreenTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("/screen:templates cannot read templates: %v", err)
+	}
+	if len(names) == 0 {
+		return sstore.InfoMsgUpdate("no screen templates (create %s)", configstore.GetConfigPath(configstore.ScreenTemplatesDirName+"/[name].json")), nil
+	}
+	var buf bytes.Buffer
+	for _, name := range names {
+		tmpl, err := configstore.ReadScreenTemplate(name)
+		if err != nil {
+			buf.WriteString(fmt.Sprintf("  %-20s error: %v\n", name, err))
+			continue
+		}
+		remoteName := tmpl.Remote
+		if remoteName == "" {
+			remoteName = sstore.LocalRemoteAlias
+		}
+		buf.WriteString(fmt.Sprintf("  %-20s remote=%-20s cwd=%-25s commands=%d\n", name, remoteName, defaultStr(tmpl.Cwd, "-"), len(tmpl.Commands)))
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{
+		InfoTitle: "screen templates (use /screen:new template=[name])",
+		InfoLines: splitLinesForInfo(buf.String()),
+	})
+	return update, nil
+}
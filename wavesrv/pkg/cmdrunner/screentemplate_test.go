@@ -0,0 +1,53 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+)
+
+func TestMakeScreenTemplateInitCmd(t *testing.T) {
+	tests := []struct {
+		tmpl     configstore.ScreenTemplateType
+		expected string
+	}{
+		{configstore.ScreenTemplateType{}, ""},
+		{configstore.ScreenTemplateType{Cwd: "~"}, "cd ~"},
+		{configstore.ScreenTemplateType{Cwd: "~/deploy"}, "cd ~/deploy"},
+		{configstore.ScreenTemplateType{Cwd: "~/my project"}, "cd ~/'my project'"},
+		{configstore.ScreenTemplateType{Cwd: "/tmp/a b"}, "cd '/tmp/a b'"},
+		{configstore.ScreenTemplateType{Cwd: "/~foo"}, "cd '/~foo'"},
+		{configstore.ScreenTemplateType{Cwd: "/src", Env: map[string]string{"B": "it's", "A": "1"}}, `cd /src && export A=1 B='it'"'"'s'`},
+	}
+	for _, test := range tests {
+		err := validateScreenTemplate(context.Background(), &test.tmpl, "")
+		if err != nil {
+			t.Errorf("cwd=%q env=%v: unexpected validation error: %v", test.tmpl.Cwd, test.tmpl.Env, err)
+		}
+		rtn := makeScreenTemplateInitCmd(&test.tmpl)
+		if rtn != test.expected {
+			t.Errorf("cwd=%q env=%v: got %q, expected %q", test.tmpl.Cwd, test.tmpl.Env, rtn, test.expected)
+		}
+	}
+}
+
+func TestValidateScreenTemplateInitCmdLen(t *testing.T) {
+	// each value fits, the combined cd/export command does not
+	halfVal := strings.Repeat("x", MaxCommandLen/2)
+	tmpls := []configstore.ScreenTemplateType{
+		{Env: map[string]string{"LONG": strings.Repeat("x", MaxCommandLen)}},
+		{Env: map[string]string{"A": halfVal, "B": halfVal}},
+		{Cwd: "/" + halfVal, Env: map[string]string{"A": halfVal}},
+	}
+	for idx, tmpl := range tmpls {
+		err := validateScreenTemplate(context.Background(), &tmpl, "")
+		if err == nil {
+			t.Errorf("template %d: expected an error for an over-length cwd/env command", idx)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// settings.json is applied on startup and whenever the file changes.  only the values that changed since the
+// file was last applied (SettingsAppliedFileName in the wave home dir) are written, so a value set with /client:set
+// stays in effect until it is changed in the file.  values are validated with the same rules as /client:set,
+// invalid values are skipped and reported to the frontend (along with the keybindings) in a "settings" update.
+
+const SettingsFileTimeout = 10 * time.Second
+const SettingsAppliedFileName = "settings-applied.json"
+
+func init() {
+	configstore.RegisterConfigHandler(configstore.SettingsFileName, func(relPath string, removed bool) {
+		if removed {
+			// editors often save by renaming, the new file will trigger another event
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), SettingsFileTimeout)
+		defer cancelFn()
+		update, err := ApplySettingsFile(ctx)
+		if err != nil {
+			log.Printf("error applying %s: %v\n", configstore.SettingsFileName, err)
+			return
+		}
+		scbus.MainUpdateBus.DoUpdate(update)
+	})
+}
+
+type settingsApplyType struct {
+	FeOpts     sstore.FeOptsType
+	ClientOpts sstore.ClientOptsType
+	AIOpts     sstore.OpenAIOptsType
+	Errors     []string
+}
+
+func (sa *settingsApplyType) addError(key string, err error) {
+	sa.Errors = append(sa.Errors, fmt.Sprintf("%s: %v", key, err))
+}
+
+func (sa *settingsApplyType) applyFeSettings(settings *configstore.SettingsType) {
+	if settings.TermFontSize != nil {
+		if *settings.TermFontSize < TermFontSizeMin || *settings.TermFontSize > TermFontSizeMax {
+			sa.addError("termfontsize", fmt.Errorf("must be a number between %d-%d", TermFontSizeMin, TermFontSizeMax))
+		} else {
+			sa.FeOpts.TermFontSize = *settings.TermFontSize
+		}
+	}
+	if settings.TermFontFamily != nil {
+		if err := validateFontFamily(*settings.TermFontFamily); err != nil {
+			sa.addError("termfontfamily", err)
+		} else {
+			sa.FeOpts.TermFontFamily = *settings.TermFontFamily
+		}
+	}
+	if settings.Theme != nil {
+		if !utilfn.ContainsStr(ThemeSources, *settings.Theme) {
+			sa.addError("theme", fmt.Errorf("must be %s", formatStrs(ThemeSources, "or", false)))
+		} else {
+			sa.FeOpts.Theme = *settings.Theme
+		}
+	}
+	if settings.TermTheme != nil {
+		termThemeSettings := make(map[string]string)
+		for key, val := range sa.FeOpts.TermThemeSettings {
+			termThemeSettings[key] = val
+		}
+		if *settings.TermTheme == "" {
+			delete(termThemeSettings, "root")
+		} else {
+			termThemeSettings["root"] = *settings.TermTheme
+		}
+		sa.FeOpts.TermThemeSettings = termThemeSettings
+	}
+	if settings.SudoPwStore != nil {
+		sudoPwStore := strings.ToLower(*settings.SudoPwStore)
+		if err := validateSudoPwStore(sudoPwStore); err != nil {
+			sa.addError("sudopwstore", fmt.Errorf("must be \"on\", \"off\", or \"notimeout\""))
+		} else {
+			sa.FeOpts.SudoPwStore = sudoPwStore
+		}
+	}
+	if settings.SudoPwTimeout != nil {
+		if *settings.SudoPwTimeout <= 0 {
+			sa.addError("sudopwtimeout", fmt.Errorf("must be a number of minutes greater than 0"))
+		} else {
+			sa.FeOpts.SudoPwTimeoutMs = *settings.SudoPwTimeout * 60 * 1000
+		}
+	}
+	if settings.SudoPwClearOnSleep != nil {
+		sa.FeOpts.NoSudoPwClearOnSleep = !*settings.SudoPwClearOnSleep
+	}
+}
+
+func (sa *settingsApplyType) applyClientSettings(settings *configstore.SettingsType) {
+	if settings.WebGL != nil {
+		sa.ClientOpts.WebGL = *settings.WebGL
+	}
+	if settings.Autocomplete != nil {
+		sa.ClientOpts.AutocompleteEnabled = *settings.Autocomplete
+	}
+	if settings.ReleaseCheck != nil {
+		sa.ClientOpts.NoReleaseCheck = !*settings.ReleaseCheck
+	}
+	if settings.DBBackupCount != nil {
+		if *settings.DBBackupCount < -1 {
+			sa.addError("dbbackupcount", fmt.Errorf("must be -1 (off), 0 (default), or a number of backups"))
+		} else {
+			sa.ClientOpts.DBBackupCount = *settings.DBBackupCount
+		}
+	}
+	if settings.SysMetricsInterval != nil {
+		interval := *settings.SysMetricsInterval
+		if interval != -1 && interval != 0 && interval < remote.MinSysMetricsIntervalSec {
+			sa.addError("sysmetricsinterval", fmt.Errorf("must be -1 (off), 0 (default), or at least %d seconds", remote.MinSysMetricsIntervalSec))
+		} else {
+			sa.ClientOpts.SysMetricsIntervalSec = interval
+		}
+	}
+}
+
+func (sa *settingsApplyType) applyAISettings(settings *configstore.SettingsType) {
+	if settings.AIApiToken != nil {
+		if err := validateOpenAIAPIToken(*settings.AIApiToken); err != nil {
+			sa.addError("aiapitoken", err)
+		} else {
+			sa.AIOpts.APIToken = *settings.AIApiToken
+		}
+	}
+	if settings.AIModel != nil {
+		if err := validateOpenAIModel(*settings.AIModel); err != nil {
+			sa.addError("aimodel", err)
+		} else {
+			sa.AIOpts.Model = *settings.AIModel
+		}
+	}
+	if settings.AIBaseURL != nil {
+		sa.AIOpts.BaseURL = *settings.AIBaseURL
+	}
+	if settings.AIMaxTokens != nil {
+		if *settings.AIMaxTokens < 0 || *settings.AIMaxTokens > 1000000 {
+			sa.addError("aimaxtokens", fmt.Errorf("out of range: %d", *settings.AIMaxTokens))
+		} else {
+			sa.AIOpts.MaxTokens = *settings.AIMaxTokens
+		}
+	}
+	if settings.AIMaxChoices != nil {
+		if *settings.AIMaxChoices < 0 || *settings.AIMaxChoices > 10 {
+			sa.addError("aimaxchoices", fmt.Errorf("out of range: %d", *settings.AIMaxChoices))
+		} else {
+			sa.AIOpts.MaxChoices = *settings.AIMaxChoices
+		}
+	}
+	if settings.AITimeout != nil {
+		if *settings.AITimeout < 0 {
+			sa.addError("aitimeout", fmt.Errorf("must not be negative"))
+		} else {
+			sa.AIOpts.Timeout = int(*settings.AITimeout * 1000)
+		}
+	}
+}
+
+func getSettingsAppliedPath() string {
+	return filepath.Join(scbase.GetWaveHomeDir(), SettingsAppliedFileName)
+}
+
+// returns nil if settings.json has not been applied before
+func readAppliedSettings() *configstore.SettingsType {
+	barr, err := os.ReadFile(getSettingsAppliedPath())
+	if err != nil {
+		return nil
+	}
+	var rtn configstore.SettingsType
+	err = json.Unmarshal(barr, &rtn)
+	if err != nil {
+		log.Printf("invalid %s (ignoring): %v\n", SettingsAppliedFileName, err)
+		return nil
+	}
+	return &rtn
+}
+
+func writeAppliedSettings(settings *configstore.SettingsType) error {
+	barr, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	fileName := getSettingsAppliedPath()
+	tmpName := fileName + ".tmp"
+	err = os.WriteFile(tmpName, barr, 0600) // can contain the ai api token
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// applies settings.json to the client data, returns an update with the new clientdata (if anything changed)
+// and a settings update (keybindings and errors).  the settings update is also cached for new connections.
+func ApplySettingsFile(ctx context.Context) (scbus.UpdatePacket, error) {
+	clientData, err := sstore.EnsureClientData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve client data: %v", err)
+	}
+	settings, parseErrs := configstore.ReadSettings()
+	settingsUpdate := &configstore.SettingsUpdateType{}
+	for _, parseErr := range parseErrs {
+		settingsUpdate.Errors = append(settingsUpdate.Errors, parseErr.Error())
+	}
+	if settings == nil && len(parseErrs) > 0 {
+		// keep the last good keybindings while the file has a syntax error
+		if lastUpdate := configstore.GetLastSettingsUpdate(); lastUpdate != nil {
+			settingsUpdate.Keybindings = lastUpdate.Keybindings
+		}
+	}
+	update := scbus.MakeUpdatePacket()
+	if settings != nil {
+		// validate the whole file (so invalid values keep being reported), but only write the changed values
+		validateSa := &settingsApplyType{}
+		validateSa.applyFeSettings(settings)
+		validateSa.applyClientSettings(settings)
+		validateSa.applyAISettings(settings)
+		settingsUpdate.Errors = append(settingsUpdate.Errors, validateSa.Errors...)
+		fullSettings := settings
+		settings = configstore.DiffSettings(readAppliedSettings(), fullSettings)
+		sa := &settingsApplyType{FeOpts: clientData.FeOpts, ClientOpts: clientData.ClientOpts}
+		if clientData.OpenAIOpts != nil {
+			sa.AIOpts = *clientData.OpenAIOpts
+		}
+		sa.applyFeSettings(settings)
+		sa.applyClientSettings(settings)
+		sa.applyAISettings(settings)
+		settingsUpdate.Keybindings = settings.Keybindings
+		changed, err := writeSettingsApply(ctx, clientData, sa)
+		if err != nil {
+			return nil, err
+		}
+		if settings.Telemetry != nil && clientData.ClientOpts.NoTelemetry == *settings.Telemetry {
+			updatedClientData, err := sstore.EnsureClientData(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("cannot retrieve updated client data: %v", err)
+			}
+			err = setNoTelemetry(ctx, updatedClientData, !*settings.Telemetry)
+			if err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		err = writeAppliedSettings(fullSettings)
+		if err != nil {
+			log.Printf("error writing %s: %v\n", SettingsAppliedFileName, err)
+		}
+		if changed {
+			clientData, err = sstore.EnsureClientData(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("cannot retrieve updated client data: %v", err)
+			}
+			update.AddUpdate(*clientData)
+		}
+	}
+	for _, errStr := range settingsUpdate.Errors {
+		log.Printf("%s: %s\n", configstore.SettingsFileName, errStr)
+	}
+	configstore.SetLastSettingsUpdate(settingsUpdate)
+	update.AddUpdate(*settingsUpdate)
+	return update, nil
+}
+
+// only writes the option groups that changed, returns true if anything was written
+func writeSettingsApply(ctx context.Context, clientData *sstore.ClientData, sa *settingsApplyType) (bool, error) {
+	var changed bool
+	oldFeOpts := clientData.FeOpts
+	if !reflect.DeepEqual(oldFeOpts, sa.FeOpts) {
+		err := sstore.UpdateClientFeOpts(ctx, sa.FeOpts)
+		if err != nil {
+			return false, fmt.Errorf("error updating client feopts: %v", err)
+		}
+		changed = true
+		if sa.FeOpts.SudoPwStore == "off" && oldFeOpts.SudoPwStore != "off" {
+			for _, proc := range remote.GetRemoteMap() {
+				proc.ClearCachedSudoPw()
+			}
+		}
+		if sa.FeOpts.SudoPwTimeoutMs != oldFeOpts.SudoPwTimeoutMs {
+			oldTimeout := oldFeOpts.SudoPwTimeoutMs / 1000 / 60
+			if oldTimeout == 0 {
+				oldTimeout = sstore.DefaultSudoTimeout
+			}
+			newTimeout := sa.FeOpts.SudoPwTimeoutMs / 1000 / 60
+			for _, proc := range remote.GetRemoteMap() {
+				proc.ChangeSudoTimeout(int64(newTimeout - oldTimeout))
+			}
+		}
+	}
+	if !reflect.DeepEqual(clientData.ClientOpts, sa.ClientOpts) {
+		err := sstore.SetClientOpts(ctx, sa.ClientOpts)
+		if err != nil {
+			return false, fmt.Errorf("error updating client opts: %v", err)
+		}
+		changed = true
+	}
+	var oldAIOpts sstore.OpenAIOptsType
+	if clientData.OpenAIOpts != nil {
+		oldAIOpts = *clientData.OpenAIOpts
+	}
+	if oldAIOpts != sa.AIOpts {
+		err := sstore.UpdateClientOpenAIOpts(ctx, sa.AIOpts)
+		if err != nil {
+			return false, fmt.Errorf("error updating client ai opts: %v", err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmdrunner
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+)
+
+func TestApplySettingsDBBackupCount(t *testing.T) {
+	tests := []struct {
+		data     string
+		isErr    bool
+		expected int
+	}{
+		{`{"dbbackupcount": 3}`, false, 3},
+		{`{"dbbackupcount": -1}`, false, -1},
+		{`{"dbbackupcount": 0}`, false, 0},
+		{`{"dbbackupcount": -2}`, true, 5},
+		{`{}`, false, 5},
+	}
+	for _, test := range tests {
+		settings, errs := configstore.ParseSettings([]byte(test.data))
+		if settings == nil {
+			t.Fatalf("%s: cannot parse settings: %v", test.data, errs)
+		}
+		sa := &settingsApplyType{}
+		sa.ClientOpts.DBBackupCount = 5
+		sa.applyClientSettings(settings)
+		if (len(sa.Errors) > 0) != test.isErr {
+			t.Errorf("%s: unexpected errors %v", test.data, sa.Errors)
+		}
+		if sa.ClientOpts.DBBackupCount != test.expected {
+			t.Errorf("%s: got dbbackupcount %d, expected %d", test.data, sa.ClientOpts.DBBackupCount, test.expected)
+		}
+	}
+}
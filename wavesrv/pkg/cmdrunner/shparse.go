@@ -51,6 +51,8 @@ var CmdParseOverrides map[string]string = map[string]string{
 	"run":     CmdParseTypeRaw,
 	"comment": CmdParseTypeRaw,
 	"chat":    CmdParseTypeRaw,
+
+	"line:note": CmdParseTypeRaw,
 }
 
 func DumpPacket(pk *scpacket.FeCommandPacketType) {
@@ -140,6 +142,9 @@ func onlyPositionalArgs(metaCmd string, metaSubCmd string) bool {
 }
 
 func onlyRawArgs(metaCmd string, metaSubCmd string) bool {
+	if metaSubCmd != "" && CmdParseOverrides[metaCmd+":"+metaSubCmd] == CmdParseTypeRaw {
+		return true
+	}
 	return CmdParseOverrides[metaCmd] == CmdParseTypeRaw
 }
 
@@ -66,3 +66,12 @@ func TestIsReturnStateCommand(t *testing.T) {
 	testRSC(t, "cd work; conda activate myenv", true)
 	testRSC(t, "asdf foo", true)
 }
+
+func TestOnlyRawArgs(t *testing.T) {
+	if !onlyRawArgs("comment", "") || !onlyRawArgs("line", "note") {
+		t.Errorf("comment and line:note should use raw args")
+	}
+	if onlyRawArgs("line", "star") || onlyRawArgs("line", "") {
+		t.Errorf("line and line:star should not use raw args")
+	}
+}
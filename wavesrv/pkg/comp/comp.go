@@ -549,8 +549,14 @@ func DoCompGen(ctx context.Context, cmdStr utilfn.StrWithPos, compCtx CompContex
 			compPrefix = fixupVarPrefix(compPrefix)
 		}
 	}
-	scType := getCompType(compPos)
-	crtn, err := DoSimpleComp(ctx, scType, compPrefix, compCtx, nil)
+	var crtn *CompReturn
+	var err error
+	if specTarget := findCompSpecTarget(compPos); specTarget != nil {
+		crtn, err = specTarget.doComp(ctx, compPrefix, compCtx)
+	} else {
+		scType := getCompType(compPos)
+		crtn, err = DoSimpleComp(ctx, scType, compPrefix, compCtx, nil)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,356 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package comp
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/remote"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/shparse"
+)
+
+// declarative (fig-style) completion specs.  built-in specs are embedded from specs/*.json,
+// user specs are read from config/completions/*.json (and override built-in specs with the same name)
+
+const CompSpecsDirName = "completions"
+
+const (
+	CompSpecTemplateFilepaths = "filepaths"
+	CompSpecTemplateFolders   = "folders"
+)
+
+//go:embed specs/*.json
+var builtinSpecFS embed.FS
+
+var compSpecLock = &sync.Mutex{}
+var compSpecMap map[string]*CompSpec // command name -> spec
+
+// a name can be specified as a single string or an array of aliases
+type CompSpecNames []string
+
+func (n *CompSpecNames) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*n = CompSpecNames{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("name must be a string or an array of strings")
+	}
+	*n = CompSpecNames(names)
+	return nil
+}
+
+func (n CompSpecNames) has(name string) bool {
+	for _, s := range n {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+type CompSpecGenerator struct {
+	Script string `json:"script"`
+}
+
+type CompSpecArg struct {
+	Name        string             `json:"name,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Suggestions []string           `json:"suggestions,omitempty"`
+	Template    string             `json:"template,omitempty"` // "filepaths" or "folders"
+	Generator   *CompSpecGenerator `json:"generator,omitempty"`
+	IsVariadic  bool               `json:"isVariadic,omitempty"`
+	IsOptional  bool               `json:"isOptional,omitempty"`
+}
+
+type CompSpecOption struct {
+	Name        CompSpecNames  `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Args        []*CompSpecArg `json:"args,omitempty"`
+}
+
+// used for the top-level command and for subcommands
+type CompSpec struct {
+	Name        CompSpecNames     `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Subcommands []*CompSpec       `json:"subcommands,omitempty"`
+	Options     []*CompSpecOption `json:"options,omitempty"`
+	Args        []*CompSpecArg    `json:"args,omitempty"`
+}
+
+// what to complete for the current word (the result of walking the spec with the words already typed)
+type compSpecTarget struct {
+	CmdName string
+	Words   []string     // static completions (subcommands, option names, and suggestions)
+	Arg     *CompSpecArg // argument to complete (can be nil)
+}
+
+func init() {
+	configstore.RegisterConfigHandler(CompSpecsDirName, func(relPath string, removed bool) {
+		err := LoadCompSpecs()
+		if err != nil {
+			log.Printf("error reloading completion specs: %v\n", err)
+		}
+	})
+}
+
+func (spec *CompSpec) findSubcommand(name string) *CompSpec {
+	for _, sub := range spec.Subcommands {
+		if sub.Name.has(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (spec *CompSpec) findOption(name string) *CompSpecOption {
+	for _, opt := range spec.Options {
+		if opt.Name.has(name) {
+			return opt
+		}
+	}
+	return nil
+}
+
+func (spec *CompSpec) getPositionalArg(argIdx int) *CompSpecArg {
+	if len(spec.Args) == 0 {
+		return nil
+	}
+	if argIdx < len(spec.Args) {
+		return spec.Args[argIdx]
+	}
+	lastArg := spec.Args[len(spec.Args)-1]
+	if lastArg.IsVariadic {
+		return lastArg
+	}
+	return nil
+}
+
+// args are the (expanded) words after the command name that precede the word being completed
+func (spec *CompSpec) findTarget(args []string, prefix string) *compSpecTarget {
+	curSpec := spec
+	argIdx := 0
+	var pendingOptArgs []*CompSpecArg
+	optsDone := false
+	for _, arg := range args {
+		if len(pendingOptArgs) > 0 {
+			pendingOptArgs = pendingOptArgs[1:]
+			continue
+		}
+		if arg == "--" {
+			optsDone = true
+			continue
+		}
+		if !optsDone && strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			optName, _, hasValue := strings.Cut(arg, "=")
+			opt := curSpec.findOption(optName)
+			if opt != nil && !hasValue {
+				pendingOptArgs = opt.Args
+			}
+			continue
+		}
+		if argIdx == 0 {
+			if sub := curSpec.findSubcommand(arg); sub != nil {
+				curSpec = sub
+				continue
+			}
+		}
+		argIdx++
+	}
+	rtn := &compSpecTarget{}
+	if len(pendingOptArgs) > 0 {
+		rtn.Arg = pendingOptArgs[0]
+		return rtn
+	}
+	if !optsDone && strings.HasPrefix(prefix, "-") {
+		for _, opt := range curSpec.Options {
+			rtn.Words = append(rtn.Words, opt.Name...)
+		}
+		return rtn
+	}
+	if argIdx == 0 {
+		for _, sub := range curSpec.Subcommands {
+			rtn.Words = append(rtn.Words, sub.Name...)
+		}
+	}
+	rtn.Arg = curSpec.getPositionalArg(argIdx)
+	if rtn.Arg == nil && len(rtn.Words) == 0 {
+		return nil
+	}
+	return rtn
+}
+
+func parseCompSpec(data []byte, defaultName string) (*CompSpec, error) {
+	var spec CompSpec
+	err := json.Unmarshal(data, &spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(spec.Name) == 0 {
+		spec.Name = CompSpecNames{defaultName}
+	}
+	return &spec, nil
+}
+
+func addSpecsFromFS(specMap map[string]*CompSpec, fsys fs.FS, dirName string) error {
+	entries, err := fs.ReadDir(fsys, dirName)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dirName, entry.Name()))
+		if err != nil {
+			log.Printf("error reading completion spec %s: %v\n", entry.Name(), err)
+			continue
+		}
+		spec, err := parseCompSpec(data, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			log.Printf("error parsing completion spec %s: %v\n", entry.Name(), err)
+			continue
+		}
+		for _, name := range spec.Name {
+			specMap[name] = spec
+		}
+	}
+	return nil
+}
+
+// LoadCompSpecs (re)loads the built-in and user completion specs
+func LoadCompSpecs() error {
+	specMap := make(map[string]*CompSpec)
+	err := addSpecsFromFS(specMap, builtinSpecFS, "specs")
+	if err != nil {
+		return fmt.Errorf("reading built-in completion specs: %w", err)
+	}
+	userDir := configstore.GetConfigPath(CompSpecsDirName)
+	err = addSpecsFromFS(specMap, os.DirFS(userDir), ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading completion specs from %s: %w", userDir, err)
+	}
+	compSpecLock.Lock()
+	defer compSpecLock.Unlock()
+	compSpecMap = specMap
+	return nil
+}
+
+func getCompSpec(cmdName string) *CompSpec {
+	compSpecLock.Lock()
+	defer compSpecLock.Unlock()
+	return compSpecMap[filepath.Base(cmdName)]
+}
+
+// returns nil if there is no spec for this command (caller falls back to the default completion)
+func findCompSpecTarget(compPos shparse.CompletionPos) *compSpecTarget {
+	if compPos.CompType != shparse.CompTypeArg || compPos.Cmd == nil || compPos.CmdWordPos <= 0 {
+		return nil
+	}
+	words := compPos.Cmd.Words
+	if len(words) == 0 {
+		return nil
+	}
+	cmdName, info := shparse.SimpleExpand(shparse.ExpandContext{}, words[0])
+	if info.HasVar || info.HasGlob || cmdName == "" {
+		return nil
+	}
+	spec := getCompSpec(cmdName)
+	if spec == nil {
+		return nil
+	}
+	var args []string
+	for idx := 1; idx < compPos.CmdWordPos && idx < len(words); idx++ {
+		argStr, _ := shparse.SimpleExpand(shparse.ExpandContext{}, words[idx])
+		args = append(args, argStr)
+	}
+	var prefix string
+	if compPos.CompWord != nil {
+		prefix, _ = shparse.SimpleExpandPrefix(shparse.ExpandContext{}, compPos.CompWord, compPos.CompWordOffset)
+	}
+	target := spec.findTarget(args, prefix)
+	if target != nil {
+		target.CmdName = filepath.Base(cmdName)
+	}
+	return target
+}
+
+func doCompGenScript(ctx context.Context, prefix string, script string, compCtx CompContext) (*CompReturn, error) {
+	if compCtx.RemotePtr == nil {
+		return nil, fmt.Errorf("cannot run completion generator, no remote")
+	}
+	wsh := remote.GetRemoteById(compCtx.RemotePtr.RemoteId)
+	if wsh == nil {
+		return nil, fmt.Errorf("invalid remote '%s', not found", compCtx.RemotePtr)
+	}
+	cgPacket := packet.MakeCompGenPacket()
+	cgPacket.ReqId = uuid.New().String()
+	cgPacket.CompType = packet.CompGenTypeScript
+	cgPacket.Prefix = prefix
+	cgPacket.Cwd = compCtx.Cwd
+	cgPacket.Script = script
+	resp, err := wsh.PacketRpc(ctx, cgPacket)
+	if err != nil {
+		return nil, err
+	}
+	if err = resp.Err(); err != nil {
+		return nil, err
+	}
+	comps := utilfn.GetStrArr(resp.Data, "comps")
+	hasMore := utilfn.GetBool(resp.Data, "hasmore")
+	return compsToCompReturn(comps, hasMore), nil
+}
+
+func (target *compSpecTarget) doComp(ctx context.Context, prefix string, compCtx CompContext) (*CompReturn, error) {
+	staticWords := append([]string{}, target.Words...)
+	if target.Arg != nil {
+		staticWords = append(staticWords, target.Arg.Suggestions...)
+	}
+	var staticComps []string
+	for _, word := range staticWords {
+		if strings.HasPrefix(word, prefix) && !utilfn.ContainsStr(staticComps, word) {
+			staticComps = append(staticComps, word)
+		}
+	}
+	crtn := compsToCompReturn(staticComps, false)
+	crtn.CompType = target.CmdName
+	if target.Arg == nil {
+		SortCompReturnEntries(crtn)
+		return crtn, nil
+	}
+	var argRtn *CompReturn
+	var err error
+	if target.Arg.Generator != nil && target.Arg.Generator.Script != "" {
+		argRtn, err = doCompGenScript(ctx, prefix, target.Arg.Generator.Script, compCtx)
+	} else if target.Arg.Template == CompSpecTemplateFolders {
+		argRtn, err = DoSimpleComp(ctx, CGTypeDir, prefix, compCtx, nil)
+	} else if target.Arg.Template == CompSpecTemplateFilepaths {
+		argRtn, err = DoSimpleComp(ctx, CGTypeFile, prefix, compCtx, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if argRtn == nil {
+		SortCompReturnEntries(crtn)
+		return crtn, nil
+	}
+	return CombineCompReturn(target.CmdName, crtn, argRtn), nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package comp
+
+import (
+	"testing"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+)
+
+func TestBuiltinCompSpecs(t *testing.T) {
+	specMap := make(map[string]*CompSpec)
+	err := addSpecsFromFS(specMap, builtinSpecFS, "specs")
+	if err != nil {
+		t.Fatalf("error reading built-in specs: %v", err)
+	}
+	for _, name := range []string{"git", "kubectl", "docker"} {
+		if specMap[name] == nil {
+			t.Errorf("missing built-in spec for %q", name)
+		}
+	}
+}
+
+func testSpecTarget(t *testing.T, spec *CompSpec, args []string, prefix string, expectedWords []string, expectedArg string) {
+	target := spec.findTarget(args, prefix)
+	if target == nil {
+		if expectedWords != nil || expectedArg != "" {
+			t.Errorf("args %v: expected target, got nil", args)
+		}
+		return
+	}
+	for _, word := range expectedWords {
+		if !utilfn.ContainsStr(target.Words, word) {
+			t.Errorf("args %v: expected word %q in %v", args, word, target.Words)
+		}
+	}
+	var argName string
+	if target.Arg != nil {
+		argName = target.Arg.Name
+	}
+	if argName != expectedArg {
+		t.Errorf("args %v: expected arg %q, got %q", args, expectedArg, argName)
+	}
+}
+
+func TestCompSpecTarget(t *testing.T) {
+	specJson := `{
+		"name": "tool",
+		"options": [{"name": ["-C", "--dir"], "args": [{"name": "dir", "template": "folders"}]}, {"name": "--verbose"}],
+		"subcommands": [
+			{"name": ["checkout", "co"], "options": [{"name": "-b", "args": [{"name": "newbranch"}]}], "args": [{"name": "branch"}, {"name": "path", "isVariadic": true}]},
+			{"name": "status"}
+		]
+	}`
+	spec, err := parseCompSpec([]byte(specJson), "tool")
+	if err != nil {
+		t.Fatalf("error parsing spec: %v", err)
+	}
+	testSpecTarget(t, spec, nil, "", []string{"checkout", "co", "status"}, "")
+	testSpecTarget(t, spec, nil, "--", []string{"-C", "--dir", "--verbose"}, "")
+	testSpecTarget(t, spec, []string{"-C"}, "", nil, "dir")
+	testSpecTarget(t, spec, []string{"-C", "/tmp"}, "", []string{"checkout"}, "")
+	testSpecTarget(t, spec, []string{"--dir=/tmp", "co"}, "", nil, "branch")
+	testSpecTarget(t, spec, []string{"checkout", "-b"}, "", nil, "newbranch")
+	testSpecTarget(t, spec, []string{"checkout", "main"}, "", nil, "path")
+	testSpecTarget(t, spec, []string{"checkout", "main", "a", "b"}, "", nil, "path")
+	testSpecTarget(t, spec, []string{"status"}, "", nil, "")
+	testSpecTarget(t, spec, []string{"checkout"}, "-", []string{"-b"}, "")
+}
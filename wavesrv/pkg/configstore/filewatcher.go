@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -13,11 +14,42 @@ import (
 var instance *Watcher
 var once sync.Once
 
+var handlerLock = &sync.Mutex{}
+var configHandlers = make(map[string]ConfigHandlerFn)
+
 type Watcher struct {
 	watcher *fsnotify.Watcher
 	mutex   sync.Mutex
 }
 
+// relPath is relative to the config directory (always uses forward slashes)
+// removed is set when the file was removed or renamed away
+type ConfigHandlerFn func(relPath string, removed bool)
+
+// RegisterConfigHandler registers fn to be called when relPath changes.
+// relPath can be a file or a directory (relative to the config directory).
+func RegisterConfigHandler(relPath string, fn ConfigHandlerFn) {
+	handlerLock.Lock()
+	defer handlerLock.Unlock()
+	configHandlers[strings.TrimSuffix(relPath, "/")] = fn
+}
+
+func getConfigHandler(relPath string) ConfigHandlerFn {
+	handlerLock.Lock()
+	defer handlerLock.Unlock()
+	for key, fn := range configHandlers {
+		if relPath == key || strings.HasPrefix(relPath, key+"/") {
+			return fn
+		}
+	}
+	return nil
+}
+
+// GetConfigPath returns the absolute path for a path relative to the config directory
+func GetConfigPath(relPath string) string {
+	return filepath.Join(configBaseDirAbsPath, filepath.FromSlash(relPath))
+}
+
 // GetWatcher returns the singleton instance of the Watcher
 func GetWatcher() *Watcher {
 	once.Do(func() {
@@ -27,9 +59,9 @@ func GetWatcher() *Watcher {
 			return
 		}
 		instance = &Watcher{watcher: watcher}
-		log.Printf("started config watcher: %v\n", configDirAbsPath)
-		if err := instance.addPath(configDirAbsPath); err != nil {
-			log.Printf("failed to add path %s to watcher: %v", configDirAbsPath, err)
+		log.Printf("started config watcher: %v\n", configBaseDirAbsPath)
+		if err := instance.addPath(configBaseDirAbsPath); err != nil {
+			log.Printf("failed to add path %s to watcher: %v", configBaseDirAbsPath, err)
 			return
 		}
 	})
@@ -80,6 +112,32 @@ func (w *Watcher) Close() {
 }
 
 func (w *Watcher) handleEvent(event fsnotify.Event) {
+	relPath, err := filepath.Rel(configBaseDirAbsPath, event.Name)
+	if err != nil {
+		log.Printf("error getting relative config path %s: %v", event.Name, err)
+		return
+	}
+	relPath = filepath.ToSlash(relPath)
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.addPath(event.Name); err != nil {
+				log.Printf("failed to add path %s to watcher: %v", event.Name, err)
+			}
+		}
+	}
+	if strings.HasPrefix(relPath, TermThemesDirName+"/") {
+		w.handleTermThemeEvent(event)
+		return
+	}
+	handlerFn := getConfigHandler(relPath)
+	if handlerFn == nil {
+		return
+	}
+	removed := event.Op&fsnotify.Remove == fsnotify.Remove || event.Op&fsnotify.Rename == fsnotify.Rename
+	handlerFn(relPath, removed)
+}
+
+func (w *Watcher) handleTermThemeEvent(event fsnotify.Event) {
 	config := make(ConfigReturn)
 	fileName, normalizedPath := getNameAndPath(event)
 
@@ -0,0 +1,130 @@
+package configstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// [config]/screen-templates/[name].json, used by /screen:new template=[name] to create a prepared screen.
+// templates are read when they are used, so there is nothing to reload when they change.
+
+const ScreenTemplatesDirName = "screen-templates"
+const MaxScreenTemplateCommands = 20
+
+var screenTemplateNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+var envVarNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type ScreenTemplateSidebarType struct {
+	Open  bool   `json:"open"`
+	Width string `json:"width,omitempty"`
+}
+
+type ScreenTemplateType struct {
+	Name      string                     `json:"-"`
+	TabName   string                     `json:"tabname,omitempty"`
+	TabColor  string                     `json:"tabcolor,omitempty"`
+	TabIcon   string                     `json:"tabicon,omitempty"`
+	Remote    string                     `json:"remote,omitempty"`
+	Cwd       string                     `json:"cwd,omitempty"`
+	Env       map[string]string          `json:"env,omitempty"`
+	TermTheme string                     `json:"termtheme,omitempty"`
+	Sidebar   *ScreenTemplateSidebarType `json:"sidebar,omitempty"`
+	Commands  []string                   `json:"commands,omitempty"`
+}
+
+func ValidateScreenTemplateName(name string) error {
+	if !screenTemplateNameRe.MatchString(name) {
+		return fmt.Errorf("invalid screen template name %q (must start with a letter or number and contain only letters, numbers, '_', '.' and '-')", name)
+	}
+	return nil
+}
+
+func screenTemplateRelPath(name string) string {
+	return ScreenTemplatesDirName + "/" + name + ".json"
+}
+
+// EnvNames returns the template's env var names in sorted order
+func (st *ScreenTemplateType) EnvNames() []string {
+	var rtn []string
+	for name := range st.Env {
+		rtn = append(rtn, name)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// unlike settings.json, a template with any invalid value is rejected (a half-applied template is not useful)
+func ParseScreenTemplate(name string, barr []byte) (*ScreenTemplateType, error) {
+	decoder := json.NewDecoder(bytes.NewReader(barr))
+	decoder.DisallowUnknownFields()
+	var rtn ScreenTemplateType
+	err := decoder.Decode(&rtn)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("syntax error at %s: %v", offsetToLineCol(barr, syntaxErr.Offset), err)
+		}
+		return nil, fmt.Errorf("invalid screen template: %s", jsonTypeErrStr(err))
+	}
+	rtn.Name = name
+	for _, envName := range rtn.EnvNames() {
+		if !envVarNameRe.MatchString(envName) {
+			return nil, fmt.Errorf("env: invalid variable name %q", envName)
+		}
+	}
+	if len(rtn.Commands) > MaxScreenTemplateCommands {
+		return nil, fmt.Errorf("commands: too many commands (max %d)", MaxScreenTemplateCommands)
+	}
+	for idx, cmdStr := range rtn.Commands {
+		if strings.TrimSpace(cmdStr) == "" {
+			return nil, fmt.Errorf("commands: command #%d is empty", idx+1)
+		}
+	}
+	return &rtn, nil
+}
+
+func ReadScreenTemplate(name string) (*ScreenTemplateType, error) {
+	err := ValidateScreenTemplateName(name)
+	if err != nil {
+		return nil, err
+	}
+	barr, err := os.ReadFile(GetConfigPath(screenTemplateRelPath(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("screen template %q not found (create %s)", name, GetConfigPath(screenTemplateRelPath(name)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := ParseScreenTemplate(name, barr)
+	if err != nil {
+		return nil, fmt.Errorf("screen template %q: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// returns the sorted template names (no error if the directory does not exist)
+func ListScreenTemplates() ([]string, error) {
+	entries, err := os.ReadDir(GetConfigPath(ScreenTemplatesDirName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rtn []string
+	for _, entry := range entries {
+		name, isJson := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !isJson || ValidateScreenTemplateName(name) != nil {
+			continue
+		}
+		rtn = append(rtn, name)
+	}
+	sort.Strings(rtn)
+	return rtn, nil
+}
@@ -0,0 +1,51 @@
+package configstore
+
+import (
+	"testing"
+)
+
+func TestParseScreenTemplate(t *testing.T) {
+	tmpl, err := ParseScreenTemplate("deploy", []byte(`{
+		"tabname": "deploy",
+		"remote": "ops@bastion",
+		"cwd": "~/deploy",
+		"env": {"KUBECONFIG": "/etc/kube/prod", "AWS_PROFILE": "prod"},
+		"sidebar": {"open": true, "width": "400px"},
+		"commands": ["git pull", "kubectl get pods"]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tmpl.Name != "deploy" || tmpl.Remote != "ops@bastion" || len(tmpl.Commands) != 2 || tmpl.Sidebar == nil || !tmpl.Sidebar.Open {
+		t.Errorf("template not parsed correctly: %+v", tmpl)
+	}
+	envNames := tmpl.EnvNames()
+	if len(envNames) != 2 || envNames[0] != "AWS_PROFILE" || envNames[1] != "KUBECONFIG" {
+		t.Errorf("unexpected env names %v", envNames)
+	}
+	badTemplates := []string{
+		`{"remote": "local",`,
+		`{"remotes": "local"}`,
+		`{"env": {"NOT-VALID": "x"}}`,
+		`{"commands": ["ls", " "]}`,
+		`{"commands": "ls"}`,
+	}
+	for _, bad := range badTemplates {
+		if _, err := ParseScreenTemplate("bad", []byte(bad)); err == nil {
+			t.Errorf("expected error for template %s", bad)
+		}
+	}
+}
+
+func TestValidateScreenTemplateName(t *testing.T) {
+	for _, name := range []string{"deploy", "on-call", "prod_db.v2"} {
+		if err := ValidateScreenTemplateName(name); err != nil {
+			t.Errorf("expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../settings", "a/b", ".hidden", "with space"} {
+		if err := ValidateScreenTemplateName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
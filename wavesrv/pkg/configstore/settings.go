@@ -0,0 +1,196 @@
+package configstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// [config]/settings.json, every field is optional (nil means "not set in the file, leave the current value alone").
+// the file is parsed key by key so one bad value does not prevent the rest of the file from being applied.
+
+const SettingsFileName = "settings.json"
+const SettingsUpdateTypeStr = "settings"
+
+type SettingsKeybindingType struct {
+	Command    string   `json:"command"`
+	Keys       []string `json:"keys"`
+	CommandStr []string `json:"commandStr,omitempty"`
+	Info       string   `json:"info,omitempty"`
+}
+
+type SettingsType struct {
+	TermFontSize       *int                      `json:"termfontsize,omitempty"`
+	TermFontFamily     *string                   `json:"termfontfamily,omitempty"`
+	Theme              *string                   `json:"theme,omitempty"`
+	TermTheme          *string                   `json:"termtheme,omitempty"`
+	WebGL              *bool                     `json:"webgl,omitempty"`
+	Autocomplete       *bool                     `json:"autocomplete,omitempty"`
+	Telemetry          *bool                     `json:"telemetry,omitempty"`
+	ReleaseCheck       *bool                     `json:"releasecheck,omitempty"`
+	SudoPwStore        *string                   `json:"sudopwstore,omitempty"`
+	SudoPwTimeout      *int                      `json:"sudopwtimeout,omitempty"` // minutes
+	SudoPwClearOnSleep *bool                     `json:"sudopwclearonsleep,omitempty"`
+	SysMetricsInterval *int                      `json:"sysmetricsinterval,omitempty"` // seconds, -1 for off
+	DBBackupCount      *int                      `json:"dbbackupcount,omitempty"`      // -1 for off, 0 for default
+	AIApiToken         *string                   `json:"aiapitoken,omitempty"`
+	AIModel            *string                   `json:"aimodel,omitempty"`
+	AIBaseURL          *string                   `json:"aibaseurl,omitempty"`
+	AIMaxTokens        *int                      `json:"aimaxtokens,omitempty"`
+	AIMaxChoices       *int                      `json:"aimaxchoices,omitempty"`
+	AITimeout          *float64                  `json:"aitimeout,omitempty"` // seconds
+	Keybindings        []*SettingsKeybindingType `json:"keybindings,omitempty"`
+}
+
+// sent to the frontend on connect and whenever settings.json is reloaded
+type SettingsUpdateType struct {
+	Keybindings []*SettingsKeybindingType `json:"keybindings,omitempty"`
+	Errors      []string                  `json:"errors,omitempty"`
+}
+
+func (SettingsUpdateType) GetType() string {
+	return SettingsUpdateTypeStr
+}
+
+var settingsLock = &sync.Mutex{}
+var lastSettingsUpdate *SettingsUpdateType
+
+func SetLastSettingsUpdate(update *SettingsUpdateType) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	lastSettingsUpdate = update
+}
+
+func GetLastSettingsUpdate() *SettingsUpdateType {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	return lastSettingsUpdate
+}
+
+func settingsJsonKey(field reflect.StructField) string {
+	tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return tag
+}
+
+// converts a json.SyntaxError offset (just past the bad byte) into a "line:col" string for error messages
+func offsetToLineCol(barr []byte, offset int64) string {
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(barr)) {
+		offset = int64(len(barr))
+	}
+	prefix := barr[0:offset]
+	line := bytes.Count(prefix, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(prefix, '\n')
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+func jsonTypeErrStr(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("invalid type, got %s expected %s", typeErr.Value, typeErr.Type.String())
+	}
+	return err.Error()
+}
+
+func validateKeybindings(keybindings []*SettingsKeybindingType) error {
+	for idx, kb := range keybindings {
+		if kb == nil || kb.Command == "" {
+			return fmt.Errorf("keybinding #%d: command is required", idx+1)
+		}
+		if kb.Keys == nil {
+			return fmt.Errorf("keybinding #%d (%s): keys is required (use [] to unbind)", idx+1, kb.Command)
+		}
+	}
+	return nil
+}
+
+// ParseSettings parses settings.json.  a syntax error fails the whole file (returns nil settings).
+// otherwise invalid keys/values are returned as errors and left unset in the returned settings.
+func ParseSettings(barr []byte) (*SettingsType, []error) {
+	var rawMap map[string]json.RawMessage
+	err := json.Unmarshal(barr, &rawMap)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, []error{fmt.Errorf("syntax error at %s: %v", offsetToLineCol(barr, syntaxErr.Offset), err)}
+		}
+		return nil, []error{fmt.Errorf("invalid settings (must be a json object): %v", jsonTypeErrStr(err))}
+	}
+	rtn := &SettingsType{}
+	rval := reflect.ValueOf(rtn).Elem()
+	fieldMap := make(map[string]int)
+	for i := 0; i < rval.NumField(); i++ {
+		fieldMap[settingsJsonKey(rval.Type().Field(i))] = i
+	}
+	keys := make([]string, 0, len(rawMap))
+	for key := range rawMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		fieldIdx, ok := fieldMap[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+			continue
+		}
+		field := rval.Field(fieldIdx)
+		newVal := reflect.New(field.Type())
+		err = json.Unmarshal(rawMap[key], newVal.Interface())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", key, jsonTypeErrStr(err)))
+			continue
+		}
+		field.Set(newVal.Elem())
+	}
+	err = validateKeybindings(rtn.Keybindings)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("keybindings: %v", err))
+		rtn.Keybindings = nil
+	}
+	return rtn, errs
+}
+
+// returns the settings in newSettings that are different from oldSettings (keybindings are always included).
+// used to only apply the values that were changed in the file, so values set with /client:set are not reverted.
+// oldSettings can be nil (everything set in newSettings is returned).
+func DiffSettings(oldSettings *SettingsType, newSettings *SettingsType) *SettingsType {
+	if oldSettings == nil {
+		oldSettings = &SettingsType{}
+	}
+	rtn := &SettingsType{Keybindings: newSettings.Keybindings}
+	oldVal := reflect.ValueOf(oldSettings).Elem()
+	newVal := reflect.ValueOf(newSettings).Elem()
+	rtnVal := reflect.ValueOf(rtn).Elem()
+	for i := 0; i < newVal.NumField(); i++ {
+		field := newVal.Field(i)
+		if field.Kind() != reflect.Pointer || field.IsNil() {
+			continue
+		}
+		if reflect.DeepEqual(field.Interface(), oldVal.Field(i).Interface()) {
+			continue
+		}
+		rtnVal.Field(i).Set(field)
+	}
+	return rtn
+}
+
+// returns (nil, nil) if settings.json does not exist
+func ReadSettings() (*SettingsType, []error) {
+	barr, err := os.ReadFile(GetConfigPath(SettingsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{err}
+	}
+	return ParseSettings(barr)
+}
@@ -0,0 +1,78 @@
+package configstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSettings(t *testing.T) {
+	settings, errs := ParseSettings([]byte(`{
+		"termfontsize": 14,
+		"theme": "dark",
+		"webgl": "yes",
+		"fontsize": 12,
+		"keybindings": [{"command": "app:openTab", "keys": ["Cmd:t"]}]
+	}`))
+	if settings == nil {
+		t.Fatalf("expected settings, got errors: %v", errs)
+	}
+	if settings.TermFontSize == nil || *settings.TermFontSize != 14 {
+		t.Errorf("termfontsize not parsed: %v", settings.TermFontSize)
+	}
+	if settings.Theme == nil || *settings.Theme != "dark" {
+		t.Errorf("theme not parsed: %v", settings.Theme)
+	}
+	if settings.WebGL != nil {
+		t.Errorf("invalid webgl value should be left unset")
+	}
+	if settings.AIModel != nil {
+		t.Errorf("aimodel should not be set")
+	}
+	if len(settings.Keybindings) != 1 || settings.Keybindings[0].Command != "app:openTab" {
+		t.Errorf("keybindings not parsed: %v", settings.Keybindings)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "fontsize: unknown setting") || !strings.HasPrefix(errs[1].Error(), "webgl: invalid type") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestParseSettingsErrors(t *testing.T) {
+	settings, errs := ParseSettings([]byte("{\n  \"theme\": \"dark\",\n}"))
+	if settings != nil || len(errs) != 1 || !strings.Contains(errs[0].Error(), "at 3:1") {
+		t.Errorf("expected syntax error with position, got %v", errs)
+	}
+	settings, errs = ParseSettings([]byte(`[1, 2]`))
+	if settings != nil || len(errs) != 1 {
+		t.Errorf("expected error for non-object settings, got %v", errs)
+	}
+	settings, errs = ParseSettings([]byte(`{"keybindings": [{"keys": ["Cmd:t"]}]}`))
+	if settings == nil || settings.Keybindings != nil || len(errs) != 1 {
+		t.Errorf("expected keybinding error, got %v", errs)
+	}
+}
+
+func TestDiffSettings(t *testing.T) {
+	oldSettings, _ := ParseSettings([]byte(`{"termfontsize": 14, "theme": "dark", "webgl": true}`))
+	newSettings, _ := ParseSettings([]byte(`{"termfontsize": 14, "theme": "light", "autocomplete": true,
+		"keybindings": [{"command": "app:openTab", "keys": ["Cmd:t"]}]}`))
+	diff := DiffSettings(oldSettings, newSettings)
+	if diff.TermFontSize != nil {
+		t.Errorf("unchanged termfontsize should not be in the diff")
+	}
+	if diff.WebGL != nil {
+		t.Errorf("removed webgl should not be in the diff")
+	}
+	if diff.Theme == nil || *diff.Theme != "light" || diff.Autocomplete == nil || !*diff.Autocomplete {
+		t.Errorf("changed values missing from the diff: %+v", diff)
+	}
+	if len(diff.Keybindings) != 1 {
+		t.Errorf("keybindings should always be in the diff")
+	}
+	diff = DiffSettings(nil, oldSettings)
+	if diff.TermFontSize == nil || diff.Theme == nil || diff.WebGL == nil {
+		t.Errorf("diff against nil should have all values: %+v", diff)
+	}
+}
@@ -13,9 +13,11 @@ import (
 )
 
 const ConfigReturnTypeStr = "termthemes"
-const configDir = "config/terminal-themes/"
+const configBaseDir = "config"
+const TermThemesDirName = "terminal-themes"
 
-var configDirAbsPath = path.Join(scbase.GetWaveHomeDir(), configDir)
+var configBaseDirAbsPath = path.Join(scbase.GetWaveHomeDir(), configBaseDir)
+var configDirAbsPath = path.Join(configBaseDirAbsPath, TermThemesDirName)
 
 type ConfigReturn map[string]map[string]string
 
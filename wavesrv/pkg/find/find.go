@@ -0,0 +1,363 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// search across sessions, screens and lines (session/screen names, line text, cmdstrs, line notes, remotes and cwds).
+// results are ranked by how well they match and by recency.
+package find
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+const DefaultMaxItems = 20
+const MaxLineCandidates = 500
+const MaxScreenCandidates = 200
+const MaxSessionCandidates = 200
+const MaxMatchTextLen = 80
+
+const (
+	ItemTypeSession = "session"
+	ItemTypeScreen  = "screen"
+	ItemTypeLine    = "line"
+)
+
+const (
+	MatchField_Name   = "name"
+	MatchField_CmdStr = "cmdstr"
+	MatchField_Text   = "text"
+	MatchField_Note   = "note"
+	MatchField_Cwd    = "cwd"
+	MatchField_Remote = "remote"
+)
+
+var fieldWeights = map[string]float64{
+	MatchField_Name:   3,
+	MatchField_CmdStr: 2,
+	MatchField_Text:   2,
+	MatchField_Note:   2,
+	MatchField_Cwd:    1,
+	MatchField_Remote: 1,
+}
+
+// recency boost halves every RecencyHalfLife
+const RecencyHalfLife = 7 * 24 * time.Hour
+const RecencyWeight = 3
+const ArchivedPenalty = 1
+
+type FindOpts struct {
+	Query           string
+	IncludeArchived bool
+	MaxItems        int
+}
+
+type FindResultType struct {
+	ItemType    string  `json:"itemtype"`
+	MatchField  string  `json:"matchfield"`
+	MatchText   string  `json:"matchtext"`
+	SessionId   string  `json:"sessionid"`
+	SessionName string  `json:"sessionname"`
+	ScreenId    string  `json:"screenid,omitempty"`
+	ScreenName  string  `json:"screenname,omitempty"`
+	LineId      string  `json:"lineid,omitempty"`
+	LineNum     int64   `json:"linenum,omitempty"`
+	Ts          int64   `json:"ts"`
+	Archived    bool    `json:"archived"`
+	Score       float64 `json:"score"`
+}
+
+type sessionRow struct {
+	SessionId string
+	Name      string
+	Archived  bool
+	Ts        int64
+}
+
+type screenRow struct {
+	ScreenId        string
+	SessionId       string
+	Name            string
+	Archived        bool
+	SessionName     string
+	SessionArchived bool
+	CurRemoteId     string
+	Ts              int64
+}
+
+type lineRow struct {
+	ScreenId        string
+	LineId          string
+	LineNum         int64
+	Ts              int64
+	Text            string
+	Note            string
+	Archived        bool
+	ScreenName      string
+	ScreenArchived  bool
+	SessionId       string
+	SessionName     string
+	SessionArchived bool
+	CmdStr          string
+	Cwd             string
+}
+
+type remoteRow struct {
+	RemoteId            string
+	RemoteAlias         string
+	RemoteCanonicalName string
+}
+
+func makeLikeArg(str string) string {
+	str = strings.ReplaceAll(str, "\\", "\\\\")
+	str = strings.ReplaceAll(str, "%", "\\%")
+	str = strings.ReplaceAll(str, "_", "\\_")
+	return "%" + str + "%"
+}
+
+// exact (case-insensitive) match = 3, prefix = 2, substring = 1, no match = 0
+func matchQuality(query string, text string) float64 {
+	query = strings.ToLower(query)
+	text = strings.ToLower(text)
+	switch {
+	case query == "" || text == "":
+		return 0
+	case text == query:
+		return 3
+	case strings.HasPrefix(text, query):
+		return 2
+	case strings.Contains(text, query):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func recencyBoost(ts int64, now time.Time) float64 {
+	if ts <= 0 {
+		return 0
+	}
+	age := now.Sub(time.UnixMilli(ts))
+	if age < 0 {
+		age = 0
+	}
+	halfLives := float64(age) / float64(RecencyHalfLife)
+	return 1 / (1 + halfLives)
+}
+
+func scoreResult(query string, r *FindResultType, now time.Time) float64 {
+	score := matchQuality(query, r.MatchText)*fieldWeights[r.MatchField] + RecencyWeight*recencyBoost(r.Ts, now)
+	if r.Archived {
+		score -= ArchivedPenalty
+	}
+	return score
+}
+
+func rankResults(query string, results []*FindResultType, now time.Time, maxItems int) []*FindResultType {
+	for _, r := range results {
+		r.Score = scoreResult(query, r, now)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Ts > results[j].Ts
+	})
+	if maxItems > 0 && len(results) > maxItems {
+		results = results[:maxItems]
+	}
+	return results
+}
+
+func truncateMatchText(str string) string {
+	str = strings.Join(strings.Fields(str), " ")
+	if len(str) > MaxMatchTextLen {
+		return str[:MaxMatchTextLen-3] + "..."
+	}
+	return str
+}
+
+func remoteDisplayName(r remoteRow) string {
+	if r.RemoteAlias != "" {
+		return r.RemoteAlias
+	}
+	return r.RemoteCanonicalName
+}
+
+// for a line, picks the best matching field (in priority order)
+func lineMatch(query string, row lineRow) (string, string) {
+	if matchQuality(query, row.CmdStr) > 0 {
+		return MatchField_CmdStr, row.CmdStr
+	}
+	if matchQuality(query, row.Text) > 0 {
+		return MatchField_Text, row.Text
+	}
+	if matchQuality(query, row.Note) > 0 {
+		return MatchField_Note, row.Note
+	}
+	if matchQuality(query, row.Cwd) > 0 {
+		return MatchField_Cwd, row.Cwd
+	}
+	return "", ""
+}
+
+func Find(ctx context.Context, opts FindOpts) ([]*FindResultType, error) {
+	searchText := strings.TrimSpace(opts.Query)
+	if searchText == "" {
+		return nil, fmt.Errorf("no search text")
+	}
+	maxItems := opts.MaxItems
+	if maxItems <= 0 {
+		maxItems = DefaultMaxItems
+	}
+	likeArg := makeLikeArg(searchText)
+	results, err := sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) ([]*FindResultType, error) {
+		var rtn []*FindResultType
+		sessionArchivedClause := ""
+		screenArchivedClause := ""
+		lineArchivedClause := ""
+		if !opts.IncludeArchived {
+			sessionArchivedClause = " AND NOT s.archived"
+			screenArchivedClause = " AND NOT s.archived AND NOT sc.archived"
+			lineArchivedClause = " AND NOT s.archived AND NOT sc.archived AND NOT l.archived"
+		}
+
+		// sessions (by name), recency is the last line in any of its screens
+		query := fmt.Sprintf(`SELECT s.sessionid, s.name, s.archived,
+                                     COALESCE((SELECT max(l.ts) FROM screen sc JOIN line l ON l.screenid = sc.screenid WHERE sc.sessionid = s.sessionid), 0) ts
+                              FROM session s
+                              WHERE s.name LIKE ? ESCAPE '\'%s
+                              LIMIT ?`, sessionArchivedClause)
+		var sessionRows []sessionRow
+		tx.Select(&sessionRows, query, likeArg, MaxSessionCandidates)
+		for _, row := range sessionRows {
+			rtn = append(rtn, &FindResultType{
+				ItemType:    ItemTypeSession,
+				MatchField:  MatchField_Name,
+				MatchText:   row.Name,
+				SessionId:   row.SessionId,
+				SessionName: row.Name,
+				Ts:          row.Ts,
+				Archived:    row.Archived,
+			})
+		}
+
+		// remotes matching by alias or canonical name, matched to screens that use them
+		var remoteRows []remoteRow
+		query = `SELECT remoteid, remotealias, remotecanonicalname FROM remote WHERE NOT archived AND (remotealias LIKE ? ESCAPE '\' OR remotecanonicalname LIKE ? ESCAPE '\')`
+		tx.Select(&remoteRows, query, likeArg, likeArg)
+		remoteMap := make(map[string]remoteRow)
+		var remoteIds []interface{}
+		for _, r := range remoteRows {
+			remoteMap[r.RemoteId] = r
+			remoteIds = append(remoteIds, r.RemoteId)
+		}
+		remoteClause := ""
+		queryArgs := []interface{}{likeArg}
+		if len(remoteIds) > 0 {
+			placeholders := strings.TrimSuffix(strings.Repeat("?,", len(remoteIds)), ",")
+			remoteClause = fmt.Sprintf(" OR sc.curremoteid IN (%s)", placeholders)
+			queryArgs = append(queryArgs, remoteIds...)
+		}
+		queryArgs = append(queryArgs, MaxScreenCandidates)
+
+		// screens (by name or current remote)
+		query = fmt.Sprintf(`SELECT sc.screenid, sc.sessionid, sc.name, sc.archived, s.name sessionname, s.archived sessionarchived, sc.curremoteid,
+                                    COALESCE((SELECT max(l.ts) FROM line l WHERE l.screenid = sc.screenid), 0) ts
+                             FROM screen sc JOIN session s ON sc.sessionid = s.sessionid
+                             WHERE (sc.name LIKE ? ESCAPE '\'%s)%s
+                             LIMIT ?`, remoteClause, screenArchivedClause)
+		var screenRows []screenRow
+		tx.Select(&screenRows, query, queryArgs...)
+		for _, row := range screenRows {
+			result := &FindResultType{
+				ItemType:    ItemTypeScreen,
+				MatchField:  MatchField_Name,
+				MatchText:   row.Name,
+				SessionId:   row.SessionId,
+				SessionName: row.SessionName,
+				ScreenId:    row.ScreenId,
+				ScreenName:  row.Name,
+				Ts:          row.Ts,
+				Archived:    row.Archived || row.SessionArchived,
+			}
+			if matchQuality(searchText, row.Name) == 0 {
+				if r, found := remoteMap[row.CurRemoteId]; found {
+					result.MatchField = MatchField_Remote
+					result.MatchText = remoteDisplayName(r)
+				}
+			}
+			rtn = append(rtn, result)
+		}
+
+		// lines (by text, cmdstr, note or cwd), most recent first
+		query = fmt.Sprintf(`SELECT l.screenid, l.lineid, l.linenum, l.ts, l.text, l.note, l.archived,
+                                    sc.name screenname, sc.archived screenarchived, s.sessionid, s.name sessionname, s.archived sessionarchived,
+                                    COALESCE(c.cmdstr, '') cmdstr, COALESCE(json_extract(c.festate, '$.cwd'), '') cwd
+                             FROM line l
+                               JOIN screen sc ON l.screenid = sc.screenid
+                               JOIN session s ON sc.sessionid = s.sessionid
+                               LEFT OUTER JOIN cmd c ON l.screenid = c.screenid AND l.lineid = c.lineid
+                             WHERE (l.text LIKE ? ESCAPE '\' OR l.note LIKE ? ESCAPE '\' OR c.cmdstr LIKE ? ESCAPE '\' OR json_extract(c.festate, '$.cwd') LIKE ? ESCAPE '\')%s
+                             ORDER BY l.ts DESC
+                             LIMIT ?`, lineArchivedClause)
+		var lineRows []lineRow
+		tx.Select(&lineRows, query, likeArg, likeArg, likeArg, likeArg, MaxLineCandidates)
+		for _, row := range lineRows {
+			matchField, matchText := lineMatch(searchText, row)
+			if matchField == "" {
+				continue
+			}
+			rtn = append(rtn, &FindResultType{
+				ItemType:    ItemTypeLine,
+				MatchField:  matchField,
+				MatchText:   matchText,
+				SessionId:   row.SessionId,
+				SessionName: row.SessionName,
+				ScreenId:    row.ScreenId,
+				ScreenName:  row.ScreenName,
+				LineId:      row.LineId,
+				LineNum:     row.LineNum,
+				Ts:          row.Ts,
+				Archived:    row.Archived || row.ScreenArchived || row.SessionArchived,
+			})
+		}
+		return rtn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rankResults(searchText, results, time.Now(), maxItems), nil
+}
+
+// the command that opens the result (uses the standard session/screen/line resolver arguments)
+func (r *FindResultType) OpenCommand() string {
+	switch r.ItemType {
+	case ItemTypeSession:
+		return fmt.Sprintf("/session %s", r.SessionId)
+	case ItemTypeScreen:
+		return fmt.Sprintf("/screen session=%s %s", r.SessionId, r.ScreenId)
+	default:
+		return fmt.Sprintf("/line:view %s %s %d", r.SessionId, r.ScreenId, r.LineNum)
+	}
+}
+
+// "session", "session / screen", or "session / screen #linenum"
+func (r *FindResultType) Location() string {
+	switch r.ItemType {
+	case ItemTypeSession:
+		return r.SessionName
+	case ItemTypeScreen:
+		return fmt.Sprintf("%s / %s", r.SessionName, r.ScreenName)
+	default:
+		return fmt.Sprintf("%s / %s #%d", r.SessionName, r.ScreenName, r.LineNum)
+	}
+}
+
+func (r *FindResultType) DisplayMatchText() string {
+	return truncateMatchText(r.MatchText)
+}
@@ -0,0 +1,91 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package find
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchQuality(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  float64
+	}{
+		{"build", "build", 3},
+		{"Build", "build", 3},
+		{"bui", "build", 2},
+		{"uil", "build", 1},
+		{"deploy", "build", 0},
+		{"", "build", 0},
+		{"build", "", 0},
+	}
+	for _, test := range tests {
+		if got := matchQuality(test.query, test.text); got != test.want {
+			t.Errorf("matchQuality(%q, %q) = %v, want %v", test.query, test.text, got, test.want)
+		}
+	}
+}
+
+func TestRankResults(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour).UnixMilli()
+	recent := now.Add(-time.Hour).UnixMilli()
+	yesterday := now.Add(-24 * time.Hour).UnixMilli()
+	results := []*FindResultType{
+		{ItemType: ItemTypeLine, MatchField: MatchField_Cwd, MatchText: "/home/mike/src/build", LineId: "cwd", Ts: yesterday},
+		{ItemType: ItemTypeScreen, MatchField: MatchField_Name, MatchText: "build", ScreenId: "exact", Ts: old},
+		{ItemType: ItemTypeLine, MatchField: MatchField_CmdStr, MatchText: "make build", LineId: "recent", Ts: recent},
+		{ItemType: ItemTypeLine, MatchField: MatchField_CmdStr, MatchText: "make build", LineId: "old", Ts: old},
+		{ItemType: ItemTypeLine, MatchField: MatchField_CmdStr, MatchText: "make build", LineId: "archived", Ts: recent, Archived: true},
+	}
+	ranked := rankResults("build", results, now, 0)
+	var order []string
+	for _, r := range ranked {
+		order = append(order, r.ScreenId+r.LineId)
+	}
+	want := []string{"exact", "recent", "archived", "cwd", "old"}
+	for idx := range want {
+		if order[idx] != want[idx] {
+			t.Fatalf("unexpected rank order %v, want %v", order, want)
+		}
+	}
+	ranked = rankResults("build", results, now, 2)
+	if len(ranked) != 2 {
+		t.Errorf("expected maxitems to limit results, got %d", len(ranked))
+	}
+}
+
+func TestLineMatch(t *testing.T) {
+	row := lineRow{Text: "ls -l", CmdStr: "ls -l", Cwd: "/var/log"}
+	if field, text := lineMatch("ls", row); field != MatchField_CmdStr || text != "ls -l" {
+		t.Errorf("expected cmdstr match, got %q %q", field, text)
+	}
+	if field, text := lineMatch("log", row); field != MatchField_Cwd || text != "/var/log" {
+		t.Errorf("expected cwd match, got %q %q", field, text)
+	}
+	if field, _ := lineMatch("nomatch", row); field != "" {
+		t.Errorf("expected no match, got %q", field)
+	}
+	textRow := lineRow{Text: "some notes"}
+	if field, _ := lineMatch("notes", textRow); field != MatchField_Text {
+		t.Errorf("expected text match, got %q", field)
+	}
+	noteRow := lineRow{CmdStr: "make deploy", Note: "rollback with `make undeploy`"}
+	if field, _ := lineMatch("rollback", noteRow); field != MatchField_Note {
+		t.Errorf("expected note match, got %q", field)
+	}
+}
+
+func TestOpenCommand(t *testing.T) {
+	r := &FindResultType{ItemType: ItemTypeLine, SessionId: "s1", ScreenId: "sc1", LineNum: 7}
+	if cmd := r.OpenCommand(); cmd != "/line:view s1 sc1 7" {
+		t.Errorf("unexpected open command %q", cmd)
+	}
+	r = &FindResultType{ItemType: ItemTypeScreen, SessionId: "s1", ScreenId: "sc1"}
+	if cmd := r.OpenCommand(); cmd != "/screen session=s1 sc1" {
+		t.Errorf("unexpected open command %q", cmd)
+	}
+}
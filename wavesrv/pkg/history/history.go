@@ -132,6 +132,9 @@ func InsertHistoryItem(ctx context.Context, hitem *HistoryItemType) error {
 		tx.NamedExec(query, hitem.ToMap())
 		return nil
 	})
+	if txErr == nil {
+		updateSuggestIndex(hitem)
+	}
 	return txErr
 }
 
@@ -236,11 +239,12 @@ func runHistoryQuery(tx *sstore.TxWrap, opts HistoryQueryOpts, realOffset int, i
 		hNumStr = "g"
 	}
 	if opts.SearchText != "" {
-		whereClause += " AND h.cmdstr LIKE ? ESCAPE '\\'"
+		// also matches the note attached to the history item's line
+		whereClause += " AND (h.cmdstr LIKE ? ESCAPE '\\' OR EXISTS (SELECT 1 FROM line l WHERE l.screenid = h.screenid AND l.lineid = h.lineid AND l.note LIKE ? ESCAPE '\\'))"
 		likeArg := opts.SearchText
 		likeArg = strings.ReplaceAll(likeArg, "%", "\\%")
 		likeArg = strings.ReplaceAll(likeArg, "_", "\\_")
-		queryArgs = append(queryArgs, "%"+likeArg+"%")
+		queryArgs = append(queryArgs, "%"+likeArg+"%", "%"+likeArg+"%")
 	}
 	if opts.FromTs > 0 {
 		whereClause += fmt.Sprintf(" AND h.ts <= %d", opts.FromTs)
@@ -317,10 +321,38 @@ func GetLineCmdsFromHistoryItems(ctx context.Context, historyItems []*HistoryIte
 	})
 }
 
+// counts (dryRun) or removes the history entries of sessionIds (or of all other sessions if exclude
+// is set) older than cutoffTs
+func PurgeHistoryBefore(ctx context.Context, cutoffTs int64, sessionIds []string, exclude bool, dryRun bool) (int, error) {
+	numHistory, txErr := sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) (int, error) {
+		sessionCond := `sessionid IN (SELECT value FROM json_each(?))`
+		if exclude {
+			sessionCond = `sessionid NOT IN (SELECT value FROM json_each(?))`
+		}
+		query := `SELECT count(*) FROM history WHERE ts < ? AND ` + sessionCond
+		numHistory := tx.GetInt(query, cutoffTs, dbutil.QuickJsonArr(sessionIds))
+		if dryRun || numHistory == 0 {
+			return numHistory, nil
+		}
+		query = `DELETE FROM history WHERE ts < ? AND ` + sessionCond
+		tx.Exec(query, cutoffTs, dbutil.QuickJsonArr(sessionIds))
+		return numHistory, nil
+	})
+	if txErr != nil {
+		return 0, txErr
+	}
+	if !dryRun && numHistory > 0 {
+		invalidateSuggestIndex()
+	}
+	return numHistory, nil
+}
+
 func PurgeHistoryByIds(ctx context.Context, historyIds []string) error {
-	return sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+	txErr := sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
 		query := `DELETE FROM history WHERE historyid IN (SELECT value FROM json_each(?))`
 		tx.Exec(query, dbutil.QuickJsonArr(historyIds))
 		return nil
 	})
+	invalidateSuggestIndex()
+	return txErr
 }
@@ -0,0 +1,318 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package history
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/shparse"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// command duration / failure statistics computed from the history table (/history:stats)
+
+const MaxStatsHistoryItems = 100000
+const DefaultStatsMaxItems = 10
+
+type StatsOpts struct {
+	SessionId string
+	ScreenId  string
+	RemoteId  string
+	StartTs   int64 // inclusive (0 for no limit)
+	EndTs     int64 // exclusive (0 for no limit)
+	MaxItems  int   // max items for each of the top-n lists
+}
+
+type CmdNameStatType struct {
+	Name      string  `json:"name"`
+	Count     int     `json:"count"`
+	NumFailed int     `json:"numfailed"`
+	FailRate  float64 `json:"failrate"`
+	P50Ms     int64   `json:"p50ms"`
+	P95Ms     int64   `json:"p95ms"`
+
+	durations []int64
+}
+
+type RemoteStatType struct {
+	RemoteId   string  `json:"remoteid"`
+	RemoteName string  `json:"remotename"`
+	Count      int     `json:"count"`
+	NumFailed  int     `json:"numfailed"`
+	FailRate   float64 `json:"failrate"`
+}
+
+type SlowCmdType struct {
+	CmdStr     string `json:"cmdstr"`
+	RemoteName string `json:"remotename"`
+	Ts         int64  `json:"ts"`
+	DurationMs int64  `json:"durationms"`
+	ExitCode   int64  `json:"exitcode"`
+}
+
+type DayStatType struct {
+	Day       string `json:"day"`
+	Count     int    `json:"count"`
+	NumFailed int    `json:"numfailed"`
+	P50Ms     int64  `json:"p50ms"`
+	P95Ms     int64  `json:"p95ms"`
+
+	durations []int64
+}
+
+type HistoryStatsType struct {
+	NumCmds        int                `json:"numcmds"`
+	NumFailed      int                `json:"numfailed"`
+	P50Ms          int64              `json:"p50ms"`
+	P95Ms          int64              `json:"p95ms"`
+	SlowestCmds    []*SlowCmdType     `json:"slowestcmds"`
+	FailingCmds    []*CmdNameStatType `json:"failingcmds"`
+	FailingRemotes []*RemoteStatType  `json:"failingremotes"`
+	Days           []*DayStatType     `json:"days"`
+}
+
+type statsRow struct {
+	Ts         int64
+	RemoteId   string
+	RemoteName string
+	CmdStr     string
+	HadError   bool
+	ExitCode   *int64
+	DurationMs *int64
+}
+
+func (row statsRow) failed() bool {
+	if row.ExitCode != nil {
+		return *row.ExitCode != 0
+	}
+	return row.HadError
+}
+
+// nearest-rank percentile, durations must be sorted
+func percentile(durations []int64, pct int) int64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	rank := (pct*len(durations) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+func sortedPercentiles(durations []int64) (int64, int64) {
+	sort.Slice(durations, func(i int, j int) bool { return durations[i] < durations[j] })
+	return percentile(durations, 50), percentile(durations, 95)
+}
+
+func failRate(numFailed int, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(numFailed) / float64(count)
+}
+
+func computeHistoryStats(rows []statsRow, maxItems int, loc *time.Location) *HistoryStatsType {
+	if maxItems <= 0 {
+		maxItems = DefaultStatsMaxItems
+	}
+	rtn := &HistoryStatsType{}
+	cmdMap := make(map[string]*CmdNameStatType)
+	remoteMap := make(map[string]*RemoteStatType)
+	dayMap := make(map[string]*DayStatType)
+	var allDurations []int64
+	for _, row := range rows {
+		failed := row.failed()
+		rtn.NumCmds++
+		if failed {
+			rtn.NumFailed++
+		}
+		if row.DurationMs != nil {
+			allDurations = append(allDurations, *row.DurationMs)
+			slowCmd := &SlowCmdType{CmdStr: row.CmdStr, RemoteName: row.RemoteName, Ts: row.Ts, DurationMs: *row.DurationMs}
+			if row.ExitCode != nil {
+				slowCmd.ExitCode = *row.ExitCode
+			}
+			rtn.SlowestCmds = append(rtn.SlowestCmds, slowCmd)
+		}
+		if cmdName := shparse.CmdName(row.CmdStr); cmdName != "" {
+			cstat := cmdMap[cmdName]
+			if cstat == nil {
+				cstat = &CmdNameStatType{Name: cmdName}
+				cmdMap[cmdName] = cstat
+			}
+			cstat.Count++
+			if failed {
+				cstat.NumFailed++
+			}
+			if row.DurationMs != nil {
+				cstat.durations = append(cstat.durations, *row.DurationMs)
+			}
+		}
+		rstat := remoteMap[row.RemoteId]
+		if rstat == nil {
+			rstat = &RemoteStatType{RemoteId: row.RemoteId, RemoteName: row.RemoteName}
+			remoteMap[row.RemoteId] = rstat
+		}
+		rstat.Count++
+		if failed {
+			rstat.NumFailed++
+		}
+		dayStr := time.UnixMilli(row.Ts).In(loc).Format("2006-01-02")
+		dstat := dayMap[dayStr]
+		if dstat == nil {
+			dstat = &DayStatType{Day: dayStr}
+			dayMap[dayStr] = dstat
+		}
+		dstat.Count++
+		if failed {
+			dstat.NumFailed++
+		}
+		if row.DurationMs != nil {
+			dstat.durations = append(dstat.durations, *row.DurationMs)
+		}
+	}
+	rtn.P50Ms, rtn.P95Ms = sortedPercentiles(allDurations)
+	sort.SliceStable(rtn.SlowestCmds, func(i int, j int) bool {
+		return rtn.SlowestCmds[i].DurationMs > rtn.SlowestCmds[j].DurationMs
+	})
+	if len(rtn.SlowestCmds) > maxItems {
+		rtn.SlowestCmds = rtn.SlowestCmds[0:maxItems]
+	}
+	rtn.FailingCmds = []*CmdNameStatType{}
+	for _, cstat := range cmdMap {
+		cstat.FailRate = failRate(cstat.NumFailed, cstat.Count)
+		cstat.P50Ms, cstat.P95Ms = sortedPercentiles(cstat.durations)
+		rtn.FailingCmds = append(rtn.FailingCmds, cstat)
+	}
+	sort.Slice(rtn.FailingCmds, func(i int, j int) bool {
+		ci, cj := rtn.FailingCmds[i], rtn.FailingCmds[j]
+		if ci.NumFailed != cj.NumFailed {
+			return ci.NumFailed > cj.NumFailed
+		}
+		if ci.Count != cj.Count {
+			return ci.Count > cj.Count
+		}
+		return ci.Name < cj.Name
+	})
+	if len(rtn.FailingCmds) > maxItems {
+		rtn.FailingCmds = rtn.FailingCmds[0:maxItems]
+	}
+	rtn.FailingRemotes = []*RemoteStatType{}
+	for _, rstat := range remoteMap {
+		if rstat.NumFailed == 0 {
+			continue
+		}
+		rstat.FailRate = failRate(rstat.NumFailed, rstat.Count)
+		rtn.FailingRemotes = append(rtn.FailingRemotes, rstat)
+	}
+	sort.Slice(rtn.FailingRemotes, func(i int, j int) bool {
+		ri, rj := rtn.FailingRemotes[i], rtn.FailingRemotes[j]
+		if ri.NumFailed != rj.NumFailed {
+			return ri.NumFailed > rj.NumFailed
+		}
+		return ri.RemoteName < rj.RemoteName
+	})
+	if len(rtn.FailingRemotes) > maxItems {
+		rtn.FailingRemotes = rtn.FailingRemotes[0:maxItems]
+	}
+	rtn.Days = []*DayStatType{}
+	for _, dstat := range dayMap {
+		dstat.P50Ms, dstat.P95Ms = sortedPercentiles(dstat.durations)
+		rtn.Days = append(rtn.Days, dstat)
+	}
+	sort.Slice(rtn.Days, func(i int, j int) bool {
+		return rtn.Days[i].Day < rtn.Days[j].Day
+	})
+	return rtn
+}
+
+func GetHistoryStats(ctx context.Context, opts StatsOpts) (*HistoryStatsType, error) {
+	whereClause := "WHERE NOT h.ismetacmd"
+	var queryArgs []interface{}
+	if opts.SessionId != "" {
+		whereClause += " AND h.sessionid = ?"
+		queryArgs = append(queryArgs, opts.SessionId)
+	}
+	if opts.ScreenId != "" {
+		whereClause += " AND h.screenid = ?"
+		queryArgs = append(queryArgs, opts.ScreenId)
+	}
+	if opts.RemoteId != "" {
+		whereClause += " AND h.remoteid = ?"
+		queryArgs = append(queryArgs, opts.RemoteId)
+	}
+	if opts.StartTs > 0 {
+		whereClause += " AND h.ts >= ?"
+		queryArgs = append(queryArgs, opts.StartTs)
+	}
+	if opts.EndTs > 0 {
+		whereClause += " AND h.ts < ?"
+		queryArgs = append(queryArgs, opts.EndTs)
+	}
+	queryArgs = append(queryArgs, MaxStatsHistoryItems)
+	rows, err := sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) ([]statsRow, error) {
+		query := fmt.Sprintf(`SELECT h.ts, h.remoteid, COALESCE(NULLIF(r.remotealias, ''), r.remotecanonicalname, h.remotename) remotename,
+                                     h.cmdstr, h.haderror, h.exitcode, h.durationms
+                              FROM history h LEFT OUTER JOIN remote r ON h.remoteid = r.remoteid
+                              %s
+                              ORDER BY h.ts DESC
+                              LIMIT ?`, whereClause)
+		var rows []statsRow
+		tx.Select(&rows, query, queryArgs...)
+		return rows, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return computeHistoryStats(rows, opts.MaxItems, time.Local), nil
+}
+
+func formatStatsDuration(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond).String()
+}
+
+func formatFailRate(rate float64) string {
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
+
+// table view for /history:stats
+func (stats *HistoryStatsType) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("commands %d, failed %d (%s), p50 %s, p95 %s\n", stats.NumCmds, stats.NumFailed, formatFailRate(failRate(stats.NumFailed, stats.NumCmds)), formatStatsDuration(stats.P50Ms), formatStatsDuration(stats.P95Ms)))
+	if len(stats.SlowestCmds) > 0 {
+		buf.WriteString("\nslowest commands:\n")
+		for _, scmd := range stats.SlowestCmds {
+			cmdStr := strings.ReplaceAll(scmd.CmdStr, "\n", " ")
+			if len(cmdStr) > 50 {
+				cmdStr = cmdStr[0:47] + "..."
+			}
+			buf.WriteString(fmt.Sprintf("  %10s  %-15s %s\n", formatStatsDuration(scmd.DurationMs), scmd.RemoteName, cmdStr))
+		}
+	}
+	if len(stats.FailingCmds) > 0 {
+		buf.WriteString(fmt.Sprintf("\n  %-20s %7s %7s %7s %10s %10s\n", "command", "count", "failed", "rate", "p50", "p95"))
+		for _, cstat := range stats.FailingCmds {
+			buf.WriteString(fmt.Sprintf("  %-20s %7d %7d %7s %10s %10s\n", cstat.Name, cstat.Count, cstat.NumFailed, formatFailRate(cstat.FailRate), formatStatsDuration(cstat.P50Ms), formatStatsDuration(cstat.P95Ms)))
+		}
+	}
+	if len(stats.FailingRemotes) > 0 {
+		buf.WriteString(fmt.Sprintf("\n  %-20s %7s %7s %7s\n", "connection", "count", "failed", "rate"))
+		for _, rstat := range stats.FailingRemotes {
+			buf.WriteString(fmt.Sprintf("  %-20s %7d %7d %7s\n", rstat.RemoteName, rstat.Count, rstat.NumFailed, formatFailRate(rstat.FailRate)))
+		}
+	}
+	if len(stats.Days) > 0 {
+		buf.WriteString(fmt.Sprintf("\n  %-12s %7s %7s %10s %10s\n", "day", "count", "failed", "p50", "p95"))
+		for _, dstat := range stats.Days {
+			buf.WriteString(fmt.Sprintf("  %-12s %7d %7d %10s %10s\n", dstat.Day, dstat.Count, dstat.NumFailed, formatStatsDuration(dstat.P50Ms), formatStatsDuration(dstat.P95Ms)))
+		}
+	}
+	return buf.String()
+}
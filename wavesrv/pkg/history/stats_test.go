@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	durations := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if p := percentile(durations, 50); p != 5 {
+		t.Errorf("p50 expected 5, got %d", p)
+	}
+	if p := percentile(durations, 95); p != 10 {
+		t.Errorf("p95 expected 10, got %d", p)
+	}
+	if p := percentile(nil, 50); p != 0 {
+		t.Errorf("empty p50 expected 0, got %d", p)
+	}
+}
+
+func TestComputeHistoryStats(t *testing.T) {
+	i64 := func(v int64) *int64 { return &v }
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	rows := []statsRow{
+		{Ts: ts, RemoteId: "r1", RemoteName: "local", CmdStr: "make", ExitCode: i64(2), DurationMs: i64(5000)},
+		{Ts: ts, RemoteId: "r1", RemoteName: "local", CmdStr: "make test", ExitCode: i64(0), DurationMs: i64(1000)},
+		{Ts: ts + 24*3600*1000, RemoteId: "r2", RemoteName: "prod", CmdStr: "ls", ExitCode: i64(0), DurationMs: i64(10)},
+		{Ts: ts + 24*3600*1000, RemoteId: "r2", RemoteName: "prod", CmdStr: "sleep 100"},
+	}
+	stats := computeHistoryStats(rows, 2, time.UTC)
+	if stats.NumCmds != 4 || stats.NumFailed != 1 {
+		t.Errorf("unexpected totals: %d/%d", stats.NumCmds, stats.NumFailed)
+	}
+	if len(stats.SlowestCmds) != 2 || stats.SlowestCmds[0].DurationMs != 5000 {
+		t.Errorf("unexpected slowest cmds: %v", stats.SlowestCmds)
+	}
+	if len(stats.FailingCmds) != 2 || stats.FailingCmds[0].Name != "make" || stats.FailingCmds[0].FailRate != 0.5 {
+		t.Errorf("unexpected failing cmds: %v", stats.FailingCmds)
+	}
+	if len(stats.FailingRemotes) != 1 || stats.FailingRemotes[0].RemoteName != "local" {
+		t.Errorf("unexpected failing remotes: %v", stats.FailingRemotes)
+	}
+	if len(stats.Days) != 2 || stats.Days[0].Day != "2024-03-01" || stats.Days[0].P95Ms != 5000 {
+		t.Errorf("unexpected day stats: %v", stats.Days)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package history
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// in-memory index over the history table used for fast (fish-style) command suggestions.
+// the index is built lazily with a single query, and kept up to date by InsertHistoryItem.
+
+const MaxSuggestIndexItems = 50000
+const DefaultMaxSuggestions = 10
+const MaxSuggestCmdLen = 4096
+const suggestRecencyHalfLife = 7 * 24 * time.Hour
+
+// ranking weights
+const (
+	suggestWeightFreq       = 1.0
+	suggestWeightRecency    = 2.0
+	suggestWeightCwd        = 1.5
+	suggestWeightRemote     = 1.0
+	suggestWeightTransition = 3.0
+)
+
+const (
+	SuggestTypePrefix = "prefix"
+	SuggestTypeNext   = "next"
+)
+
+type SuggestOpts struct {
+	Prefix   string
+	ScreenId string // used to find the previous command (for "next" suggestions)
+	RemoteId string
+	Cwd      string
+	MaxItems int
+}
+
+type SuggestionType struct {
+	CmdStr  string   `json:"cmdstr"`
+	Type    string   `json:"type"`
+	Score   float64  `json:"score"`
+	Count   int      `json:"count"`
+	LastTs  int64    `json:"lastts"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type suggestEntry struct {
+	CmdStr       string
+	Count        int
+	LastTs       int64
+	RemoteCounts map[string]int
+	CwdCounts    map[string]int
+	NextCounts   map[string]int // cmdstr -> number of times it was run directly after this command (same screen)
+}
+
+type suggestIndex struct {
+	Lock          *sync.Mutex
+	Loaded        bool
+	Entries       map[string]*suggestEntry
+	SortedCmds    []string          // sorted unique cmdstrs (for prefix lookups)
+	LastScreenCmd map[string]string // screenid -> last cmdstr run on that screen
+	LoadedRecent  map[string]bool   // recent historyids from the load query (not added again by updateSuggestIndex)
+	RecentExpTs   int64             // LoadedRecent is dropped after this ts (late updateSuggestIndex calls have all arrived by then)
+}
+
+var globalSuggestIndex = makeSuggestIndex()
+
+func makeSuggestIndex() *suggestIndex {
+	return &suggestIndex{
+		Lock:          &sync.Mutex{},
+		Entries:       make(map[string]*suggestEntry),
+		LastScreenCmd: make(map[string]string),
+	}
+}
+
+func (idx *suggestIndex) reset() {
+	idx.Loaded = false
+	idx.Entries = make(map[string]*suggestEntry)
+	idx.SortedCmds = nil
+	idx.LastScreenCmd = make(map[string]string)
+	idx.LoadedRecent = nil
+	idx.RecentExpTs = 0
+}
+
+func isSuggestableCmd(cmdStr string) bool {
+	cmdStr = strings.TrimSpace(cmdStr)
+	if cmdStr == "" || len(cmdStr) > MaxSuggestCmdLen {
+		return false
+	}
+	return !strings.Contains(cmdStr, "\n")
+}
+
+// must hold idx.Lock
+func (idx *suggestIndex) addItem(screenId string, remoteId string, cwd string, cmdStr string, ts int64) {
+	if !isSuggestableCmd(cmdStr) {
+		return
+	}
+	entry := idx.Entries[cmdStr]
+	if entry == nil {
+		entry = &suggestEntry{
+			CmdStr:       cmdStr,
+			RemoteCounts: make(map[string]int),
+			CwdCounts:    make(map[string]int),
+			NextCounts:   make(map[string]int),
+		}
+		idx.Entries[cmdStr] = entry
+		insertPos := sort.SearchStrings(idx.SortedCmds, cmdStr)
+		idx.SortedCmds = append(idx.SortedCmds, "")
+		copy(idx.SortedCmds[insertPos+1:], idx.SortedCmds[insertPos:])
+		idx.SortedCmds[insertPos] = cmdStr
+	}
+	entry.Count++
+	if ts > entry.LastTs {
+		entry.LastTs = ts
+	}
+	if remoteId != "" {
+		entry.RemoteCounts[remoteId]++
+	}
+	if cwd != "" {
+		entry.CwdCounts[cwd]++
+	}
+	if screenId == "" {
+		return
+	}
+	if prevCmd := idx.LastScreenCmd[screenId]; prevCmd != "" {
+		if prevEntry := idx.Entries[prevCmd]; prevEntry != nil {
+			prevEntry.NextCounts[cmdStr]++
+		}
+	}
+	idx.LastScreenCmd[screenId] = cmdStr
+}
+
+// must hold idx.Lock
+func (idx *suggestIndex) prefixMatches(prefix string) []*suggestEntry {
+	var rtn []*suggestEntry
+	startPos := sort.SearchStrings(idx.SortedCmds, prefix)
+	for i := startPos; i < len(idx.SortedCmds); i++ {
+		cmdStr := idx.SortedCmds[i]
+		if !strings.HasPrefix(cmdStr, prefix) {
+			break
+		}
+		if cmdStr == prefix {
+			continue
+		}
+		rtn = append(rtn, idx.Entries[cmdStr])
+	}
+	return rtn
+}
+
+func recencyScore(lastTs int64, now time.Time) float64 {
+	age := now.Sub(time.UnixMilli(lastTs))
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(suggestRecencyHalfLife))
+}
+
+func (entry *suggestEntry) score(opts SuggestOpts, now time.Time) (float64, []string) {
+	var reasons []string
+	score := suggestWeightFreq*math.Log1p(float64(entry.Count)) + suggestWeightRecency*recencyScore(entry.LastTs, now)
+	if opts.Cwd != "" && entry.CwdCounts[opts.Cwd] > 0 {
+		score += suggestWeightCwd
+		reasons = append(reasons, "cwd")
+	}
+	if opts.RemoteId != "" && entry.RemoteCounts[opts.RemoteId] > 0 {
+		score += suggestWeightRemote
+		reasons = append(reasons, "remote")
+	}
+	return score, reasons
+}
+
+// must hold idx.Lock
+func (idx *suggestIndex) suggest(opts SuggestOpts, now time.Time) []*SuggestionType {
+	var rtn []*SuggestionType
+	if opts.Prefix != "" {
+		for _, entry := range idx.prefixMatches(opts.Prefix) {
+			score, reasons := entry.score(opts, now)
+			rtn = append(rtn, &SuggestionType{CmdStr: entry.CmdStr, Type: SuggestTypePrefix, Score: score, Count: entry.Count, LastTs: entry.LastTs, Reasons: reasons})
+		}
+	} else if opts.ScreenId != "" {
+		prevEntry := idx.Entries[idx.LastScreenCmd[opts.ScreenId]]
+		if prevEntry != nil {
+			for nextCmd, transitionCount := range prevEntry.NextCounts {
+				entry := idx.Entries[nextCmd]
+				if entry == nil {
+					continue
+				}
+				score, reasons := entry.score(opts, now)
+				score += suggestWeightTransition * math.Log1p(float64(transitionCount))
+				reasons = append(reasons, "next")
+				rtn = append(rtn, &SuggestionType{CmdStr: entry.CmdStr, Type: SuggestTypeNext, Score: score, Count: entry.Count, LastTs: entry.LastTs, Reasons: reasons})
+			}
+		}
+	}
+	sort.Slice(rtn, func(i int, j int) bool {
+		if rtn[i].Score != rtn[j].Score {
+			return rtn[i].Score > rtn[j].Score
+		}
+		return rtn[i].CmdStr < rtn[j].CmdStr
+	})
+	maxItems := opts.MaxItems
+	if maxItems <= 0 {
+		maxItems = DefaultMaxSuggestions
+	}
+	if len(rtn) > maxItems {
+		rtn = rtn[0:maxItems]
+	}
+	return rtn
+}
+
+// items inserted within this window before the load may also be passed to updateSuggestIndex
+const suggestLoadRecentWindow = time.Minute
+
+type suggestRow struct {
+	HistoryId string
+	ScreenId  string
+	RemoteId  string
+	Cwd       string
+	CmdStr    string
+	Ts        int64
+}
+
+// idx.Lock is held while loading, so inserts (updateSuggestIndex) and invalidations wait for the load
+// instead of being lost.  never called from inside a transaction, so holding the lock over the query is safe.
+func (idx *suggestIndex) ensureLoaded(ctx context.Context) error {
+	idx.Lock.Lock()
+	defer idx.Lock.Unlock()
+	if idx.Loaded {
+		return nil
+	}
+	now := time.Now()
+	loadStartTs := now.Add(-suggestLoadRecentWindow).UnixMilli()
+	rows, err := sstore.WithTxRtn(ctx, func(tx *sstore.TxWrap) ([]suggestRow, error) {
+		query := `SELECT historyid, screenid, remoteid, COALESCE(json_extract(festate, '$.cwd'), '') cwd, cmdstr, ts
+                  FROM (SELECT * FROM history WHERE NOT ismetacmd ORDER BY ts DESC LIMIT ?)
+                  ORDER BY ts, historyid`
+		var rows []suggestRow
+		tx.Select(&rows, query, MaxSuggestIndexItems)
+		return rows, nil
+	})
+	if err != nil {
+		return err
+	}
+	idx.LoadedRecent = make(map[string]bool)
+	idx.RecentExpTs = now.Add(suggestLoadRecentWindow).UnixMilli()
+	for _, row := range rows {
+		idx.addItem(row.ScreenId, row.RemoteId, row.Cwd, row.CmdStr, row.Ts)
+		if row.Ts >= loadStartTs {
+			idx.LoadedRecent[row.HistoryId] = true
+		}
+	}
+	idx.Loaded = true
+	return nil
+}
+
+// called after a history item is inserted (no-op if the index has not been loaded yet)
+func updateSuggestIndex(hitem *HistoryItemType) {
+	if hitem == nil || hitem.IsMetaCmd {
+		return
+	}
+	idx := globalSuggestIndex
+	idx.Lock.Lock()
+	defer idx.Lock.Unlock()
+	if !idx.Loaded {
+		return
+	}
+	idx.addInsertedItem(hitem, time.Now())
+}
+
+// must hold idx.Lock
+func (idx *suggestIndex) addInsertedItem(hitem *HistoryItemType, now time.Time) {
+	if idx.LoadedRecent != nil && now.UnixMilli() > idx.RecentExpTs {
+		// ids that were loaded but never re-inserted would otherwise stay in the map forever
+		idx.LoadedRecent = nil
+	}
+	if idx.LoadedRecent[hitem.HistoryId] {
+		// already added by the load query
+		delete(idx.LoadedRecent, hitem.HistoryId)
+		return
+	}
+	idx.addItem(hitem.ScreenId, hitem.Remote.RemoteId, hitem.FeState["cwd"], hitem.CmdStr, hitem.Ts)
+}
+
+func invalidateSuggestIndex() {
+	idx := globalSuggestIndex
+	idx.Lock.Lock()
+	defer idx.Lock.Unlock()
+	idx.reset()
+}
+
+// GetSuggestions returns prefix matches (when opts.Prefix is set) or "next command" suggestions
+// for opts.ScreenId (based on the last command run on that screen), ranked by frequency, recency, cwd and remote.
+func GetSuggestions(ctx context.Context, opts SuggestOpts) ([]*SuggestionType, error) {
+	idx := globalSuggestIndex
+	err := idx.ensureLoaded(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx.Lock.Lock()
+	defer idx.Lock.Unlock()
+	return idx.suggest(opts, time.Now()), nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuggestPrefix(t *testing.T) {
+	now := time.Now()
+	nowTs := now.UnixMilli()
+	oldTs := now.Add(-60 * 24 * time.Hour).UnixMilli()
+	idx := makeSuggestIndex()
+	idx.addItem("s1", "r1", "/home", "git status", oldTs)
+	idx.addItem("s1", "r1", "/home", "git status", oldTs)
+	idx.addItem("s1", "r1", "/home", "git status", oldTs)
+	idx.addItem("s1", "r2", "/src", "git stash", nowTs)
+	idx.addItem("s1", "r1", "/home", "ls -l", nowTs)
+	idx.addItem("s1", "r1", "/home", "multi\nline", nowTs)
+	if len(idx.SortedCmds) != 3 {
+		t.Fatalf("expected 3 unique cmds, got %v", idx.SortedCmds)
+	}
+	items := idx.suggest(SuggestOpts{Prefix: "git st"}, now)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 suggestions, got %d", len(items))
+	}
+	items = idx.suggest(SuggestOpts{Prefix: "git st", RemoteId: "r2", Cwd: "/src"}, now)
+	if items[0].CmdStr != "git stash" {
+		t.Errorf("expected 'git stash' to rank first for r2:/src, got %q", items[0].CmdStr)
+	}
+	items = idx.suggest(SuggestOpts{Prefix: "git st", MaxItems: 1}, now)
+	if len(items) != 1 {
+		t.Errorf("expected maxitems to limit suggestions, got %d", len(items))
+	}
+	items = idx.suggest(SuggestOpts{Prefix: "ls -l"}, now)
+	if len(items) != 0 {
+		t.Errorf("exact match should not be suggested, got %v", items)
+	}
+}
+
+func TestSuggestNext(t *testing.T) {
+	now := time.Now()
+	ts := now.UnixMilli()
+	idx := makeSuggestIndex()
+	idx.addItem("s1", "r1", "", "make", ts)
+	idx.addItem("s1", "r1", "", "./run-tests", ts)
+	idx.addItem("s2", "r1", "", "make", ts)
+	idx.addItem("s1", "r1", "", "make", ts)
+	items := idx.suggest(SuggestOpts{ScreenId: "s1"}, now)
+	if len(items) != 1 || items[0].CmdStr != "./run-tests" || items[0].Type != SuggestTypeNext {
+		t.Fatalf("expected './run-tests' as next suggestion, got %v", items)
+	}
+	items = idx.suggest(SuggestOpts{ScreenId: "s3"}, now)
+	if len(items) != 0 {
+		t.Errorf("expected no suggestions for unknown screen, got %v", items)
+	}
+}
+
+func TestSuggestLoadedRecent(t *testing.T) {
+	now := time.Now()
+	ts := now.UnixMilli()
+	idx := makeSuggestIndex()
+	idx.addItem("s1", "r1", "", "make", ts)
+	idx.addItem("s1", "r1", "", "make test", ts)
+	idx.LoadedRecent = map[string]bool{"h1": true, "h2": true}
+	idx.RecentExpTs = now.Add(suggestLoadRecentWindow).UnixMilli()
+	// already loaded, not counted twice
+	idx.addInsertedItem(&HistoryItemType{HistoryId: "h1", ScreenId: "s1", CmdStr: "make", Ts: ts}, now)
+	if idx.Entries["make"].Count != 1 || len(idx.LoadedRecent) != 1 {
+		t.Errorf("loaded item added twice, count:%d loadedrecent:%v", idx.Entries["make"].Count, idx.LoadedRecent)
+	}
+	idx.addInsertedItem(&HistoryItemType{HistoryId: "h3", ScreenId: "s1", CmdStr: "make", Ts: ts}, now)
+	if idx.Entries["make"].Count != 2 {
+		t.Errorf("new item not added, count:%d", idx.Entries["make"].Count)
+	}
+	// h2 never comes back, the map is dropped once the window has passed
+	idx.addInsertedItem(&HistoryItemType{HistoryId: "h4", ScreenId: "s1", CmdStr: "ls", Ts: ts}, now.Add(2*suggestLoadRecentWindow))
+	if idx.LoadedRecent != nil {
+		t.Errorf("expected loadedrecent to be dropped after the window, got %v", idx.LoadedRecent)
+	}
+	idx.reset()
+	if idx.LoadedRecent != nil || idx.RecentExpTs != 0 {
+		t.Errorf("reset should clear loadedrecent")
+	}
+}
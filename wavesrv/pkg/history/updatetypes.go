@@ -14,3 +14,13 @@ type HistoryInfoType struct {
 func (HistoryInfoType) GetType() string {
 	return "history"
 }
+
+type HistorySuggestionsType struct {
+	Prefix   string            `json:"prefix"`
+	ScreenId string            `json:"screenid,omitempty"`
+	Items    []*SuggestionType `json:"items"`
+}
+
+func (HistorySuggestionsType) GetType() string {
+	return "historysuggestions"
+}
@@ -0,0 +1,375 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// the janitor applies the retention policies (see sstore/retention.go) in the background:
+//   - outputdays: cmd lines (and their output) older than N days are removed
+//   - maxoutputsize: when the total output is over the limit, the oldest output is removed, output in
+//     archived lines/screens/sessions goes first.  the client limit applies to the total of all sessions,
+//     a session limit applies to the session's output.
+//   - historydays: history entries older than N days are removed
+//
+// the output of deleted items in the trash counts against the client maxoutputsize, trash items (oldest
+// first) are purged before any lines are removed.  running cmds and starred lines are never removed.
+// removed lines do not go to the trash.
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/history"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+const InitialJanitorWait = 2 * time.Minute
+const JanitorInterval = 1 * time.Hour
+const JanitorTimeout = 5 * time.Minute
+
+const (
+	RemoveReason_Age   = "age"
+	RemoveReason_Quota = "quota"
+)
+
+const dayMs = int64(24 * time.Hour / time.Millisecond)
+
+type JanitorReportType struct {
+	Ts                int64
+	DryRun            bool
+	LinesRemovedAge   int
+	LinesRemovedQuota int
+	TrashRemoved      int // trash items purged by quota
+	BytesRemoved      int64
+	HistoryRemoved    int
+	TotalOutputSize   int64 // after removal
+	Errors            []string
+}
+
+func (r *JanitorReportType) HasRemoved() bool {
+	return r.LinesRemovedAge > 0 || r.LinesRemovedQuota > 0 || r.TrashRemoved > 0 || r.HistoryRemoved > 0
+}
+
+func (r *JanitorReportType) String() string {
+	verb := "removed"
+	if r.DryRun {
+		verb = "would remove"
+	}
+	rtn := fmt.Sprintf("%s %d line(s) by age, %d line(s) and %d trash item(s) by quota (%s of output), %d history entries", verb, r.LinesRemovedAge,
+		r.LinesRemovedQuota, r.TrashRemoved, scbase.NumFormatB2(r.BytesRemoved), r.HistoryRemoved)
+	if len(r.Errors) > 0 {
+		rtn += fmt.Sprintf(", %d error(s)", len(r.Errors))
+	}
+	return rtn
+}
+
+type lineSizeType struct {
+	Line   *sstore.RetentionLineType
+	Size   int64
+	Reason string // set when the line is to be removed
+}
+
+type trashSizeType struct {
+	Item   *sstore.TrashItemType
+	Size   int64
+	Remove bool
+}
+
+// janitor runs are serialized (background loop and /retention:run)
+var janitorLock = &sync.Mutex{}
+
+// separate lock so GetLastReport does not wait for a running janitor
+var lastReportLock = &sync.Mutex{}
+var lastReport *JanitorReportType
+
+func GetLastReport() *JanitorReportType {
+	lastReportLock.Lock()
+	defer lastReportLock.Unlock()
+	return lastReport
+}
+
+func setLastReport(report *JanitorReportType) {
+	lastReportLock.Lock()
+	defer lastReportLock.Unlock()
+	lastReport = report
+}
+
+// session values override the client values (0 means "use the client value")
+func effectiveValue[T int | int64](sessionVal T, clientVal T) T {
+	if sessionVal == sstore.RetentionOff {
+		return 0
+	}
+	if sessionVal == 0 {
+		return clientVal
+	}
+	return sessionVal
+}
+
+func getPolicy(policies map[string]*sstore.RetentionPolicyType, sessionId string) *sstore.RetentionPolicyType {
+	if p := policies[sessionId]; p != nil {
+		return p
+	}
+	return &sstore.RetentionPolicyType{SessionId: sessionId}
+}
+
+// archived output first, then oldest first
+func sortForEviction(lines []*lineSizeType) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Line.Archived != lines[j].Line.Archived {
+			return lines[i].Line.Archived
+		}
+		return lines[i].Line.Ts < lines[j].Line.Ts
+	})
+}
+
+// marks lines (in eviction order) until totalSize is at most maxSize, returns the new total
+func evictToSize(lines []*lineSizeType, totalSize int64, maxSize int64, canEvict func(*lineSizeType) bool) int64 {
+	sortForEviction(lines)
+	for _, ls := range lines {
+		if totalSize <= maxSize {
+			break
+		}
+		if ls.Reason != "" || ls.Line.IsProtected() || !canEvict(ls) {
+			continue
+		}
+		ls.Reason = RemoveReason_Quota
+		totalSize -= ls.Size
+	}
+	return totalSize
+}
+
+// sets Reason on the lines to remove and Remove on the trash items to purge.  policies is keyed by sessionid
+// ("" for the client policy).
+func planOutputRetention(policies map[string]*sstore.RetentionPolicyType, lines []*lineSizeType, trash []*trashSizeType, nowMs int64) {
+	clientPolicy := getPolicy(policies, "")
+	sessionLines := make(map[string][]*lineSizeType)
+	for _, ls := range lines {
+		sessionLines[ls.Line.SessionId] = append(sessionLines[ls.Line.SessionId], ls)
+		outputDays := effectiveValue(getPolicy(policies, ls.Line.SessionId).OutputDays, clientPolicy.OutputDays)
+		if outputDays > 0 && !ls.Line.IsProtected() && ls.Line.Ts < nowMs-int64(outputDays)*dayMs {
+			ls.Reason = RemoveReason_Age
+		}
+	}
+	var totalSize int64
+	for sessionId, slines := range sessionLines {
+		var sessionSize int64
+		for _, ls := range slines {
+			if ls.Reason == "" {
+				sessionSize += ls.Size
+			}
+		}
+		maxSize := getPolicy(policies, sessionId).MaxOutputSize
+		if maxSize > 0 {
+			sessionSize = evictToSize(slines, sessionSize, maxSize, func(*lineSizeType) bool { return true })
+		}
+		totalSize += sessionSize
+	}
+	if clientPolicy.MaxOutputSize > 0 {
+		for _, ts := range trash {
+			totalSize += ts.Size
+		}
+		sort.SliceStable(trash, func(i, j int) bool {
+			return trash[i].Item.DeletedTs < trash[j].Item.DeletedTs
+		})
+		for _, ts := range trash {
+			if totalSize <= clientPolicy.MaxOutputSize {
+				break
+			}
+			ts.Remove = true
+			totalSize -= ts.Size
+		}
+		evictToSize(lines, totalSize, clientPolicy.MaxOutputSize, func(ls *lineSizeType) bool {
+			return getPolicy(policies, ls.Line.SessionId).MaxOutputSize != sstore.RetentionOff
+		})
+	}
+}
+
+func removeLines(ctx context.Context, toRemove []*lineSizeType, report *JanitorReportType) {
+	screenLines := make(map[string][]*lineSizeType)
+	for _, ls := range toRemove {
+		screenLines[ls.Line.ScreenId] = append(screenLines[ls.Line.ScreenId], ls)
+	}
+	for screenId, slines := range screenLines {
+		lineIds := make([]string, 0, len(slines))
+		for _, ls := range slines {
+			lineIds = append(lineIds, ls.Line.LineId)
+		}
+		removedIds, err := sstore.PurgeLinesByIds(ctx, screenId, lineIds)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("screen %s: %v", screenId, err))
+			continue
+		}
+		removedMap := make(map[string]bool)
+		for _, lineId := range removedIds {
+			removedMap[lineId] = true
+		}
+		for _, ls := range slines {
+			if !removedMap[ls.Line.LineId] {
+				continue
+			}
+			report.BytesRemoved += ls.Size
+			if ls.Reason == RemoveReason_Age {
+				report.LinesRemovedAge++
+			} else {
+				report.LinesRemovedQuota++
+			}
+		}
+		update := scbus.MakeUpdatePacket()
+		sstore.AddLinesRemoveUpdate(update, screenId, removedIds)
+		scbus.MainUpdateBus.DoScreenUpdate(screenId, update)
+	}
+}
+
+func removeTrashItems(ctx context.Context, toRemove []*trashSizeType, report *JanitorReportType) {
+	for _, ts := range toRemove {
+		err := sstore.DeleteTrashItem(ctx, ts.Item.TrashId)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("trash item %s: %v", ts.Item.TrashId, err))
+			continue
+		}
+		report.TrashRemoved++
+		report.BytesRemoved += ts.Size
+	}
+}
+
+func applyHistoryRetention(ctx context.Context, policies map[string]*sstore.RetentionPolicyType, nowMs int64, report *JanitorReportType) {
+	clientDays := getPolicy(policies, "").HistoryDays
+	// sessions with their own historydays are handled separately, the client policy covers everything else
+	var ownSessionIds []string
+	for sessionId, policy := range policies {
+		if sessionId == "" || policy.HistoryDays == 0 {
+			continue
+		}
+		ownSessionIds = append(ownSessionIds, sessionId)
+		if policy.HistoryDays == sstore.RetentionOff {
+			continue
+		}
+		numRemoved, err := history.PurgeHistoryBefore(ctx, nowMs-int64(policy.HistoryDays)*dayMs, []string{sessionId}, false, report.DryRun)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("history for session %s: %v", sessionId, err))
+			continue
+		}
+		report.HistoryRemoved += numRemoved
+	}
+	if clientDays <= 0 {
+		return
+	}
+	numRemoved, err := history.PurgeHistoryBefore(ctx, nowMs-int64(clientDays)*dayMs, ownSessionIds, true, report.DryRun)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("history: %v", err))
+		return
+	}
+	report.HistoryRemoved += numRemoved
+}
+
+// applies the retention policies.  with dryRun nothing is removed, the report has what would be removed.
+func RunJanitor(ctx context.Context, dryRun bool) (*JanitorReportType, error) {
+	janitorLock.Lock()
+	defer janitorLock.Unlock()
+	now := time.Now()
+	report := &JanitorReportType{Ts: now.UnixMilli(), DryRun: dryRun}
+	policyArr, err := sstore.GetRetentionPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get retention policies: %v", err)
+	}
+	policies := make(map[string]*sstore.RetentionPolicyType)
+	for _, policy := range policyArr {
+		policies[policy.SessionId] = policy
+	}
+	rlines, err := sstore.GetRetentionLines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get lines: %v", err)
+	}
+	lines := make([]*lineSizeType, 0, len(rlines))
+	for _, rl := range rlines {
+		lines = append(lines, &lineSizeType{Line: rl, Size: sstore.PtyOutFileSize(rl.ScreenId, rl.LineId)})
+	}
+	trashItems, err := sstore.GetTrashItems(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get trash items: %v", err)
+	}
+	trash := make([]*trashSizeType, 0, len(trashItems))
+	for _, item := range trashItems {
+		trash = append(trash, &trashSizeType{Item: item, Size: sstore.TrashItemSize(item.TrashId)})
+	}
+	planOutputRetention(policies, lines, trash, report.Ts)
+	var trashToRemove []*trashSizeType
+	for _, ts := range trash {
+		if ts.Remove {
+			trashToRemove = append(trashToRemove, ts)
+			continue
+		}
+		report.TotalOutputSize += ts.Size
+	}
+	var toRemove []*lineSizeType
+	for _, ls := range lines {
+		if ls.Reason != "" {
+			toRemove = append(toRemove, ls)
+			continue
+		}
+		report.TotalOutputSize += ls.Size
+	}
+	if dryRun {
+		for _, ts := range trashToRemove {
+			report.TrashRemoved++
+			report.BytesRemoved += ts.Size
+		}
+		for _, ls := range toRemove {
+			report.BytesRemoved += ls.Size
+			if ls.Reason == RemoveReason_Age {
+				report.LinesRemovedAge++
+			} else {
+				report.LinesRemovedQuota++
+			}
+		}
+	} else {
+		removeTrashItems(ctx, trashToRemove, report)
+		removeLines(ctx, toRemove, report)
+	}
+	applyHistoryRetention(ctx, policies, report.Ts, report)
+	if !dryRun {
+		setLastReport(report)
+	}
+	return report, nil
+}
+
+func runJanitorWrapper() {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		log.Printf("[error] in runJanitorWrapper: %v\n", r)
+		debug.PrintStack()
+	}()
+	ctx, cancelFn := context.WithTimeout(context.Background(), JanitorTimeout)
+	defer cancelFn()
+	report, err := RunJanitor(ctx, false)
+	if err != nil {
+		log.Printf("[error] running janitor: %v\n", err)
+		return
+	}
+	for _, errStr := range report.Errors {
+		log.Printf("[error] janitor: %s\n", errStr)
+	}
+	if !report.HasRemoved() {
+		return
+	}
+	log.Printf("janitor: %s\n", report.String())
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(sstore.InfoMsgType{InfoMsg: fmt.Sprintf("retention policy: %s (see /retention:show)", report.String())})
+	scbus.MainUpdateBus.DoUpdate(update)
+}
+
+func RunJanitorLoop() {
+	time.Sleep(InitialJanitorWait)
+	for {
+		runJanitorWrapper()
+		time.Sleep(JanitorInterval)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package janitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+func makeTestLine(sessionId string, lineId string, ageDays int64, size int64, archived bool) *lineSizeType {
+	const nowMs = 100 * dayMs
+	return &lineSizeType{
+		Line: &sstore.RetentionLineType{SessionId: sessionId, ScreenId: "screen-" + sessionId, LineId: lineId, Ts: nowMs - ageDays*dayMs - 1, Archived: archived},
+		Size: size,
+	}
+}
+
+func getRemoved(lines []*lineSizeType) map[string]string {
+	rtn := make(map[string]string)
+	for _, ls := range lines {
+		if ls.Reason != "" {
+			rtn[ls.Line.LineId] = ls.Reason
+		}
+	}
+	return rtn
+}
+
+func TestPlanOutputAge(t *testing.T) {
+	lines := []*lineSizeType{
+		makeTestLine("s1", "old", 40, 10, false),
+		makeTestLine("s1", "new", 5, 10, false),
+		makeTestLine("s2", "s2old", 40, 10, false),
+		makeTestLine("s3", "s3old", 40, 10, false),
+		makeTestLine("s1", "starred", 40, 10, false),
+		makeTestLine("s1", "running", 40, 10, false),
+	}
+	lines[4].Line.Star = 1
+	lines[5].Line.Status = sstore.CmdStatusRunning
+	policies := map[string]*sstore.RetentionPolicyType{
+		"":   {OutputDays: 30},
+		"s2": {SessionId: "s2", OutputDays: 60},
+		"s3": {SessionId: "s3", OutputDays: sstore.RetentionOff},
+	}
+	planOutputRetention(policies, lines, nil, 100*dayMs)
+	removed := getRemoved(lines)
+	if len(removed) != 1 || removed["old"] != RemoveReason_Age {
+		t.Errorf("unexpected removed lines %v", removed)
+	}
+}
+
+func TestPlanOutputQuota(t *testing.T) {
+	lines := []*lineSizeType{
+		makeTestLine("s1", "a", 3, 100, false),
+		makeTestLine("s1", "b", 2, 100, true),
+		makeTestLine("s1", "c", 1, 100, false),
+		makeTestLine("s2", "d", 5, 100, false),
+		makeTestLine("s3", "e", 9, 100, false),
+	}
+	// client cap (over all sessions), s3 opts out, archived output goes first, then oldest
+	policies := map[string]*sstore.RetentionPolicyType{
+		"":   {MaxOutputSize: 250},
+		"s3": {SessionId: "s3", MaxOutputSize: sstore.RetentionOff},
+	}
+	planOutputRetention(policies, lines, nil, 100*dayMs)
+	removed := getRemoved(lines)
+	if len(removed) != 3 || removed["b"] != RemoveReason_Quota || removed["d"] == "" || removed["a"] == "" {
+		t.Errorf("unexpected removed lines (client cap) %v", removed)
+	}
+
+	// session cap only applies to the session
+	for _, ls := range lines {
+		ls.Reason = ""
+	}
+	policies = map[string]*sstore.RetentionPolicyType{
+		"s1": {SessionId: "s1", MaxOutputSize: 150},
+	}
+	planOutputRetention(policies, lines, nil, 100*dayMs)
+	removed = getRemoved(lines)
+	if len(removed) != 2 || removed["b"] == "" || removed["a"] == "" {
+		t.Errorf("unexpected removed lines (session cap) %v", removed)
+	}
+}
+
+func TestPlanOutputQuotaTrash(t *testing.T) {
+	lines := []*lineSizeType{
+		makeTestLine("s1", "a", 3, 100, false),
+		makeTestLine("s1", "b", 1, 100, false),
+	}
+	trash := []*trashSizeType{
+		{Item: &sstore.TrashItemType{TrashId: "t-new", DeletedTs: 90 * dayMs}, Size: 100},
+		{Item: &sstore.TrashItemType{TrashId: "t-old", DeletedTs: 80 * dayMs}, Size: 100},
+	}
+	// trash is purged (oldest first) before any lines are removed
+	policies := map[string]*sstore.RetentionPolicyType{
+		"": {MaxOutputSize: 300},
+	}
+	planOutputRetention(policies, lines, trash, 100*dayMs)
+	removed := getRemoved(lines)
+	if len(removed) != 0 || !trash[0].Remove || trash[1].Remove || trash[0].Item.TrashId != "t-old" {
+		t.Errorf("unexpected removed lines %v / trash %v %v", removed, trash[0], trash[1])
+	}
+
+	for _, ts := range trash {
+		ts.Remove = false
+	}
+	policies = map[string]*sstore.RetentionPolicyType{
+		"": {MaxOutputSize: 100},
+	}
+	planOutputRetention(policies, lines, trash, 100*dayMs)
+	removed = getRemoved(lines)
+	if len(removed) != 1 || removed["a"] != RemoveReason_Quota || !trash[0].Remove || !trash[1].Remove {
+		t.Errorf("unexpected removed lines %v / trash %v %v", removed, trash[0], trash[1])
+	}
+}
+
+func TestGetLastReportWhileRunning(t *testing.T) {
+	setLastReport(&JanitorReportType{Ts: 100})
+	t.Cleanup(func() { setLastReport(nil) })
+	// simulates a janitor run in progress
+	janitorLock.Lock()
+	defer janitorLock.Unlock()
+	reportCh := make(chan *JanitorReportType, 1)
+	go func() {
+		reportCh <- GetLastReport()
+	}()
+	select {
+	case report := <-reportCh:
+		if report == nil || report.Ts != 100 {
+			t.Errorf("unexpected last report %#v", report)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("GetLastReport blocked on a running janitor")
+	}
+}
@@ -295,7 +295,7 @@ func makeWebShareUpdate(ctx context.Context, update *sstore.ScreenUpdateType) (*
 	case sstore.UpdateType_LineDel:
 		break
 
-	case sstore.UpdateType_LineRenderer, sstore.UpdateType_LineContentHeight:
+	case sstore.UpdateType_LineRenderer, sstore.UpdateType_LineContentHeight, sstore.UpdateType_LineNote:
 		line, err := sstore.GetLineById(ctx, update.ScreenId, update.LineId)
 		if err != nil || line == nil {
 			return nil, fmt.Errorf("error getting line: %v", defaultError(err, "not found"))
@@ -304,6 +304,8 @@ func makeWebShareUpdate(ctx context.Context, update *sstore.ScreenUpdateType) (*
 			rtn.SVal = line.Renderer
 		} else if update.UpdateType == sstore.UpdateType_LineContentHeight {
 			rtn.IVal = line.ContentHeight
+		} else if update.UpdateType == sstore.UpdateType_LineNote {
+			rtn.SVal = line.Note
 		}
 
 	case sstore.UpdateType_CmdStatus:
@@ -128,6 +128,7 @@ type WebShareLineType struct {
 	ContentHeight int64  `json:"contentheight"`
 	Renderer      string `json:"renderer,omitempty"`
 	Text          string `json:"text,omitempty"`
+	Note          string `json:"note,omitempty"`
 }
 
 func webLineFromLine(line *sstore.LineType) (*WebShareLineType, error) {
@@ -139,6 +140,7 @@ func webLineFromLine(line *sstore.LineType) (*WebShareLineType, error) {
 		ContentHeight: line.ContentHeight,
 		Renderer:      line.Renderer,
 		Text:          line.Text,
+		Note:          line.Note,
 	}
 	return rtn, nil
 }
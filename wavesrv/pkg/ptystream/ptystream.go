@@ -0,0 +1,362 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Streams pty output to external consumers as Server-Sent Events.  A client subscribes to a screen (the output of
+// all of its commands) or to a single line, and receives ordered output chunks with their pty offsets.  After a
+// reconnect the client can resume from an offset (offset query param or the Last-Event-ID header) and the missed
+// output is replayed from the ptyout file before live output is streamed.
+//
+// events:
+//
+//	id: [lineid]:[endoffset]
+//	event: output     data: {"screenid", "lineid", "offset", "data64", "len"}
+//	event: truncated  data: {"screenid", "lineid", "offset", "availableoffset"}  (requested output no longer in the ptyout file)
+//	event: cmddone    data: {"screenid", "lineid", "status", "exitcode", "durationms"}  (line streams end after this event)
+package ptystream
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+const (
+	StreamPtyOutUrl   = "/api/stream-ptyout"
+	HeartbeatInterval = 15 * time.Second
+	WriteTimeout      = 10 * time.Second
+	MaxReplayChunk    = 64 * 1024
+	ReadTimeout       = 5 * time.Second
+)
+
+type OutputEventType struct {
+	ScreenId string `json:"screenid"`
+	LineId   string `json:"lineid"`
+	Offset   int64  `json:"offset"`
+	Data64   string `json:"data64"`
+	Len      int64  `json:"len"`
+}
+
+type TruncatedEventType struct {
+	ScreenId        string `json:"screenid"`
+	LineId          string `json:"lineid"`
+	Offset          int64  `json:"offset"`
+	AvailableOffset int64  `json:"availableoffset"`
+}
+
+type CmdDoneEventType struct {
+	ScreenId   string `json:"screenid"`
+	LineId     string `json:"lineid"`
+	Status     string `json:"status"`
+	ExitCode   int    `json:"exitcode"`
+	DurationMs int    `json:"durationms"`
+}
+
+type ptyStream struct {
+	W          http.ResponseWriter
+	Rc         *http.ResponseController
+	ScreenId   string
+	LineId     string           // empty for screen streams
+	NextOffset map[string]int64 // per line, the offset of the next byte to send
+}
+
+// parses "[lineid]:[offset]" (the event id), returns ok=false if invalid
+func parseEventId(eventId string) (string, int64, bool) {
+	lineId, offsetStr, found := strings.Cut(eventId, ":")
+	if !found {
+		return "", 0, false
+	}
+	if _, err := uuid.Parse(lineId); err != nil {
+		return "", 0, false
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil || offset < 0 {
+		return "", 0, false
+	}
+	return lineId, offset, true
+}
+
+// returns the part of a chunk (starting at pos) that has not been sent yet (nextOffset), and whether there is a
+// gap between what was sent and the chunk (missed data that must be replayed from the ptyout file)
+func unsentPart(pos int64, data []byte, nextOffset int64) ([]byte, bool) {
+	if pos > nextOffset {
+		return nil, true
+	}
+	end := pos + int64(len(data))
+	if end <= nextOffset {
+		return nil, false
+	}
+	return data[nextOffset-pos:], false
+}
+
+func (s *ptyStream) writeEvent(eventType string, eventId string, data any) error {
+	barr, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if eventId != "" {
+		sb.WriteString("id: " + eventId + "\n")
+	}
+	sb.WriteString("event: " + eventType + "\n")
+	sb.WriteString("data: " + string(barr) + "\n\n")
+	return s.writeRaw(sb.String())
+}
+
+func (s *ptyStream) writeRaw(str string) error {
+	s.Rc.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	_, err := s.W.Write([]byte(str))
+	if err != nil {
+		return err
+	}
+	return s.Rc.Flush()
+}
+
+func (s *ptyStream) sendOutput(lineId string, pos int64, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	endOffset := pos + int64(len(data))
+	s.NextOffset[lineId] = endOffset
+	event := OutputEventType{
+		ScreenId: s.ScreenId,
+		LineId:   lineId,
+		Offset:   pos,
+		Data64:   base64.StdEncoding.EncodeToString(data),
+		Len:      int64(len(data)),
+	}
+	return s.writeEvent("output", fmt.Sprintf("%s:%d", lineId, endOffset), event)
+}
+
+// sends everything in the ptyout file from NextOffset[lineId]
+func (s *ptyStream) replay(ctx context.Context, lineId string) error {
+	for {
+		offset := s.NextOffset[lineId]
+		readCtx, cancelFn := context.WithTimeout(ctx, ReadTimeout)
+		realOffset, data, err := sstore.ReadPtyOutFile(readCtx, s.ScreenId, lineId, offset, MaxReplayChunk)
+		cancelFn()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading ptyout file: %v", err)
+		}
+		if realOffset > offset {
+			err = s.writeEvent("truncated", "", TruncatedEventType{ScreenId: s.ScreenId, LineId: lineId, Offset: offset, AvailableOffset: realOffset})
+			if err != nil {
+				return err
+			}
+			s.NextOffset[lineId] = realOffset
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		err = s.sendOutput(lineId, realOffset, data)
+		if err != nil {
+			return err
+		}
+		if len(data) < MaxReplayChunk {
+			return nil
+		}
+	}
+}
+
+func (s *ptyStream) handlePtyUpdate(ctx context.Context, update *scbus.PtyDataUpdate) error {
+	if update.ScreenId != s.ScreenId || update.LineId == "" {
+		return nil
+	}
+	if s.LineId != "" && update.LineId != s.LineId {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(update.PtyData64)
+	if err != nil {
+		return nil
+	}
+	nextOffset, found := s.NextOffset[update.LineId]
+	if !found {
+		// first output seen for this line in a screen stream
+		return s.sendOutput(update.LineId, update.PtyPos, data)
+	}
+	unsent, gap := unsentPart(update.PtyPos, data, nextOffset)
+	if gap {
+		// updates were dropped (full channel), replay from the file (which includes this update)
+		return s.replay(ctx, update.LineId)
+	}
+	return s.sendOutput(update.LineId, nextOffset, unsent)
+}
+
+// returns true if the stream should end (a line stream's command is done)
+func (s *ptyStream) handleModelUpdate(ctx context.Context, update *scbus.ModelUpdatePacketType) (bool, error) {
+	if update.Data == nil {
+		return false, nil
+	}
+	for _, item := range *update.Data {
+		cmd, ok := item.(sstore.CmdType)
+		if !ok || cmd.ScreenId != s.ScreenId || cmd.IsRunning() {
+			continue
+		}
+		if s.LineId != "" && cmd.LineId != s.LineId {
+			continue
+		}
+		done, err := s.sendCmdDone(ctx, &cmd)
+		if done || err != nil {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+func (s *ptyStream) sendCmdDone(ctx context.Context, cmd *sstore.CmdType) (bool, error) {
+	// make sure all of the output has been sent before the done event
+	err := s.replay(ctx, cmd.LineId)
+	if err != nil {
+		return false, err
+	}
+	event := CmdDoneEventType{ScreenId: cmd.ScreenId, LineId: cmd.LineId, Status: cmd.Status, ExitCode: cmd.ExitCode, DurationMs: cmd.DurationMs}
+	err = s.writeEvent("cmddone", fmt.Sprintf("%s:%d", cmd.LineId, s.NextOffset[cmd.LineId]), event)
+	if err != nil {
+		return false, err
+	}
+	return s.LineId != "", nil
+}
+
+func (s *ptyStream) checkCmdDone(ctx context.Context) (bool, error) {
+	cmd, err := sstore.GetCmdByScreenId(ctx, s.ScreenId, s.LineId)
+	if err != nil {
+		return false, err
+	}
+	if cmd == nil {
+		return true, fmt.Errorf("cmd was deleted")
+	}
+	if cmd.IsRunning() {
+		return false, nil
+	}
+	return s.sendCmdDone(ctx, cmd)
+}
+
+// GET /api/stream-ptyout?screenid=[screenid]&lineid=[lineid]&offset=[offset]
+// (must not be wrapped in an http.TimeoutHandler)
+func HandleStreamPtyOut(w http.ResponseWriter, r *http.Request) {
+	qvals := r.URL.Query()
+	screenId := qvals.Get("screenid")
+	lineId := qvals.Get("lineid")
+	if _, err := uuid.Parse(screenId); err != nil {
+		http.Error(w, fmt.Sprintf("invalid screenid: %v", err), http.StatusBadRequest)
+		return
+	}
+	if lineId != "" {
+		if _, err := uuid.Parse(lineId); err != nil {
+			http.Error(w, fmt.Sprintf("invalid lineid: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	s := &ptyStream{W: w, Rc: http.NewResponseController(w), ScreenId: screenId, LineId: lineId, NextOffset: make(map[string]int64)}
+	if lineId != "" {
+		s.NextOffset[lineId] = 0
+	}
+	if offsetStr := qvals.Get("offset"); offsetStr != "" {
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 || lineId == "" {
+			http.Error(w, "invalid offset (requires lineid)", http.StatusBadRequest)
+			return
+		}
+		s.NextOffset[lineId] = offset
+	}
+	if resumeLineId, resumeOffset, ok := parseEventId(r.Header.Get("Last-Event-ID")); ok {
+		if lineId == "" || resumeLineId == lineId {
+			s.NextOffset[resumeLineId] = resumeOffset
+		}
+	}
+	var cmd *sstore.CmdType
+	if lineId != "" {
+		var err error
+		cmd, err = sstore.GetCmdByScreenId(r.Context(), screenId, lineId)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error getting cmd: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if cmd == nil {
+			http.Error(w, "cmd not found", http.StatusNotFound)
+			return
+		}
+	}
+	// register before replaying so no output is missed (duplicates are dropped by offset)
+	// the server's read timeout would cancel the request context of a long-lived stream
+	s.Rc.SetReadDeadline(time.Time{})
+	channelId := "ptystream:" + uuid.New().String()
+	updateCh := scbus.MainUpdateBus.RegisterChannel(channelId, &scbus.UpdateChannel{ScreenId: screenId})
+	defer scbus.MainUpdateBus.UnregisterChannel(channelId)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	err := s.runStream(r.Context(), cmd, updateCh)
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("[ptystream] stream screen=%s line=%s ended: %v\n", screenId, lineId, err)
+	}
+}
+
+func (s *ptyStream) runStream(ctx context.Context, cmd *sstore.CmdType, updateCh chan scbus.UpdatePacket) error {
+	err := s.writeRaw(": wave pty stream\n\n")
+	if err != nil {
+		return err
+	}
+	for lineId := range s.NextOffset {
+		err = s.replay(ctx, lineId)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd != nil && !cmd.IsRunning() {
+		_, err = s.sendCmdDone(ctx, cmd)
+		return err
+	}
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-heartbeat.C:
+			err = s.writeRaw(": ping\n\n")
+			if err == nil && s.LineId != "" {
+				// the done update can be dropped if the channel is full, so re-check the cmd status
+				var done bool
+				done, err = s.checkCmdDone(ctx)
+				if done {
+					return err
+				}
+			}
+
+		case update, ok := <-updateCh:
+			if !ok {
+				return fmt.Errorf("update channel closed")
+			}
+			var done bool
+			switch upk := update.(type) {
+			case *scbus.PtyDataUpdatePacketType:
+				err = s.handlePtyUpdate(ctx, upk.Data)
+			case *scbus.ModelUpdatePacketType:
+				done, err = s.handleModelUpdate(ctx, upk)
+			}
+			if done {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ptystream
+
+import (
+	"testing"
+)
+
+func TestUnsentPart(t *testing.T) {
+	data := []byte("hello world")
+	unsent, gap := unsentPart(0, data, 0)
+	if gap || string(unsent) != "hello world" {
+		t.Errorf("unexpected unsent %q %v", unsent, gap)
+	}
+	unsent, gap = unsentPart(0, data, 6)
+	if gap || string(unsent) != "world" {
+		t.Errorf("unexpected unsent %q %v", unsent, gap)
+	}
+	unsent, gap = unsentPart(0, data, 11)
+	if gap || len(unsent) != 0 {
+		t.Errorf("expected nothing unsent, got %q %v", unsent, gap)
+	}
+	unsent, gap = unsentPart(20, data, 11)
+	if !gap || len(unsent) != 0 {
+		t.Errorf("expected gap, got %q %v", unsent, gap)
+	}
+}
+
+func TestParseEventId(t *testing.T) {
+	lineId, offset, ok := parseEventId("0d9dfc4b-6cd0-4d1f-8b43-0d4a9e0b6f51:1234")
+	if !ok || lineId != "0d9dfc4b-6cd0-4d1f-8b43-0d4a9e0b6f51" || offset != 1234 {
+		t.Errorf("unexpected parse %q %d %v", lineId, offset, ok)
+	}
+	for _, bad := range []string{"", "1234", "notauuid:5", "0d9dfc4b-6cd0-4d1f-8b43-0d4a9e0b6f51:-1", "0d9dfc4b-6cd0-4d1f-8b43-0d4a9e0b6f51:x"} {
+		if _, _, ok := parseEventId(bad); ok {
+			t.Errorf("expected %q to be invalid", bad)
+		}
+	}
+}
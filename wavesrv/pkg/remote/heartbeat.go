@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shexec"
+	"golang.org/x/mod/semver"
+)
+
+// heartbeats: wavesrv pings each connected waveshell (ping packets with a reqid are answered by the server)
+// to measure round-trip latency.  after HeartbeatMaxMissed consecutive failures the connection is flagged
+// as degraded (it is not disconnected, the flag is cleared on the next successful heartbeat).
+
+const HeartbeatInterval = 15 * time.Second
+const HeartbeatTimeout = 10 * time.Second
+const HeartbeatMaxMissed = 3
+const HeartbeatLatencyNotifyMs = 50 // only send a remote update for latency changes larger than this
+
+// waveshell servers older than this do not answer ping (with reqid), sysmetrics, or proc rpcs (they drop the packets)
+const MinRpcWaveshellVersion = "v0.8.0"
+
+type heartbeatState struct {
+	LatencyMs        int64
+	LastSeenTs       int64
+	MissedHeartbeats int
+	Degraded         bool
+}
+
+func (wsh *WaveshellProc) resetHeartbeatState_nolock() {
+	wsh.Heartbeat = heartbeatState{LastSeenTs: time.Now().UnixMilli()}
+}
+
+// must be called without the lock held.  returns false if cproc is no longer the active (connected) server proc
+func (wsh *WaveshellProc) isActiveServerProc(cproc *shexec.ClientProc) bool {
+	wsh.Lock.Lock()
+	defer wsh.Lock.Unlock()
+	return wsh.ServerProc == cproc && wsh.Status == StatusConnected
+}
+
+// returns an error if the connected waveshell server is older than minVersion
+func (wsh *WaveshellProc) CheckWaveshellVersion(minVersion string) error {
+	wsh.Lock.Lock()
+	defer wsh.Lock.Unlock()
+	if wsh.ServerProc == nil || wsh.ServerProc.InitPk == nil {
+		return fmt.Errorf("remote not connected")
+	}
+	version := wsh.ServerProc.InitPk.Version
+	if !semver.IsValid(version) || semver.Compare(version, minVersion) < 0 {
+		return fmt.Errorf("remote waveshell too old (%s), requires %s (reinstall waveshell with /remote:install)", version, minVersion)
+	}
+	return nil
+}
+
+func (wsh *WaveshellProc) runHeartbeatLoop(cproc *shexec.ClientProc) {
+	if err := wsh.CheckWaveshellVersion(MinRpcWaveshellVersion); err != nil {
+		log.Printf("[%s] heartbeats disabled: %v\n", wsh.GetRemoteName(), err)
+		return
+	}
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !wsh.isActiveServerProc(cproc) {
+			return
+		}
+		wsh.sendHeartbeat()
+	}
+}
+
+func (wsh *WaveshellProc) sendHeartbeat() {
+	ctx, cancelFn := context.WithTimeout(context.Background(), HeartbeatTimeout)
+	defer cancelFn()
+	pingPk := packet.MakePingPacket()
+	pingPk.ReqId = uuid.New().String()
+	startTime := time.Now()
+	resp, err := wsh.PacketRpc(ctx, pingPk)
+	if err == nil {
+		err = resp.Err()
+	}
+	wsh.recordHeartbeat(time.Since(startTime), err == nil)
+}
+
+func (wsh *WaveshellProc) recordHeartbeat(latency time.Duration, ok bool) {
+	var becameDegraded, recovered, notify bool
+	wsh.WithLock(func() {
+		hb := &wsh.Heartbeat
+		if !ok {
+			notify = true
+			hb.MissedHeartbeats++
+			if hb.MissedHeartbeats >= HeartbeatMaxMissed && !hb.Degraded {
+				hb.Degraded = true
+				becameDegraded = true
+			}
+			return
+		}
+		latencyDelta := latency.Milliseconds() - hb.LatencyMs
+		notify = hb.MissedHeartbeats > 0 || latencyDelta > HeartbeatLatencyNotifyMs || latencyDelta < -HeartbeatLatencyNotifyMs
+		hb.LatencyMs = latency.Milliseconds()
+		hb.LastSeenTs = time.Now().UnixMilli()
+		hb.MissedHeartbeats = 0
+		if hb.Degraded {
+			hb.Degraded = false
+			recovered = true
+		}
+	})
+	if becameDegraded {
+		wsh.WriteToPtyBuffer("*connection degraded, missed %d heartbeats\n", HeartbeatMaxMissed)
+	}
+	if recovered {
+		wsh.WriteToPtyBuffer("connection recovered, latency %dms\n", latency.Milliseconds())
+	}
+	if notify {
+		wsh.NotifyRemoteUpdate()
+	}
+}
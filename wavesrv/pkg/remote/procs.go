@@ -0,0 +1,66 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+)
+
+// process list / signal rpcs (used by /proc:list and /proc:kill).  these act on any process on the remote,
+// not just commands started by wave (see SignalCommand for those)
+
+const ProcRpcTimeout = 10 * time.Second
+
+// returns the matching procs and the total number of matches (procs is capped at maxItems)
+func (wsh *WaveshellProc) GetProcList(ctx context.Context, filter string, user string, maxItems int) ([]*packet.ProcInfoType, int, error) {
+	procListPk := packet.MakeProcListPacket()
+	procListPk.ReqId = uuid.New().String()
+	procListPk.Filter = filter
+	procListPk.User = user
+	procListPk.MaxItems = maxItems
+	err := wsh.CheckWaveshellVersion(MinRpcWaveshellVersion)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ProcRpcTimeout)
+	defer cancelFn()
+	rtnPk, err := wsh.PacketRpcRaw(ctx, procListPk)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, ok := rtnPk.(*packet.ProcListResponseType)
+	if !ok {
+		if respPk, ok := rtnPk.(*packet.ResponsePacketType); ok && respPk.Error != "" {
+			return nil, 0, fmt.Errorf("%s", respPk.Error)
+		}
+		return nil, 0, fmt.Errorf("invalid response packet received: %s", packet.AsString(rtnPk))
+	}
+	if resp.Error != "" {
+		return nil, 0, fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Procs, resp.NumProcs, nil
+}
+
+func (wsh *WaveshellProc) SignalProc(ctx context.Context, pid int, sigName string) error {
+	sigPk := packet.MakeProcSignalPacket()
+	sigPk.ReqId = uuid.New().String()
+	sigPk.Pid = pid
+	sigPk.SigName = sigName
+	err := wsh.CheckWaveshellVersion(MinRpcWaveshellVersion)
+	if err != nil {
+		return err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, ProcRpcTimeout)
+	defer cancelFn()
+	resp, err := wsh.PacketRpc(ctx, sigPk)
+	if err != nil {
+		return err
+	}
+	return resp.Err()
+}
@@ -62,6 +62,9 @@ const RpcIterChannelSize = 100
 const MaxInputDataSize = 1000
 const SudoTimeoutTime = 5 * time.Minute
 
+// valid values for RemoteOpts.Color
+var RemoteColorNames = []string{"red", "green", "yellow", "blue", "magenta", "cyan", "white", "orange"}
+
 var envVarsToStrip map[string]bool = map[string]bool{
 	"PROMPT":               true,
 	"PROMPT_VERSION":       true,
@@ -103,6 +106,36 @@ func MakeLocalWaveshellCommandStr(isSudo bool) (string, error) {
 	}
 }
 
+// runs the local waveshell binary as another user (the binary must be executable by that user)
+func MakeRunAsLocalWaveshellCommandStr(opts *sstore.SSHOpts) (string, error) {
+	waveshellPath, err := scbase.LocalWaveshellBinaryPath()
+	if err != nil {
+		return "", err
+	}
+	serverCmd := fmt.Sprintf("%s --server", shellescape.Quote(waveshellPath))
+	if opts.RunAsMethod == sstore.RunAsMethodSu {
+		return fmt.Sprintf(`%s; su - %s -c %s`, PrintPingPacket, shellescape.Quote(opts.RunAsUser), shellescape.Quote(serverCmd)), nil
+	}
+	return fmt.Sprintf(`%s; sudo -H -u %s %s`, PrintPingPacket, shellescape.Quote(opts.RunAsUser), serverCmd), nil
+}
+
+// wraps a command run over ssh so it runs as opts.RunAsUser (with their home dir, so ~/.mshell is theirs).
+// ssh sessions have no tty for a password prompt, so sudo must not require a password.
+func makeRunAsRemoteCmd(opts *sstore.SSHOpts, shellCmd string) (string, error) {
+	if opts.RunAsMethod == sstore.RunAsMethodSu {
+		return "", fmt.Errorf("runasmethod=su is only supported for local remotes (no tty for the password prompt over ssh), use runasmethod=sudo with passwordless sudo")
+	}
+	return fmt.Sprintf("sudo -n -H -u %s -- %s", shellescape.Quote(opts.RunAsUser), shellCmd), nil
+}
+
+func makeSSHServerCmd(remoteCopy sstore.RemoteType, sapi shellapi.ShellApi) (string, error) {
+	cmd := fmt.Sprintf("%s -c %s", sapi.GetLocalShellPath(), shellescape.Quote(MakeServerCommandStr()))
+	if remoteCopy.IsRunAs() {
+		return makeRunAsRemoteCmd(remoteCopy.SSHOpts, cmd)
+	}
+	return cmd, nil
+}
+
 func MakeServerCommandStr() string {
 	rtn := strings.ReplaceAll(WaveshellServerCommandFmt, "[%VERSION%]", semver.MajorMinor(scbase.WaveshellVersion))
 	rtn = strings.ReplaceAll(rtn, "[%PINGPACKET%]", PrintPingPacket)
@@ -155,6 +188,7 @@ type WaveshellProc struct {
 	NumTryConnect      int
 	InitPkShellType    string
 	DataPosMap         *utilfn.SyncMap[base.CommandKey, int64]
+	Heartbeat          heartbeatState
 
 	// install
 	InstallStatus         string
@@ -207,7 +241,7 @@ type RemoteRuntimeState = sstore.RemoteRuntimeState
 
 func CanComplete(remoteType string) bool {
 	switch remoteType {
-	case sstore.RemoteTypeSsh:
+	case sstore.RemoteTypeSsh, sstore.RemoteTypeCommand:
 		return true
 	default:
 		return false
@@ -578,6 +612,7 @@ func (wsh *WaveshellProc) GetRemoteRuntimeState() RemoteRuntimeState {
 		Archived:              wsh.Remote.Archived,
 		RemoteIdx:             wsh.Remote.RemoteIdx,
 		SSHConfigSrc:          wsh.Remote.SSHConfigSrc,
+		ConnectCmd:            wsh.Remote.ConnectCmd,
 		UName:                 wsh.UName,
 		InstallStatus:         wsh.InstallStatus,
 		NeedsWaveshellUpgrade: wsh.NeedsWaveshellUpgrade,
@@ -590,6 +625,13 @@ func (wsh *WaveshellProc) GetRemoteRuntimeState() RemoteRuntimeState {
 	}
 	if wsh.Remote.SSHOpts != nil {
 		state.AuthType = wsh.Remote.SSHOpts.GetAuthType()
+		state.RunAsUser = wsh.Remote.SSHOpts.RunAsUser
+	}
+	if wsh.Status == StatusConnected {
+		state.LatencyMs = wsh.Heartbeat.LatencyMs
+		state.LastSeenTs = wsh.Heartbeat.LastSeenTs
+		state.MissedHeartbeats = wsh.Heartbeat.MissedHeartbeats
+		state.Degraded = wsh.Heartbeat.Degraded
 	}
 	if wsh.Remote.RemoteOpts != nil {
 		optsCopy := *wsh.Remote.RemoteOpts
@@ -632,6 +674,9 @@ func (wsh *WaveshellProc) GetRemoteRuntimeState() RemoteRuntimeState {
 	if wsh.Remote.Local {
 		vars["local"] = "1"
 	}
+	if wsh.Remote.IsRunAs() {
+		vars["runas"] = wsh.Remote.SSHOpts.RunAsUser
+	}
 	vars["port"] = "22"
 	if wsh.Remote.SSHOpts != nil {
 		if wsh.Remote.SSHOpts.SSHPort != 0 {
@@ -661,7 +706,7 @@ func (wsh *WaveshellProc) GetRemoteRuntimeState() RemoteRuntimeState {
 	} else if wsh.Remote.IsSudo() {
 		vars["bestuser"] = "sudo@" + vars["bestuser"]
 	}
-	if wsh.Remote.Local {
+	if wsh.Remote.IsLocalHost() {
 		vars["bestname"] = vars["bestuser"] + "@local"
 		vars["bestshortname"] = vars["bestuser"] + "@local"
 	} else {
@@ -1111,10 +1156,16 @@ func (wsh *WaveshellProc) WaitAndSendPasswordNew(pw string) {
 		}
 	}
 
+	title := "Sudo Password"
+	wsh.WithLock(func() {
+		if wsh.Remote.IsRunAs() && wsh.Remote.SSHOpts.RunAsMethod == sstore.RunAsMethodSu {
+			title = fmt.Sprintf("Password for %s", wsh.Remote.SSHOpts.RunAsUser)
+		}
+	})
 	request := &userinput.UserInputRequestType{
 		QueryText:    "Please enter your password",
 		ResponseType: "text",
-		Title:        "Sudo Password",
+		Title:        title,
 		Markdown:     false,
 	}
 	response, err := userinput.GetUserInput(ctx, scbus.MainRpcBus, request)
@@ -1310,34 +1361,53 @@ func (wsh *WaveshellProc) RunInstall(autoInstall bool) {
 		wsh.WriteToPtyBuffer("*error: cannot install on remote that is already trying to install, cancel current install to try again\n")
 		return
 	}
-	if remoteCopy.Local {
+	if remoteCopy.IsLocalHost() {
 		wsh.WriteToPtyBuffer("*error: cannot install on a local remote\n")
 		return
 	}
-	_, err = shellapi.MakeShellApi(packet.ShellType_bash)
+	installSapi, err := shellapi.MakeShellApi(packet.ShellType_bash)
 	if err != nil {
 		wsh.WriteToPtyBuffer("*error: %v\n", err)
 		return
 	}
-	if wsh.Client == nil {
-		remoteDisplayName := fmt.Sprintf("%s [%s]", remoteCopy.RemoteAlias, remoteCopy.RemoteCanonicalName)
-		client, err := ConnectToClient(makeClientCtx, remoteCopy.SSHOpts, remoteDisplayName)
+	var installSession shexec.ConnInterface
+	if remoteCopy.IsCommand() {
+		installSession, err = wsh.makeCommandPipeWrap(remoteCopy, shexec.MakeInstallCommandStr())
+		if err != nil {
+			wsh.setInstallErrorStatus(err)
+			return
+		}
+	} else {
+		if wsh.Client == nil {
+			remoteDisplayName := fmt.Sprintf("%s [%s]", remoteCopy.RemoteAlias, remoteCopy.RemoteCanonicalName)
+			client, err := ConnectToClient(makeClientCtx, remoteCopy.SSHOpts, remoteDisplayName)
+			if err != nil {
+				statusErr := fmt.Errorf("ssh cannot connect to client: %w", err)
+				wsh.setInstallErrorStatus(statusErr)
+				return
+			}
+			wsh.WithLock(func() {
+				wsh.Client = client
+			})
+		}
+		session, err := wsh.Client.NewSession()
 		if err != nil {
 			statusErr := fmt.Errorf("ssh cannot connect to client: %w", err)
 			wsh.setInstallErrorStatus(statusErr)
 			return
 		}
-		wsh.WithLock(func() {
-			wsh.Client = client
-		})
-	}
-	session, err := wsh.Client.NewSession()
-	if err != nil {
-		statusErr := fmt.Errorf("ssh cannot connect to client: %w", err)
-		wsh.setInstallErrorStatus(statusErr)
-		return
+		installCmd := shexec.MakeInstallCommandStr()
+		if remoteCopy.IsRunAs() {
+			// install into the run-as user's ~/.mshell
+			installCmd, err = makeRunAsRemoteCmd(remoteCopy.SSHOpts, fmt.Sprintf("%s -c %s", installSapi.GetLocalShellPath(), shellescape.Quote(installCmd)))
+			if err != nil {
+				session.Close()
+				wsh.setInstallErrorStatus(err)
+				return
+			}
+		}
+		installSession = shexec.SessionWrap{Session: session, StartCmd: installCmd}
 	}
-	installSession := shexec.SessionWrap{Session: session, StartCmd: shexec.MakeInstallCommandStr()}
 	wsh.WriteToPtyBuffer("installing waveshell %s to %s...\n", scbase.WaveshellVersion, remoteCopy.RemoteCanonicalName)
 	clientCtx, clientCancelFn := context.WithCancel(context.Background())
 	defer clientCancelFn()
@@ -1585,6 +1655,31 @@ func (wsh *WaveshellProc) getActiveShellTypes(ctx context.Context) ([]string, er
 	return utilfn.CombineStrArrays(rtn, activeShells), nil
 }
 
+// runs the remote's connect command locally and starts shellCmd in the remote shell on the other end of its pipe.
+// the connect command gets a controlling tty so any prompts it prints show up in the remote's terminal.
+func (wsh *WaveshellProc) makeCommandPipeWrap(remoteCopy sstore.RemoteType, shellCmd string) (*shexec.ShellPipeWrap, error) {
+	if strings.TrimSpace(remoteCopy.ConnectCmd) == "" {
+		return nil, fmt.Errorf("remote has no connect command")
+	}
+	sapi, err := shellapi.MakeShellApi(wsh.GetShellType())
+	if err != nil {
+		return nil, err
+	}
+	ecmd := shexec.MakeLocalExecCmd(remoteCopy.ConnectCmd, sapi)
+	cmdPty, err := wsh.addControllingTty(ecmd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot attach controlling tty to connect command: %v", err)
+	}
+	go wsh.RunPtyReadLoop(cmdPty)
+	return shexec.MakeShellPipeWrap(ecmd, makeCommandPipeStartLine(sapi, shellCmd)), nil
+}
+
+// the line written to the shell on the far side of a connect command's pipe.  the shell is found through
+// the remote's PATH (the local shell path often does not exist in a container or on a jump host).
+func makeCommandPipeStartLine(sapi shellapi.ShellApi, shellCmd string) string {
+	return fmt.Sprintf("exec %s -c %s", sapi.GetRemoteShellPath(), shellescape.Quote(shellCmd))
+}
+
 func (wsh *WaveshellProc) createWaveshellSession(clientCtx context.Context, remoteCopy sstore.RemoteType) (shexec.ConnInterface, error) {
 	wsh.WithLock(func() {
 		wsh.Err = nil
@@ -1598,8 +1693,18 @@ func (wsh *WaveshellProc) createWaveshellSession(clientCtx context.Context, remo
 		return nil, err
 	}
 	var wsSession shexec.ConnInterface
-	if remoteCopy.SSHOpts.SSHHost == "" && remoteCopy.Local {
-		cmdStr, err := MakeLocalWaveshellCommandStr(remoteCopy.IsSudo())
+	if remoteCopy.IsCommand() {
+		wsSession, err = wsh.makeCommandPipeWrap(remoteCopy, MakeServerCommandStr())
+		if err != nil {
+			return nil, err
+		}
+	} else if remoteCopy.SSHOpts.SSHHost == "" && remoteCopy.IsLocalHost() {
+		var cmdStr string
+		if remoteCopy.IsRunAs() {
+			cmdStr, err = MakeRunAsLocalWaveshellCommandStr(remoteCopy.SSHOpts)
+		} else {
+			cmdStr, err = MakeLocalWaveshellCommandStr(remoteCopy.IsSudo())
+		}
 		if err != nil {
 			return nil, fmt.Errorf("cannot find local waveshell binary: %v", err)
 		}
@@ -1625,14 +1730,22 @@ func (wsh *WaveshellProc) createWaveshellSession(clientCtx context.Context, remo
 		if err != nil {
 			return nil, fmt.Errorf("ssh cannot create session: %w", err)
 		}
-		cmd := fmt.Sprintf("%s -c %s", sapi.GetLocalShellPath(), shellescape.Quote(MakeServerCommandStr()))
+		cmd, err := makeSSHServerCmd(remoteCopy, sapi)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
 		wsSession = shexec.SessionWrap{Session: session, StartCmd: cmd}
 	} else {
 		session, err := wsh.Client.NewSession()
 		if err != nil {
 			return nil, fmt.Errorf("ssh cannot create session: %w", err)
 		}
-		cmd := fmt.Sprintf(`%s -c %s`, sapi.GetLocalShellPath(), shellescape.Quote(MakeServerCommandStr()))
+		cmd, err := makeSSHServerCmd(remoteCopy, sapi)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
 		wsSession = shexec.SessionWrap{Session: session, StartCmd: cmd}
 	}
 	return wsSession, nil
@@ -1738,6 +1851,7 @@ func (wsh *WaveshellProc) Launch(interactive bool) {
 	wsh.WithLock(func() {
 		wsh.ServerProc = cproc
 		wsh.Status = StatusConnected
+		wsh.resetHeartbeatState_nolock()
 	})
 	wsh.WriteToPtyBuffer("connected to %s\n", remoteCopy.RemoteCanonicalName)
 	go func() {
@@ -1752,6 +1866,7 @@ func (wsh *WaveshellProc) Launch(interactive bool) {
 		wsh.WriteToPtyBuffer("*disconnected exitcode=%d\n", exitCode)
 	}()
 	go wsh.ProcessPackets()
+	go wsh.runHeartbeatLoop(cproc)
 	// wsh.initActiveShells()
 	go wsh.NotifyRemoteUpdate()
 }
@@ -1871,6 +1986,15 @@ func (wsh *WaveshellProc) testAndSetPendingStateCmd(screenId string, rptr sstore
 	return true, nil
 }
 
+// true if a command that can change the screen's state is still running (new commands would fail with a PSC error)
+func (wsh *WaveshellProc) HasPendingStateCmd(screenId string, rptr sstore.RemotePtrType) bool {
+	key := pendingStateKey{ScreenId: screenId, RemotePtr: rptr}
+	wsh.Lock.Lock()
+	defer wsh.Lock.Unlock()
+	ck, found := wsh.PendingStateCmds[key]
+	return found && wsh.RunningCmds[ck] != nil
+}
+
 func (wsh *WaveshellProc) removePendingStateCmd(screenId string, rptr sstore.RemotePtrType, ck base.CommandKey) {
 	key := pendingStateKey{ScreenId: screenId, RemotePtr: rptr}
 	wsh.Lock.Lock()
@@ -2334,21 +2458,25 @@ func (wsh *WaveshellProc) resolveFinalState(ctx context.Context, origState *pack
 // after this limit we'll switch to persisting the full state
 const NewStateDiffSizeThreshold = 30 * 1024
 
-// will update the remote instance with the final state
+func (wsh *WaveshellProc) updateRIWithFinalState(ctx context.Context, rct *RunCmdType, newState *packet.ShellState) (*sstore.RemoteInstance, error) {
+	return UpdateRIWithFullState(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr, newState)
+}
+
+// will update the remote instance with the given (full) state (used for cmd final states and /state:restore)
 // this is complicated because we want to be as efficient as possible.
 // so we pull the current remote-instance state (just the baseptr).  then we compute the diff.
 // then we check the size of the diff, and only persist the diff it is under some size threshold
 // also we check to see if the diff succeeds (it can fail if the shell or version changed).
 // in those cases we also update the RI with the full state
-func (wsh *WaveshellProc) updateRIWithFinalState(ctx context.Context, rct *RunCmdType, newState *packet.ShellState) (*sstore.RemoteInstance, error) {
-	curRIState, err := sstore.GetRemoteStatePtr(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr)
+func UpdateRIWithFullState(ctx context.Context, sessionId string, screenId string, remotePtr sstore.RemotePtrType, newState *packet.ShellState) (*sstore.RemoteInstance, error) {
+	curRIState, err := sstore.GetRemoteStatePtr(ctx, sessionId, screenId, remotePtr)
 	if err != nil {
 		return nil, fmt.Errorf("error trying to get current screen stateptr: %w", err)
 	}
 	feState := sstore.FeStateFromShellState(newState)
 	if curRIState == nil {
 		// no current state, so just persist the full state
-		return sstore.UpdateRemoteState(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr, feState, newState, nil)
+		return sstore.UpdateRemoteState(ctx, sessionId, screenId, remotePtr, feState, newState, nil)
 	}
 	// pull the base (not the diff) state from the RI (right now we don't want to make multi-level diffs)
 	riBaseState, err := sstore.GetStateBase(ctx, curRIState.BaseHash)
@@ -2362,16 +2490,16 @@ func (wsh *WaveshellProc) updateRIWithFinalState(ctx context.Context, rct *RunCm
 	newStateDiff, err := sapi.MakeShellStateDiff(riBaseState, curRIState.BaseHash, newState)
 	if err != nil {
 		// if we can't make a diff, just persist the full state (this could happen if the shell type changes)
-		return sstore.UpdateRemoteState(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr, feState, newState, nil)
+		return sstore.UpdateRemoteState(ctx, sessionId, screenId, remotePtr, feState, newState, nil)
 	}
 	// we have a diff, let's check the diff size first
 	_, encodedDiff := newStateDiff.EncodeAndHash()
 	if len(encodedDiff) > NewStateDiffSizeThreshold {
 		// diff is too large, persist the full state
-		return sstore.UpdateRemoteState(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr, feState, newState, nil)
+		return sstore.UpdateRemoteState(ctx, sessionId, screenId, remotePtr, feState, newState, nil)
 	}
 	// diff is small enough, persist the diff
-	return sstore.UpdateRemoteState(ctx, rct.SessionId, rct.ScreenId, rct.RemotePtr, feState, nil, newStateDiff)
+	return sstore.UpdateRemoteState(ctx, sessionId, screenId, remotePtr, feState, nil, newStateDiff)
 }
 
 func (wsh *WaveshellProc) handleSudoError(ck base.CommandKey, sudoErr error) {
@@ -0,0 +1,117 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alessio/shellescape"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shellapi"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+func TestMakeCommandPipeStartLine(t *testing.T) {
+	tests := []struct {
+		shellType string
+		shellCmd  string
+		expected  string
+	}{
+		{packet.ShellType_bash, "echo hi", "exec bash -c 'echo hi'"},
+		{packet.ShellType_zsh, "echo hi", "exec zsh -c 'echo hi'"},
+		{packet.ShellType_bash, "echo it's", `exec bash -c 'echo it'"'"'s'`},
+		{packet.ShellType_bash, "a=1; b=2", "exec bash -c 'a=1; b=2'"},
+	}
+	for _, test := range tests {
+		sapi, err := shellapi.MakeShellApi(test.shellType)
+		if err != nil {
+			t.Fatalf("cannot make shell api %s: %v", test.shellType, err)
+		}
+		rtn := makeCommandPipeStartLine(sapi, test.shellCmd)
+		if rtn != test.expected {
+			t.Errorf("%s %q: got %q, expected %q", test.shellType, test.shellCmd, rtn, test.expected)
+		}
+	}
+	// the server command is wrapped as a single shell argument, with the remote shell looked up in PATH
+	sapi, _ := shellapi.MakeShellApi(packet.ShellType_bash)
+	rtn := makeCommandPipeStartLine(sapi, MakeServerCommandStr())
+	if !strings.HasPrefix(rtn, "exec bash -c '") || !strings.HasSuffix(rtn, "'") {
+		t.Errorf("unexpected server start line %q", rtn)
+	}
+}
+
+func TestMakeRunAsRemoteCmd(t *testing.T) {
+	tests := []struct {
+		opts     *sstore.SSHOpts
+		isErr    bool
+		expected string
+	}{
+		{&sstore.SSHOpts{RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSudo}, false, "sudo -n -H -u deploy -- bash -c 'echo hi'"},
+		{&sstore.SSHOpts{RunAsUser: "deploy"}, false, "sudo -n -H -u deploy -- bash -c 'echo hi'"},
+		{&sstore.SSHOpts{RunAsUser: "svc.user-1", RunAsMethod: sstore.RunAsMethodSudo}, false, "sudo -n -H -u svc.user-1 -- bash -c 'echo hi'"},
+		{&sstore.SSHOpts{RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSu}, true, ""},
+	}
+	for _, test := range tests {
+		rtn, err := makeRunAsRemoteCmd(test.opts, "bash -c 'echo hi'")
+		if test.isErr {
+			if err == nil {
+				t.Errorf("%s/%s: expected an error", test.opts.RunAsUser, test.opts.RunAsMethod)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s: unexpected error: %v", test.opts.RunAsUser, test.opts.RunAsMethod, err)
+			continue
+		}
+		if rtn != test.expected {
+			t.Errorf("%s/%s: got %q, expected %q", test.opts.RunAsUser, test.opts.RunAsMethod, rtn, test.expected)
+		}
+	}
+}
+
+func TestMakeRunAsLocalWaveshellCommandStr(t *testing.T) {
+	waveshellPath, err := scbase.LocalWaveshellBinaryPath()
+	if err != nil {
+		t.Fatalf("cannot get waveshell path: %v", err)
+	}
+	serverCmd := shellescape.Quote(waveshellPath) + " --server"
+	tests := []struct {
+		opts     *sstore.SSHOpts
+		expected string
+	}{
+		{&sstore.SSHOpts{Local: true, RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSudo}, PrintPingPacket + "; sudo -H -u deploy " + serverCmd},
+		{&sstore.SSHOpts{Local: true, RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSu}, PrintPingPacket + "; su - deploy -c " + shellescape.Quote(serverCmd)},
+	}
+	for _, test := range tests {
+		rtn, err := MakeRunAsLocalWaveshellCommandStr(test.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.opts.RunAsMethod, err)
+			continue
+		}
+		if rtn != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.opts.RunAsMethod, rtn, test.expected)
+		}
+	}
+}
+
+func TestMakeSSHServerCmdRunAs(t *testing.T) {
+	sapi, _ := shellapi.MakeShellApi(packet.ShellType_bash)
+	plain, err := makeSSHServerCmd(sstore.RemoteType{SSHOpts: &sstore.SSHOpts{SSHHost: "host"}}, sapi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runAs, err := makeSSHServerCmd(sstore.RemoteType{SSHOpts: &sstore.SSHOpts{SSHHost: "host", RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSudo}}, sapi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runAs != "sudo -n -H -u deploy -- "+plain {
+		t.Errorf("runas server cmd should wrap the plain cmd, got %q", runAs)
+	}
+	_, err = makeSSHServerCmd(sstore.RemoteType{SSHOpts: &sstore.SSHOpts{SSHHost: "host", RunAsUser: "deploy", RunAsMethod: sstore.RunAsMethodSu}}, sapi)
+	if err == nil {
+		t.Errorf("expected an error for su over ssh")
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/configstore"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// declarative remotes: [config]/remotes.json is reconciled into the remote table on startup and whenever
+// the file changes.  remotes created from the file are tagged with SSHConfigSrcTypeFile, remotes that are
+// removed from the file are disconnected and archived (not if they have running commands).  entries are matched
+// to remotes by canonical name, then by alias, so changing the host/user/port of an entry with an alias updates
+// the remote in place.  remotes created with /remote:new or the ssh config import are never touched.
+//
+//	{"remotes": [{"alias": "prod", "host": "prod.example.com", "user": "deploy", "port": 2222,
+//	              "identity": "~/.ssh/prod_key", "connectmode": "manual", "shellpref": "bash", "color": "red"}]}
+
+const RemotesFileName = "remotes.json"
+const RemotesFileTimeout = 10 * time.Second
+const RemotesFileDisconnectTimeout = 5 * time.Second
+const maxRemoteAliasLen = 50
+
+var remotesFileAliasRe = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9._-]*$")
+var remotesFileHostRe = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9._:\\[\\]-]*$")
+var remotesFileUserRe = regexp.MustCompile("^[a-zA-Z0-9_][a-zA-Z0-9._-]*$")
+
+// remotes.json may be rewritten several times in quick succession by editors, reconcile serially
+var remotesFileLock = &sync.Mutex{}
+
+type RemotesFileType struct {
+	Remotes []*RemotesFileEntryType `json:"remotes"`
+}
+
+type RemotesFileEntryType struct {
+	Alias       string `json:"alias,omitempty"`
+	Host        string `json:"host"`
+	User        string `json:"user,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	Identity    string `json:"identity,omitempty"`
+	ConnectMode string `json:"connectmode,omitempty"`
+	ShellPref   string `json:"shellpref,omitempty"`
+	Color       string `json:"color,omitempty"`
+}
+
+func init() {
+	configstore.RegisterConfigHandler(RemotesFileName, func(relPath string, removed bool) {
+		if removed {
+			// editors often save by renaming, the file will be reconciled when it is re-created.
+			// to remove all file remotes, set "remotes" to an empty list.
+			return
+		}
+		ctx, cancelFn := context.WithTimeout(context.Background(), RemotesFileTimeout)
+		defer cancelFn()
+		err := ReconcileRemotesFile(ctx)
+		if err != nil {
+			log.Printf("error reconciling %s: %v\n", RemotesFileName, err)
+			update := scbus.MakeUpdatePacket()
+			update.AddUpdate(sstore.InfoMsgType{InfoError: fmt.Sprintf("error loading %s: %v", RemotesFileName, err)})
+			scbus.MainUpdateBus.DoUpdate(update)
+		}
+	})
+}
+
+func (entry *RemotesFileEntryType) CanonicalName() string {
+	canonicalName := entry.Host
+	if entry.User != "" {
+		canonicalName = entry.User + "@" + entry.Host
+	}
+	if entry.Port != 0 && entry.Port != 22 {
+		canonicalName = canonicalName + ":" + strconv.Itoa(entry.Port)
+	}
+	return canonicalName
+}
+
+func (entry *RemotesFileEntryType) getConnectMode() string {
+	if entry.ConnectMode == "" {
+		return sstore.ConnectModeAuto
+	}
+	return entry.ConnectMode
+}
+
+func (entry *RemotesFileEntryType) getShellPref() string {
+	if entry.ShellPref == "" {
+		return sstore.ShellTypePref_Detect
+	}
+	return entry.ShellPref
+}
+
+func (entry *RemotesFileEntryType) Validate() error {
+	if entry.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if !remotesFileHostRe.MatchString(entry.Host) {
+		return fmt.Errorf("invalid host %q", entry.Host)
+	}
+	if entry.User != "" && !remotesFileUserRe.MatchString(entry.User) {
+		return fmt.Errorf("invalid user %q", entry.User)
+	}
+	if entry.Port < 0 || entry.Port > 65535 {
+		return fmt.Errorf("invalid port %d, must be in the range of 1 to 65535", entry.Port)
+	}
+	if entry.Alias != "" {
+		if len(entry.Alias) > maxRemoteAliasLen {
+			return fmt.Errorf("alias %q too long, max length = %d", entry.Alias, maxRemoteAliasLen)
+		}
+		if !remotesFileAliasRe.MatchString(entry.Alias) {
+			return fmt.Errorf("invalid alias format %q", entry.Alias)
+		}
+	}
+	if !sstore.IsValidConnectMode(entry.getConnectMode()) {
+		return fmt.Errorf("invalid connectmode %q", entry.ConnectMode)
+	}
+	if entry.Color != "" && !utilfn.ContainsStr(RemoteColorNames, entry.Color) {
+		return fmt.Errorf("invalid color %q, valid colors are: %s", entry.Color, strings.Join(RemoteColorNames, ", "))
+	}
+	shellPref := entry.getShellPref()
+	if shellPref != packet.ShellType_bash && shellPref != packet.ShellType_zsh && shellPref != sstore.ShellTypePref_Detect {
+		return fmt.Errorf("invalid shellpref %q", entry.ShellPref)
+	}
+	return nil
+}
+
+// returns (nil, nil) if the file does not exist
+func ReadRemotesFile() (*RemotesFileType, error) {
+	barr, err := os.ReadFile(configstore.GetConfigPath(RemotesFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseRemotesFile(barr)
+}
+
+// validates all entries, duplicate canonical names and aliases are errors
+func ParseRemotesFile(barr []byte) (*RemotesFileType, error) {
+	var rtn RemotesFileType
+	err := json.Unmarshal(barr, &rtn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	seenNames := make(map[string]bool)
+	seenAliases := make(map[string]bool)
+	for idx, entry := range rtn.Remotes {
+		if entry == nil {
+			return nil, fmt.Errorf("remote #%d: invalid (null) entry", idx+1)
+		}
+		err = entry.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("remote #%d: %v", idx+1, err)
+		}
+		canonicalName := entry.CanonicalName()
+		if seenNames[canonicalName] {
+			return nil, fmt.Errorf("remote #%d: duplicate remote %q", idx+1, canonicalName)
+		}
+		seenNames[canonicalName] = true
+		if entry.Alias != "" {
+			if seenAliases[entry.Alias] {
+				return nil, fmt.Errorf("remote #%d: duplicate alias %q", idx+1, entry.Alias)
+			}
+			seenAliases[entry.Alias] = true
+		}
+	}
+	return &rtn, nil
+}
+
+func getRemoteColor(r *sstore.RemoteType) string {
+	if r.RemoteOpts == nil {
+		return ""
+	}
+	return r.RemoteOpts.Color
+}
+
+// returns the edits needed to make r match entry (nil if none)
+func makeRemotesFileEditMap(r *sstore.RemoteType, entry *RemotesFileEntryType) map[string]interface{} {
+	editMap := make(map[string]interface{})
+	if r.RemoteAlias != entry.Alias {
+		editMap[sstore.RemoteField_Alias] = entry.Alias
+	}
+	if r.ConnectMode != entry.getConnectMode() {
+		editMap[sstore.RemoteField_ConnectMode] = entry.getConnectMode()
+	}
+	var curIdentity string
+	if r.SSHOpts != nil {
+		curIdentity = r.SSHOpts.SSHIdentity
+	}
+	if curIdentity != entry.Identity {
+		editMap[sstore.RemoteField_SSHKey] = entry.Identity
+	}
+	if r.ShellPref != entry.getShellPref() {
+		editMap[sstore.RemoteField_ShellPref] = entry.getShellPref()
+	}
+	if getRemoteColor(r) != entry.Color {
+		editMap[sstore.RemoteField_Color] = entry.Color
+	}
+	if len(editMap) == 0 {
+		return nil
+	}
+	return editMap
+}
+
+func makeRemoteFromFileEntry(entry *RemotesFileEntryType) *sstore.RemoteType {
+	r := &sstore.RemoteType{
+		RemoteId:            scbase.GenWaveUUID(),
+		RemoteType:          sstore.RemoteTypeSsh,
+		RemoteAlias:         entry.Alias,
+		RemoteCanonicalName: entry.CanonicalName(),
+		RemoteUser:          entry.User,
+		RemoteHost:          entry.Host,
+		ConnectMode:         entry.getConnectMode(),
+		AutoInstall:         true,
+		SSHOpts: &sstore.SSHOpts{
+			SSHHost:     entry.Host,
+			SSHUser:     entry.User,
+			SSHPort:     entry.Port,
+			SSHIdentity: entry.Identity,
+		},
+		SSHConfigSrc: sstore.SSHConfigSrcTypeFile,
+		ShellPref:    entry.getShellPref(),
+	}
+	if entry.Color != "" {
+		r.RemoteOpts = &sstore.RemoteOptsType{Color: entry.Color}
+	}
+	return r
+}
+
+// disconnects the remote (waits for the disconnect), fails if it has running commands
+func disconnectFileRemote(wsh *WaveshellProc) error {
+	if !wsh.IsConnected() {
+		return nil
+	}
+	numCommands := wsh.GetNumRunningCommands()
+	if numCommands > 0 {
+		return fmt.Errorf("remote has %d running command(s), disconnect it first", numCommands)
+	}
+	wsh.Disconnect(false)
+	deadline := time.Now().Add(RemotesFileDisconnectTimeout)
+	for wsh.IsConnected() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for remote to disconnect")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func (wsh *WaveshellProc) updateSSHTarget(ctx context.Context, entry *RemotesFileEntryType) error {
+	wsh.Lock.Lock()
+	defer wsh.Lock.Unlock()
+	updatedRemote, err := sstore.UpdateRemoteSSHTarget(ctx, wsh.Remote.RemoteId, entry.CanonicalName(), entry.User, entry.Host, entry.Port)
+	if err != nil {
+		return err
+	}
+	wsh.Remote = updatedRemote
+	go wsh.NotifyRemoteUpdate()
+	return nil
+}
+
+// reconciles remotes.json with the remote table (no-op if the file does not exist).
+// individual remote failures do not stop the reconciliation, they are all returned in the error.
+func ReconcileRemotesFile(ctx context.Context) error {
+	remotesFileLock.Lock()
+	defer remotesFileLock.Unlock()
+	remotesFile, err := ReadRemotesFile()
+	if err != nil {
+		return err
+	}
+	if remotesFile == nil {
+		return nil
+	}
+	entryMap := make(map[string]*RemotesFileEntryType)
+	for _, entry := range remotesFile.Remotes {
+		entryMap[entry.CanonicalName()] = entry
+	}
+	fileRemotes := make(map[string]*WaveshellProc)
+	for _, wsh := range GetRemoteMap() {
+		rcopy := wsh.GetRemoteCopy()
+		if rcopy.SSHConfigSrc != sstore.SSHConfigSrcTypeFile || rcopy.Archived {
+			continue
+		}
+		fileRemotes[rcopy.RemoteCanonicalName] = wsh
+	}
+	// remotes whose canonical name is no longer in the file are retargeted if an entry has the same alias
+	retargetRemotes := make(map[string]*WaveshellProc) // new canonical name -> remote
+	for canonicalName, wsh := range fileRemotes {
+		if entryMap[canonicalName] != nil {
+			continue
+		}
+		alias := wsh.GetRemoteCopy().RemoteAlias
+		if alias == "" {
+			continue
+		}
+		for _, entry := range remotesFile.Remotes {
+			if entry.Alias == alias && fileRemotes[entry.CanonicalName()] == nil {
+				retargetRemotes[entry.CanonicalName()] = wsh
+				delete(fileRemotes, canonicalName)
+				break
+			}
+		}
+	}
+	var errs []string
+	addErr := func(canonicalName string, format string, args ...interface{}) {
+		errStr := fmt.Sprintf("remote %q: %s", canonicalName, fmt.Sprintf(format, args...))
+		log.Printf("%s: %s\n", RemotesFileName, errStr)
+		errs = append(errs, errStr)
+	}
+	// archive first so aliases are freed up for the updates and creates below
+	for canonicalName, wsh := range fileRemotes {
+		if entryMap[canonicalName] != nil {
+			continue
+		}
+		err = disconnectFileRemote(wsh)
+		if err == nil {
+			err = ArchiveRemote(ctx, wsh.RemoteId)
+		}
+		if err != nil {
+			addErr(canonicalName, "cannot archive: %v", err)
+			continue
+		}
+		log.Printf("%s: archived remote %q\n", RemotesFileName, canonicalName)
+	}
+	for _, entry := range remotesFile.Remotes {
+		canonicalName := entry.CanonicalName()
+		wsh := fileRemotes[canonicalName]
+		if wsh == nil && retargetRemotes[canonicalName] != nil {
+			wsh = retargetRemotes[canonicalName]
+			oldName := wsh.GetRemoteCopy().RemoteCanonicalName
+			err = disconnectFileRemote(wsh)
+			if err == nil {
+				err = wsh.updateSSHTarget(ctx, entry)
+			}
+			if err != nil {
+				addErr(oldName, "cannot change to %q: %v", canonicalName, err)
+				continue
+			}
+			log.Printf("%s: changed remote %q to %q\n", RemotesFileName, oldName, canonicalName)
+		}
+		if wsh != nil {
+			rcopy := wsh.GetRemoteCopy()
+			editMap := makeRemotesFileEditMap(&rcopy, entry)
+			if editMap == nil {
+				continue
+			}
+			err = wsh.UpdateRemote(ctx, editMap)
+			if err != nil {
+				addErr(canonicalName, "cannot update: %v", err)
+				continue
+			}
+			log.Printf("%s: updated remote %q\n", RemotesFileName, canonicalName)
+			continue
+		}
+		r := makeRemoteFromFileEntry(entry)
+		err = AddRemote(ctx, r, r.ConnectMode == sstore.ConnectModeStartup)
+		if err != nil {
+			addErr(canonicalName, "cannot create: %v", err)
+			continue
+		}
+		log.Printf("%s: created remote %q\n", RemotesFileName, canonicalName)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+const testRemotesFile = `{
+    "remotes": [
+        {"host": "build.example.com", "user": "ci", "alias": "build", "identity": "~/.ssh/ci_key", "color": "green"},
+        {"host": "db1", "port": 2222, "connectmode": "manual", "shellpref": "zsh"},
+        {"host": "10.0.0.5", "user": "admin", "port": 22}
+    ]
+}`
+
+func TestParseRemotesFile(t *testing.T) {
+	remotesFile, err := ParseRemotesFile([]byte(testRemotesFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(remotesFile.Remotes) != 3 {
+		t.Fatalf("expected 3 remotes, got %d", len(remotesFile.Remotes))
+	}
+	names := []string{"ci@build.example.com", "db1:2222", "admin@10.0.0.5"}
+	for idx, entry := range remotesFile.Remotes {
+		if entry.CanonicalName() != names[idx] {
+			t.Errorf("remote #%d: got canonical name %q, expected %q", idx+1, entry.CanonicalName(), names[idx])
+		}
+	}
+	if mode := remotesFile.Remotes[0].getConnectMode(); mode != sstore.ConnectModeAuto {
+		t.Errorf("expected default connectmode auto, got %q", mode)
+	}
+	if pref := remotesFile.Remotes[0].getShellPref(); pref != sstore.ShellTypePref_Detect {
+		t.Errorf("expected default shellpref detect, got %q", pref)
+	}
+}
+
+func TestParseRemotesFileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		errStr string
+	}{
+		{"bad json", `{"remotes": [`, "invalid json"},
+		{"null entry", `{"remotes": [null]}`, "remote #1: invalid (null) entry"},
+		{"no host", `{"remotes": [{"user": "ci"}]}`, "host is required"},
+		{"bad host", `{"remotes": [{"host": "a b"}]}`, "invalid host"},
+		{"bad user", `{"remotes": [{"host": "h1", "user": "$(id)"}]}`, "invalid user"},
+		{"bad port", `{"remotes": [{"host": "h1", "port": 70000}]}`, "invalid port"},
+		{"bad alias", `{"remotes": [{"host": "h1", "alias": "-x"}]}`, "invalid alias"},
+		{"long alias", `{"remotes": [{"host": "h1", "alias": "` + strings.Repeat("a", maxRemoteAliasLen+1) + `"}]}`, "too long"},
+		{"bad connectmode", `{"remotes": [{"host": "h1", "connectmode": "sometimes"}]}`, "invalid connectmode"},
+		{"bad color", `{"remotes": [{"host": "h1", "color": "puce"}]}`, "invalid color"},
+		{"bad shellpref", `{"remotes": [{"host": "h1", "shellpref": "fish"}]}`, "invalid shellpref"},
+		{"second entry", `{"remotes": [{"host": "h1"}, {"host": ""}]}`, "remote #2: host is required"},
+		{"duplicate alias", `{"remotes": [{"host": "h1", "alias": "a"}, {"host": "h2", "alias": "a"}]}`, `remote #2: duplicate alias "a"`},
+		{"duplicate remote", `{"remotes": [{"host": "h1", "user": "u"}, {"host": "h1", "user": "u", "port": 22}]}`, `remote #2: duplicate remote "u@h1"`},
+	}
+	for _, test := range tests {
+		_, err := ParseRemotesFile([]byte(test.data))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("%s: expected error containing %q, got %q", test.name, test.errStr, err.Error())
+		}
+	}
+}
+
+func TestMergeRemotesFileEntry(t *testing.T) {
+	remotesFile, err := ParseRemotesFile([]byte(testRemotesFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry := remotesFile.Remotes[0]
+	r := makeRemoteFromFileEntry(entry)
+	if r.RemoteCanonicalName != "ci@build.example.com" || r.RemoteAlias != "build" || r.SSHConfigSrc != sstore.SSHConfigSrcTypeFile {
+		t.Errorf("unexpected remote from file entry: %#v", r)
+	}
+	if r.SSHOpts.SSHIdentity != "~/.ssh/ci_key" || getRemoteColor(r) != "green" {
+		t.Errorf("unexpected sshopts/color: %#v %q", r.SSHOpts, getRemoteColor(r))
+	}
+	// an unchanged entry needs no edits
+	if editMap := makeRemotesFileEditMap(r, entry); editMap != nil {
+		t.Errorf("expected no edits, got %v", editMap)
+	}
+	changed := *entry
+	changed.Alias = "builder"
+	changed.Identity = ""
+	changed.ConnectMode = sstore.ConnectModeManual
+	changed.Color = ""
+	editMap := makeRemotesFileEditMap(r, &changed)
+	expected := map[string]interface{}{
+		sstore.RemoteField_Alias:       "builder",
+		sstore.RemoteField_SSHKey:      "",
+		sstore.RemoteField_ConnectMode: sstore.ConnectModeManual,
+		sstore.RemoteField_Color:       "",
+	}
+	if len(editMap) != len(expected) {
+		t.Errorf("expected %d edits, got %v", len(expected), editMap)
+	}
+	for key, val := range expected {
+		if editMap[key] != val {
+			t.Errorf("edit %s: got %v, expected %v", key, editMap[key], val)
+		}
+	}
+}
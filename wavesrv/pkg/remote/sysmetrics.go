@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// periodically polls system metrics (sysmetrics rpc) from connected linux remotes and publishes them
+// on the update bus.  the interval is set with /client:set sysmetricsinterval=[secs|off]
+
+const DefaultSysMetricsIntervalSec = 30
+const MinSysMetricsIntervalSec = 5
+const SysMetricsTimeout = 10 * time.Second
+
+type RemoteSysMetricsType struct {
+	RemoteId string                 `json:"remoteid"`
+	Metrics  *packet.SysMetricsType `json:"metrics"`
+}
+
+func (RemoteSysMetricsType) GetType() string {
+	return "remotesysmetrics"
+}
+
+func (wsh *WaveshellProc) SupportsSysMetrics() bool {
+	if wsh.CheckWaveshellVersion(MinRpcWaveshellVersion) != nil {
+		return false
+	}
+	wsh.Lock.Lock()
+	defer wsh.Lock.Unlock()
+	return strings.HasPrefix(wsh.UName, "linux|")
+}
+
+func (wsh *WaveshellProc) GetSysMetrics(ctx context.Context, numTopProcs int) (*packet.SysMetricsType, error) {
+	metricsPk := packet.MakeSysMetricsPacket()
+	metricsPk.ReqId = uuid.New().String()
+	metricsPk.NumTopProcs = numTopProcs
+	// waveshells older than MinRpcWaveshellVersion drop the packet (they never respond)
+	err := wsh.CheckWaveshellVersion(MinRpcWaveshellVersion)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, SysMetricsTimeout)
+	defer cancelFn()
+	rtnPk, err := wsh.PacketRpcRaw(ctx, metricsPk)
+	if err != nil {
+		return nil, err
+	}
+	resp, ok := rtnPk.(*packet.SysMetricsResponseType)
+	if !ok {
+		if respPk, ok := rtnPk.(*packet.ResponsePacketType); ok && respPk.Error != "" {
+			return nil, fmt.Errorf("%s", respPk.Error)
+		}
+		return nil, fmt.Errorf("invalid response packet received: %s", packet.AsString(rtnPk))
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	if resp.Metrics == nil {
+		return nil, fmt.Errorf("no metrics returned")
+	}
+	return resp.Metrics, nil
+}
+
+// returns 0 if polling is turned off
+func getSysMetricsInterval(ctx context.Context) time.Duration {
+	clientData, err := sstore.EnsureClientData(ctx)
+	if err != nil {
+		return DefaultSysMetricsIntervalSec * time.Second
+	}
+	intervalSec := clientData.ClientOpts.SysMetricsIntervalSec
+	if intervalSec < 0 {
+		return 0
+	}
+	if intervalSec == 0 {
+		intervalSec = DefaultSysMetricsIntervalSec
+	}
+	if intervalSec < MinSysMetricsIntervalSec {
+		intervalSec = MinSysMetricsIntervalSec
+	}
+	return time.Duration(intervalSec) * time.Second
+}
+
+func pollSysMetrics(wsh *WaveshellProc) {
+	metrics, err := wsh.GetSysMetrics(context.Background(), 0)
+	if err != nil {
+		log.Printf("error getting sysmetrics for remote %s: %v\n", wsh.GetRemoteName(), err)
+		return
+	}
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(RemoteSysMetricsType{RemoteId: wsh.RemoteId, Metrics: metrics})
+	scbus.MainUpdateBus.DoUpdate(update)
+}
+
+func RunSysMetricsLoop() {
+	for {
+		ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+		interval := getSysMetricsInterval(ctx)
+		cancelFn()
+		if interval == 0 {
+			time.Sleep(DefaultSysMetricsIntervalSec * time.Second)
+			continue
+		}
+		for _, wsh := range GetRemoteMap() {
+			if !wsh.IsConnected() || !wsh.SupportsSysMetrics() {
+				continue
+			}
+			go pollSysMetrics(wsh)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package rtnstate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shellapi"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shellenv"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/utilfn"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+const (
+	StateDiffOpAdd    = "add"
+	StateDiffOpChange = "change"
+	StateDiffOpRemove = "remove"
+)
+
+type StateDiffEntryType struct {
+	Name   string `json:"name"`
+	Op     string `json:"op"`
+	OldVal string `json:"oldval,omitempty"`
+	NewVal string `json:"newval,omitempty"`
+}
+
+// structured version of DisplayStateUpdateDiff (used by /state:diff and /line:statediff)
+type StateDiffType struct {
+	OldCwd  string                `json:"oldcwd,omitempty"`
+	NewCwd  string                `json:"newcwd,omitempty"`
+	Vars    []*StateDiffEntryType `json:"vars,omitempty"`
+	Aliases []*StateDiffEntryType `json:"aliases,omitempty"`
+	Funcs   []*StateDiffEntryType `json:"funcs,omitempty"`
+}
+
+func (sd *StateDiffType) IsEmpty() bool {
+	return sd.OldCwd == sd.NewCwd && len(sd.Vars) == 0 && len(sd.Aliases) == 0 && len(sd.Funcs) == 0
+}
+
+func diffStrMaps(oldMap map[string]string, newMap map[string]string) []*StateDiffEntryType {
+	var rtn []*StateDiffEntryType
+	for name, newVal := range newMap {
+		oldVal, found := oldMap[name]
+		if !found {
+			rtn = append(rtn, &StateDiffEntryType{Name: name, Op: StateDiffOpAdd, NewVal: newVal})
+		} else if oldVal != newVal {
+			rtn = append(rtn, &StateDiffEntryType{Name: name, Op: StateDiffOpChange, OldVal: oldVal, NewVal: newVal})
+		}
+	}
+	for name, oldVal := range oldMap {
+		if _, found := newMap[name]; !found {
+			rtn = append(rtn, &StateDiffEntryType{Name: name, Op: StateDiffOpRemove, OldVal: oldVal})
+		}
+	}
+	sort.Slice(rtn, func(i int, j int) bool {
+		return rtn[i].Name < rtn[j].Name
+	})
+	return rtn
+}
+
+func zshMapToStrMap(data string) map[string]string {
+	zshMap, err := shellapi.DecodeZshMap([]byte(data))
+	if err != nil {
+		return nil
+	}
+	rtn := make(map[string]string)
+	for key, val := range zshMap {
+		name := key.ParamName
+		if key.ParamType != "aliases" && key.ParamType != "functions" {
+			name = key.ParamType + " " + key.ParamName
+		}
+		rtn[name] = string(val)
+	}
+	return rtn
+}
+
+func declMapToStrMap(state *packet.ShellState) map[string]string {
+	rtn := make(map[string]string)
+	for key, decl := range shellenv.DeclMapFromState(state) {
+		if IgnoreVars[key] {
+			continue
+		}
+		val := decl.Value
+		if decl.IsExport() {
+			val = "export " + val
+		}
+		rtn[key] = val
+	}
+	return rtn
+}
+
+func MakeStateDiff(oldState *packet.ShellState, newState *packet.ShellState) *StateDiffType {
+	rtn := &StateDiffType{OldCwd: oldState.Cwd, NewCwd: newState.Cwd}
+	if !bytes.Equal(oldState.ShellVars, newState.ShellVars) {
+		rtn.Vars = diffStrMaps(declMapToStrMap(oldState), declMapToStrMap(newState))
+	}
+	if newState.GetShellType() == packet.ShellType_zsh {
+		rtn.Aliases = diffStrMaps(zshMapToStrMap(oldState.Aliases), zshMapToStrMap(newState.Aliases))
+		rtn.Funcs = diffStrMaps(zshMapToStrMap(oldState.Funcs), zshMapToStrMap(newState.Funcs))
+	} else {
+		oldAliases, _ := ParseAliases(oldState.Aliases)
+		newAliases, _ := ParseAliases(newState.Aliases)
+		rtn.Aliases = diffStrMaps(oldAliases, newAliases)
+		if oldState.Funcs != newState.Funcs {
+			oldFuncs, _ := ParseFuncs(oldState.Funcs)
+			newFuncs, _ := ParseFuncs(newState.Funcs)
+			rtn.Funcs = diffStrMaps(oldFuncs, newFuncs)
+		}
+	}
+	return rtn
+}
+
+func writeDiffEntries(buf *bytes.Buffer, title string, entries []*StateDiffEntryType, showVals bool) {
+	if len(entries) == 0 {
+		return
+	}
+	buf.WriteString(fmt.Sprintf("%s:\n", title))
+	for _, entry := range entries {
+		name := utilfn.EllipsisStr(entry.Name, MaxDiffKeyLen)
+		switch {
+		case entry.Op == StateDiffOpRemove:
+			buf.WriteString(fmt.Sprintf("  - %s\n", name))
+		case !showVals:
+			buf.WriteString(fmt.Sprintf("  %s %s\n", diffOpSymbol(entry.Op), name))
+		case entry.Op == StateDiffOpAdd:
+			buf.WriteString(fmt.Sprintf("  + %s=%s\n", name, utilfn.EllipsisStr(entry.NewVal, MaxDiffValLen)))
+		default:
+			buf.WriteString(fmt.Sprintf("  ~ %s=%s (was %s)\n", name, utilfn.EllipsisStr(entry.NewVal, MaxDiffValLen), utilfn.EllipsisStr(entry.OldVal, MaxDiffValLen)))
+		}
+	}
+}
+
+func diffOpSymbol(op string) string {
+	switch op {
+	case StateDiffOpAdd:
+		return "+"
+	case StateDiffOpRemove:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// human readable diff ("+" added, "~" changed, "-" removed).  function bodies are not shown.
+func (sd *StateDiffType) String() string {
+	if sd.IsEmpty() {
+		return "no state changes\n"
+	}
+	var buf bytes.Buffer
+	if sd.OldCwd != sd.NewCwd {
+		buf.WriteString(fmt.Sprintf("cwd: %s => %s\n", sd.OldCwd, sd.NewCwd))
+	}
+	writeDiffEntries(&buf, "vars", sd.Vars, true)
+	writeDiffEntries(&buf, "aliases", sd.Aliases, true)
+	writeDiffEntries(&buf, "functions", sd.Funcs, false)
+	return buf.String()
+}
+
+// the state in effect after the command ran (the rtnstate if the command returned state)
+func GetCmdFinalStatePtr(cmd *sstore.CmdType) packet.ShellStatePtr {
+	if cmd.RtnState && !cmd.RtnStatePtr.IsEmpty() {
+		return cmd.RtnStatePtr
+	}
+	return cmd.StatePtr
+}
+
+func GetStateDiffFromPtrs(ctx context.Context, oldPtr packet.ShellStatePtr, newPtr packet.ShellStatePtr) (*StateDiffType, error) {
+	if oldPtr.IsEmpty() || newPtr.IsEmpty() {
+		return nil, fmt.Errorf("no shell state recorded")
+	}
+	oldState, err := sstore.GetFullState(ctx, oldPtr)
+	if err != nil {
+		return nil, fmt.Errorf("getting old full state: %v", err)
+	}
+	newState, err := sstore.GetFullState(ctx, newPtr)
+	if err != nil {
+		return nil, fmt.Errorf("getting new full state: %v", err)
+	}
+	return MakeStateDiff(oldState, newState), nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package rtnstate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/waveshell/pkg/packet"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shellapi"
+	"github.com/wavetermdev/waveterm/waveshell/pkg/shellenv"
+)
+
+const testBashVersion = "bash v5.1.16"
+const testZshVersion = "zsh v5.9.0"
+
+// vars are name => "args value" pairs (e.g. "-x" => exported)
+func makeTestBashState(cwd string, vars map[string][2]string, aliases string, funcs string) *packet.ShellState {
+	declMap := make(map[string]*shellenv.DeclareDeclType)
+	for name, argsVal := range vars {
+		declMap[name] = &shellenv.DeclareDeclType{Args: argsVal[0], Name: name, Value: argsVal[1]}
+	}
+	return &packet.ShellState{
+		Version:   testBashVersion,
+		Cwd:       cwd,
+		ShellVars: shellenv.SerializeDeclMap(declMap),
+		Aliases:   aliases,
+		Funcs:     funcs,
+	}
+}
+
+func makeTestZshState(cwd string, aliases map[string]string, funcs map[string]string) *packet.ShellState {
+	aliasMap := make(shellapi.ZshMap)
+	for name, val := range aliases {
+		aliasMap[shellapi.ZshParamKey{ParamType: "aliases", ParamName: name}] = val
+	}
+	funcMap := make(shellapi.ZshMap)
+	for name, val := range funcs {
+		funcMap[shellapi.ZshParamKey{ParamType: "functions", ParamName: name}] = val
+	}
+	return &packet.ShellState{
+		Version: testZshVersion,
+		Cwd:     cwd,
+		Aliases: string(shellapi.EncodeZshMap(aliasMap)),
+		Funcs:   string(shellapi.EncodeZshMap(funcMap)),
+	}
+}
+
+// applies the diff entries to a copy of oldMap
+func applyDiffEntries(oldMap map[string]string, entries []*StateDiffEntryType) map[string]string {
+	rtn := make(map[string]string)
+	for key, val := range oldMap {
+		rtn[key] = val
+	}
+	for _, entry := range entries {
+		if entry.Op == StateDiffOpRemove {
+			delete(rtn, entry.Name)
+		} else {
+			rtn[entry.Name] = entry.NewVal
+		}
+	}
+	return rtn
+}
+
+func bashAliasMap(state *packet.ShellState) map[string]string {
+	rtn, _ := ParseAliases(state.Aliases)
+	return rtn
+}
+
+func bashFuncMap(state *packet.ShellState) map[string]string {
+	rtn, _ := ParseFuncs(state.Funcs)
+	return rtn
+}
+
+func checkMapRoundTrip(t *testing.T, kind string, oldMap map[string]string, newMap map[string]string, entries []*StateDiffEntryType) {
+	t.Helper()
+	applied := applyDiffEntries(oldMap, entries)
+	if len(applied) == 0 && len(newMap) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(applied, newMap) {
+		t.Errorf("%s: diff+apply != target\n  got:  %v\n  want: %v", kind, applied, newMap)
+	}
+}
+
+func getEntryOps(entries []*StateDiffEntryType) map[string]string {
+	rtn := make(map[string]string)
+	for _, entry := range entries {
+		rtn[entry.Name] = entry.Op
+	}
+	return rtn
+}
+
+func TestMakeStateDiffBashRoundTrip(t *testing.T) {
+	baseVars := map[string][2]string{
+		"FOO":  {"--", `"foo"`},
+		"BAR":  {"-x", `"bar"`},
+		"GONE": {"--", `"gone"`},
+	}
+	baseAliases := "alias ll='ls -l'\nalias gs='git status'\n"
+	baseFuncs := "hello () \n{ \n    echo hello\n}\nbye () \n{ \n    echo bye\n}\n"
+	oldState := makeTestBashState("/home/user", baseVars, baseAliases, baseFuncs)
+	tests := []struct {
+		name     string
+		newState *packet.ShellState
+		varOps   map[string]string
+		aliasOps map[string]string
+		funcOps  map[string]string
+	}{
+		{
+			name:     "empty",
+			newState: makeTestBashState("/home/user", baseVars, baseAliases, baseFuncs),
+			varOps:   map[string]string{},
+			aliasOps: map[string]string{},
+			funcOps:  map[string]string{},
+		},
+		{
+			name: "vars",
+			newState: makeTestBashState("/tmp", map[string][2]string{
+				"FOO": {"--", `"foo2"`},
+				"BAR": {"--", `"bar"`},
+				"NEW": {"-x", `"new"`},
+			}, baseAliases, baseFuncs),
+			varOps:   map[string]string{"FOO": StateDiffOpChange, "BAR": StateDiffOpChange, "NEW": StateDiffOpAdd, "GONE": StateDiffOpRemove},
+			aliasOps: map[string]string{},
+			funcOps:  map[string]string{},
+		},
+		{
+			name:     "ignored-vars",
+			newState: makeTestBashState("/home/user", map[string][2]string{"FOO": {"--", `"foo"`}, "BAR": {"-x", `"bar"`}, "GONE": {"--", `"gone"`}, "PROMPT": {"--", `"> "`}}, baseAliases, baseFuncs),
+			varOps:   map[string]string{},
+			aliasOps: map[string]string{},
+			funcOps:  map[string]string{},
+		},
+		{
+			name:     "aliases",
+			newState: makeTestBashState("/home/user", baseVars, "alias ll='ls -la'\nalias k='kubectl'\n", baseFuncs),
+			varOps:   map[string]string{},
+			aliasOps: map[string]string{"ll": StateDiffOpChange, "gs": StateDiffOpRemove, "k": StateDiffOpAdd},
+			funcOps:  map[string]string{},
+		},
+		{
+			name:     "funcs",
+			newState: makeTestBashState("/home/user", baseVars, baseAliases, "hello () \n{ \n    echo hello world\n}\nnewfn () \n{ \n    echo new\n}\n"),
+			varOps:   map[string]string{},
+			aliasOps: map[string]string{},
+			funcOps:  map[string]string{"hello": StateDiffOpChange, "bye": StateDiffOpRemove, "newfn": StateDiffOpAdd},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := MakeStateDiff(oldState, tc.newState)
+			if diff.NewCwd != tc.newState.Cwd || diff.OldCwd != oldState.Cwd {
+				t.Errorf("cwd mismatch: %q => %q", diff.OldCwd, diff.NewCwd)
+			}
+			checkMapRoundTrip(t, "vars", declMapToStrMap(oldState), declMapToStrMap(tc.newState), diff.Vars)
+			checkMapRoundTrip(t, "aliases", bashAliasMap(oldState), bashAliasMap(tc.newState), diff.Aliases)
+			checkMapRoundTrip(t, "funcs", bashFuncMap(oldState), bashFuncMap(tc.newState), diff.Funcs)
+			if ops := getEntryOps(diff.Vars); !reflect.DeepEqual(ops, tc.varOps) {
+				t.Errorf("var ops: got %v, want %v", ops, tc.varOps)
+			}
+			if ops := getEntryOps(diff.Aliases); !reflect.DeepEqual(ops, tc.aliasOps) {
+				t.Errorf("alias ops: got %v, want %v", ops, tc.aliasOps)
+			}
+			if ops := getEntryOps(diff.Funcs); !reflect.DeepEqual(ops, tc.funcOps) {
+				t.Errorf("func ops: got %v, want %v", ops, tc.funcOps)
+			}
+			isEmpty := len(tc.varOps) == 0 && len(tc.aliasOps) == 0 && len(tc.funcOps) == 0 && tc.newState.Cwd == oldState.Cwd
+			if diff.IsEmpty() != isEmpty {
+				t.Errorf("IsEmpty: got %v, want %v", diff.IsEmpty(), isEmpty)
+			}
+			if isEmpty && diff.String() != "no state changes\n" {
+				t.Errorf("empty diff string: %q", diff.String())
+			}
+		})
+	}
+}
+
+func TestMakeStateDiffZshRoundTrip(t *testing.T) {
+	oldState := makeTestZshState("/home/user", map[string]string{"ll": "ls -l", "gs": "git status"}, map[string]string{"hello": "echo hello", "bye": "echo bye"})
+	newState := makeTestZshState("/home/user", map[string]string{"ll": "ls -la", "k": "kubectl"}, map[string]string{"hello": "echo hello world", "newfn": "echo new"})
+	diff := MakeStateDiff(oldState, newState)
+	checkMapRoundTrip(t, "aliases", zshMapToStrMap(oldState.Aliases), zshMapToStrMap(newState.Aliases), diff.Aliases)
+	checkMapRoundTrip(t, "funcs", zshMapToStrMap(oldState.Funcs), zshMapToStrMap(newState.Funcs), diff.Funcs)
+	wantFuncOps := map[string]string{"hello": StateDiffOpChange, "bye": StateDiffOpRemove, "newfn": StateDiffOpAdd}
+	if ops := getEntryOps(diff.Funcs); !reflect.DeepEqual(ops, wantFuncOps) {
+		t.Errorf("func ops: got %v, want %v", ops, wantFuncOps)
+	}
+	emptyDiff := MakeStateDiff(oldState, oldState)
+	if !emptyDiff.IsEmpty() {
+		t.Errorf("diff of identical zsh states should be empty: %s", emptyDiff.String())
+	}
+}
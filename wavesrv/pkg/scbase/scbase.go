@@ -31,12 +31,14 @@ const WaveHomeVarName = "WAVETERM_HOME"
 const WaveDevVarName = "WAVETERM_DEV"
 const SessionsDirBaseName = "sessions"
 const ScreensDirBaseName = "screens"
+const TrashDirBaseName = "trash"
+const DBBackupsDirBaseName = "db-backups"
 const WaveLockFile = "waveterm.lock"
 const WaveDirName = ".waveterm"        // must match emain.ts
 const WaveDevDirName = ".waveterm-dev" // must match emain.ts
 const WaveAppPathVarName = "WAVETERM_APP_PATH"
 const WaveAuthKeyFileName = "waveterm.authkey"
-const WaveshellVersion = "v0.7.0" // must match base.WaveshellVersion
+const WaveshellVersion = "v0.8.0" // must match base.WaveshellVersion
 
 // initialized by InitialzeWaveAuthKey (called by main-server)
 var WaveAuthKey string
@@ -234,6 +236,18 @@ func GetScreensDir() string {
 	return sdir
 }
 
+// deleted screen dirs and ptyout files are kept here (see sstore/trash.go)
+func GetTrashDir() string {
+	waveHome := GetWaveHomeDir()
+	return filepath.Join(waveHome, TrashDirBaseName)
+}
+
+// snapshots of waveterm.db (see sstore/dbbackup.go)
+func GetDBBackupsDir() string {
+	waveHome := GetWaveHomeDir()
+	return filepath.Join(waveHome, DBBackupsDirBaseName)
+}
+
 func EnsureConfigDirs() (string, error) {
 	scHome := GetWaveHomeDir()
 	configDir := filepath.Join(scHome, "config")
@@ -255,6 +269,11 @@ func EnsureConfigDirs() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	completionsDir := filepath.Join(configDir, "completions")
+	err = ensureDir(completionsDir)
+	if err != nil {
+		return "", err
+	}
 	return configDir, nil
 }
 
@@ -0,0 +1,85 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package scws
+
+import (
+	"sync"
+	"time"
+)
+
+// input arbitration between multiple frontend clients.  the first client to send input to a target
+// (a running command, a remote's connection terminal, or a screen's command line) holds a lease on it
+// until it has been idle for InputLeaseIdleTime or the client disconnects.  input from other clients
+// is dropped while the lease is held (and the client is sent an "inputdenied" update).
+
+const InputLeaseIdleTime = 3 * time.Second
+const InputDeniedNotifyInterval = 2 * time.Second
+const InputLeaseCleanInterval = time.Minute
+
+type inputLeaseType struct {
+	ClientId    string
+	LastInputTs time.Time
+}
+
+type InputDeniedUpdateType struct {
+	Target string `json:"target"`
+	Msg    string `json:"msg"`
+}
+
+func (InputDeniedUpdateType) GetType() string {
+	return "inputdenied"
+}
+
+var inputLeaseLock = &sync.Mutex{}
+var inputLeases = make(map[string]*inputLeaseType)
+var lastLeaseCleanTs time.Time
+
+func inputLeaseKey(targetType string, id string) string {
+	return targetType + ":" + id
+}
+
+// returns true if clientId may send input to key.  if acquire is false the lease is only checked (an unleased
+// target is allowed but not taken, used for winsize changes which are not user input)
+func checkInputLease(key string, clientId string, acquire bool, now time.Time) bool {
+	inputLeaseLock.Lock()
+	defer inputLeaseLock.Unlock()
+	cleanInputLeases_nolock(now)
+	lease := inputLeases[key]
+	if lease != nil && lease.ClientId != clientId && now.Sub(lease.LastInputTs) < InputLeaseIdleTime {
+		return false
+	}
+	if !acquire {
+		return true
+	}
+	if lease == nil || lease.ClientId != clientId {
+		lease = &inputLeaseType{ClientId: clientId}
+		inputLeases[key] = lease
+	}
+	lease.LastInputTs = now
+	return true
+}
+
+// releases all leases held by clientId (called when the client's websocket closes)
+func ReleaseInputLeases(clientId string) {
+	inputLeaseLock.Lock()
+	defer inputLeaseLock.Unlock()
+	for key, lease := range inputLeases {
+		if lease.ClientId == clientId {
+			delete(inputLeases, key)
+		}
+	}
+}
+
+// removes expired leases so the map does not grow without bound (must hold inputLeaseLock)
+func cleanInputLeases_nolock(now time.Time) {
+	if now.Sub(lastLeaseCleanTs) < InputLeaseCleanInterval {
+		return
+	}
+	lastLeaseCleanTs = now
+	for key, lease := range inputLeases {
+		if now.Sub(lease.LastInputTs) >= InputLeaseIdleTime {
+			delete(inputLeases, key)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package scws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInputLease(t *testing.T) {
+	key := inputLeaseKey("cmd", "test-screen/test-line")
+	now := time.Now()
+	if !checkInputLease(key, "client-a", true, now) {
+		t.Fatalf("first client should acquire the lease")
+	}
+	if checkInputLease(key, "client-b", true, now.Add(time.Second)) {
+		t.Errorf("second client should be denied while the lease is active")
+	}
+	if checkInputLease(key, "client-b", false, now.Add(time.Second)) {
+		t.Errorf("second client check (no acquire) should be denied while the lease is active")
+	}
+	if !checkInputLease(key, "client-a", true, now.Add(2*time.Second)) {
+		t.Errorf("lease holder should keep the lease")
+	}
+	// lease was renewed at +2s, so it is still held at +4s
+	if checkInputLease(key, "client-b", true, now.Add(4*time.Second)) {
+		t.Errorf("lease should have been renewed by the holder's input")
+	}
+	if !checkInputLease(key, "client-b", true, now.Add(2*time.Second+InputLeaseIdleTime)) {
+		t.Errorf("second client should acquire the lease after it goes idle")
+	}
+	ReleaseInputLeases("client-b")
+	if !checkInputLease(key, "client-a", false, now.Add(2*time.Second+InputLeaseIdleTime)) {
+		t.Errorf("lease should be free after release")
+	}
+}
@@ -45,6 +45,8 @@ type WSState struct {
 
 	SessionId string
 	ScreenId  string
+
+	LastInputDeniedTs time.Time
 }
 
 func MakeWSState(clientId string, authKey string) *WSState {
@@ -120,6 +122,26 @@ func (ws *WSState) UnWatchScreen() {
 	log.Printf("[ws] unwatch screen clientid=%s\n", ws.ClientId)
 }
 
+// rate limited, the frontend shows the message as an info message
+func (ws *WSState) notifyInputDenied(target string) {
+	ws.Lock.Lock()
+	if time.Since(ws.LastInputDeniedTs) < InputDeniedNotifyInterval {
+		ws.Lock.Unlock()
+		return
+	}
+	ws.LastInputDeniedTs = time.Now()
+	ws.Lock.Unlock()
+	update := scbus.MakeUpdatePacket()
+	update.AddUpdate(InputDeniedUpdateType{
+		Target: target,
+		Msg:    fmt.Sprintf("input ignored, %s is being controlled by another client", target),
+	})
+	err := ws.WriteUpdate(update)
+	if err != nil {
+		log.Printf("[ws %s] error sending inputdenied update: %v\n", ws.ClientId, err)
+	}
+}
+
 func (ws *WSState) RunUpdates(updateCh chan scbus.UpdatePacket) {
 	if updateCh == nil {
 		panic("invalid nil updateCh passed to RunUpdates")
@@ -171,6 +193,7 @@ func (ws *WSState) handleConnection() error {
 		return fmt.Errorf("getting configs: %w", err)
 	}
 	connectUpdate.TermThemes = &configs
+	connectUpdate.Settings = configstore.GetLastSettingsUpdate()
 	mu := scbus.MakeUpdatePacket()
 	mu.AddUpdate(*connectUpdate)
 	err = ws.Shell.WriteJson(mu)
@@ -250,6 +273,13 @@ func (ws *WSState) processMessage(msgBytes []byte) error {
 		if feInputPk.Remote.RemoteId == "" {
 			return fmt.Errorf("error invalid input packet, remoteid is not set")
 		}
+		isUserInput := feInputPk.InputData64 != "" || feInputPk.SigName != ""
+		if !checkInputLease(inputLeaseKey("cmd", string(feInputPk.CK)), ws.ClientId, isUserInput, time.Now()) {
+			if isUserInput {
+				ws.notifyInputDenied("this command")
+			}
+			return nil
+		}
 		err := RemoteInputMapQueue.Enqueue(feInputPk.Remote.RemoteId, func() {
 			sendErr := sendCmdInput(feInputPk)
 			if sendErr != nil {
@@ -266,6 +296,10 @@ func (ws *WSState) processMessage(msgBytes []byte) error {
 		if inputPk.RemoteId == "" {
 			return fmt.Errorf("error invalid remoteinput packet, remoteid is not set")
 		}
+		if !checkInputLease(inputLeaseKey("remote", inputPk.RemoteId), ws.ClientId, true, time.Now()) {
+			ws.notifyInputDenied("this connection")
+			return nil
+		}
 		go func() {
 			sendErr := remote.SendRemoteInput(inputPk)
 			if sendErr != nil {
@@ -279,8 +313,12 @@ func (ws *WSState) processMessage(msgBytes []byte) error {
 		if cmdInputPk.ScreenId == "" {
 			return fmt.Errorf("error invalid cmdinput packet, screenid is not set")
 		}
+		if !checkInputLease(inputLeaseKey("cmdinput", cmdInputPk.ScreenId), ws.ClientId, true, time.Now()) {
+			ws.notifyInputDenied("the command line for this tab")
+			return nil
+		}
 		// no need for goroutine for memory ops
-		sstore.ScreenMemSetCmdInputText(cmdInputPk.ScreenId, cmdInputPk.Text, cmdInputPk.SeqNum)
+		sstore.ScreenMemSetCmdInputText(cmdInputPk.ScreenId, cmdInputPk.Text, cmdInputPk.SeqNum, ws.ClientId)
 		return nil
 	}
 	if pk.GetType() == userinput.UserInputResponsePacketStr {
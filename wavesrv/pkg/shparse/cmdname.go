@@ -0,0 +1,48 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package shparse
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commands that run another command, CmdName skips these (and their options) to find the real program
+var cmdNameWrappers = map[string]bool{
+	"sudo":    true,
+	"time":    true,
+	"exec":    true,
+	"command": true,
+	"nohup":   true,
+}
+
+// returns the program name for the first simple command in cmdStr (used by history stats and the telemetry report).
+// skips env assignments and wrapper commands (sudo, time, ...), and strips directories.
+// returns "" if no name can be determined (e.g. the program is a variable).
+func CmdName(cmdStr string) string {
+	cmds := ParseCommands(Tokenize(cmdStr))
+	for _, cmd := range cmds {
+		if cmd.Type != CmdTypeSimple || len(cmd.Words) == 0 {
+			continue
+		}
+		inWrapper := false
+		for _, word := range cmd.Words {
+			name, info := SimpleExpand(ExpandContext{}, word)
+			name = strings.TrimSpace(name)
+			if name == "" || info.HasVar {
+				return ""
+			}
+			if cmdNameWrappers[name] {
+				inWrapper = true
+				continue
+			}
+			if inWrapper && strings.HasPrefix(name, "-") {
+				continue
+			}
+			return filepath.Base(name)
+		}
+		return ""
+	}
+	return ""
+}
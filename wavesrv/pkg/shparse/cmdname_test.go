@@ -0,0 +1,30 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package shparse
+
+import "testing"
+
+func TestCmdName(t *testing.T) {
+	tests := map[string]string{
+		"ls -l":                    "ls",
+		"  git status":             "git",
+		"FOO=1 BAR=2 make build":   "make",
+		"/usr/bin/git status":      "git",
+		"sudo /usr/bin/apt update": "apt",
+		"sudo -E make install":     "make",
+		"time ./run.sh":            "run.sh",
+		"exec zsh":                 "zsh",
+		"'my prog' arg":            "my prog",
+		"cd foo && npm run build":  "cd",
+		"$EDITOR file.txt":         "",
+		"sudo":                     "",
+		"A=1":                      "",
+		"":                         "",
+	}
+	for cmdStr, expected := range tests {
+		if rtn := CmdName(cmdStr); rtn != expected {
+			t.Errorf("CmdName(%q) expected %q, got %q", cmdStr, expected, rtn)
+		}
+	}
+}
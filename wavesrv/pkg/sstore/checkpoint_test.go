@@ -0,0 +1,133 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+)
+
+func insertTestRemote(t *testing.T, alias string) *RemoteType {
+	r := &RemoteType{
+		RemoteId:            scbase.GenWaveUUID(),
+		RemoteType:          RemoteTypeSsh,
+		RemoteAlias:         alias,
+		RemoteCanonicalName: "test@" + alias,
+		RemoteUser:          "test",
+		RemoteHost:          alias,
+		ConnectMode:         ConnectModeManual,
+		SSHOpts:             &SSHOpts{SSHHost: alias, SSHUser: "test"},
+		SSHConfigSrc:        SSHConfigSrcTypeManual,
+		ShellPref:           ShellTypePref_Detect,
+	}
+	err := UpsertRemote(context.Background(), r)
+	if err != nil {
+		t.Fatalf("cannot insert remote: %v", err)
+	}
+	return r
+}
+
+func makeTestCheckpoint(remoteId string, name string, baseHash string) *StateCheckpointType {
+	return &StateCheckpointType{
+		RemoteId:         remoteId,
+		Name:             name,
+		Ts:               time.Now().UnixMilli(),
+		ShellType:        "bash",
+		FeState:          map[string]string{"cwd": "/tmp"},
+		StateBaseHash:    baseHash,
+		StateDiffHashArr: []string{"diff1", "diff2"},
+	}
+}
+
+func TestStateCheckpointSaveLoad(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	r := insertTestRemote(t, "cphost")
+	cp := makeTestCheckpoint(r.RemoteId, "before", "base1")
+	err := UpsertStateCheckpoint(ctx, cp)
+	if err != nil {
+		t.Fatalf("cannot save checkpoint: %v", err)
+	}
+	dbCp, err := GetStateCheckpoint(ctx, r.RemoteId, "before")
+	if err != nil || dbCp == nil {
+		t.Fatalf("cannot load checkpoint: %v", err)
+	}
+	if !reflect.DeepEqual(dbCp, cp) {
+		t.Errorf("checkpoint mismatch, got %#v, want %#v", dbCp, cp)
+	}
+	// saving with the same name overwrites
+	cp2 := makeTestCheckpoint(r.RemoteId, "before", "base2")
+	cp2.FeState = map[string]string{"cwd": "/home"}
+	err = UpsertStateCheckpoint(ctx, cp2)
+	if err != nil {
+		t.Fatalf("cannot overwrite checkpoint: %v", err)
+	}
+	dbCp, _ = GetStateCheckpoint(ctx, r.RemoteId, "before")
+	if dbCp == nil || dbCp.StateBaseHash != "base2" || dbCp.FeState["cwd"] != "/home" {
+		t.Errorf("checkpoint not overwritten: %#v", dbCp)
+	}
+	dbCp, _ = GetStateCheckpoint(ctx, r.RemoteId, "missing")
+	if dbCp != nil {
+		t.Errorf("missing checkpoint should return nil, got %#v", dbCp)
+	}
+	err = DeleteStateCheckpoint(ctx, r.RemoteId, "before")
+	if err != nil {
+		t.Fatalf("cannot delete checkpoint: %v", err)
+	}
+	err = DeleteStateCheckpoint(ctx, r.RemoteId, "before")
+	if err == nil {
+		t.Errorf("deleting a missing checkpoint should fail")
+	}
+}
+
+func TestStateCheckpointPruneOnArchive(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	r1 := insertTestRemote(t, "cphost1")
+	r2 := insertTestRemote(t, "cphost2")
+	for _, name := range []string{"a", "b"} {
+		err := UpsertStateCheckpoint(ctx, makeTestCheckpoint(r1.RemoteId, name, "base"))
+		if err != nil {
+			t.Fatalf("cannot save checkpoint: %v", err)
+		}
+	}
+	err := UpsertStateCheckpoint(ctx, makeTestCheckpoint(r2.RemoteId, "a", "base"))
+	if err != nil {
+		t.Fatalf("cannot save checkpoint: %v", err)
+	}
+	// non-archiving upserts keep the checkpoints
+	r1.ConnectMode = ConnectModeStartup
+	err = UpsertRemote(ctx, r1)
+	if err != nil {
+		t.Fatalf("cannot update remote: %v", err)
+	}
+	cps, _ := GetStateCheckpoints(ctx, r1.RemoteId)
+	if len(cps) != 2 {
+		t.Fatalf("expected 2 checkpoints after update, got %d", len(cps))
+	}
+	archived := &RemoteType{
+		RemoteId:            r1.RemoteId,
+		RemoteType:          r1.RemoteType,
+		RemoteCanonicalName: r1.RemoteCanonicalName,
+		ConnectMode:         ConnectModeManual,
+		Archived:            true,
+		SSHConfigSrc:        r1.SSHConfigSrc,
+	}
+	err = UpsertRemote(ctx, archived)
+	if err != nil {
+		t.Fatalf("cannot archive remote: %v", err)
+	}
+	cps, _ = GetStateCheckpoints(ctx, r1.RemoteId)
+	if len(cps) != 0 {
+		t.Errorf("expected checkpoints to be pruned with the archived remote, got %d", len(cps))
+	}
+	cps, _ = GetStateCheckpoints(ctx, r2.RemoteId)
+	if len(cps) != 1 {
+		t.Errorf("other remote's checkpoints should be kept, got %d", len(cps))
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+)
+
+// database snapshots are written with VACUUM INTO (consistent while the db is in use) to the db-backups dir.
+// scheduled ("auto") backups are rotated, manual backups are kept until removed by hand.
+// snapshots only cover the database, not the ptyout files in the screens dir.
+//
+// a restore is staged (the snapshot is checked and copied to DBRestoreFileName) and applied by
+// ApplyPendingDBRestore at the next startup, before the db is opened.  the replaced db is saved
+// as a manual snapshot (so it is not overwritten by the backup taken before a migration).  if the
+// restore fails the staged file is renamed to DBRestoreFileName + DBRestoreFailedSuffix.
+
+const DBRestoreFileName = "restore.waveterm.db"
+const DBRestoreFailedSuffix = ".failed"
+const DBSHMFileName = "waveterm.db-shm"
+const DefaultDBBackupCount = 7
+const DBBackupInterval = 24 * time.Hour
+
+const (
+	DBBackupKind_Manual = "manual"
+	DBBackupKind_Auto   = "auto"
+)
+
+const dbBackupTsFormat = "20060102-150405.000"
+
+var dbBackupNameRe = regexp.MustCompile(`^waveterm-(\d{8}-\d{6}\.\d{3})-(manual|auto)\.db$`)
+
+type DBBackupType struct {
+	Name string
+	Path string
+	Kind string
+	Ts   int64
+	Size int64
+}
+
+type DBCheckResultType struct {
+	Problems   []string // empty if the integrity check passed
+	Vacuumed   bool
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+func GetDBRestoreName() string {
+	scHome := scbase.GetWaveHomeDir()
+	return path.Join(scHome, DBRestoreFileName)
+}
+
+func GetDBSHMName() string {
+	scHome := scbase.GetWaveHomeDir()
+	return path.Join(scHome, DBSHMFileName)
+}
+
+// size of the db including the wal file
+func GetDBSize() int64 {
+	var rtn int64
+	for _, fileName := range []string{GetDBName(), GetDBWALName()} {
+		finfo, err := os.Stat(fileName)
+		if err == nil {
+			rtn += finfo.Size()
+		}
+	}
+	return rtn
+}
+
+func makeDBBackupName(ts time.Time, kind string) string {
+	return fmt.Sprintf("waveterm-%s-%s.db", ts.Format(dbBackupTsFormat), kind)
+}
+
+// returns ok=false if name is not a backup file name
+func parseDBBackupName(name string) (kind string, ts time.Time, ok bool) {
+	m := dbBackupNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+	ts, err := time.ParseInLocation(dbBackupTsFormat, m[1], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return m[2], ts, true
+}
+
+func BackupDB(ctx context.Context, kind string) (*DBBackupType, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return backupDBTo(ctx, db, kind)
+}
+
+// writes a snapshot of db (VACUUM INTO) to the backup dir
+func backupDBTo(ctx context.Context, db *sqlx.DB, kind string) (*DBBackupType, error) {
+	if kind != DBBackupKind_Manual && kind != DBBackupKind_Auto {
+		return nil, fmt.Errorf("invalid backup kind %q", kind)
+	}
+	backupDir := scbase.GetDBBackupsDir()
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create backup dir: %v", err)
+	}
+	now := time.Now()
+	name := makeDBBackupName(now, kind)
+	backupPath := filepath.Join(backupDir, name)
+	tmpPath := backupPath + ".tmp"
+	os.Remove(tmpPath) // VACUUM INTO fails if the file exists
+	_, err = db.ExecContext(ctx, `VACUUM INTO ?`, tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("cannot write snapshot: %v", err)
+	}
+	err = os.Rename(tmpPath, backupPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("cannot write snapshot: %v", err)
+	}
+	rtn := &DBBackupType{Name: name, Path: backupPath, Kind: kind, Ts: now.UnixMilli()}
+	finfo, err := os.Stat(backupPath)
+	if err == nil {
+		rtn.Size = finfo.Size()
+	}
+	return rtn, nil
+}
+
+// newest first
+func GetDBBackups() ([]*DBBackupType, error) {
+	backupDir := scbase.GetDBBackupsDir()
+	entries, err := os.ReadDir(backupDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read backup dir: %v", err)
+	}
+	var rtn []*DBBackupType
+	for _, entry := range entries {
+		kind, ts, ok := parseDBBackupName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		backup := &DBBackupType{Name: entry.Name(), Path: filepath.Join(backupDir, entry.Name()), Kind: kind, Ts: ts.UnixMilli()}
+		finfo, err := entry.Info()
+		if err == nil {
+			backup.Size = finfo.Size()
+		}
+		rtn = append(rtn, backup)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Ts > rtn[j].Ts
+	})
+	return rtn, nil
+}
+
+// arg can be a 1-based number (as listed by GetDBBackups) or a backup file name.  returns nil if not found.
+func FindDBBackupByArg(arg string) (*DBBackupType, error) {
+	backups, err := GetDBBackups()
+	if err != nil {
+		return nil, err
+	}
+	if num, err := strconv.Atoi(arg); err == nil {
+		if num < 1 || num > len(backups) {
+			return nil, nil
+		}
+		return backups[num-1], nil
+	}
+	for _, backup := range backups {
+		if backup.Name == arg {
+			return backup, nil
+		}
+	}
+	return nil, nil
+}
+
+// removes the oldest auto backups so that at most keepCount remain, returns the removed backups
+func RotateDBBackups(keepCount int) ([]*DBBackupType, error) {
+	backups, err := GetDBBackups()
+	if err != nil {
+		return nil, err
+	}
+	var removed []*DBBackupType
+	numAuto := 0
+	for _, backup := range backups {
+		if backup.Kind != DBBackupKind_Auto {
+			continue
+		}
+		numAuto++
+		if numAuto <= keepCount {
+			continue
+		}
+		err = os.Remove(backup.Path)
+		if err != nil {
+			return removed, fmt.Errorf("cannot remove backup %s: %v", backup.Name, err)
+		}
+		removed = append(removed, backup)
+	}
+	return removed, nil
+}
+
+// runs an integrity check on a database file (opened read-only), returns its migration version
+func checkDBFile(ctx context.Context, fileName string) (int, error) {
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", fileName))
+	if err != nil {
+		return 0, fmt.Errorf("cannot open %s: %v", fileName, err)
+	}
+	defer db.Close()
+	var results []string
+	err = db.SelectContext(ctx, &results, `PRAGMA integrity_check`)
+	if err != nil {
+		return 0, fmt.Errorf("cannot check %s: %v", fileName, err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return 0, fmt.Errorf("%s failed the integrity check (%d problem(s))", fileName, len(results))
+	}
+	var version int
+	err = db.GetContext(ctx, &version, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get migration version of %s: %v", fileName, err)
+	}
+	return version, nil
+}
+
+// checks the snapshot and stages it to be restored at the next startup (see ApplyPendingDBRestore)
+func StageDBRestore(ctx context.Context, backup *DBBackupType) error {
+	version, err := checkDBFile(ctx, backup.Path)
+	if err != nil {
+		return err
+	}
+	if version > MaxMigration {
+		return fmt.Errorf("backup %s is from a newer version of wave (db version %d > %d)", backup.Name, version, MaxMigration)
+	}
+	tmpName := GetDBRestoreName() + ".tmp"
+	err = copyFile(backup.Path, tmpName, false)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, GetDBRestoreName())
+}
+
+// must be called before the db is opened.  returns true if a staged restore was applied.
+func ApplyPendingDBRestore() (bool, error) {
+	restoreName := GetDBRestoreName()
+	_, err := os.Stat(restoreName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot stat %s: %v", restoreName, err)
+	}
+	err = applyDBRestore(restoreName)
+	if err != nil {
+		// don't retry the restore at every startup
+		failedName := restoreName + DBRestoreFailedSuffix
+		os.Remove(failedName)
+		renameErr := os.Rename(restoreName, failedName)
+		if renameErr != nil {
+			os.Remove(restoreName)
+		}
+		return false, fmt.Errorf("%v (staged restore moved to %s)", err, DBRestoreFileName+DBRestoreFailedSuffix)
+	}
+	return true, nil
+}
+
+func applyDBRestore(restoreName string) error {
+	if _, err := os.Stat(GetDBName()); err == nil {
+		backup, err := backupDBFile(GetDBName())
+		if err != nil {
+			return fmt.Errorf("error backing up current database: %v", err)
+		}
+		log.Printf("[db] restoring database from %s, current database saved as %s\n", DBRestoreFileName, backup.Name)
+	}
+	for _, fileName := range []string{GetDBWALName(), GetDBSHMName()} {
+		err := os.Remove(fileName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot remove %s: %v", fileName, err)
+		}
+	}
+	err := os.Rename(restoreName, GetDBName())
+	if err != nil {
+		return fmt.Errorf("cannot move %s into place: %v", DBRestoreFileName, err)
+	}
+	return nil
+}
+
+// saves a db file that is not open (including its wal) as a manual snapshot
+func backupDBFile(fileName string) (*DBBackupType, error) {
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000", fileName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %v", fileName, err)
+	}
+	defer db.Close()
+	return backupDBTo(context.Background(), db, DBBackupKind_Manual)
+}
+
+// runs an integrity check, vacuums the db if it passes
+func CheckDB(ctx context.Context) (*DBCheckResultType, error) {
+	db, err := GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rtn := &DBCheckResultType{SizeBefore: GetDBSize()}
+	var results []string
+	err = db.SelectContext(ctx, &results, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run integrity check: %v", err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		rtn.Problems = results
+		rtn.SizeAfter = rtn.SizeBefore
+		return rtn, nil
+	}
+	_, err = db.ExecContext(ctx, `VACUUM`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot vacuum database: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	if err != nil {
+		log.Printf("[db] error checkpointing wal after vacuum: %v\n", err)
+	}
+	rtn.Vacuumed = true
+	rtn.SizeAfter = GetDBSize()
+	return rtn, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+)
+
+func TestParseDBBackupName(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 14, 7, 9, 123*int(time.Millisecond), time.Local)
+	for _, kind := range []string{DBBackupKind_Manual, DBBackupKind_Auto} {
+		name := makeDBBackupName(ts, kind)
+		rtnKind, rtnTs, ok := parseDBBackupName(name)
+		if !ok || rtnKind != kind || !rtnTs.Equal(ts) {
+			t.Errorf("parse %q: got %q %v %v", name, rtnKind, rtnTs, ok)
+		}
+	}
+	badNames := []string{
+		"waveterm.db",
+		"waveterm-20240305-140709.123-other.db",
+		"waveterm-20240305-140709-manual.db",
+		"waveterm-20240305-140709.123-manual.db.tmp",
+		"waveterm-20241305-140709.123-manual.db",
+	}
+	for _, name := range badNames {
+		if _, _, ok := parseDBBackupName(name); ok {
+			t.Errorf("parse %q: expected not ok", name)
+		}
+	}
+}
+
+// creates empty backup files, one minute apart (oldest first), returns the names
+func makeTestBackups(t *testing.T, kinds ...string) []string {
+	backupDir := scbase.GetDBBackupsDir()
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		t.Fatalf("cannot create backup dir: %v", err)
+	}
+	baseTs := time.Date(2024, 3, 5, 14, 0, 0, 0, time.Local)
+	var rtn []string
+	for idx, kind := range kinds {
+		name := makeDBBackupName(baseTs.Add(time.Duration(idx)*time.Minute), kind)
+		err = os.WriteFile(filepath.Join(backupDir, name), nil, 0600)
+		if err != nil {
+			t.Fatalf("cannot write backup: %v", err)
+		}
+		rtn = append(rtn, name)
+	}
+	return rtn
+}
+
+func getBackupNames(t *testing.T) []string {
+	backups, err := GetDBBackups()
+	if err != nil {
+		t.Fatalf("error getting backups: %v", err)
+	}
+	var rtn []string
+	for _, backup := range backups {
+		rtn = append(rtn, backup.Name)
+	}
+	return rtn
+}
+
+func TestGetDBBackups(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	if names := getBackupNames(t); len(names) != 0 {
+		t.Errorf("expected no backups (no dir), got %v", names)
+	}
+	names := makeTestBackups(t, DBBackupKind_Auto, DBBackupKind_Manual, DBBackupKind_Auto)
+	os.WriteFile(filepath.Join(scbase.GetDBBackupsDir(), "notes.txt"), nil, 0600)
+	rtn := getBackupNames(t)
+	if len(rtn) != 3 || rtn[0] != names[2] || rtn[1] != names[1] || rtn[2] != names[0] {
+		t.Errorf("expected newest first, got %v", rtn)
+	}
+}
+
+func TestRotateDBBackups(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	names := makeTestBackups(t, DBBackupKind_Auto, DBBackupKind_Manual, DBBackupKind_Auto, DBBackupKind_Auto, DBBackupKind_Manual)
+	removed, err := RotateDBBackups(1)
+	if err != nil {
+		t.Fatalf("error rotating backups: %v", err)
+	}
+	// the newest auto backup and all manual backups are kept
+	if len(removed) != 2 || removed[0].Name != names[2] || removed[1].Name != names[0] {
+		t.Errorf("unexpected removed backups %v", removed)
+	}
+	rtn := getBackupNames(t)
+	if len(rtn) != 3 || rtn[0] != names[4] || rtn[1] != names[3] || rtn[2] != names[1] {
+		t.Errorf("unexpected remaining backups %v", rtn)
+	}
+	removed, err = RotateDBBackups(1)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("expected nothing to rotate, got %v %v", removed, err)
+	}
+}
+
+func TestFindDBBackupByArg(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	names := makeTestBackups(t, DBBackupKind_Manual, DBBackupKind_Auto)
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{"1", names[1]},
+		{"2", names[0]},
+		{"0", ""},
+		{"3", ""},
+		{names[0], names[0]},
+		{"waveterm.db", ""},
+	}
+	for _, test := range tests {
+		backup, err := FindDBBackupByArg(test.arg)
+		if err != nil {
+			t.Fatalf("find %q: %v", test.arg, err)
+		}
+		var rtn string
+		if backup != nil {
+			rtn = backup.Name
+		}
+		if rtn != test.expected {
+			t.Errorf("find %q: got %q, expected %q", test.arg, rtn, test.expected)
+		}
+	}
+}
+
+func writeTestDB(t *testing.T, fileName string, val string) {
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=rwc", fileName))
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", fileName, err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE test (val text)`)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO test VALUES (?)`, val)
+	}
+	if err != nil {
+		t.Fatalf("cannot write %s: %v", fileName, err)
+	}
+}
+
+func readTestDB(t *testing.T, fileName string) string {
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", fileName))
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", fileName, err)
+	}
+	defer db.Close()
+	var rtn string
+	err = db.Get(&rtn, `SELECT val FROM test`)
+	if err != nil {
+		t.Fatalf("cannot read %s: %v", fileName, err)
+	}
+	return rtn
+}
+
+func TestApplyPendingDBRestore(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	applied, err := ApplyPendingDBRestore()
+	if applied || err != nil {
+		t.Fatalf("expected nothing to restore, got %v %v", applied, err)
+	}
+	writeTestDB(t, GetDBName(), "current")
+	writeTestDB(t, GetDBRestoreName(), "restored")
+	applied, err = ApplyPendingDBRestore()
+	if !applied || err != nil {
+		t.Fatalf("expected restore, got %v %v", applied, err)
+	}
+	if val := readTestDB(t, GetDBName()); val != "restored" {
+		t.Errorf("expected restored db, got %q", val)
+	}
+	// the replaced db is kept as a manual snapshot
+	backups, err := GetDBBackups()
+	if err != nil || len(backups) != 1 || backups[0].Kind != DBBackupKind_Manual {
+		t.Fatalf("expected one manual backup, got %v %v", backups, err)
+	}
+	if val := readTestDB(t, backups[0].Path); val != "current" {
+		t.Errorf("expected the replaced db in the backup, got %q", val)
+	}
+	if _, err := os.Stat(GetDBRestoreName()); err == nil {
+		t.Errorf("staged restore should be gone")
+	}
+
+	// a failed restore is moved aside so it is not retried
+	err = os.WriteFile(GetDBRestoreName(), nil, 0600)
+	if err != nil {
+		t.Fatalf("cannot write restore file: %v", err)
+	}
+	os.Remove(GetDBName())
+	err = os.Mkdir(GetDBName(), 0700)
+	if err != nil {
+		t.Fatalf("cannot create dir: %v", err)
+	}
+	applied, err = ApplyPendingDBRestore()
+	if applied || err == nil {
+		t.Errorf("expected restore error, got %v %v", applied, err)
+	}
+	if _, err := os.Stat(GetDBRestoreName()); err == nil {
+		t.Errorf("failed restore should be moved aside")
+	}
+	if _, err := os.Stat(GetDBRestoreName() + DBRestoreFailedSuffix); err != nil {
+		t.Errorf("failed restore file missing: %v", err)
+	}
+}
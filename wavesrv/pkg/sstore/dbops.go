@@ -214,6 +214,10 @@ func UpsertRemote(ctx context.Context, r *RemoteType) error {
 		if tx.Exists(query, r.RemoteId) {
 			tx.Exec(`DELETE FROM remote WHERE remoteid = ?`, r.RemoteId)
 		}
+		if r.Archived {
+			// archiving is how remotes get deleted, checkpoints cannot be applied to an archived remote
+			tx.Exec(`DELETE FROM state_checkpoint WHERE remoteid = ?`, r.RemoteId)
+		}
 		query = `SELECT remoteid FROM remote WHERE remotecanonicalname = ?`
 		if tx.Exists(query, r.RemoteCanonicalName) {
 			return fmt.Errorf("remote has duplicate canonicalname '%s', cannot create", r.RemoteCanonicalName)
@@ -226,8 +230,8 @@ func UpsertRemote(ctx context.Context, r *RemoteType) error {
 		maxRemoteIdx := tx.GetInt(query)
 		r.RemoteIdx = int64(maxRemoteIdx + 1)
 		query = `INSERT INTO remote
-            ( remoteid, remotetype, remotealias, remotecanonicalname, remoteuser, remotehost, connectmode, autoinstall, sshopts, remoteopts, lastconnectts, archived, remoteidx, local, statevars, sshconfigsrc, openaiopts, shellpref) VALUES
-            (:remoteid,:remotetype,:remotealias,:remotecanonicalname,:remoteuser,:remotehost,:connectmode,:autoinstall,:sshopts,:remoteopts,:lastconnectts,:archived,:remoteidx,:local,:statevars,:sshconfigsrc,:openaiopts,:shellpref)`
+            ( remoteid, remotetype, remotealias, remotecanonicalname, remoteuser, remotehost, connectmode, autoinstall, sshopts, remoteopts, lastconnectts, archived, remoteidx, local, statevars, sshconfigsrc, openaiopts, shellpref, connectcmd) VALUES
+            (:remoteid,:remotetype,:remotealias,:remotecanonicalname,:remoteuser,:remotehost,:connectmode,:autoinstall,:sshopts,:remoteopts,:lastconnectts,:archived,:remoteidx,:local,:statevars,:sshconfigsrc,:openaiopts,:shellpref,:connectcmd)`
 		tx.NamedExec(query, r.ToMap())
 		return nil
 	})
@@ -1051,6 +1055,7 @@ func DeleteScreen(ctx context.Context, screenId string, sessionDel bool, update
 	var sessionId string
 	var isActive bool
 	var screenTombstone *ScreenTombstoneType
+	var trashId string
 	txErr := WithTx(ctx, func(tx *TxWrap) error {
 		screen, err := GetScreenById(tx.Context(), screenId)
 		if err != nil {
@@ -1061,6 +1066,12 @@ func DeleteScreen(ctx context.Context, screenId string, sessionDel bool, update
 		}
 		webSharing := isWebShare(tx, screenId)
 		if !sessionDel {
+			var data trashDataType
+			snapshotScreenForTrash(tx, &data, screenId)
+			trashId, err = insertTrashItem(tx, TrashItemType_Screen, screen.SessionId, screenId, fmt.Sprintf("screen %q", screen.Name), &data)
+			if err != nil {
+				return err
+			}
 			query := `SELECT sessionid FROM screen WHERE screenid = ?`
 			sessionId = tx.GetString(query, screenId)
 			if sessionId == "" {
@@ -1089,6 +1100,8 @@ func DeleteScreen(ctx context.Context, screenId string, sessionDel bool, update
 		tx.Exec(query, screenId)
 		query = `DELETE FROM cmd WHERE screenid = ?`
 		tx.Exec(query, screenId)
+		query = `DELETE FROM remote_instance WHERE screenid = ?`
+		tx.Exec(query, screenId)
 		query = `UPDATE history SET lineid = '', linenum = 0 WHERE screenid = ?`
 		tx.Exec(query, screenId)
 		if webSharing {
@@ -1100,7 +1113,7 @@ func DeleteScreen(ctx context.Context, screenId string, sessionDel bool, update
 		return nil, txErr
 	}
 	if !sessionDel {
-		GoDeleteScreenDirs(screenId)
+		moveScreenDirsToTrash(trashId, screenId)
 	}
 	if update == nil {
 		update = scbus.MakeUpdatePacket()
@@ -1460,6 +1473,7 @@ func DeleteSession(ctx context.Context, sessionId string) (scbus.UpdatePacket, e
 	var newActiveSessionId string
 	var screenIds []string
 	var sessionTombstone *SessionTombstoneType
+	var trashId string
 	update := scbus.MakeUpdatePacket()
 	txErr := WithTx(ctx, func(tx *TxWrap) error {
 		bareSession, err := GetBareSessionById(tx.Context(), sessionId)
@@ -1471,6 +1485,16 @@ func DeleteSession(ctx context.Context, sessionId string) (scbus.UpdatePacket, e
 		}
 		query := `SELECT screenid FROM screen WHERE sessionid = ?`
 		screenIds = tx.SelectStrings(query, sessionId)
+		var data trashDataType
+		data.Sessions = tx.SelectMaps(`SELECT * FROM session WHERE sessionid = ?`, sessionId)
+		data.RIs = tx.SelectMaps(`SELECT * FROM remote_instance WHERE sessionid = ? AND screenid = ''`, sessionId)
+		for _, screenId := range screenIds {
+			snapshotScreenForTrash(tx, &data, screenId)
+		}
+		trashId, err = insertTrashItem(tx, TrashItemType_Session, sessionId, "", fmt.Sprintf("session %q", bareSession.Name), &data)
+		if err != nil {
+			return err
+		}
 		for _, screenId := range screenIds {
 			_, err := DeleteScreen(tx.Context(), screenId, true, update)
 			if err != nil {
@@ -1479,6 +1503,8 @@ func DeleteSession(ctx context.Context, sessionId string) (scbus.UpdatePacket, e
 		}
 		query = `DELETE FROM session WHERE sessionid = ?`
 		tx.Exec(query, sessionId)
+		query = `DELETE FROM remote_instance WHERE sessionid = ?`
+		tx.Exec(query, sessionId)
 		newActiveSessionId, _ = fixActiveSessionId(tx.Context())
 		sessionTombstone = &SessionTombstoneType{
 			SessionId: sessionId,
@@ -1493,7 +1519,7 @@ func DeleteSession(ctx context.Context, sessionId string) (scbus.UpdatePacket, e
 	if txErr != nil {
 		return nil, txErr
 	}
-	GoDeleteScreenDirs(screenIds...)
+	moveScreenDirsToTrash(trashId, screenIds...)
 	if newActiveSessionId != "" {
 		update.AddUpdate(ActiveSessionIdUpdate(newActiveSessionId))
 	}
@@ -1632,6 +1658,7 @@ const (
 	RemoteField_SSHPassword = "sshpassword" // string
 	RemoteField_Color       = "color"       // string
 	RemoteField_ShellPref   = "shellpref"   // string
+	RemoteField_ConnectCmd  = "connectcmd"  // string
 )
 
 // editMap: alias, connectmode, autoinstall, sshkey, color, sshpassword (from constants)
@@ -1667,6 +1694,10 @@ func UpdateRemote(ctx context.Context, remoteId string, editMap map[string]inter
 			query = `UPDATE remote SET shellpref = ? WHERE remoteid = ?`
 			tx.Exec(query, shellPref, remoteId)
 		}
+		if connectCmd, found := editMap[RemoteField_ConnectCmd]; found {
+			query = `UPDATE remote SET connectcmd = ? WHERE remoteid = ?`
+			tx.Exec(query, connectCmd, remoteId)
+		}
 		if color, found := editMap[RemoteField_Color]; found {
 			query = `UPDATE remote SET remoteopts = json_set(remoteopts, '$.color', ?) WHERE remoteid = ?`
 			tx.Exec(query, color, remoteId)
@@ -1684,6 +1715,26 @@ func UpdateRemote(ctx context.Context, remoteId string, editMap map[string]inter
 	return rtn, nil
 }
 
+// changes the ssh target (user, host, port) of a remote in place.  the remoteid is kept, so screens and lines
+// that reference the remote stay valid.
+func UpdateRemoteSSHTarget(ctx context.Context, remoteId string, canonicalName string, user string, host string, port int) (*RemoteType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (*RemoteType, error) {
+		query := `SELECT remoteid FROM remote WHERE remoteid = ?`
+		if !tx.Exists(query, remoteId) {
+			return nil, fmt.Errorf("remote not found")
+		}
+		query = `SELECT remoteid FROM remote WHERE remotecanonicalname = ? AND remoteid <> ?`
+		if tx.Exists(query, canonicalName, remoteId) {
+			return nil, fmt.Errorf("remote has duplicate canonicalname '%s', cannot update", canonicalName)
+		}
+		query = `UPDATE remote SET remotecanonicalname = ?, remoteuser = ?, remotehost = ?,
+		                sshopts = json_set(sshopts, '$.sshuser', ?, '$.sshhost', ?, '$.sshport', ?)
+		         WHERE remoteid = ?`
+		tx.Exec(query, canonicalName, user, host, user, host, port, remoteId)
+		return GetRemoteById(tx.Context(), remoteId)
+	})
+}
+
 const (
 	ScreenField_AnchorLine   = "anchorline"   // int
 	ScreenField_AnchorOffset = "anchoroffset" // int
@@ -1974,6 +2025,26 @@ func UpdateLineStar(ctx context.Context, screenId string, lineId string, starVal
 	return nil
 }
 
+// an empty note removes the note
+func UpdateLineNote(ctx context.Context, screenId string, lineId string, note string) error {
+	txErr := WithTx(ctx, func(tx *TxWrap) error {
+		var noteTs int64
+		if note != "" {
+			noteTs = time.Now().UnixMilli()
+		}
+		query := `UPDATE line SET note = ?, notets = ? WHERE screenid = ? AND lineid = ?`
+		tx.Exec(query, note, noteTs, screenId, lineId)
+		if isWebShare(tx, screenId) {
+			insertScreenLineUpdate(tx, screenId, lineId, UpdateType_LineNote)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return txErr
+	}
+	return nil
+}
+
 func UpdateLineHeight(ctx context.Context, screenId string, lineId string, heightVal int) error {
 	txErr := WithTx(ctx, func(tx *TxWrap) error {
 		query := `UPDATE line SET contentheight = ? WHERE screenid = ? AND lineid = ?`
@@ -2076,9 +2147,19 @@ func FixupScreenSelectedLine(ctx context.Context, screenId string) (*ScreenType,
 	})
 }
 
+// the lines (and their output) are moved to the trash
 func DeleteLinesByIds(ctx context.Context, screenId string, lineIds []string) error {
+	var trashId string
 	txErr := WithTx(ctx, func(tx *TxWrap) error {
 		isWS := isWebShare(tx, screenId)
+		var data trashDataType
+		snapshotLinesForTrash(tx, &data, screenId, lineIds)
+		var err error
+		sessionId := tx.GetString(`SELECT sessionid FROM screen WHERE screenid = ?`, screenId)
+		trashId, err = insertTrashItem(tx, TrashItemType_Line, sessionId, screenId, makeLinesTrashDesc(tx, screenId, &data), &data)
+		if err != nil {
+			return err
+		}
 		for _, lineId := range lineIds {
 			query := `SELECT status FROM cmd WHERE screenid = ? AND lineid = ?`
 			cmdStatus := tx.GetString(query, screenId, lineId)
@@ -2098,7 +2179,11 @@ func DeleteLinesByIds(ctx context.Context, screenId string, lineIds []string) er
 		}
 		return nil
 	})
-	return txErr
+	if txErr != nil {
+		return txErr
+	}
+	movePtyOutFilesToTrash(trashId, screenId, lineIds)
+	return nil
 }
 
 func GetRIsForScreen(ctx context.Context, sessionId string, screenId string) ([]*RemoteInstance, error) {
@@ -2114,6 +2199,44 @@ func GetRIsForScreen(ctx context.Context, sessionId string, screenId string) ([]
 	return rtn, nil
 }
 
+func UpsertStateCheckpoint(ctx context.Context, cp *StateCheckpointType) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `INSERT INTO state_checkpoint ( remoteid, name, ts, shelltype, festate, statebasehash, statediffhasharr)
+                                        VALUES (:remoteid,:name,:ts,:shelltype,:festate,:statebasehash,:statediffhasharr)
+                  ON CONFLICT (remoteid, name) DO UPDATE SET ts = excluded.ts, shelltype = excluded.shelltype, festate = excluded.festate,
+                                                             statebasehash = excluded.statebasehash, statediffhasharr = excluded.statediffhasharr`
+		tx.NamedExec(query, cp.ToMap())
+		return nil
+	})
+}
+
+// returns nil if not found
+func GetStateCheckpoint(ctx context.Context, remoteId string, name string) (*StateCheckpointType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (*StateCheckpointType, error) {
+		query := `SELECT * FROM state_checkpoint WHERE remoteid = ? AND name = ?`
+		return dbutil.GetMapGen[*StateCheckpointType](tx, query, remoteId, name), nil
+	})
+}
+
+func GetStateCheckpoints(ctx context.Context, remoteId string) ([]*StateCheckpointType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*StateCheckpointType, error) {
+		query := `SELECT * FROM state_checkpoint WHERE remoteid = ? ORDER BY name`
+		return dbutil.SelectMapsGen[*StateCheckpointType](tx, query, remoteId), nil
+	})
+}
+
+func DeleteStateCheckpoint(ctx context.Context, remoteId string, name string) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `SELECT name FROM state_checkpoint WHERE remoteid = ? AND name = ?`
+		if !tx.Exists(query, remoteId, name) {
+			return fmt.Errorf("checkpoint %q not found", name)
+		}
+		query = `DELETE FROM state_checkpoint WHERE remoteid = ? AND name = ?`
+		tx.Exec(query, remoteId, name)
+		return nil
+	})
+}
+
 func foundInStrArr(strs []string, s string) bool {
 	for _, sval := range strs {
 		if s == sval {
@@ -12,6 +12,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
@@ -226,3 +227,133 @@ func DeleteScreenDir(ctx context.Context, screenId string) error {
 	log.Printf("delete screen dir, remove-all %s\n", screenDir)
 	return os.RemoveAll(screenDir)
 }
+
+func getTrashItemDir(trashId string) string {
+	return filepath.Join(scbase.GetTrashDir(), trashId)
+}
+
+// moves the screen dirs (and all of their ptyout files) to [trash]/[trashid]/[screenid]
+func moveScreenDirsToTrash(trashId string, screenIds ...string) {
+	trashDir := getTrashItemDir(trashId)
+	err := os.MkdirAll(trashDir, 0700)
+	if err != nil {
+		log.Printf("error creating trash dir %s: %v\n", trashDir, err)
+		return
+	}
+	for _, screenId := range screenIds {
+		screenDir := filepath.Join(scbase.GetScreensDir(), screenId)
+		err = os.Rename(screenDir, filepath.Join(trashDir, screenId))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("error moving screendir %s to trash: %v\n", screenId, err)
+		}
+	}
+}
+
+func movePtyOutFilesToTrash(trashId string, screenId string, lineIds []string) {
+	trashScreenDir := filepath.Join(getTrashItemDir(trashId), screenId)
+	err := os.MkdirAll(trashScreenDir, 0700)
+	if err != nil {
+		log.Printf("error creating trash dir %s: %v\n", trashScreenDir, err)
+		return
+	}
+	for _, lineId := range lineIds {
+		ptyOutFileName, err := scbase.PtyOutFile(screenId, lineId)
+		if err != nil {
+			log.Printf("error getting ptyout file for line %s: %v\n", lineId, err)
+			continue
+		}
+		err = os.Rename(ptyOutFileName, filepath.Join(trashScreenDir, filepath.Base(ptyOutFileName)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("error moving ptyout file %s to trash: %v\n", ptyOutFileName, err)
+		}
+	}
+}
+
+type trashFileMoveType struct {
+	From string
+	To   string
+}
+
+// moves the trash item's screen dirs (or ptyout files, if the screen dir exists) back, existing files are
+// not overwritten.  returns the moves so they can be undone (see undoTrashFileMoves), on error the moves
+// done so far are undone.  the trash dir is not removed.
+func restoreTrashFiles(trashId string) ([]trashFileMoveType, error) {
+	var moves []trashFileMoveType
+	doMove := func(from string, to string) error {
+		if _, err := os.Stat(to); err == nil {
+			return nil
+		}
+		err := os.Rename(from, to)
+		if err != nil {
+			return err
+		}
+		moves = append(moves, trashFileMoveType{From: from, To: to})
+		return nil
+	}
+	err := func() error {
+		trashDir := getTrashItemDir(trashId)
+		entries, err := os.ReadDir(trashDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			trashScreenDir := filepath.Join(trashDir, entry.Name())
+			screenDir := filepath.Join(scbase.GetScreensDir(), entry.Name())
+			if _, err := os.Stat(screenDir); errors.Is(err, fs.ErrNotExist) {
+				err = os.MkdirAll(scbase.GetScreensDir(), 0700)
+				if err != nil {
+					return err
+				}
+				err = doMove(trashScreenDir, screenDir)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			files, err := os.ReadDir(trashScreenDir)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				err = doMove(filepath.Join(trashScreenDir, file.Name()), filepath.Join(screenDir, file.Name()))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		undoTrashFileMoves(moves)
+		return nil, err
+	}
+	return moves, nil
+}
+
+// moves restored files back to the trash (in reverse order)
+func undoTrashFileMoves(moves []trashFileMoveType) {
+	for i := len(moves) - 1; i >= 0; i-- {
+		move := moves[i]
+		err := os.MkdirAll(filepath.Dir(move.From), 0700)
+		if err == nil {
+			err = os.Rename(move.To, move.From)
+		}
+		if err != nil {
+			log.Printf("error moving %s back to trash: %v\n", move.To, err)
+		}
+	}
+}
+
+func deleteTrashItemDir(trashId string) {
+	trashDir := getTrashItemDir(trashId)
+	err := os.RemoveAll(trashDir)
+	if err != nil {
+		log.Printf("error deleting trash dir %s: %v\n", trashDir, err)
+	}
+}
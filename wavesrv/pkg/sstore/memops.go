@@ -45,6 +45,7 @@ type ScreenMemState struct {
 	StatusIndicator    StatusIndicatorLevel    `json:"statusindicator,omitempty"`
 	CmdInputText       utilfn.StrWithPos       `json:"cmdinputtext,omitempty"`
 	CmdInputSeqNum     int                     `json:"cmdinputseqnum,omitempty"`
+	CmdInputClientId   string                  `json:"-"`
 	AICmdInfoChat      *OpenAICmdInfoChatStore `json:"aicmdinfochat,omitempty"`
 }
 
@@ -140,17 +141,20 @@ func ScreenMemUpdateCmdInfoChatMessage(screenId string, messageID int, msg *pack
 	return nil
 }
 
-func ScreenMemSetCmdInputText(screenId string, sp utilfn.StrWithPos, seqNum int) {
+// seqnums are per-client, so a write from a different client is always accepted (input arbitration happens in scws)
+func ScreenMemSetCmdInputText(screenId string, sp utilfn.StrWithPos, seqNum int, clientId string) {
 	MemLock.Lock()
 	defer MemLock.Unlock()
 	if ScreenMemStore[screenId] == nil {
 		ScreenMemStore[screenId] = &ScreenMemState{}
 	}
-	if seqNum <= ScreenMemStore[screenId].CmdInputSeqNum {
+	memState := ScreenMemStore[screenId]
+	if memState.CmdInputClientId == clientId && seqNum <= memState.CmdInputSeqNum {
 		return
 	}
-	ScreenMemStore[screenId].CmdInputText = sp
-	ScreenMemStore[screenId].CmdInputSeqNum = seqNum
+	memState.CmdInputText = sp
+	memState.CmdInputSeqNum = seqNum
+	memState.CmdInputClientId = clientId
 }
 
 func ScreenMemIncrementNumRunningCommands(screenId string, delta int) int {
@@ -0,0 +1,170 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/dbutil"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+)
+
+// retention policies limit how much output and history is kept (they are applied by the janitor package).
+// the client-wide policy has an empty sessionid.  in a session policy 0 means "use the client value"
+// and RetentionOff means "no limit for this session".
+
+const RetentionOff = -1
+
+type RetentionPolicyType struct {
+	SessionId     string `json:"sessionid"`
+	OutputDays    int    `json:"outputdays"`    // remove cmd lines (and their output) older than N days
+	MaxOutputSize int64  `json:"maxoutputsize"` // max total ptyout size in bytes, oldest (archived first) output is removed
+	HistoryDays   int    `json:"historydays"`   // remove history entries older than N days
+}
+
+func (RetentionPolicyType) UseDBMap() {}
+
+func (p *RetentionPolicyType) IsEmpty() bool {
+	return p.OutputDays == 0 && p.MaxOutputSize == 0 && p.HistoryDays == 0
+}
+
+// cmd lines that hold output (ptyout files), see GetRetentionLines
+type RetentionLineType struct {
+	ScreenId  string
+	LineId    string
+	SessionId string
+	LineNum   int64
+	Ts        int64
+	Star      int
+	Status    string
+	Archived  bool // line, screen or session is archived
+}
+
+// running cmds and starred lines are never removed by the janitor
+func (rl *RetentionLineType) IsProtected() bool {
+	return rl.Star > 0 || rl.Status == CmdStatusRunning || rl.Status == CmdStatusDetached
+}
+
+func GetRetentionPolicies(ctx context.Context) ([]*RetentionPolicyType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*RetentionPolicyType, error) {
+		query := `SELECT * FROM retention_policy ORDER BY sessionid`
+		return dbutil.SelectMappable[*RetentionPolicyType](tx, query), nil
+	})
+}
+
+// returns an empty policy if none is set
+func GetRetentionPolicy(ctx context.Context, sessionId string) (*RetentionPolicyType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (*RetentionPolicyType, error) {
+		query := `SELECT * FROM retention_policy WHERE sessionid = ?`
+		rtn := dbutil.GetMappable[*RetentionPolicyType](tx, query, sessionId)
+		if rtn == nil {
+			rtn = &RetentionPolicyType{SessionId: sessionId}
+		}
+		return rtn, nil
+	})
+}
+
+// an empty policy removes the policy
+func SetRetentionPolicy(ctx context.Context, policy *RetentionPolicyType) error {
+	return WithTx(ctx, func(tx *TxWrap) error {
+		query := `DELETE FROM retention_policy WHERE sessionid = ?`
+		tx.Exec(query, policy.SessionId)
+		if policy.IsEmpty() {
+			return nil
+		}
+		query = `INSERT INTO retention_policy ( sessionid, outputdays, maxoutputsize, historydays)
+		                               VALUES (:sessionid,:outputdays,:maxoutputsize,:historydays)`
+		tx.NamedExec(query, dbutil.ToDBMap(policy, false))
+		return nil
+	})
+}
+
+func GetRetentionLines(ctx context.Context) ([]*RetentionLineType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*RetentionLineType, error) {
+		var rtn []*RetentionLineType
+		query := `SELECT c.screenid, c.lineid, s.sessionid, l.linenum, l.ts, l.star, c.status,
+		                 (l.archived OR s.archived OR ss.archived) AS archived
+		          FROM cmd c
+		          JOIN line l ON l.screenid = c.screenid AND l.lineid = c.lineid
+		          JOIN screen s ON s.screenid = c.screenid
+		          JOIN session ss ON ss.sessionid = s.sessionid`
+		tx.Select(&rtn, query)
+		return rtn, nil
+	})
+}
+
+// total size of the ptyout files of a trash item (see RestoreTrashItem), 0 if it has none
+func TrashItemSize(trashId string) int64 {
+	var rtn int64
+	filepath.WalkDir(getTrashItemDir(trashId), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		finfo, err := entry.Info()
+		if err == nil {
+			rtn += finfo.Size()
+		}
+		return nil
+	})
+	return rtn
+}
+
+// returns 0 if the file does not exist
+func PtyOutFileSize(screenId string, lineId string) int64 {
+	// don't use scbase.PtyOutFile (it creates the screen dir)
+	finfo, err := os.Stat(filepath.Join(scbase.GetScreensDir(), screenId, lineId+".ptyout.cf"))
+	if err != nil {
+		return 0
+	}
+	return finfo.Size()
+}
+
+// permanently deletes the lines and their output (they do not go to the trash).  lines with running
+// cmds are skipped.  returns the ids of the removed lines.
+func PurgeLinesByIds(ctx context.Context, screenId string, lineIds []string) ([]string, error) {
+	removedIds, err := WithTxRtn(ctx, func(tx *TxWrap) ([]string, error) {
+		var rtn []string
+		isWS := isWebShare(tx, screenId)
+		for _, lineId := range lineIds {
+			query := `SELECT status FROM cmd WHERE screenid = ? AND lineid = ?`
+			cmdStatus := tx.GetString(query, screenId, lineId)
+			if cmdStatus == CmdStatusRunning || cmdStatus == CmdStatusDetached {
+				continue
+			}
+			query = `DELETE FROM line WHERE screenid = ? AND lineid = ?`
+			tx.Exec(query, screenId, lineId)
+			query = `DELETE FROM cmd WHERE screenid = ? AND lineid = ?`
+			tx.Exec(query, screenId, lineId)
+			query = `UPDATE history SET lineid = '', linenum = 0 WHERE screenid = ? AND lineid = ?`
+			tx.Exec(query, screenId, lineId)
+			if isWS {
+				insertScreenLineUpdate(tx, screenId, lineId, UpdateType_LineDel)
+			}
+			rtn = append(rtn, lineId)
+		}
+		return rtn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, lineId := range removedIds {
+		err = os.Remove(filepath.Join(scbase.GetScreensDir(), screenId, lineId+".ptyout.cf"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("error removing ptyout file for line %s/%s: %v\n", screenId, lineId, err)
+		}
+	}
+	return removedIds, nil
+}
+
+func AddLinesRemoveUpdate(update *scbus.ModelUpdatePacketType, screenId string, lineIds []string) {
+	for _, lineId := range lineIds {
+		AddLineUpdate(update, &LineType{ScreenId: screenId, LineId: lineId, Remove: true}, nil)
+	}
+}
@@ -109,6 +109,7 @@ const (
 const (
 	SSHConfigSrcTypeManual = "waveterm-manual"
 	SSHConfigSrcTypeImport = "sshconfig-import"
+	SSHConfigSrcTypeFile   = "remotes-file" // managed by [config]/remotes.json
 )
 
 // TODO: move to webshare package once sstore code is more modular
@@ -124,8 +125,14 @@ const (
 )
 
 const (
-	RemoteTypeSsh    = "ssh"
-	RemoteTypeOpenAI = "openai"
+	RunAsMethodSudo = "sudo"
+	RunAsMethodSu   = "su"
+)
+
+const (
+	RemoteTypeSsh     = "ssh"
+	RemoteTypeCommand = "command" // connects over the stdin/stdout of a user-supplied command (kubectl exec -i, etc.)
+	RemoteTypeOpenAI  = "openai"
 )
 
 const (
@@ -148,6 +155,7 @@ const (
 	UpdateType_LineRenderer       = "line:renderer"
 	UpdateType_LineContentHeight  = "line:contentheight"
 	UpdateType_LineState          = "line:state"
+	UpdateType_LineNote           = "line:note"
 	UpdateType_CmdStatus          = "cmd:status"
 	UpdateType_CmdTermOpts        = "cmd:termopts"
 	UpdateType_CmdExitCode        = "cmd:exitcode"
@@ -253,6 +261,8 @@ type ClientOptsType struct {
 	GlobalShortcutEnabled bool              `json:"globalshortcutenabled,omitempty"`
 	WebGL                 bool              `json:"webgl,omitempty"`
 	AutocompleteEnabled   bool              `json:"autocompleteenabled,omitempty"`
+	SysMetricsIntervalSec int               `json:"sysmetricsintervalsec,omitempty"` // 0 for default, -1 for off
+	DBBackupCount         int               `json:"dbbackupcount,omitempty"`         // scheduled db backups to keep, 0 for default, -1 for off
 }
 
 type FeOptsType struct {
@@ -657,6 +667,44 @@ func (ri *RemoteInstance) ToMap() map[string]interface{} {
 	return rtn
 }
 
+// named shell state saved with /state:save (can be restored on any screen using the same remote)
+type StateCheckpointType struct {
+	RemoteId         string            `json:"remoteid"`
+	Name             string            `json:"name"`
+	Ts               int64             `json:"ts"`
+	ShellType        string            `json:"shelltype"`
+	FeState          map[string]string `json:"festate"`
+	StateBaseHash    string            `json:"-"`
+	StateDiffHashArr []string          `json:"-"`
+}
+
+func (cp *StateCheckpointType) GetStatePtr() packet.ShellStatePtr {
+	return packet.ShellStatePtr{BaseHash: cp.StateBaseHash, DiffHashArr: cp.StateDiffHashArr}
+}
+
+func (cp *StateCheckpointType) FromMap(m map[string]interface{}) bool {
+	quickSetStr(&cp.RemoteId, m, "remoteid")
+	quickSetStr(&cp.Name, m, "name")
+	quickSetInt64(&cp.Ts, m, "ts")
+	quickSetStr(&cp.ShellType, m, "shelltype")
+	quickSetJson(&cp.FeState, m, "festate")
+	quickSetStr(&cp.StateBaseHash, m, "statebasehash")
+	quickSetJsonArr(&cp.StateDiffHashArr, m, "statediffhasharr")
+	return true
+}
+
+func (cp *StateCheckpointType) ToMap() map[string]interface{} {
+	rtn := make(map[string]interface{})
+	rtn["remoteid"] = cp.RemoteId
+	rtn["name"] = cp.Name
+	rtn["ts"] = cp.Ts
+	rtn["shelltype"] = cp.ShellType
+	rtn["festate"] = quickJson(cp.FeState)
+	rtn["statebasehash"] = cp.StateBaseHash
+	rtn["statediffhasharr"] = quickJsonArr(cp.StateDiffHashArr)
+	return rtn
+}
+
 type ScreenUpdateType struct {
 	UpdateId   int64  `json:"updateid"`
 	ScreenId   string `json:"screenid"`
@@ -682,6 +730,8 @@ type LineType struct {
 	Ephemeral     bool           `json:"ephemeral,omitempty"`
 	ContentHeight int64          `json:"contentheight,omitempty"`
 	Star          bool           `json:"star,omitempty"`
+	Note          string         `json:"note,omitempty"`   // markdown
+	NoteTs        int64          `json:"notets,omitempty"` // last edit
 	Archived      bool           `json:"archived,omitempty"`
 	Remove        bool           `json:"remove,omitempty"`
 }
@@ -723,6 +773,8 @@ type SSHOpts struct {
 	SSHIdentity string `json:"sshidentity,omitempty"`
 	SSHPort     int    `json:"sshport,omitempty"`
 	SSHPassword string `json:"sshpassword,omitempty"`
+	RunAsUser   string `json:"runasuser,omitempty"`   // run waveshell as this user (local, or on the ssh host)
+	RunAsMethod string `json:"runasmethod,omitempty"` // sudo or su
 }
 
 func (opts SSHOpts) GetAuthType() string {
@@ -778,6 +830,8 @@ type RemoteRuntimeState struct {
 	Archived              bool              `json:"archived,omitempty"`
 	RemoteIdx             int64             `json:"remoteidx"`
 	SSHConfigSrc          string            `json:"sshconfigsrc"`
+	ConnectCmd            string            `json:"connectcmd,omitempty"`
+	RunAsUser             string            `json:"runasuser,omitempty"`
 	UName                 string            `json:"uname"`
 	WaveshellVersion      string            `json:"waveshellversion"`
 	WaitingForPassword    bool              `json:"waitingforpassword,omitempty"`
@@ -787,6 +841,10 @@ type RemoteRuntimeState struct {
 	CanComplete           bool              `json:"cancomplete,omitempty"`
 	ShellPref             string            `json:"shellpref,omitempty"`
 	DefaultShellType      string            `json:"defaultshelltype,omitempty"`
+	LatencyMs             int64             `json:"latencyms,omitempty"`
+	LastSeenTs            int64             `json:"lastseents,omitempty"`
+	MissedHeartbeats      int               `json:"missedheartbeats,omitempty"`
+	Degraded              bool              `json:"degraded,omitempty"`
 }
 
 func (state RemoteRuntimeState) IsConnected() bool {
@@ -847,6 +905,9 @@ type RemoteType struct {
 	SSHConfigSrc string            `json:"sshconfigsrc"`
 	ShellPref    string            `json:"shellpref"` // bash, zsh, or detect
 
+	// Command fields (command that gives a stdin/stdout pipe to a shell on the remote)
+	ConnectCmd string `json:"connectcmd,omitempty"`
+
 	// OpenAI fields (unused)
 	OpenAIOpts *OpenAIOptsType `json:"openaiopts,omitempty"`
 }
@@ -859,6 +920,19 @@ func (r *RemoteType) IsSudo() bool {
 	return r.SSHOpts != nil && r.SSHOpts.IsSudo
 }
 
+// runs on this machine (the local remote, local sudo, or a local run-as remote)
+func (r *RemoteType) IsLocalHost() bool {
+	return r.Local || (r.SSHOpts != nil && r.SSHOpts.Local)
+}
+
+func (r *RemoteType) IsRunAs() bool {
+	return r.SSHOpts != nil && r.SSHOpts.RunAsUser != ""
+}
+
+func (r *RemoteType) IsCommand() bool {
+	return r.RemoteType == RemoteTypeCommand
+}
+
 func (r *RemoteType) GetName() string {
 	if r.RemoteAlias != "" {
 		return r.RemoteAlias
@@ -886,6 +960,7 @@ func (r *RemoteType) ToMap() map[string]interface{} {
 	rtn["sshconfigsrc"] = r.SSHConfigSrc
 	rtn["openaiopts"] = quickJson(r.OpenAIOpts)
 	rtn["shellpref"] = r.ShellPref
+	rtn["connectcmd"] = r.ConnectCmd
 	return rtn
 }
 
@@ -908,6 +983,7 @@ func (r *RemoteType) FromMap(m map[string]interface{}) bool {
 	quickSetStr(&r.SSHConfigSrc, m, "sshconfigsrc")
 	quickSetJson(&r.OpenAIOpts, m, "openaiopts")
 	quickSetStr(&r.ShellPref, m, "shellpref")
+	quickSetStr(&r.ConnectCmd, m, "connectcmd")
 	return true
 }
 
@@ -0,0 +1,361 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/dbutil"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbus"
+)
+
+// deleted lines, screens and sessions go to the trash.  a trash item holds a snapshot of the deleted rows
+// (session, screen, remote_instance, line and cmd) and of the history entries that linked to the deleted lines.  the ptyout
+// files are moved to [trash]/[trashid]/[screenid]/.  restoring an item moves the files back and then re-inserts
+// the rows with their original ids (screens and sessions go back to their original position).  items are purged after TrashRetention
+// (see PurgeExpiredTrash) or with /trash:empty.
+//
+// restored screens are not web-shared (sharemode is reset to local).
+
+const (
+	TrashItemType_Line    = "line"
+	TrashItemType_Screen  = "screen"
+	TrashItemType_Session = "session"
+)
+
+const TrashRetention = 30 * 24 * time.Hour
+const maxTrashDescLen = 200
+
+type TrashItemType struct {
+	TrashId     string `json:"trashid"`
+	ItemType    string `json:"itemtype"`
+	SessionId   string `json:"sessionid"`
+	ScreenId    string `json:"screenid"`
+	Description string `json:"description"`
+	NumLines    int    `json:"numlines"`
+	DeletedTs   int64  `json:"deletedts"`
+}
+
+func (TrashItemType) UseDBMap() {}
+
+type trashHistoryLinkType struct {
+	HistoryId string
+	LineId    string
+	LineNum   int64
+}
+
+// rows are stored as returned by SelectMaps (column name => value), so columns added by later
+// migrations are snapshotted (and restored) without changes here.
+type trashDataType struct {
+	Sessions     []map[string]interface{}
+	Screens      []map[string]interface{}
+	RIs          []map[string]interface{} // remote_instance rows
+	Lines        []map[string]interface{}
+	Cmds         []map[string]interface{}
+	HistoryLinks []trashHistoryLinkType
+}
+
+func (data *trashDataType) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeTrashData(barr []byte) (*trashDataType, error) {
+	var rtn trashDataType
+	err := gob.NewDecoder(bytes.NewReader(barr)).Decode(&rtn)
+	if err != nil {
+		return nil, err
+	}
+	return &rtn, nil
+}
+
+func (data *trashDataType) lineIds() []string {
+	var rtn []string
+	for _, line := range data.Lines {
+		if lineId, ok := line["lineid"].(string); ok {
+			rtn = append(rtn, lineId)
+		}
+	}
+	return rtn
+}
+
+func snapshotLinesForTrash(tx *TxWrap, data *trashDataType, screenId string, lineIds []string) {
+	lineIdsJson := quickJsonArr(lineIds)
+	query := `SELECT * FROM line WHERE screenid = ? AND lineid IN (SELECT value FROM json_each(?)) ORDER BY linenum`
+	data.Lines = append(data.Lines, tx.SelectMaps(query, screenId, lineIdsJson)...)
+	query = `SELECT * FROM cmd WHERE screenid = ? AND lineid IN (SELECT value FROM json_each(?))`
+	data.Cmds = append(data.Cmds, tx.SelectMaps(query, screenId, lineIdsJson)...)
+	var links []trashHistoryLinkType
+	query = `SELECT historyid, lineid, linenum FROM history WHERE screenid = ? AND lineid IN (SELECT value FROM json_each(?))`
+	tx.Select(&links, query, screenId, lineIdsJson)
+	data.HistoryLinks = append(data.HistoryLinks, links...)
+}
+
+func snapshotScreenForTrash(tx *TxWrap, data *trashDataType, screenId string) {
+	query := `SELECT * FROM screen WHERE screenid = ?`
+	data.Screens = append(data.Screens, tx.SelectMaps(query, screenId)...)
+	query = `SELECT * FROM remote_instance WHERE screenid = ?`
+	data.RIs = append(data.RIs, tx.SelectMaps(query, screenId)...)
+	query = `SELECT lineid FROM line WHERE screenid = ?`
+	snapshotLinesForTrash(tx, data, screenId, tx.SelectStrings(query, screenId))
+}
+
+func insertTrashItem(tx *TxWrap, itemType string, sessionId string, screenId string, description string, data *trashDataType) (string, error) {
+	barr, err := data.encode()
+	if err != nil {
+		return "", fmt.Errorf("cannot encode trash data: %v", err)
+	}
+	if len(description) > maxTrashDescLen {
+		description = description[:maxTrashDescLen-3] + "..."
+	}
+	item := &TrashItemType{
+		TrashId:     scbase.GenWaveUUID(),
+		ItemType:    itemType,
+		SessionId:   sessionId,
+		ScreenId:    screenId,
+		Description: description,
+		NumLines:    len(data.Lines),
+		DeletedTs:   time.Now().UnixMilli(),
+	}
+	dbMap := dbutil.ToDBMap(item, false)
+	dbMap["data"] = barr
+	query := `INSERT INTO trash ( trashid, itemtype, sessionid, screenid, description, numlines, deletedts, data)
+	                     VALUES (:trashid,:itemtype,:sessionid,:screenid,:description,:numlines,:deletedts,:data)`
+	tx.NamedExec(query, dbMap)
+	return item.TrashId, nil
+}
+
+func makeLinesTrashDesc(tx *TxWrap, screenId string, data *trashDataType) string {
+	var lineNums []string
+	for _, line := range data.Lines {
+		if lineNum, ok := line["linenum"].(int64); ok {
+			lineNums = append(lineNums, strconv.FormatInt(lineNum, 10))
+		}
+	}
+	screenName := tx.GetString(`SELECT name FROM screen WHERE screenid = ?`, screenId)
+	desc := "line " + strings.Join(lineNums, ", ")
+	if len(lineNums) != 1 {
+		desc = "lines " + strings.Join(lineNums, ", ")
+	}
+	return fmt.Sprintf("%s (screen %q)", desc, screenName)
+}
+
+func insertRowsFromTrash(tx *TxWrap, tableName string, rows []map[string]interface{}) {
+	for _, row := range rows {
+		var cols []string
+		for col := range row {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (:%s)`, tableName, strings.Join(cols, ", "), strings.Join(cols, ", :"))
+		tx.NamedExec(query, row)
+	}
+}
+
+// the lines were unlinked from their history entries when they were deleted
+func relinkHistoryFromTrash(tx *TxWrap, links []trashHistoryLinkType) {
+	for _, link := range links {
+		query := `UPDATE history SET lineid = ?, linenum = ? WHERE historyid = ? AND lineid = ''`
+		tx.Exec(query, link.LineId, link.LineNum, link.HistoryId)
+	}
+}
+
+func GetTrashItems(ctx context.Context) ([]*TrashItemType, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) ([]*TrashItemType, error) {
+		query := `SELECT trashid, itemtype, sessionid, screenid, description, numlines, deletedts FROM trash ORDER BY deletedts DESC, rowid DESC`
+		return dbutil.SelectMappable[*TrashItemType](tx, query), nil
+	})
+}
+
+// trashArg can be a full trash id, the first 8 characters of the id, or the item number from
+// /trash:list (1 is the most recently deleted item).  returns "" if not found.
+func FindTrashIdByArg(ctx context.Context, trashArg string) (string, error) {
+	return WithTxRtn(ctx, func(tx *TxWrap) (string, error) {
+		if itemNum, err := strconv.Atoi(trashArg); err == nil && len(trashArg) < 8 {
+			if itemNum <= 0 {
+				return "", nil
+			}
+			query := `SELECT trashid FROM trash ORDER BY deletedts DESC, rowid DESC LIMIT 1 OFFSET ?`
+			return tx.GetString(query, itemNum-1), nil
+		}
+		if len(trashArg) == 8 {
+			query := `SELECT trashid FROM trash WHERE trashid LIKE (? || '%')`
+			return tx.GetString(query, trashArg), nil
+		}
+		query := `SELECT trashid FROM trash WHERE trashid = ?`
+		return tx.GetString(query, trashArg), nil
+	})
+}
+
+// restores the item with its original ids, the item is removed from the trash
+func RestoreTrashItem(ctx context.Context, trashId string) (*scbus.ModelUpdatePacketType, error) {
+	var item *TrashItemType
+	var data *trashDataType
+	// the files are moved first, so the rows are never restored without their output
+	fileMoves, err := restoreTrashFiles(trashId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot restore output files: %v", err)
+	}
+	txErr := WithTx(ctx, func(tx *TxWrap) error {
+		query := `SELECT trashid, itemtype, sessionid, screenid, description, numlines, deletedts FROM trash WHERE trashid = ?`
+		item = dbutil.GetMappable[*TrashItemType](tx, query, trashId)
+		if item == nil {
+			return fmt.Errorf("trash item not found")
+		}
+		var barr []byte
+		tx.Get(&barr, `SELECT data FROM trash WHERE trashid = ?`, trashId)
+		var err error
+		data, err = decodeTrashData(barr)
+		if err != nil {
+			return fmt.Errorf("cannot decode trash item: %v", err)
+		}
+		switch item.ItemType {
+		case TrashItemType_Line:
+			if !tx.Exists(`SELECT screenid FROM screen WHERE screenid = ?`, item.ScreenId) {
+				return fmt.Errorf("screen no longer exists (restore the screen first)")
+			}
+			query = `SELECT lineid FROM line WHERE screenid = ? AND lineid IN (SELECT value FROM json_each(?))`
+			if tx.Exists(query, item.ScreenId, quickJsonArr(data.lineIds())) {
+				return fmt.Errorf("lines already exist")
+			}
+
+		case TrashItemType_Screen:
+			if !tx.Exists(`SELECT sessionid FROM session WHERE sessionid = ?`, item.SessionId) {
+				return fmt.Errorf("session no longer exists (restore the session first)")
+			}
+			if tx.Exists(`SELECT screenid FROM screen WHERE screenid = ?`, item.ScreenId) {
+				return fmt.Errorf("screen already exists")
+			}
+			for _, screen := range data.Screens {
+				query = `UPDATE screen SET screenidx = screenidx + 1 WHERE sessionid = ? AND screenidx >= ?`
+				tx.Exec(query, item.SessionId, screen["screenidx"])
+			}
+			query = `DELETE FROM screen_tombstone WHERE screenid = ?`
+			tx.Exec(query, item.ScreenId)
+
+		case TrashItemType_Session:
+			if tx.Exists(`SELECT sessionid FROM session WHERE sessionid = ?`, item.SessionId) {
+				return fmt.Errorf("session already exists")
+			}
+			for _, session := range data.Sessions {
+				query = `UPDATE session SET sessionidx = sessionidx + 1 WHERE sessionidx >= ?`
+				tx.Exec(query, session["sessionidx"])
+			}
+			query = `DELETE FROM session_tombstone WHERE sessionid = ?`
+			tx.Exec(query, item.SessionId)
+			query = `DELETE FROM screen_tombstone WHERE sessionid = ?`
+			tx.Exec(query, item.SessionId)
+
+		default:
+			return fmt.Errorf("invalid trash item type %q", item.ItemType)
+		}
+		for _, screen := range data.Screens {
+			screen["sharemode"] = ShareModeLocal
+			screen["webshareopts"] = "null"
+		}
+		insertRowsFromTrash(tx, "session", data.Sessions)
+		insertRowsFromTrash(tx, "screen", data.Screens)
+		insertRowsFromTrash(tx, "remote_instance", data.RIs)
+		insertRowsFromTrash(tx, "line", data.Lines)
+		insertRowsFromTrash(tx, "cmd", data.Cmds)
+		relinkHistoryFromTrash(tx, data.HistoryLinks)
+		query = `DELETE FROM trash WHERE trashid = ?`
+		tx.Exec(query, trashId)
+		return nil
+	})
+	if txErr != nil {
+		undoTrashFileMoves(fileMoves)
+		return nil, txErr
+	}
+	deleteTrashItemDir(trashId)
+	update := scbus.MakeUpdatePacket()
+	switch item.ItemType {
+	case TrashItemType_Line:
+		for _, lineId := range data.lineIds() {
+			line, cmd, err := GetLineCmdByLineId(ctx, item.ScreenId, lineId)
+			if err != nil {
+				return nil, err
+			}
+			AddLineUpdate(update, line, cmd)
+		}
+
+	case TrashItemType_Screen:
+		screen, err := GetScreenById(ctx, item.ScreenId)
+		if err != nil {
+			return nil, err
+		}
+		if screen != nil {
+			update.AddUpdate(*screen)
+		}
+
+	case TrashItemType_Session:
+		session, err := GetSessionById(ctx, item.SessionId)
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			update.AddUpdate(*session)
+		}
+		screens, err := GetSessionScreens(ctx, item.SessionId)
+		if err != nil {
+			return nil, err
+		}
+		for _, screen := range screens {
+			update.AddUpdate(*screen)
+		}
+	}
+	return update, nil
+}
+
+// permanently deletes trash items (and their output files) deleted before cutoffTs (0 for all items).
+// returns the removed items.
+func EmptyTrash(ctx context.Context, cutoffTs int64) ([]*TrashItemType, error) {
+	items, err := WithTxRtn(ctx, func(tx *TxWrap) ([]*TrashItemType, error) {
+		query := `SELECT trashid, itemtype, sessionid, screenid, description, numlines, deletedts FROM trash WHERE ? = 0 OR deletedts < ?`
+		items := dbutil.SelectMappable[*TrashItemType](tx, query, cutoffTs, cutoffTs)
+		query = `DELETE FROM trash WHERE ? = 0 OR deletedts < ?`
+		tx.Exec(query, cutoffTs, cutoffTs)
+		return items, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		deleteTrashItemDir(item.TrashId)
+	}
+	return items, nil
+}
+
+func DeleteTrashItem(ctx context.Context, trashId string) error {
+	txErr := WithTx(ctx, func(tx *TxWrap) error {
+		query := `SELECT trashid FROM trash WHERE trashid = ?`
+		if !tx.Exists(query, trashId) {
+			return fmt.Errorf("trash item not found")
+		}
+		query = `DELETE FROM trash WHERE trashid = ?`
+		tx.Exec(query, trashId)
+		return nil
+	})
+	if txErr != nil {
+		return txErr
+	}
+	deleteTrashItemDir(trashId)
+	return nil
+}
+
+func PurgeExpiredTrash(ctx context.Context) ([]*TrashItemType, error) {
+	return EmptyTrash(ctx, time.Now().Add(-TrashRetention).UnixMilli())
+}
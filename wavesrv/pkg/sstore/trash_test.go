@@ -0,0 +1,221 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package sstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/scbase"
+)
+
+// migrated db (with the local remote) in a temp wave home, closed when the test ends
+func setupTestDB(t *testing.T) {
+	t.Setenv(scbase.WaveHomeVarName, t.TempDir())
+	CloseDB()
+	t.Cleanup(CloseDB)
+	err := TryMigrateUp()
+	if err != nil {
+		t.Fatalf("cannot migrate db: %v", err)
+	}
+	ctx := context.Background()
+	_, err = EnsureClientData(ctx)
+	if err != nil {
+		t.Fatalf("cannot create client data: %v", err)
+	}
+	err = EnsureLocalRemote(ctx)
+	if err != nil {
+		t.Fatalf("cannot create local remote: %v", err)
+	}
+}
+
+// adds a done cmd line with a ptyout file to the screen, returns the lineid
+func addTestCmdLine(t *testing.T, screenId string, output string) string {
+	ctx := context.Background()
+	cmd := &CmdType{ScreenId: screenId, LineId: scbase.GenWaveUUID(), CmdStr: "ls", RawCmdStr: "ls", Status: CmdStatusDone}
+	_, err := AddCmdLine(ctx, screenId, "", cmd, "", nil)
+	if err != nil {
+		t.Fatalf("cannot add line: %v", err)
+	}
+	ptyOutFile, err := scbase.PtyOutFile(screenId, cmd.LineId)
+	if err != nil {
+		t.Fatalf("cannot get ptyout file: %v", err)
+	}
+	err = os.WriteFile(ptyOutFile, []byte(output), 0600)
+	if err != nil {
+		t.Fatalf("cannot write ptyout file: %v", err)
+	}
+	return cmd.LineId
+}
+
+func readTestPtyOut(screenId string, lineId string) string {
+	barr, err := os.ReadFile(filepath.Join(scbase.GetScreensDir(), screenId, lineId+".ptyout.cf"))
+	if err != nil {
+		return ""
+	}
+	return string(barr)
+}
+
+func getTestTrashId(t *testing.T, itemType string) string {
+	items, err := GetTrashItems(context.Background())
+	if err != nil {
+		t.Fatalf("cannot get trash items: %v", err)
+	}
+	if len(items) != 1 || items[0].ItemType != itemType {
+		t.Fatalf("expected one %s trash item, got %v", itemType, items)
+	}
+	return items[0].TrashId
+}
+
+func TestTrashRestoreScreen(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, sessionId, _, err := InsertSessionWithName(ctx, "test", true)
+	if err != nil {
+		t.Fatalf("cannot create session: %v", err)
+	}
+	sco := ScreenCreateOpts{RtnScreenId: new(string)}
+	_, err = InsertScreen(ctx, sessionId, "trashme", sco, false)
+	if err != nil {
+		t.Fatalf("cannot create screen: %v", err)
+	}
+	screenId := *sco.RtnScreenId
+	lineId1 := addTestCmdLine(t, screenId, "output 1")
+	lineId2 := addTestCmdLine(t, screenId, "output 2")
+	_, err = DeleteScreen(ctx, screenId, false, nil)
+	if err != nil {
+		t.Fatalf("cannot delete screen: %v", err)
+	}
+	if screen, _ := GetScreenById(ctx, screenId); screen != nil {
+		t.Fatalf("screen should be deleted")
+	}
+	if readTestPtyOut(screenId, lineId1) != "" {
+		t.Errorf("ptyout file should be in the trash")
+	}
+	trashId := getTestTrashId(t, TrashItemType_Screen)
+	if size := TrashItemSize(trashId); size != int64(len("output 1")+len("output 2")) {
+		t.Errorf("unexpected trash item size %d", size)
+	}
+	_, err = RestoreTrashItem(ctx, trashId)
+	if err != nil {
+		t.Fatalf("cannot restore screen: %v", err)
+	}
+	screen, err := GetScreenById(ctx, screenId)
+	if err != nil || screen == nil || screen.Name != "trashme" {
+		t.Fatalf("screen not restored: %v %v", screen, err)
+	}
+	for lineId, output := range map[string]string{lineId1: "output 1", lineId2: "output 2"} {
+		line, cmd, err := GetLineCmdByLineId(ctx, screenId, lineId)
+		if err != nil || line == nil || cmd == nil {
+			t.Errorf("line %s not restored: %v", lineId, err)
+		}
+		if rtn := readTestPtyOut(screenId, lineId); rtn != output {
+			t.Errorf("line %s output not restored, got %q", lineId, rtn)
+		}
+	}
+	if _, err := os.Stat(getTrashItemDir(trashId)); err == nil {
+		t.Errorf("trash dir should be removed")
+	}
+	if items, _ := GetTrashItems(ctx); len(items) != 0 {
+		t.Errorf("trash should be empty, got %v", items)
+	}
+}
+
+func TestTrashRestoreCollision(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, _, screenId, err := InsertSessionWithName(ctx, "test", true)
+	if err != nil {
+		t.Fatalf("cannot create session: %v", err)
+	}
+	lineId := addTestCmdLine(t, screenId, "trashed output")
+	line, cmd, err := GetLineCmdByLineId(ctx, screenId, lineId)
+	if err != nil || line == nil || cmd == nil {
+		t.Fatalf("cannot get line: %v", err)
+	}
+	err = DeleteLinesByIds(ctx, screenId, []string{lineId})
+	if err != nil {
+		t.Fatalf("cannot delete line: %v", err)
+	}
+	trashId := getTestTrashId(t, TrashItemType_Line)
+	// a line with the same id (and output) exists again, the restore must fail and leave the trash as it was
+	line.LineNum = 0
+	err = InsertLine(ctx, line, cmd)
+	if err != nil {
+		t.Fatalf("cannot re-insert line: %v", err)
+	}
+	ptyOutFile, _ := scbase.PtyOutFile(screenId, lineId)
+	os.WriteFile(ptyOutFile, []byte("new output"), 0600)
+	_, err = RestoreTrashItem(ctx, trashId)
+	if err == nil {
+		t.Fatalf("expected the restore to fail")
+	}
+	if rtn := readTestPtyOut(screenId, lineId); rtn != "new output" {
+		t.Errorf("existing output should not be overwritten, got %q", rtn)
+	}
+	if size := TrashItemSize(trashId); size != int64(len("trashed output")) {
+		t.Errorf("trashed output should still be in the trash (size %d)", size)
+	}
+	getTestTrashId(t, TrashItemType_Line)
+
+	// the restore works once the line is gone, the output is moved back
+	_, err = PurgeLinesByIds(ctx, screenId, []string{lineId})
+	if err != nil {
+		t.Fatalf("cannot purge line: %v", err)
+	}
+	_, err = RestoreTrashItem(ctx, trashId)
+	if err != nil {
+		t.Fatalf("cannot restore line: %v", err)
+	}
+	if rtn := readTestPtyOut(screenId, lineId); rtn != "trashed output" {
+		t.Errorf("output not restored, got %q", rtn)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	_, _, screenId, err := InsertSessionWithName(ctx, "test", true)
+	if err != nil {
+		t.Fatalf("cannot create session: %v", err)
+	}
+	oldLineId := addTestCmdLine(t, screenId, "old")
+	newLineId := addTestCmdLine(t, screenId, "new")
+	err = DeleteLinesByIds(ctx, screenId, []string{oldLineId})
+	if err != nil {
+		t.Fatalf("cannot delete line: %v", err)
+	}
+	oldTrashId := getTestTrashId(t, TrashItemType_Line)
+	err = WithTx(ctx, func(tx *TxWrap) error {
+		tx.Exec(`UPDATE trash SET deletedts = ? WHERE trashid = ?`, time.Now().Add(-TrashRetention-time.Hour).UnixMilli(), oldTrashId)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot update trash item: %v", err)
+	}
+	err = DeleteLinesByIds(ctx, screenId, []string{newLineId})
+	if err != nil {
+		t.Fatalf("cannot delete line: %v", err)
+	}
+	removed, err := PurgeExpiredTrash(ctx)
+	if err != nil {
+		t.Fatalf("cannot purge trash: %v", err)
+	}
+	if len(removed) != 1 || removed[0].TrashId != oldTrashId {
+		t.Errorf("expected only the expired item to be purged, got %v", removed)
+	}
+	if _, err := os.Stat(getTrashItemDir(oldTrashId)); err == nil {
+		t.Errorf("expired trash dir should be removed")
+	}
+	items, err := GetTrashItems(ctx)
+	if err != nil || len(items) != 1 || items[0].TrashId == oldTrashId {
+		t.Errorf("expected the new item to stay in the trash, got %v %v", items, err)
+	}
+	if size := TrashItemSize(items[0].TrashId); size != int64(len("new")) {
+		t.Errorf("unexpected size for the remaining item %d", size)
+	}
+}
@@ -106,6 +106,7 @@ type ConnectUpdate struct {
 	ScreenNumRunningCommands []*ScreenNumRunningCommandsType `json:"screennumrunningcommands,omitempty"`
 	ActiveSessionId          string                          `json:"activesessionid,omitempty"`
 	TermThemes               *configstore.ConfigReturn       `json:"termthemes,omitempty"`
+	Settings                 *configstore.SettingsUpdateType `json:"settings,omitempty"`
 }
 
 func (ConnectUpdate) GetType() string {
@@ -0,0 +1,190 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/shparse"
+	"github.com/wavetermdev/waveterm/wavesrv/pkg/sstore"
+)
+
+// local usage report (/telemetry:report), computed from the activity and history tables.
+// nothing here is uploaded.
+
+const DefaultReportDays = 30
+const MaxReportDays = 365
+const MaxReportCmds = 20
+
+type UsageCountType struct {
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+	NumErrors int    `json:"numerrors,omitempty"`
+}
+
+type UsageReportType struct {
+	Days          int               `json:"days"`
+	StartDay      string            `json:"startday"`
+	EndDay        string            `json:"endday"`
+	DaysActive    int               `json:"daysactive"`
+	NumCommands   int               `json:"numcommands"`
+	ActiveMinutes int               `json:"activeminutes"`
+	FgMinutes     int               `json:"fgminutes"`
+	OpenMinutes   int               `json:"openminutes"`
+	NumStartup    int               `json:"numstartup"`
+	NewTab        int               `json:"newtab"`
+	Renderers     map[string]int    `json:"renderers,omitempty"`
+	Remotes       []*UsageCountType `json:"remotes,omitempty"`
+	Commands      []*UsageCountType `json:"commands,omitempty"`
+}
+
+type reportHistoryRow struct {
+	RemoteName string
+	CmdStr     string
+	HadError   bool
+}
+
+func (report *UsageReportType) addActivity(activity *ActivityType) {
+	tdata := activity.TData
+	if tdata.NumCommands > 0 || tdata.ActiveMinutes > 0 {
+		report.DaysActive++
+	}
+	report.NumCommands += tdata.NumCommands
+	report.ActiveMinutes += tdata.ActiveMinutes
+	report.FgMinutes += tdata.FgMinutes
+	report.OpenMinutes += tdata.OpenMinutes
+	report.NumStartup += tdata.NumStartup
+	report.NewTab += tdata.NewTab
+	for renderer, count := range tdata.Renderers {
+		if report.Renderers == nil {
+			report.Renderers = make(map[string]int)
+		}
+		report.Renderers[renderer] += count
+	}
+}
+
+func addUsageCount(countMap map[string]*UsageCountType, name string, hadError bool) {
+	uc := countMap[name]
+	if uc == nil {
+		uc = &UsageCountType{Name: name}
+		countMap[name] = uc
+	}
+	uc.Count++
+	if hadError {
+		uc.NumErrors++
+	}
+}
+
+func sortedUsageCounts(countMap map[string]*UsageCountType, maxItems int) []*UsageCountType {
+	rtn := make([]*UsageCountType, 0, len(countMap))
+	for _, uc := range countMap {
+		rtn = append(rtn, uc)
+	}
+	sort.Slice(rtn, func(i int, j int) bool {
+		if rtn[i].Count != rtn[j].Count {
+			return rtn[i].Count > rtn[j].Count
+		}
+		return rtn[i].Name < rtn[j].Name
+	})
+	if maxItems > 0 && len(rtn) > maxItems {
+		rtn = rtn[0:maxItems]
+	}
+	return rtn
+}
+
+func (report *UsageReportType) addHistory(rows []reportHistoryRow) {
+	remoteCounts := make(map[string]*UsageCountType)
+	cmdCounts := make(map[string]*UsageCountType)
+	for _, row := range rows {
+		addUsageCount(remoteCounts, row.RemoteName, row.HadError)
+		cmdName := shparse.CmdName(row.CmdStr)
+		if cmdName != "" {
+			addUsageCount(cmdCounts, cmdName, row.HadError)
+		}
+	}
+	report.Remotes = sortedUsageCounts(remoteCounts, 0)
+	report.Commands = sortedUsageCounts(cmdCounts, MaxReportCmds)
+}
+
+func GetUsageReport(ctx context.Context, days int) (*UsageReportType, error) {
+	if days <= 0 {
+		days = DefaultReportDays
+	}
+	if days > MaxReportDays {
+		days = MaxReportDays
+	}
+	report := &UsageReportType{
+		Days:     days,
+		StartDay: GetRelDayStr(-(days - 1)),
+		EndDay:   GetCurDayStr(),
+	}
+	now := time.Now()
+	startTs := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(days - 1)).UnixMilli()
+	var activityArr []*ActivityType
+	var historyRows []reportHistoryRow
+	txErr := sstore.WithTx(ctx, func(tx *sstore.TxWrap) error {
+		query := `SELECT * FROM activity WHERE day >= ? ORDER BY day`
+		tx.Select(&activityArr, query, report.StartDay)
+		query = `SELECT COALESCE(NULLIF(r.remotealias, ''), r.remotecanonicalname, h.remotename) remotename, h.cmdstr, h.haderror
+                 FROM history h LEFT OUTER JOIN remote r ON h.remoteid = r.remoteid
+                 WHERE h.ts >= ? AND NOT h.ismetacmd`
+		tx.Select(&historyRows, query, startTs)
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	for _, activity := range activityArr {
+		report.addActivity(activity)
+	}
+	report.addHistory(historyRows)
+	return report, nil
+}
+
+func formatMinutes(minutes int) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
+
+func writeUsageCounts(buf *bytes.Buffer, title string, counts []*UsageCountType) {
+	if len(counts) == 0 {
+		return
+	}
+	buf.WriteString(fmt.Sprintf("%s:\n", title))
+	for _, uc := range counts {
+		if uc.NumErrors > 0 {
+			buf.WriteString(fmt.Sprintf("  %-25s %6d  (%d errors)\n", uc.Name, uc.Count, uc.NumErrors))
+		} else {
+			buf.WriteString(fmt.Sprintf("  %-25s %6d\n", uc.Name, uc.Count))
+		}
+	}
+}
+
+func (report *UsageReportType) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("  %-15s %s to %s (%d days)\n", "period", report.StartDay, report.EndDay, report.Days))
+	buf.WriteString(fmt.Sprintf("  %-15s %d\n", "days-active", report.DaysActive))
+	buf.WriteString(fmt.Sprintf("  %-15s %d\n", "commands", report.NumCommands))
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "active", formatMinutes(report.ActiveMinutes)))
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "foreground", formatMinutes(report.FgMinutes)))
+	buf.WriteString(fmt.Sprintf("  %-15s %s\n", "open", formatMinutes(report.OpenMinutes)))
+	buf.WriteString(fmt.Sprintf("  %-15s %d\n", "startups", report.NumStartup))
+	buf.WriteString(fmt.Sprintf("  %-15s %d\n", "new-tabs", report.NewTab))
+	if len(report.Renderers) > 0 {
+		renderers := make(map[string]*UsageCountType)
+		for name, count := range report.Renderers {
+			renderers[name] = &UsageCountType{Name: name, Count: count}
+		}
+		writeUsageCounts(&buf, "renderers", sortedUsageCounts(renderers, 0))
+	}
+	writeUsageCounts(&buf, "connections", report.Remotes)
+	writeUsageCounts(&buf, "top commands", report.Commands)
+	return buf.String()
+}
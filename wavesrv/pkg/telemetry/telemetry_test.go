@@ -39,3 +39,18 @@ func TestDaystrCustom(t *testing.T) {
 	testCustomDaystr(t, "2024-01-01+1w", "2024-01-08", false)
 	testCustomDaystr(t, "2024-01-01+1m+1w-1d", "2024-02-07", false)
 }
+
+func TestReportAddHistory(t *testing.T) {
+	report := &UsageReportType{}
+	report.addHistory([]reportHistoryRow{
+		{RemoteName: "local", CmdStr: "ls"},
+		{RemoteName: "local", CmdStr: "ls -l"},
+		{RemoteName: "prod", CmdStr: "git push", HadError: true},
+	})
+	if len(report.Remotes) != 2 || report.Remotes[0].Name != "local" || report.Remotes[0].Count != 2 {
+		t.Errorf("unexpected remote counts: %v", report.Remotes)
+	}
+	if len(report.Commands) != 2 || report.Commands[0].Name != "ls" || report.Commands[1].NumErrors != 1 {
+		t.Errorf("unexpected command counts: %v", report.Commands)
+	}
+}